@@ -2,21 +2,284 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 
+	"github.com/matanbaruch/netbird-api-exporter/pkg/dashboard"
+	"github.com/matanbaruch/netbird-api-exporter/pkg/events"
 	"github.com/matanbaruch/netbird-api-exporter/pkg/exporters"
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
+	"github.com/matanbaruch/netbird-api-exporter/pkg/oneshot"
+	"github.com/matanbaruch/netbird-api-exporter/pkg/push"
+	"github.com/matanbaruch/netbird-api-exporter/pkg/recording"
+	"github.com/matanbaruch/netbird-api-exporter/pkg/rules"
+	"github.com/matanbaruch/netbird-api-exporter/pkg/snapshot"
 	"github.com/matanbaruch/netbird-api-exporter/pkg/utils"
 )
 
+// startOTLPPusher pushes the exporter metrics to an OTLP receiver, with the
+// account and exporter instance as resource attributes. The exporter is also
+// registered for /metrics, it serializes the pushes and the scrapes.
+func startOTLPPusher(ctx context.Context, exporter *exporters.NetBirdExporter, config push.OTLPConfig, instanceID string) (*push.OTLPPusher, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(exporter); err != nil {
+		return nil, err
+	}
+
+	config.Attributes = map[string]string{
+		"service.name":        "netbird-api-exporter",
+		"service.instance.id": instanceID,
+	}
+	accountCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	account, err := exporter.Account(accountCtx)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to fetch NetBird account, pushing without account attributes")
+	} else {
+		config.Attributes["netbird.account.id"] = account.Id
+		config.Attributes["netbird.account.domain"] = account.Domain
+	}
+
+	return push.NewOTLPPusher(ctx, registry, config)
+}
+
+// startRemoteWritePusher pushes the exporter metrics to a remote-write endpoint.
+// The push pipeline metrics are pushed along and served on the metrics endpoint.
+// The exporter is also registered for /metrics, it serializes the pushes and
+// the scrapes.
+func startRemoteWritePusher(exporter *exporters.NetBirdExporter, config push.RemoteWriteConfig) (*push.RemoteWritePusher, error) {
+	registry := prometheus.NewRegistry()
+	pusher, err := push.NewRemoteWritePusher(registry, config)
+	if err != nil {
+		return nil, err
+	}
+	registry.MustRegister(exporter, pusher)
+	prometheus.MustRegister(pusher)
+	return pusher, nil
+}
+
+// runOnce collects the metrics once, e.g. from a cron job, and returns the exit
+// code: 0 on success, 1 when a collector failed and 2 when the metrics could not
+// be written or pushed
+func runOnce(exporter *exporters.NetBirdExporter, args []string) int {
+	flags := flag.NewFlagSet("once", flag.ContinueOnError)
+	output := flags.String("output", "", "file to write the metrics to in text exposition format, - for stdout (default: - without -pushgateway)")
+	pushgatewayURL := flags.String("pushgateway", os.Getenv("PUSHGATEWAY_URL"), "Pushgateway URL to push the metrics to")
+	job := flags.String("job", utils.GetEnvWithDefault("PUSHGATEWAY_JOB", oneshot.DefaultJob), "Pushgateway job name")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output == "" && *pushgatewayURL == "" {
+		*output = oneshot.Stdout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	failures, err := oneshot.Run(ctx, exporter, oneshot.Config{
+		Output:         *output,
+		PushgatewayURL: *pushgatewayURL,
+		Job:            *job,
+		Username:       os.Getenv("PUSHGATEWAY_USERNAME"),
+		Password:       os.Getenv("PUSHGATEWAY_PASSWORD"),
+	}, os.Stdout)
+	if err != nil {
+		logrus.WithError(err).Error("One-shot collection failed")
+		return 2
+	}
+	if failures > 0 {
+		logrus.WithField("failures", failures).Error("One-shot collection finished with collector failures")
+		return 1
+	}
+	return 0
+}
+
+// startEventEngine fires webhooks on significant changes of the account. The
+// engine metrics are served on the metrics endpoint.
+func startEventEngine(client *nbclient.Client, config events.Config, webhookURLs []string, templateFile string, slackURLs []string) (*events.Engine, error) {
+	template := ""
+	if templateFile != "" {
+		data, err := os.ReadFile(templateFile)
+		if err != nil {
+			return nil, fmt.Errorf("read webhook template: %w", err)
+		}
+		template = string(data)
+	}
+	for _, url := range webhookURLs {
+		config.Webhooks = append(config.Webhooks, events.Webhook{URL: url, Format: events.FormatJSON, Template: template})
+	}
+	for _, url := range slackURLs {
+		config.Webhooks = append(config.Webhooks, events.Webhook{URL: url, Format: events.FormatSlack})
+	}
+
+	engine, err := events.NewEngine(client, config)
+	if err != nil {
+		return nil, err
+	}
+	prometheus.MustRegister(engine)
+	return engine, nil
+}
+
+// newClient creates a NetBird client, whose requests go through a transport
+// recording or replaying the API responses when not nil
+func newClient(url, token string, transport http.RoundTripper) *nbclient.Client {
+	if transport == nil {
+		return nbclient.New(url, token)
+	}
+	return nbclient.NewWithOptions(
+		nbclient.WithManagementURL(url),
+		nbclient.WithPAT(token),
+		nbclient.WithHttpClient(&http.Client{Transport: transport}),
+	)
+}
+
+// startDemoAPI serves the demo account from a fake NetBird API on a random
+// local port. Peers connect and disconnect every churn interval.
+func startDemoAPI(churnInterval time.Duration) (*fakeapi.Server, string, error) {
+	server := fakeapi.NewServer(fakeapi.Demo(time.Now()), fakeapi.Config{Token: fakeapi.DemoToken})
+	url, err := server.Start("127.0.0.1:0")
+	if err != nil {
+		return nil, "", err
+	}
+	if churnInterval > 0 {
+		go func() {
+			rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+			ticker := time.NewTicker(churnInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				server.Churn(rng)
+			}
+		}()
+	}
+	return server, url, nil
+}
+
+// runSnapshot writes a point-in-time snapshot of the NetBird objects to a
+// directory, one file per kind plus a manifest with the hash of every file, and
+// returns the exit code
+func runSnapshot(client *nbclient.Client, args []string) int {
+	flags := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	output := flags.String("output", "", "directory to write the snapshot to (default: snapshot-<timestamp>)")
+	format := flags.String("format", snapshot.FormatCSV, "snapshot format, csv or ndjson")
+	kinds := flags.String("kinds", strings.Join(snapshot.Kinds, ","), "comma-separated object kinds to include")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	kindList := strings.Split(*kinds, ",")
+	for i := range kindList {
+		kindList[i] = strings.TrimSpace(kindList[i])
+	}
+	if err := snapshot.ValidateKinds(kindList); err != nil {
+		logrus.WithError(err).Error("Invalid snapshot kinds")
+		return 2
+	}
+	if err := snapshot.ValidateFormat(*format); err != nil {
+		logrus.WithError(err).Error("Invalid snapshot format")
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	snap, err := snapshot.Take(ctx, client, kindList)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to take snapshot")
+		return 1
+	}
+	if *output == "" {
+		*output = "snapshot-" + snap.TakenAt.Format("20060102T150405Z")
+	}
+	manifest, err := snap.WriteDir(*output, kindList, *format)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to write snapshot")
+		return 1
+	}
+
+	for _, file := range manifest.Files {
+		logrus.WithFields(logrus.Fields{
+			"file":    filepath.Join(*output, file.Name),
+			"records": file.Records,
+			"sha256":  file.SHA256,
+		}).Info("Wrote snapshot file")
+	}
+	return 0
+}
+
+// runRules writes the Prometheus rules matching the enabled collectors and
+// returns the exit code
+func runRules(config rules.Config, args []string) int {
+	flags := flag.NewFlagSet("rules", flag.ContinueOnError)
+	format := flags.String("format", rules.FormatRules, "output format, one of "+strings.Join(rules.Formats, ", "))
+	output := flags.String("output", "-", "file to write the rules to, - for stdout")
+	flags.StringVar(&config.Job, "job", config.Job, "scrape job of the exporter, defaults to netbird-api-exporter when empty")
+	flags.StringVar(&config.Namespace, "namespace", config.Namespace, "namespace of the PrometheusRule resource")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	data, err := rules.Generate(config, *format)
+	if err != nil {
+		logrus.WithError(err).Error("Invalid rules format")
+		return 2
+	}
+	if *output == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(*output, data, 0o644)
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to write rules")
+		return 1
+	}
+	return 0
+}
+
+// runDashboard writes the Grafana dashboard generated from the metrics of every
+// collector and returns the exit code
+func runDashboard(args []string) int {
+	flags := flag.NewFlagSet("dashboard", flag.ContinueOnError)
+	output := flags.String("output", "-", "file to write the dashboard to, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	exporter := exporters.NewNetBirdExporterWithConfig("", "", exporters.AllCollectorsConfig())
+	metrics, err := exporters.Metrics(exporter)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to describe the metrics")
+		return 1
+	}
+	data, err := dashboard.Generate(metrics)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to generate dashboard")
+		return 1
+	}
+	if *output == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(*output, data, 0o644)
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to write dashboard")
+		return 1
+	}
+	return 0
+}
+
 // debugLoggingMiddleware logs HTTP requests when debug level is enabled
 func debugLoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -62,6 +325,60 @@ func main() {
 	listenAddr := utils.GetEnvWithDefault("LISTEN_ADDRESS", ":8080")
 	metricsPath := utils.GetEnvWithDefault("METRICS_PATH", "/metrics")
 	logLevel := utils.GetEnvWithDefault("LOG_LEVEL", "info")
+	peersMinVersion := os.Getenv("PEERS_MIN_SUPPORTED_VERSION")
+	peersHideConnectionIP := utils.GetEnvBoolWithDefault("PEERS_HIDE_CONNECTION_IP", false)
+	stalePeersDays := utils.GetEnvIntWithDefault("STALE_PEERS_DAYS", 0)
+	stalePeersExcludedGroups := utils.GetEnvListWithDefault("STALE_PEERS_EXCLUDED_GROUPS", nil)
+	peersTrackFlaps := utils.GetEnvBoolWithDefault("PEERS_TRACK_FLAPS", false)
+	peersExportSerialNumber := utils.GetEnvBoolWithDefault("PEERS_EXPORT_SERIAL_NUMBER", false)
+	groupsTrackReferences := utils.GetEnvBoolWithDefault("GROUPS_TRACK_REFERENCES", false)
+	groupsSensitive := utils.GetEnvListWithDefault("GROUPS_SENSITIVE", nil)
+	usersDormantDays := utils.GetEnvIntWithDefault("USERS_DORMANT_DAYS", 0)
+	usersTrackInviteAge := utils.GetEnvBoolWithDefault("USERS_TRACK_INVITE_AGE", false)
+	usersHidePermissions := utils.GetEnvBoolWithDefault("USERS_HIDE_USER_PERMISSIONS", false)
+	usersPermissionsByRole := utils.GetEnvBoolWithDefault("USERS_PERMISSIONS_BY_ROLE", false)
+	usersMaxPeers := utils.GetEnvIntWithDefault("USERS_MAX_PEERS", 0)
+	usersTrackTokenExpiry := utils.GetEnvBoolWithDefault("USERS_TRACK_TOKEN_EXPIRY", false)
+	setupKeysEnabled := utils.GetEnvBoolWithDefault("SETUP_KEYS_ENABLED", false)
+	networksCollectDetails := utils.GetEnvBoolWithDefault("NETWORKS_COLLECT_DETAILS", false)
+	dnsProbeEnabled := utils.GetEnvBoolWithDefault("DNS_PROBE_ENABLED", false)
+	dnsProbeQueryName := utils.GetEnvWithDefault("DNS_PROBE_QUERY_NAME", "netbird.io")
+	dnsProbeTimeout := utils.GetEnvDurationWithDefault("DNS_PROBE_TIMEOUT", 2*time.Second)
+	inventoryEnabled := utils.GetEnvBoolWithDefault("INVENTORY_ENABLED", false)
+	inventoryRedactFields := utils.GetEnvListWithDefault("INVENTORY_REDACT_FIELDS", nil)
+	inventoryToken := os.Getenv("INVENTORY_TOKEN")
+	snapshotEnabled := utils.GetEnvBoolWithDefault("SNAPSHOT_ENABLED", false)
+	snapshotCacheTTL := utils.GetEnvDurationWithDefault("SNAPSHOT_CACHE_TTL", 60*time.Second)
+	snapshotToken := os.Getenv("SNAPSHOT_TOKEN")
+	otlpEndpoint := os.Getenv("OTLP_ENDPOINT")
+	otlpProtocol := utils.GetEnvWithDefault("OTLP_PROTOCOL", push.OTLPProtocolGRPC)
+	otlpInsecure := utils.GetEnvBoolWithDefault("OTLP_INSECURE", false)
+	otlpHeaders := utils.GetEnvMapWithDefault("OTLP_HEADERS", nil)
+	otlpInterval := utils.GetEnvDurationWithDefault("OTLP_INTERVAL", 60*time.Second)
+	remoteWriteURL := os.Getenv("REMOTE_WRITE_URL")
+	remoteWriteUsername := os.Getenv("REMOTE_WRITE_USERNAME")
+	remoteWritePassword := os.Getenv("REMOTE_WRITE_PASSWORD")
+	remoteWriteBearerToken := os.Getenv("REMOTE_WRITE_BEARER_TOKEN")
+	remoteWriteExternalLabels := utils.GetEnvMapWithDefault("REMOTE_WRITE_EXTERNAL_LABELS", nil)
+	remoteWriteInterval := utils.GetEnvDurationWithDefault("REMOTE_WRITE_INTERVAL", 60*time.Second)
+	remoteWriteQueueSize := utils.GetEnvIntWithDefault("REMOTE_WRITE_QUEUE_SIZE", 30)
+	eventsWebhookURLs := utils.GetEnvListWithDefault("EVENTS_WEBHOOK_URLS", nil)
+	eventsSlackWebhookURLs := utils.GetEnvListWithDefault("EVENTS_SLACK_WEBHOOK_URLS", nil)
+	eventsWebhookTemplate := os.Getenv("EVENTS_WEBHOOK_TEMPLATE")
+	eventsInterval := utils.GetEnvDurationWithDefault("EVENTS_INTERVAL", 5*time.Minute)
+	eventsTriggers := utils.GetEnvListWithDefault("EVENTS_TRIGGERS", nil)
+	eventsSetupKeyExpiryWarning := utils.GetEnvDurationWithDefault("EVENTS_SETUP_KEY_EXPIRY_WARNING", 7*24*time.Hour)
+	eventsDedupWindow := utils.GetEnvDurationWithDefault("EVENTS_DEDUP_WINDOW", 24*time.Hour)
+	rulesJob := utils.GetEnvWithDefault("RULES_JOB", "netbird-api-exporter")
+	rulesScrapeErrorsThreshold := utils.GetEnvFloatWithDefault("RULES_SCRAPE_ERRORS_THRESHOLD", 3)
+	rulesDisconnectedRatio := utils.GetEnvFloatWithDefault("RULES_DISCONNECTED_RATIO", 0.5)
+	rulesSetupKeyExpiryWarning := utils.GetEnvDurationWithDefault("RULES_SETUP_KEY_EXPIRY_WARNING", 7*24*time.Hour)
+	rulesTokenExpiryWarning := utils.GetEnvDurationWithDefault("RULES_TOKEN_EXPIRY_WARNING", 14*24*time.Hour)
+	demoChurnInterval := utils.GetEnvDurationWithDefault("DEMO_CHURN_INTERVAL", 30*time.Second)
+	apiRecordDir := os.Getenv("API_RECORD_DIR")
+	apiReplayDir := os.Getenv("API_REPLAY_DIR")
+	hostname, _ := os.Hostname()
+	otlpInstanceID := utils.GetEnvWithDefault("OTLP_INSTANCE_ID", hostname)
 
 	// Check for help flag before validating token
 	helpFlag := false
@@ -72,6 +389,18 @@ func main() {
 		}
 	}
 
+	// Demo mode can be combined with the commands, so remove it from the arguments
+	demoFlag := false
+	args := os.Args[:1]
+	for _, arg := range os.Args[1:] {
+		if arg == "--demo" {
+			demoFlag = true
+			continue
+		}
+		args = append(args, arg)
+	}
+	os.Args = args
+
 	// Set log level
 	level, err := logrus.ParseLevel(logLevel)
 	if err != nil {
@@ -94,10 +423,133 @@ func main() {
 		fmt.Fprintf(os.Stderr, "    LISTEN_ADDRESS: HTTP server listen address (default: :8080)\\n")
 		fmt.Fprintf(os.Stderr, "    METRICS_PATH: Metrics endpoint path (default: /metrics)\\n")
 		fmt.Fprintf(os.Stderr, "    LOG_LEVEL: Logging level (default: info)\\n")
+		fmt.Fprintf(os.Stderr, "    PEERS_MIN_SUPPORTED_VERSION: Oldest NetBird agent version considered up to date (optional)\\n")
+		fmt.Fprintf(os.Stderr, "    PEERS_HIDE_CONNECTION_IP: Drop the public connection IP from netbird_peer_info (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    STALE_PEERS_DAYS: Days without being seen before a peer is reported as stale (default: 0, disabled)\\n")
+		fmt.Fprintf(os.Stderr, "    STALE_PEERS_EXCLUDED_GROUPS: Comma-separated group names or IDs never reported as stale\\n")
+		fmt.Fprintf(os.Stderr, "    PEERS_TRACK_FLAPS: Export a per-peer connection state change counter (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    PEERS_EXPORT_SERIAL_NUMBER: Add the device serial number to netbird_peer_info (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    GROUPS_TRACK_REFERENCES: Cross-reference groups to find orphaned ones (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    GROUPS_SENSITIVE: Comma-separated group names or IDs whose membership changes are logged\\n")
+		fmt.Fprintf(os.Stderr, "    USERS_DORMANT_DAYS: Days without a login before an active user is reported as dormant (default: 0, disabled)\\n")
+		fmt.Fprintf(os.Stderr, "    USERS_TRACK_INVITE_AGE: Fetch audit events to export the age of pending invitations (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    USERS_HIDE_USER_PERMISSIONS: Drop the per-user netbird_user_permissions series (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    USERS_PERMISSIONS_BY_ROLE: Export permission counts broken down by role (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    USERS_MAX_PEERS: Peers a user may own before being flagged (default: 0, disabled)\\n")
+		fmt.Fprintf(os.Stderr, "    USERS_TRACK_TOKEN_EXPIRY: Export the expiry of the API tokens of the exporter user (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    SETUP_KEYS_ENABLED: Collect setup key metrics (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    NETWORKS_COLLECT_DETAILS: Collect network routers and resources (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    DNS_PROBE_ENABLED: Send test queries to configured nameservers (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    DNS_PROBE_QUERY_NAME: Name queried for nameserver groups without match domains (default: netbird.io)\\n")
+		fmt.Fprintf(os.Stderr, "    DNS_PROBE_TIMEOUT: Timeout of each test query (default: 2s)\\n")
+		fmt.Fprintf(os.Stderr, "    INVENTORY_ENABLED: Serve the fetched objects as JSON at /api/v1/inventory (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    INVENTORY_REDACT_FIELDS: Comma-separated kind.field values redacted from the inventory (e.g. users.email)\\n")
+		fmt.Fprintf(os.Stderr, "    INVENTORY_TOKEN: Bearer token required by /api/v1/inventory (optional)\\n")
+		fmt.Fprintf(os.Stderr, "    SNAPSHOT_ENABLED: Serve CSV and NDJSON snapshots at /api/v1/snapshot (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    SNAPSHOT_CACHE_TTL: How long a snapshot is served before fetching it again (default: 60s)\\n")
+		fmt.Fprintf(os.Stderr, "    SNAPSHOT_TOKEN: Bearer token required by /api/v1/snapshot (optional)\\n")
+		fmt.Fprintf(os.Stderr, "    OTLP_ENDPOINT: OTLP receiver to push metrics to, host:port or URL (optional, enables OTLP push)\\n")
+		fmt.Fprintf(os.Stderr, "    OTLP_PROTOCOL: OTLP protocol, grpc or http (default: grpc)\\n")
+		fmt.Fprintf(os.Stderr, "    OTLP_INSECURE: Disable TLS for a host:port OTLP endpoint (default: false)\\n")
+		fmt.Fprintf(os.Stderr, "    OTLP_HEADERS: Comma-separated key=value headers sent with every push\\n")
+		fmt.Fprintf(os.Stderr, "    OTLP_INTERVAL: Interval between two OTLP pushes (default: 60s)\\n")
+		fmt.Fprintf(os.Stderr, "    OTLP_INSTANCE_ID: service.instance.id resource attribute (default: hostname)\\n")
+		fmt.Fprintf(os.Stderr, "    REMOTE_WRITE_URL: Prometheus remote-write endpoint to push metrics to (optional, enables remote-write push)\\n")
+		fmt.Fprintf(os.Stderr, "    REMOTE_WRITE_USERNAME: Basic auth username for remote-write\\n")
+		fmt.Fprintf(os.Stderr, "    REMOTE_WRITE_PASSWORD: Basic auth password for remote-write\\n")
+		fmt.Fprintf(os.Stderr, "    REMOTE_WRITE_BEARER_TOKEN: Bearer token for remote-write, takes precedence over basic auth\\n")
+		fmt.Fprintf(os.Stderr, "    REMOTE_WRITE_EXTERNAL_LABELS: Comma-separated key=value labels added to every pushed series\\n")
+		fmt.Fprintf(os.Stderr, "    REMOTE_WRITE_INTERVAL: Interval between two remote-write pushes (default: 60s)\\n")
+		fmt.Fprintf(os.Stderr, "    REMOTE_WRITE_QUEUE_SIZE: Batches kept in memory while the endpoint is unreachable (default: 30)\\n")
+		fmt.Fprintf(os.Stderr, "    EVENTS_WEBHOOK_URLS: Comma-separated webhooks receiving events as JSON (enables the event engine)\\n")
+		fmt.Fprintf(os.Stderr, "    EVENTS_SLACK_WEBHOOK_URLS: Comma-separated Slack incoming webhooks receiving events (enables the event engine)\\n")
+		fmt.Fprintf(os.Stderr, "    EVENTS_WEBHOOK_TEMPLATE: File with a Go template replacing the JSON payload of EVENTS_WEBHOOK_URLS\\n")
+		fmt.Fprintf(os.Stderr, "    EVENTS_INTERVAL: Interval between two event checks (default: 5m)\\n")
+		fmt.Fprintf(os.Stderr, "    EVENTS_TRIGGERS: Comma-separated event types to fire (default: all)\\n")
+		fmt.Fprintf(os.Stderr, "    EVENTS_SETUP_KEY_EXPIRY_WARNING: How long before expiry a setup key is reported (default: 168h)\\n")
+		fmt.Fprintf(os.Stderr, "    EVENTS_DEDUP_WINDOW: How long an event is not fired again (default: 24h)\\n")
+		fmt.Fprintf(os.Stderr, "    API_RECORD_DIR: Directory the NetBird API responses are recorded to, scrubbed of secrets and personal data (optional)\\n")
+		fmt.Fprintf(os.Stderr, "    API_REPLAY_DIR: Directory of a recording served instead of the NetBird API (optional, NETBIRD_API_TOKEN not required)\\n")
+		fmt.Fprintf(os.Stderr, "  Commands:\\n")
+		fmt.Fprintf(os.Stderr, "    once [-output FILE|-] [-pushgateway URL] [-job NAME]: Collect once, write or push the metrics and exit (exit code 1 on collector failures)\\n")
+		fmt.Fprintf(os.Stderr, "    PUSHGATEWAY_URL, PUSHGATEWAY_JOB: Defaults of -pushgateway and -job\\n")
+		fmt.Fprintf(os.Stderr, "    PUSHGATEWAY_USERNAME, PUSHGATEWAY_PASSWORD: Basic auth for the Pushgateway\\n")
+		fmt.Fprintf(os.Stderr, "    snapshot [-output DIR] [-format csv|ndjson] [-kinds peers,users,groups,policies]: Write a snapshot of the NetBird objects with a manifest of hashes and exit\\n")
+		fmt.Fprintf(os.Stderr, "    rules [-format rules|prometheusrule|helm] [-output FILE|-] [-job NAME] [-namespace NS]: Write Prometheus alerting and recording rules for the enabled collectors and exit\\n")
+		fmt.Fprintf(os.Stderr, "    RULES_JOB: Default of -job (default: netbird-api-exporter)\\n")
+		fmt.Fprintf(os.Stderr, "    RULES_SCRAPE_ERRORS_THRESHOLD: Scrape errors over 15 minutes alerted on (default: 3)\\n")
+		fmt.Fprintf(os.Stderr, "    RULES_DISCONNECTED_RATIO: Ratio of disconnected peers alerted on (default: 0.5)\\n")
+		fmt.Fprintf(os.Stderr, "    RULES_SETUP_KEY_EXPIRY_WARNING: How long before expiry a setup key is alerted on (default: 168h)\\n")
+		fmt.Fprintf(os.Stderr, "    RULES_TOKEN_EXPIRY_WARNING: How long before expiry an API token is alerted on (default: 336h)\\n")
+		fmt.Fprintf(os.Stderr, "    dashboard [-output FILE|-]: Write the Grafana dashboard generated from the metrics of every collector and exit\\n")
+		fmt.Fprintf(os.Stderr, "  Flags:\\n")
+		fmt.Fprintf(os.Stderr, "    --demo: Serve a sample account from a built-in fake NetBird API instead of NETBIRD_API_URL, with the token expiry, setup key and network detail collectors enabled\\n")
+		fmt.Fprintf(os.Stderr, "    DEMO_CHURN_INTERVAL: Interval between two random peer connection changes in demo mode (default: 30s, 0 disables)\\n")
 		fmt.Fprintf(os.Stderr, "  Use --help or -h to display this message.\\n")
 		os.Exit(0)
 	}
 
+	// Rules command, it does not need the API
+	if len(os.Args) > 1 && os.Args[1] == "rules" {
+		os.Exit(runRules(rules.Config{
+			Job:                   rulesJob,
+			SetupKeys:             setupKeysEnabled,
+			TokenExpiry:           usersTrackTokenExpiry,
+			NetworkDetails:        networksCollectDetails,
+			DNSProbe:              dnsProbeEnabled,
+			ScrapeErrorsThreshold: rulesScrapeErrorsThreshold,
+			DisconnectedRatio:     rulesDisconnectedRatio,
+			SetupKeyExpiryWarning: rulesSetupKeyExpiryWarning,
+			TokenExpiryWarning:    rulesTokenExpiryWarning,
+		}, os.Args[2:]))
+	}
+
+	// Dashboard command, it does not need the API either
+	if len(os.Args) > 1 && os.Args[1] == "dashboard" {
+		os.Exit(runDashboard(os.Args[2:]))
+	}
+
+	// Demo mode, the exporter scrapes a fake API with a sample account
+	var demoServer *fakeapi.Server
+	if demoFlag {
+		demoServer, netbirdURL, err = startDemoAPI(demoChurnInterval)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to start the demo NetBird API")
+		}
+		netbirdToken = fakeapi.DemoToken
+		// The collectors that are off by default only because of the extra
+		// API calls, the other options keep their settings
+		usersTrackTokenExpiry = true
+		setupKeysEnabled = true
+		networksCollectDetails = true
+		logrus.WithField("netbird_url", netbirdURL).Warn("Demo mode, serving a sample account from a fake NetBird API")
+	}
+
+	// Record or replay the API responses
+	var transport http.RoundTripper
+	var now func() time.Time
+	if apiReplayDir != "" {
+		replayer, err := recording.NewReplayer(apiReplayDir)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to load the API recording")
+		}
+		transport = replayer
+		recordedAt := replayer.Manifest().RecordedAt
+		now = func() time.Time { return recordedAt }
+		netbirdURL, netbirdToken = "http://recording", "recording"
+		logrus.WithFields(logrus.Fields{
+			"dir":         apiReplayDir,
+			"recorded_at": recordedAt,
+		}).Warn("Replaying recorded NetBird API responses")
+	} else if apiRecordDir != "" {
+		recorder, err := recording.NewRecorder(apiRecordDir, nil)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to start recording the API responses")
+		}
+		transport = recorder
+		logrus.WithField("dir", apiRecordDir).Info("Recording NetBird API responses")
+	}
+
 	// Validate required configuration
 	if netbirdToken == "" {
 		logrus.Fatal("NETBIRD_API_TOKEN environment variable is required")
@@ -111,7 +563,50 @@ func main() {
 	}).Info("Starting NetBird API Exporter")
 
 	// Create exporter
-	exporter := exporters.NewNetBirdExporter(netbirdURL, netbirdToken)
+	exporter := exporters.NewNetBirdExporterWithClient(newClient(netbirdURL, netbirdToken, transport), exporters.Config{
+		Peers: exporters.PeersConfig{
+			MinSupportedVersion: peersMinVersion,
+			HideConnectionIP:    peersHideConnectionIP,
+			StaleAfterDays:      stalePeersDays,
+			StaleExcludedGroups: stalePeersExcludedGroups,
+			TrackPeerFlaps:      peersTrackFlaps,
+			ExportSerialNumber:  peersExportSerialNumber,
+		},
+		Groups: exporters.GroupsConfig{
+			TrackReferences: groupsTrackReferences,
+			SensitiveGroups: groupsSensitive,
+		},
+		Users: exporters.UsersConfig{
+			DormantAfterDays:    usersDormantDays,
+			TrackInviteAge:      usersTrackInviteAge,
+			HideUserPermissions: usersHidePermissions,
+			PermissionsByRole:   usersPermissionsByRole,
+			MaxPeersPerUser:     usersMaxPeers,
+			TrackTokenExpiry:    usersTrackTokenExpiry,
+		},
+		SetupKeys: exporters.SetupKeysConfig{
+			Enabled: setupKeysEnabled,
+		},
+		Networks: exporters.NetworksConfig{
+			CollectDetails: networksCollectDetails,
+		},
+		DNS: exporters.DNSConfig{
+			ProbeEnabled:   dnsProbeEnabled,
+			ProbeQueryName: dnsProbeQueryName,
+			ProbeTimeout:   dnsProbeTimeout,
+		},
+		Now: now,
+	})
+
+	// Snapshot command
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		os.Exit(runSnapshot(newClient(netbirdURL, netbirdToken, transport), os.Args[2:]))
+	}
+
+	// One-shot mode
+	if len(os.Args) > 1 && os.Args[1] == "once" {
+		os.Exit(runOnce(exporter, os.Args[2:]))
+	}
 
 	// Register exporter
 	prometheus.MustRegister(exporter)
@@ -138,6 +633,33 @@ func main() {
 		}
 	})
 
+	// Stale peers report endpoint
+	if stalePeersDays > 0 {
+		mux.Handle("/reports/stale-peers", exporter.StalePeersHandler())
+	}
+
+	// Inventory endpoint
+	if inventoryEnabled {
+		if inventoryToken == "" {
+			logrus.Warn("Inventory endpoint enabled without INVENTORY_TOKEN, anyone reaching the exporter can read user emails and peer IPs")
+		}
+		mux.Handle("/api/v1/inventory", exporter.InventoryHandler(exporters.InventoryHandlerConfig{
+			RedactFields: inventoryRedactFields,
+			Token:        inventoryToken,
+		}))
+	}
+
+	// Snapshot endpoint
+	if snapshotEnabled {
+		if snapshotToken == "" {
+			logrus.Warn("Snapshot endpoint enabled without SNAPSHOT_TOKEN, anyone reaching the exporter can download the account inventory")
+		}
+		mux.Handle("/api/v1/snapshot", snapshot.Handler(newClient(netbirdURL, netbirdToken, transport), snapshot.HandlerConfig{
+			CacheTTL: snapshotCacheTTL,
+			Token:    snapshotToken,
+		}))
+	}
+
 	// Root endpoint with information
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		logrus.Debug("Root endpoint accessed")
@@ -151,6 +673,9 @@ func main() {
 		<ul>
 		<li><a href="%s">Metrics</a></li>
 		<li><a href="/health">Health Check</a></li>
+		<li><a href="/reports/stale-peers">Stale Peers Report</a> (requires STALE_PEERS_DAYS)</li>
+		<li><a href="/api/v1/inventory">Inventory</a> (requires INVENTORY_ENABLED)</li>
+		<li><a href="/api/v1/snapshot?kind=users&format=csv">Users Snapshot</a> (requires SNAPSHOT_ENABLED)</li>
 		</ul>
 		<h2>Available Metrics</h2>
 		<ul>
@@ -180,6 +705,52 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// OTLP push mode
+	var otlpPusher *push.OTLPPusher
+	if otlpEndpoint != "" {
+		otlpPusher, err = startOTLPPusher(ctx, exporter, push.OTLPConfig{
+			Endpoint: otlpEndpoint,
+			Protocol: otlpProtocol,
+			Insecure: otlpInsecure,
+			Headers:  otlpHeaders,
+			Interval: otlpInterval,
+		}, otlpInstanceID)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to start OTLP push mode")
+		}
+	}
+
+	// Remote-write push mode
+	var remoteWritePusher *push.RemoteWritePusher
+	if remoteWriteURL != "" {
+		remoteWritePusher, err = startRemoteWritePusher(exporter, push.RemoteWriteConfig{
+			URL:            remoteWriteURL,
+			Username:       remoteWriteUsername,
+			Password:       remoteWritePassword,
+			BearerToken:    remoteWriteBearerToken,
+			ExternalLabels: remoteWriteExternalLabels,
+			Interval:       remoteWriteInterval,
+			QueueSize:      remoteWriteQueueSize,
+		})
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to start remote-write push mode")
+		}
+	}
+
+	// Event engine
+	var eventEngine *events.Engine
+	if len(eventsWebhookURLs) > 0 || len(eventsSlackWebhookURLs) > 0 {
+		eventEngine, err = startEventEngine(newClient(netbirdURL, netbirdToken, transport), events.Config{
+			Interval:              eventsInterval,
+			Triggers:              eventsTriggers,
+			SetupKeyExpiryWarning: eventsSetupKeyExpiryWarning,
+			DedupWindow:           eventsDedupWindow,
+		}, eventsWebhookURLs, eventsWebhookTemplate, eventsSlackWebhookURLs)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to start event engine")
+		}
+	}
+
 	go func() {
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -192,6 +763,26 @@ func main() {
 		if err := server.Shutdown(shutdownCtx); err != nil {
 			logrus.WithError(err).Error("Error during server shutdown")
 		}
+		if otlpPusher != nil {
+			if err := otlpPusher.Shutdown(shutdownCtx); err != nil {
+				logrus.WithError(err).Error("Error during OTLP pusher shutdown")
+			}
+		}
+		if remoteWritePusher != nil {
+			if err := remoteWritePusher.Shutdown(shutdownCtx); err != nil {
+				logrus.WithError(err).Error("Error during remote-write pusher shutdown")
+			}
+		}
+		if eventEngine != nil {
+			if err := eventEngine.Shutdown(shutdownCtx); err != nil {
+				logrus.WithError(err).Error("Error during event engine shutdown")
+			}
+		}
+		if demoServer != nil {
+			if err := demoServer.Close(); err != nil {
+				logrus.WithError(err).Error("Error during demo API shutdown")
+			}
+		}
 		cancel()
 	}()
 
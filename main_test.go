@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/exporters"
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
+)
+
+func TestRunOnce_ExitCode(t *testing.T) {
+	server := fakeapi.NewServer(fakeapi.Demo(time.Now()), fakeapi.Config{Token: fakeapi.DemoToken})
+	api := httptest.NewServer(server)
+	defer api.Close()
+
+	exporter := exporters.NewNetBirdExporter(api.URL, fakeapi.DemoToken)
+	output := filepath.Join(t.TempDir(), "netbird.prom")
+
+	if code := runOnce(exporter, []string{"-output", output}); code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	server.InjectError("/api/peers", http.StatusInternalServerError, 1)
+	if code := runOnce(exporter, []string{"-output", output}); code != 1 {
+		t.Errorf("Expected exit code 1 when the peers cannot be fetched, got %d", code)
+	}
+
+	if code := runOnce(exporter, []string{"-unknown"}); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown flag, got %d", code)
+	}
+}
@@ -0,0 +1,222 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/exporters"
+)
+
+const (
+	gridWidth   = 24
+	panelHeight = 8
+)
+
+// Generate renders the dashboard JSON. Every section gets its curated panels,
+// followed by a collapsed row with a default panel for each of its metrics no
+// curated panel uses. It fails when a curated panel uses a metric that is not
+// described, so renaming or removing a metric cannot silently break the
+// dashboard.
+func Generate(metrics []exporters.Metric) ([]byte, error) {
+	byName := make(map[string]exporters.Metric, len(metrics))
+	for _, metric := range metrics {
+		byName[metric.Name] = metric
+	}
+
+	used := make(map[string]bool)
+	for _, section := range sections {
+		for _, p := range section.Panels {
+			for _, t := range p.Targets {
+				if _, ok := byName[t.Metric]; !ok {
+					return nil, fmt.Errorf("panel %q uses metric %s, which no collector describes", p.Title, t.Metric)
+				}
+				used[t.Metric] = true
+			}
+		}
+	}
+
+	// Unused metrics go to the section with the longest matching prefix
+	details := make([][]panel, len(sections))
+	for _, metric := range metrics {
+		if used[metric.Name] {
+			continue
+		}
+		index, length := -1, 0
+		for i, section := range sections {
+			for _, prefix := range section.Prefixes {
+				if strings.HasPrefix(metric.Name, prefix) && len(prefix) > length {
+					index, length = i, len(prefix)
+				}
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("metric %s matches no dashboard section", metric.Name)
+		}
+		details[index] = append(details[index], defaultPanel(metric))
+	}
+
+	l := &layout{}
+	for i, section := range sections {
+		if len(section.Panels) > 0 {
+			l.row(section.Title, section.Panels, false)
+		}
+		if len(details[i]) > 0 {
+			l.row(section.Title+" Details", details[i], true)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(dashboard(l.panels)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// layout places rows and panels on the dashboard grid
+type layout struct {
+	panels []map[string]any
+	nextID int
+	y      int
+}
+
+func (l *layout) id() int {
+	l.nextID++
+	return l.nextID
+}
+
+// row adds a row and its panels. The panels of a collapsed row are nested in it.
+func (l *layout) row(title string, panels []panel, collapsed bool) {
+	row := map[string]any{
+		"collapsed": collapsed,
+		"gridPos":   gridPos(0, l.y, gridWidth, 1),
+		"id":        l.id(),
+		"panels":    []map[string]any{},
+		"title":     title,
+		"type":      "row",
+	}
+	l.panels = append(l.panels, row)
+	l.y++
+
+	var children []map[string]any
+	x := 0
+	for _, p := range panels {
+		width := p.width()
+		if x+width > gridWidth {
+			x = 0
+			l.y += panelHeight
+		}
+		children = append(children, p.render(l.id(), gridPos(x, l.y, width, panelHeight)))
+		x += width
+	}
+	if x > 0 {
+		l.y += panelHeight
+	}
+
+	if collapsed {
+		row["panels"] = children
+		// Collapsed rows take a single line until expanded
+		l.y = row["gridPos"].(map[string]int)["y"] + 1
+		return
+	}
+	l.panels = append(l.panels, children...)
+}
+
+func gridPos(x, y, w, h int) map[string]int {
+	return map[string]int{"h": h, "w": w, "x": x, "y": y}
+}
+
+// defaultPanel shows a metric no curated panel uses: counters as rates,
+// histograms as their 95th percentile, gauges as a stat without labels and a
+// table with labels
+func defaultPanel(metric exporters.Metric) panel {
+	p := panel{Title: metric.Help, Description: metric.Name}
+	switch {
+	case strings.HasSuffix(metric.Name, "_total"):
+		p.Type = panelTimeseries
+		legend := ""
+		for _, label := range metric.Labels {
+			legend += "{{" + label + "}} "
+		}
+		p.Targets = []target{{Metric: metric.Name, Expr: fmt.Sprintf("rate(%s[5m])", metric.Name), Legend: strings.TrimSpace(legend)}}
+	case strings.HasSuffix(metric.Name, "_scrape_duration_seconds"):
+		p.Type = panelTimeseries
+		p.Unit = "s"
+		p.Targets = []target{{Metric: metric.Name, Expr: fmt.Sprintf("histogram_quantile(0.95, sum by (le) (rate(%s_bucket[5m])))", metric.Name), Legend: "95th percentile"}}
+	case len(metric.Labels) == 0:
+		p.Type = panelStat
+		p.Targets = []target{{Metric: metric.Name}}
+	default:
+		p.Type = panelTable
+		p.Targets = []target{{Metric: metric.Name}}
+	}
+	if p.Unit == "" && strings.HasSuffix(metric.Name, "_seconds") && p.Type != panelTimeseries {
+		p.Unit = "s"
+	}
+	return p
+}
+
+// dashboard wraps the panels with the dashboard settings
+func dashboard(panels []map[string]any) map[string]any {
+	return map[string]any{
+		"annotations": map[string]any{
+			"list": []map[string]any{{
+				"builtIn":    1,
+				"datasource": map[string]string{"type": "grafana", "uid": "-- Grafana --"},
+				"enable":     true,
+				"hide":       true,
+				"iconColor":  "rgba(0, 211, 255, 1)",
+				"name":       "Annotations & Alerts",
+				"type":       "dashboard",
+			}},
+		},
+		"description":          "Comprehensive dashboard for NetBird API Exporter metrics including peers, users, groups, setup keys, DNS, and networks",
+		"editable":             true,
+		"fiscalYearStartMonth": 0,
+		"graphTooltip":         0,
+		"id":                   nil,
+		"links": []map[string]any{{
+			"asDropdown":  false,
+			"icon":        "external link",
+			"includeVars": false,
+			"keepTime":    false,
+			"tags":        []string{},
+			"title":       "NetBird Documentation",
+			"tooltip":     "",
+			"type":        "link",
+			"url":         "https://docs.netbird.io/",
+		}},
+		"liveNow":       false,
+		"panels":        panels,
+		"refresh":       "30s",
+		"schemaVersion": 38,
+		"style":         "dark",
+		"tags":          []string{"netbird", "networking", "vpn"},
+		"templating": map[string]any{
+			"list": []map[string]any{{
+				"current":     map[string]any{"selected": false, "text": "Prometheus", "value": "Prometheus"},
+				"hide":        0,
+				"includeAll":  false,
+				"multi":       false,
+				"name":        "DS_PROMETHEUS",
+				"options":     []any{},
+				"query":       "prometheus",
+				"refresh":     1,
+				"regex":       "",
+				"skipUrlSync": false,
+				"type":        "datasource",
+			}},
+		},
+		"time":       map[string]string{"from": "now-1h", "to": "now"},
+		"timepicker": map[string]any{},
+		"timezone":   "",
+		"title":      "NetBird API Exporter",
+		"uid":        "netbird-api-exporter",
+		"version":    1,
+		"weekStart":  "",
+	}
+}
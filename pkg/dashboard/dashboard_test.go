@@ -0,0 +1,105 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/exporters"
+)
+
+func allMetrics(t *testing.T) []exporters.Metric {
+	t.Helper()
+	metrics, err := exporters.Metrics(exporters.NewNetBirdExporterWithConfig("http://localhost", "test-token", exporters.AllCollectorsConfig()))
+	if err != nil {
+		t.Fatalf("Failed to describe the metrics: %v", err)
+	}
+	return metrics
+}
+
+// TestGenerate_MissingMetric checks that renaming or removing a metric used by a
+// curated panel fails the generation
+func TestGenerate_MissingMetric(t *testing.T) {
+	var metrics []exporters.Metric
+	for _, metric := range allMetrics(t) {
+		if metric.Name != "netbird_peers_by_os" {
+			metrics = append(metrics, metric)
+		}
+	}
+	_, err := Generate(metrics)
+	if err == nil || !strings.Contains(err.Error(), "netbird_peers_by_os") {
+		t.Errorf("Expected an error naming the missing metric, got %v", err)
+	}
+}
+
+// TestGenerate_EveryMetric checks that every described metric is on the dashboard
+func TestGenerate_EveryMetric(t *testing.T) {
+	metrics := allMetrics(t)
+	data, err := Generate(metrics)
+	if err != nil {
+		t.Fatalf("Failed to generate dashboard: %v", err)
+	}
+
+	var parsed struct {
+		Panels []struct {
+			ID     int `json:"id"`
+			Panels []struct {
+				ID      int `json:"id"`
+				Targets []struct {
+					Expr string `json:"expr"`
+				} `json:"targets"`
+			} `json:"panels"`
+			Targets []struct {
+				Expr string `json:"expr"`
+			} `json:"targets"`
+		} `json:"panels"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("Failed to parse dashboard: %v", err)
+	}
+
+	var exprs []string
+	ids := make(map[int]bool)
+	checkID := func(id int) {
+		if ids[id] {
+			t.Errorf("Expected unique panel IDs, got %d twice", id)
+		}
+		ids[id] = true
+	}
+	for _, p := range parsed.Panels {
+		checkID(p.ID)
+		for _, target := range p.Targets {
+			exprs = append(exprs, target.Expr)
+		}
+		for _, child := range p.Panels {
+			checkID(child.ID)
+			for _, target := range child.Targets {
+				exprs = append(exprs, target.Expr)
+			}
+		}
+	}
+	all := strings.Join(exprs, "\n")
+	for _, metric := range metrics {
+		if !strings.Contains(all, metric.Name) {
+			t.Errorf("Expected a panel for %s", metric.Name)
+		}
+	}
+}
+
+// TestDashboardFile fails when grafana-dashboard.json is not regenerated after
+// changing the metrics or the panels
+func TestDashboardFile(t *testing.T) {
+	expected, err := Generate(allMetrics(t))
+	if err != nil {
+		t.Fatalf("Failed to generate dashboard: %v", err)
+	}
+	actual, err := os.ReadFile(filepath.Join("..", "..", "grafana-dashboard.json"))
+	if err != nil {
+		t.Fatalf("Failed to read grafana-dashboard.json: %v", err)
+	}
+	if string(actual) != string(expected) {
+		t.Error("grafana-dashboard.json is out of date, regenerate it from the repository root with: go run . dashboard -output grafana-dashboard.json")
+	}
+}
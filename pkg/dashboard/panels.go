@@ -0,0 +1,307 @@
+package dashboard
+
+// Panel types
+const (
+	panelStat       = "stat"
+	panelPie        = "piechart"
+	panelTable      = "table"
+	panelTimeseries = "timeseries"
+)
+
+// section is a dashboard row with its curated panels. Prefixes claim the
+// metrics no curated panel uses for the collapsed details row of the section.
+type section struct {
+	Title    string
+	Prefixes []string
+	Panels   []panel
+}
+
+// panel is a panel hint
+type panel struct {
+	Title       string
+	Description string
+	Type        string
+	Targets     []target
+
+	// Width in grid columns, defaults to 6 for stats and 12 otherwise
+	Width int
+	Unit  string
+
+	// Columns renames table columns, HideValue drops the value column of info metrics
+	Columns   map[string]string
+	HideValue bool
+}
+
+// target is a query of a panel on a described metric
+type target struct {
+	Metric string
+
+	// Expr defaults to the metric
+	Expr   string
+	Legend string
+}
+
+// sections are the rows of the dashboard, in order
+var sections = []section{
+	{
+		Title: "Overview",
+		Panels: []panel{
+			{Title: "Total Peers", Type: panelStat, Targets: []target{{Metric: "netbird_peers"}}},
+			{Title: "Total Users", Type: panelStat, Targets: []target{{Metric: "netbird_users"}}},
+			{Title: "Total Groups", Type: panelStat, Targets: []target{{Metric: "netbird_groups"}}},
+			{Title: "Total Networks", Type: panelStat, Targets: []target{{Metric: "netbird_networks"}}},
+		},
+	},
+	{
+		Title:    "Peers",
+		Prefixes: []string{"netbird_peer_", "netbird_peers_"},
+		Panels: []panel{
+			{Title: "Peers Connection Status", Type: panelPie, Targets: []target{{Metric: "netbird_peers_connected"}}},
+			{Title: "Peers by Operating System", Type: panelPie, Targets: []target{{Metric: "netbird_peers_by_os"}}},
+			{
+				Title: "Peers by Country", Type: panelTable, Width: 24,
+				Targets: []target{{Metric: "netbird_peers_by_country"}},
+				Columns: map[string]string{"Value": "Count", "city_name": "City", "country_code": "Country Code"},
+			},
+			{Title: "Stale Peers", Type: panelStat, Targets: []target{{Metric: "netbird_peers_stale", Expr: "sum(netbird_peers_stale)"}}},
+			{Title: "Outdated Peers", Type: panelStat, Targets: []target{{Metric: "netbird_peers_outdated", Expr: "sum(netbird_peers_outdated)"}}},
+			{Title: "Peers with Expired Login", Type: panelStat, Targets: []target{{Metric: "netbird_peers_login_expired", Expr: `sum(netbird_peers_login_expired{login_expired="true"})`}}},
+			{Title: "Peers Pending Approval", Type: panelStat, Targets: []target{{Metric: "netbird_peers_approval_required", Expr: `sum(netbird_peers_approval_required{approval_required="true"})`}}},
+		},
+	},
+	{
+		Title:    "Users",
+		Prefixes: []string{"netbird_user_", "netbird_users"},
+		Panels: []panel{
+			{Title: "Users by Role", Type: panelPie, Width: 8, Targets: []target{{Metric: "netbird_users_by_role"}}},
+			{Title: "Users by Status", Type: panelPie, Width: 8, Targets: []target{{Metric: "netbird_users_by_status"}}},
+			{Title: "Service vs Regular Users", Type: panelPie, Width: 8, Targets: []target{{Metric: "netbird_users_service_users"}}},
+		},
+	},
+	{
+		Title:    "Groups",
+		Prefixes: []string{"netbird_group_", "netbird_groups"},
+		Panels: []panel{
+			{
+				Title: "Group Peers Count", Type: panelTable,
+				Targets: []target{{Metric: "netbird_group_peers_count"}},
+				Columns: map[string]string{"Value": "Peers", "group_id": "Group ID", "group_name": "Group Name", "issued": "Issued"},
+			},
+			{
+				Title: "Group Resources Count", Type: panelTable,
+				Targets: []target{{Metric: "netbird_group_resources_count"}},
+				Columns: map[string]string{"Value": "Resources", "group_id": "Group ID", "group_name": "Group Name", "issued": "Issued"},
+			},
+		},
+	},
+	{
+		Title:    "Setup Keys",
+		Prefixes: []string{"netbird_setup_key"},
+		Panels: []panel{
+			{Title: "Setup Keys by State", Type: panelPie, Targets: []target{{Metric: "netbird_setup_keys", Expr: "sum by (state) (netbird_setup_keys)", Legend: "{{state}}"}}},
+			{
+				Title: "Setup Key Expiry", Type: panelTable, Unit: "s",
+				Targets: []target{{Metric: "netbird_setup_key_expires_in_seconds"}},
+				Columns: map[string]string{"Value": "Expires In", "key_id": "Key ID", "key_name": "Key Name", "type": "Type"},
+			},
+		},
+	},
+	{
+		Title:    "DNS",
+		Prefixes: []string{"netbird_dns_"},
+		Panels: []panel{
+			{Title: "Total Nameserver Groups", Type: panelStat, Targets: []target{{Metric: "netbird_dns_nameserver_groups"}}},
+			{Title: "Nameserver Groups Enabled", Type: panelPie, Width: 9, Targets: []target{{Metric: "netbird_dns_nameserver_groups_enabled"}}},
+			{Title: "Nameservers by Type", Type: panelPie, Width: 9, Targets: []target{{Metric: "netbird_dns_nameservers_by_type"}}},
+		},
+	},
+	{
+		Title:    "Networks",
+		Prefixes: []string{"netbird_network_", "netbird_networks", "netbird_route_"},
+		Panels: []panel{
+			{
+				Title: "Networks Overview", Type: panelTable, Width: 24, HideValue: true,
+				Targets: []target{{Metric: "netbird_network_info"}},
+				Columns: map[string]string{"description": "Description", "network_id": "Network ID", "network_name": "Network Name"},
+			},
+			{
+				Title: "Network Routers Online", Type: panelTable,
+				Targets: []target{{Metric: "netbird_network_ha_routers_online"}},
+				Columns: map[string]string{"Value": "Routers Online", "network_id": "Network ID", "network_name": "Network Name"},
+			},
+			{Title: "Networks with a Single Point of Failure", Type: panelStat, Targets: []target{{Metric: "netbird_network_single_point_of_failure", Expr: "sum(netbird_network_single_point_of_failure)"}}},
+		},
+	},
+	{
+		Title:    "Performance & Errors",
+		Prefixes: []string{"netbird_"},
+		Panels: []panel{
+			{
+				Title: "API Scrape Duration (95th percentile)", Type: panelTimeseries, Unit: "s",
+				Targets: []target{
+					{Metric: "netbird_users_scrape_duration_seconds", Expr: "histogram_quantile(0.95, rate(netbird_users_scrape_duration_seconds_bucket[5m]))", Legend: "Users 95th percentile"},
+					{Metric: "netbird_groups_scrape_duration_seconds", Expr: "histogram_quantile(0.95, rate(netbird_groups_scrape_duration_seconds_bucket[5m]))", Legend: "Groups 95th percentile"},
+					{Metric: "netbird_networks_scrape_duration_seconds", Expr: "histogram_quantile(0.95, rate(netbird_networks_scrape_duration_seconds_bucket[5m]))", Legend: "Networks 95th percentile"},
+					{Metric: "netbird_dns_scrape_duration_seconds", Expr: "histogram_quantile(0.95, rate(netbird_dns_scrape_duration_seconds_bucket[5m]))", Legend: "DNS 95th percentile"},
+					{Metric: "netbird_setup_keys_scrape_duration_seconds", Expr: "histogram_quantile(0.95, rate(netbird_setup_keys_scrape_duration_seconds_bucket[5m]))", Legend: "Setup keys 95th percentile"},
+				},
+			},
+			{
+				Title: "API Scrape Errors Rate", Type: panelTimeseries, Unit: "reqps",
+				Targets: []target{
+					{Metric: "netbird_peers_scrape_errors_total", Expr: "rate(netbird_peers_scrape_errors_total[5m])", Legend: "Peers errors"},
+					{Metric: "netbird_users_scrape_errors_total", Expr: "rate(netbird_users_scrape_errors_total[5m])", Legend: "Users errors"},
+					{Metric: "netbird_groups_scrape_errors_total", Expr: "rate(netbird_groups_scrape_errors_total[5m])", Legend: "Groups errors"},
+					{Metric: "netbird_networks_scrape_errors_total", Expr: "rate(netbird_networks_scrape_errors_total[5m])", Legend: "Networks errors"},
+					{Metric: "netbird_dns_scrape_errors_total", Expr: "rate(netbird_dns_scrape_errors_total[5m])", Legend: "DNS errors"},
+					{Metric: "netbird_setup_keys_scrape_errors_total", Expr: "rate(netbird_setup_keys_scrape_errors_total[5m])", Legend: "Setup keys errors"},
+				},
+			},
+		},
+	},
+}
+
+func (p panel) width() int {
+	switch {
+	case p.Width > 0:
+		return p.Width
+	case p.Type == panelStat:
+		return 6
+	default:
+		return 12
+	}
+}
+
+var greenThresholds = map[string]any{
+	"mode":  "absolute",
+	"steps": []map[string]any{{"color": "green", "value": nil}},
+}
+
+var reduceLastNotNull = map[string]any{
+	"values": false,
+	"calcs":  []string{"lastNotNull"},
+	"fields": "",
+}
+
+var hideFrom = map[string]bool{"legend": false, "tooltip": false, "vis": false}
+
+// render builds the Grafana panel JSON
+func (p panel) render(id int, gridPos map[string]int) map[string]any {
+	targets := make([]map[string]any, 0, len(p.Targets))
+	for i, t := range p.Targets {
+		expr := t.Expr
+		if expr == "" {
+			expr = t.Metric
+		}
+		target := map[string]any{"expr": expr, "refId": string(rune('A' + i))}
+		if t.Legend != "" {
+			target["legendFormat"] = t.Legend
+		}
+		if p.Type == panelTable {
+			target["format"] = "table"
+		}
+		targets = append(targets, target)
+	}
+
+	defaults := map[string]any{"mappings": []any{}}
+	if p.Unit != "" {
+		defaults["unit"] = p.Unit
+	}
+	result := map[string]any{
+		"datasource":  map[string]string{"type": "prometheus", "uid": "${DS_PROMETHEUS}"},
+		"fieldConfig": map[string]any{"defaults": defaults, "overrides": []any{}},
+		"gridPos":     gridPos,
+		"id":          id,
+		"targets":     targets,
+		"title":       p.Title,
+		"type":        p.Type,
+	}
+	if p.Description != "" {
+		result["description"] = p.Description
+	}
+
+	switch p.Type {
+	case panelStat:
+		defaults["color"] = map[string]string{"mode": "thresholds"}
+		defaults["thresholds"] = greenThresholds
+		if p.Unit == "" {
+			defaults["unit"] = "short"
+		}
+		result["options"] = map[string]any{
+			"colorMode":     "value",
+			"graphMode":     "area",
+			"justifyMode":   "auto",
+			"orientation":   "auto",
+			"reduceOptions": reduceLastNotNull,
+			"textMode":      "auto",
+		}
+		result["pluginVersion"] = "10.0.0"
+	case panelPie:
+		defaults["color"] = map[string]string{"mode": "palette-classic"}
+		defaults["custom"] = map[string]any{"hideFrom": hideFrom}
+		result["options"] = map[string]any{
+			"legend":        map[string]string{"displayMode": "visible", "placement": "bottom"},
+			"pieType":       "pie",
+			"reduceOptions": reduceLastNotNull,
+			"tooltip":       map[string]string{"mode": "single", "sort": "none"},
+		}
+	case panelTable:
+		defaults["color"] = map[string]string{"mode": "thresholds"}
+		defaults["custom"] = map[string]any{
+			"align":       "auto",
+			"cellOptions": map[string]string{"type": "auto"},
+			"inspect":     false,
+		}
+		defaults["thresholds"] = greenThresholds
+		result["options"] = map[string]any{
+			"footer":     map[string]any{"fields": "", "reducer": []string{"sum"}, "show": false},
+			"showHeader": true,
+		}
+		result["pluginVersion"] = "10.0.0"
+
+		excluded := map[string]bool{"Time": true, "__name__": true, "instance": true, "job": true}
+		if p.HideValue {
+			excluded["Value"] = true
+		}
+		columns := p.Columns
+		if columns == nil {
+			columns = map[string]string{}
+		}
+		result["transformations"] = []map[string]any{{
+			"id": "organize",
+			"options": map[string]any{
+				"excludeByName": excluded,
+				"indexByName":   map[string]any{},
+				"renameByName":  columns,
+			},
+		}}
+	case panelTimeseries:
+		defaults["color"] = map[string]string{"mode": "palette-classic"}
+		defaults["custom"] = map[string]any{
+			"axisLabel":         "",
+			"axisPlacement":     "auto",
+			"barAlignment":      0,
+			"drawStyle":         "line",
+			"fillOpacity":       0,
+			"gradientMode":      "none",
+			"hideFrom":          hideFrom,
+			"lineInterpolation": "linear",
+			"lineWidth":         1,
+			"pointSize":         5,
+			"scaleDistribution": map[string]string{"type": "linear"},
+			"showPoints":        "auto",
+			"spanNulls":         false,
+			"stacking":          map[string]string{"group": "A", "mode": "none"},
+			"thresholdsStyle":   map[string]string{"mode": "off"},
+		}
+		defaults["thresholds"] = map[string]any{
+			"mode":  "absolute",
+			"steps": []map[string]any{{"color": "green", "value": nil}, {"color": "red", "value": 80}},
+		}
+		result["options"] = map[string]any{
+			"legend":  map[string]any{"calcs": []any{}, "displayMode": "list", "placement": "bottom"},
+			"tooltip": map[string]string{"mode": "single", "sort": "none"},
+		}
+	}
+	return result
+}
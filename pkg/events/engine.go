@@ -0,0 +1,357 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultInterval      = 5 * time.Minute
+	defaultExpiryWarning = 7 * 24 * time.Hour
+	defaultDedupWindow   = 24 * time.Hour
+	defaultTimeout       = 10 * time.Second
+	defaultMaxRetries    = 3
+	defaultMinBackoff    = time.Second
+)
+
+// Config holds the settings of the event engine
+type Config struct {
+	// Webhooks notified of every event
+	Webhooks []Webhook
+
+	// Interval between two checks. Defaults to 5m.
+	Interval time.Duration
+
+	// Triggers are the event types fired. Defaults to all of EventTypes.
+	Triggers []string
+
+	// SetupKeyExpiryWarning is how long before its expiry a setup key is
+	// reported. Defaults to 7 days.
+	SetupKeyExpiryWarning time.Duration
+
+	// DedupWindow is how long an event is not fired again after being fired.
+	// Defaults to 24h.
+	DedupWindow time.Duration
+
+	// Timeout of each webhook request. Defaults to 10s.
+	Timeout time.Duration
+
+	// MaxRetries is the number of retries of a failed webhook request.
+	// Defaults to 3, negative disables retries.
+	MaxRetries int
+
+	// MinBackoff is the wait before the first retry, doubled on every retry.
+	// Defaults to 1s.
+	MinBackoff time.Duration
+}
+
+// Engine periodically fetches the account state, compares it with the state of
+// the previous check and posts the resulting events to the webhooks. The state
+// holds peers, users, policies, setup keys and networks; groups are not
+// compared, as none of the events is about a group. The engine is itself a
+// prometheus.Collector exporting the engine metrics.
+type Engine struct {
+	config     Config
+	client     *nbclient.Client
+	httpClient *http.Client
+	targets    []*webhookTarget
+	triggers   map[string]bool
+
+	// mu serializes checks
+	mu       sync.Mutex
+	previous *State
+	fired    map[string]time.Time
+	// pending holds the events no webhook accepted, retried on the next check
+	pending []Event
+
+	// cancel stops the periodic checks and aborts pending retries
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Prometheus metrics
+	eventsTotal          *prometheus.CounterVec
+	eventsDeduplicated   *prometheus.CounterVec
+	webhookRequestsTotal *prometheus.CounterVec
+	checkErrorsTotal     prometheus.Counter
+	lastCheckTimestamp   prometheus.Gauge
+}
+
+// NewEngine starts checking the account on every interval until Shutdown is
+// called. The first check records the baseline the later checks compare with.
+func NewEngine(client *nbclient.Client, config Config) (*Engine, error) {
+	e, err := newEngine(client, config)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"webhooks": len(e.targets),
+		"interval": e.config.Interval,
+		"triggers": e.config.Triggers,
+	}).Info("Sending events to webhooks")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	go e.run(ctx)
+	return e, nil
+}
+
+// newEngine creates the engine without starting the periodic checks
+func newEngine(client *nbclient.Client, config Config) (*Engine, error) {
+	if len(config.Webhooks) == 0 {
+		return nil, fmt.Errorf("at least one webhook is required")
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultInterval
+	}
+	if len(config.Triggers) == 0 {
+		config.Triggers = EventTypes
+	}
+	if config.SetupKeyExpiryWarning <= 0 {
+		config.SetupKeyExpiryWarning = defaultExpiryWarning
+	}
+	if config.DedupWindow <= 0 {
+		config.DedupWindow = defaultDedupWindow
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = defaultMaxRetries
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultMinBackoff
+	}
+
+	triggers := make(map[string]bool, len(config.Triggers))
+	for _, trigger := range config.Triggers {
+		if !slices.Contains(EventTypes, trigger) {
+			return nil, fmt.Errorf("unknown event trigger %q, expected one of %v", trigger, EventTypes)
+		}
+		triggers[trigger] = true
+	}
+
+	targets := make([]*webhookTarget, 0, len(config.Webhooks))
+	for _, webhook := range config.Webhooks {
+		target, err := newWebhookTarget(webhook)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return &Engine{
+		config:     config,
+		client:     client,
+		httpClient: &http.Client{Timeout: config.Timeout},
+		targets:    targets,
+		triggers:   triggers,
+		fired:      make(map[string]time.Time),
+		done:       make(chan struct{}),
+
+		eventsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_events_total",
+				Help: "Total number of events fired by type",
+			},
+			[]string{"type"},
+		),
+
+		eventsDeduplicated: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_events_deduplicated_total",
+				Help: "Total number of events not fired again within the dedup window",
+			},
+			[]string{"type"},
+		),
+
+		webhookRequestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_events_webhook_requests_total",
+				Help: "Total number of webhook requests by result",
+			},
+			[]string{"result"},
+		),
+
+		checkErrorsTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "netbird_events_check_errors_total",
+				Help: "Total number of checks that failed to fetch the account state",
+			},
+		),
+
+		lastCheckTimestamp: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "netbird_events_last_check_timestamp_seconds",
+				Help: "Timestamp of the last successful check",
+			},
+		),
+	}, nil
+}
+
+// Describe implements prometheus.Collector
+func (e *Engine) Describe(ch chan<- *prometheus.Desc) {
+	e.eventsTotal.Describe(ch)
+	e.eventsDeduplicated.Describe(ch)
+	e.webhookRequestsTotal.Describe(ch)
+	e.checkErrorsTotal.Describe(ch)
+	e.lastCheckTimestamp.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (e *Engine) Collect(ch chan<- prometheus.Metric) {
+	e.eventsTotal.Collect(ch)
+	e.eventsDeduplicated.Collect(ch)
+	e.webhookRequestsTotal.Collect(ch)
+	e.checkErrorsTotal.Collect(ch)
+	e.lastCheckTimestamp.Collect(ch)
+}
+
+// run checks right away and then on every interval until ctx is cancelled
+func (e *Engine) run(ctx context.Context) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.Check(ctx); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Error("Failed to check for events")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check fetches the account state, fires the events since the previous check
+// and keeps the state for the next one
+func (e *Engine) Check(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	fetchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	state, err := FetchState(fetchCtx, e.client)
+	if err != nil {
+		e.checkErrorsTotal.Inc()
+		return err
+	}
+
+	now := time.Now()
+	e.process(ctx, Diff(e.previous, state, now, e.config.SetupKeyExpiryWarning), now)
+	e.previous = state
+	e.lastCheckTimestamp.SetToCurrentTime()
+	return nil
+}
+
+// process fires the enabled events that were not fired within the dedup window.
+// An event counts as fired once a webhook accepted it; events no webhook
+// accepted are retried on the next check until they are older than the dedup
+// window.
+func (e *Engine) process(ctx context.Context, events []Event, now time.Time) {
+	for key, firedAt := range e.fired {
+		if now.Sub(firedAt) >= e.config.DedupWindow {
+			delete(e.fired, key)
+		}
+	}
+
+	pending := make([]Event, 0, len(e.pending))
+	for _, event := range e.pending {
+		if now.Sub(event.Time) >= e.config.DedupWindow {
+			logrus.WithField("key", event.Key).Warn("Dropping event no webhook accepted within the dedup window")
+			continue
+		}
+		pending = append(pending, event)
+	}
+	e.pending = nil
+
+	queued := make(map[string]bool, len(pending)+len(events))
+	for _, event := range append(pending, events...) {
+		// An event derived from the current state alone is diffed again
+		// while it is still pending
+		if !e.triggers[event.Type] || queued[event.Key] {
+			continue
+		}
+		queued[event.Key] = true
+		if _, ok := e.fired[event.Key]; ok {
+			e.eventsDeduplicated.WithLabelValues(event.Type).Inc()
+			logrus.WithField("key", event.Key).Debug("Skipping event fired within the dedup window")
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"type":    event.Type,
+			"summary": event.Summary,
+		}).Info("Firing event")
+		delivered := false
+		for _, target := range e.targets {
+			if err := e.deliver(ctx, target, event); err != nil {
+				logrus.WithError(err).WithField("type", event.Type).Error("Failed to deliver event to webhook")
+				continue
+			}
+			delivered = true
+		}
+		if !delivered {
+			e.pending = append(e.pending, event)
+			continue
+		}
+		e.fired[event.Key] = now
+		e.eventsTotal.WithLabelValues(event.Type).Inc()
+	}
+}
+
+// deliver posts an event to a webhook, retrying with exponential backoff
+func (e *Engine) deliver(ctx context.Context, target *webhookTarget, event Event) error {
+	payload, err := target.payload(event)
+	if err != nil {
+		e.webhookRequestsTotal.WithLabelValues("failed").Inc()
+		return err
+	}
+
+	backoff := e.config.MinBackoff
+	for attempt := 0; ; attempt++ {
+		err := target.send(ctx, e.httpClient, payload)
+		if err == nil {
+			e.webhookRequestsTotal.WithLabelValues("success").Inc()
+			return nil
+		}
+		if errors.Is(err, errNonRetryable) || attempt >= e.config.MaxRetries {
+			e.webhookRequestsTotal.WithLabelValues("failed").Inc()
+			return err
+		}
+
+		e.webhookRequestsTotal.WithLabelValues("retry").Inc()
+		logrus.WithError(err).WithField("backoff", backoff).Debug("Retrying webhook request")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Shutdown stops the periodic checks
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.cancel()
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,295 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testAPI is a NetBird API stand-in serving a mutable state
+type testAPI struct {
+	mu    sync.Mutex
+	state State
+}
+
+func (a *testAPI) setState(state State) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.state = state
+}
+
+func (a *testAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	responses := map[string]any{
+		"/api/peers":      a.state.Peers,
+		"/api/users":      a.state.Users,
+		"/api/policies":   a.state.Policies,
+		"/api/setup-keys": a.state.SetupKeys,
+		"/api/networks":   a.state.Networks,
+	}
+	for networkID, routers := range a.state.Routers {
+		responses["/api/networks/"+networkID+"/routers"] = routers
+	}
+	for _, network := range a.state.Networks {
+		if _, ok := a.state.Routers[network.Id]; !ok {
+			responses["/api/networks/"+network.Id+"/routers"] = []api.NetworkRouter{}
+		}
+	}
+	response, ok := responses[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// webhookReceiver is a local webhook stand-in recording the payloads. It fails
+// the first failures requests with a server error.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	failures int
+	payloads []string
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures > 0 {
+		r.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	r.payloads = append(r.payloads, string(body))
+}
+
+func (r *webhookReceiver) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.payloads...)
+}
+
+func newTestEngine(t *testing.T, apiURL string, webhooks ...Webhook) *Engine {
+	t.Helper()
+	engine, err := newEngine(nbclient.New(apiURL, "test-token"), Config{
+		Webhooks:   webhooks,
+		MinBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	return engine
+}
+
+func TestEngine_Check(t *testing.T) {
+	netbird := &testAPI{}
+	netbird.setState(State{
+		Users:    []api.User{{Id: "user1", Email: "alice@example.com", Role: "user"}},
+		Policies: []api.Policy{{Id: stringPtr("policy1"), Name: "ssh", Enabled: true}},
+	})
+	apiServer := httptest.NewServer(netbird)
+	defer apiServer.Close()
+
+	generic := &webhookReceiver{failures: 1}
+	genericServer := httptest.NewServer(generic)
+	defer genericServer.Close()
+	slack := &webhookReceiver{}
+	slackServer := httptest.NewServer(slack)
+	defer slackServer.Close()
+
+	engine := newTestEngine(t, apiServer.URL,
+		Webhook{URL: genericServer.URL},
+		Webhook{URL: slackServer.URL, Format: FormatSlack},
+	)
+	ctx := context.Background()
+
+	// The first check only records the baseline
+	if err := engine.Check(ctx); err != nil {
+		t.Fatalf("Failed to check: %v", err)
+	}
+	if len(generic.received()) != 0 {
+		t.Fatalf("Expected no events on the baseline check, got %v", generic.received())
+	}
+
+	netbird.setState(State{
+		Users:    []api.User{{Id: "user1", Email: "alice@example.com", Role: "admin"}},
+		Policies: []api.Policy{{Id: stringPtr("policy1"), Name: "ssh", Enabled: false}},
+	})
+	if err := engine.Check(ctx); err != nil {
+		t.Fatalf("Failed to check: %v", err)
+	}
+
+	// The generic webhook got both events after retrying the failed request
+	payloads := generic.received()
+	if len(payloads) != 2 {
+		t.Fatalf("Expected 2 events, got %v", payloads)
+	}
+	types := make(map[string]bool)
+	for _, payload := range payloads {
+		var event Event
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			t.Fatalf("Failed to decode event %s: %v", payload, err)
+		}
+		types[event.Type] = true
+	}
+	if !types[EventAdminUserAdded] || !types[EventPolicyDisabled] {
+		t.Errorf("Expected admin_user_added and policy_disabled events, got %v", types)
+	}
+	if retries := testutil.ToFloat64(engine.webhookRequestsTotal.WithLabelValues("retry")); retries != 1 {
+		t.Errorf("Expected 1 retry, got %v", retries)
+	}
+
+	// The Slack webhook got Slack messages
+	for _, payload := range slack.received() {
+		var message map[string]string
+		if err := json.Unmarshal([]byte(payload), &message); err != nil {
+			t.Fatalf("Failed to decode Slack message %s: %v", payload, err)
+		}
+		if !strings.Contains(message["text"], ":warning:") {
+			t.Errorf("Expected a Slack message with the severity emoji, got %q", message["text"])
+		}
+	}
+	if len(slack.received()) != 2 {
+		t.Errorf("Expected 2 Slack messages, got %v", slack.received())
+	}
+
+	if fired := testutil.ToFloat64(engine.eventsTotal.WithLabelValues(EventPolicyDisabled)); fired != 1 {
+		t.Errorf("Expected 1 policy_disabled event, got %v", fired)
+	}
+}
+
+func TestEngine_Dedup(t *testing.T) {
+	netbird := &testAPI{}
+	netbird.setState(State{
+		SetupKeys: []api.SetupKey{{Id: "key1", Name: "ci", Valid: true, Expires: time.Now().Add(24 * time.Hour)}},
+	})
+	apiServer := httptest.NewServer(netbird)
+	defer apiServer.Close()
+
+	receiver := &webhookReceiver{}
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+
+	engine := newTestEngine(t, apiServer.URL, Webhook{URL: receiverServer.URL})
+	ctx := context.Background()
+
+	// The expiring setup key is reported once, not on every check
+	for i := 0; i < 3; i++ {
+		if err := engine.Check(ctx); err != nil {
+			t.Fatalf("Failed to check: %v", err)
+		}
+	}
+	if len(receiver.received()) != 1 {
+		t.Errorf("Expected the expiring setup key to be reported once, got %v", receiver.received())
+	}
+	if deduplicated := testutil.ToFloat64(engine.eventsDeduplicated.WithLabelValues(EventSetupKeyExpiring)); deduplicated != 2 {
+		t.Errorf("Expected 2 deduplicated events, got %v", deduplicated)
+	}
+
+	// Once the dedup window passed, the event fires again
+	engine.process(ctx, Diff(nil, &netbird.state, time.Now(), defaultExpiryWarning), time.Now().Add(defaultDedupWindow))
+	if len(receiver.received()) != 2 {
+		t.Errorf("Expected the event to fire again after the dedup window, got %v", receiver.received())
+	}
+}
+
+func TestEngine_RetryUndelivered(t *testing.T) {
+	receiver := &webhookReceiver{failures: 1}
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+
+	engine, err := newEngine(nbclient.New("http://localhost", "test-token"), Config{
+		Webhooks:   []Webhook{{URL: receiverServer.URL}},
+		MaxRetries: -1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	ctx := context.Background()
+	now := time.Now()
+	blocked := Event{Key: "user_blocked/user1", Type: EventUserBlocked, Summary: "User was blocked", Time: now}
+
+	// The webhook is down, the event is kept for the next check
+	engine.process(ctx, []Event{blocked}, now)
+	if len(receiver.received()) != 0 || len(engine.pending) != 1 {
+		t.Fatalf("Expected the event to be pending, got %v", receiver.received())
+	}
+	if fired := testutil.ToFloat64(engine.eventsTotal.WithLabelValues(EventUserBlocked)); fired != 0 {
+		t.Errorf("Expected no event fired, got %v", fired)
+	}
+
+	// The next check delivers it even though the diff no longer has it
+	engine.process(ctx, nil, now.Add(defaultInterval))
+	if len(receiver.received()) != 1 || len(engine.pending) != 0 {
+		t.Errorf("Expected the pending event to be delivered, got %v", receiver.received())
+	}
+	if fired := testutil.ToFloat64(engine.eventsTotal.WithLabelValues(EventUserBlocked)); fired != 1 {
+		t.Errorf("Expected the event fired once, got %v", fired)
+	}
+
+	// Pending events are dropped once older than the dedup window
+	receiver.mu.Lock()
+	receiver.failures = 1
+	receiver.mu.Unlock()
+	engine.process(ctx, []Event{{Key: "user_blocked/user2", Type: EventUserBlocked, Time: now}}, now)
+	engine.process(ctx, nil, now.Add(defaultDedupWindow))
+	if len(receiver.received()) != 1 || len(engine.pending) != 0 {
+		t.Errorf("Expected the stale event to be dropped, got %v", receiver.received())
+	}
+}
+
+func TestEngine_CustomTemplateAndTriggers(t *testing.T) {
+	receiver := &webhookReceiver{}
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+
+	engine, err := newEngine(nbclient.New("http://localhost", "test-token"), Config{
+		Webhooks: []Webhook{{URL: receiverServer.URL, Template: `{"message":{{json .Summary}},"severity":"{{.Severity}}"}`}},
+		Triggers: []string{EventPolicyDisabled},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	engine.process(context.Background(), []Event{
+		{Key: "policy_disabled/policy1", Type: EventPolicyDisabled, Severity: SeverityWarning, Summary: `Policy "ssh" was disabled`},
+		{Key: "user_blocked/user1", Type: EventUserBlocked, Severity: SeverityWarning, Summary: "User was blocked"},
+	}, time.Now())
+
+	payloads := receiver.received()
+	if len(payloads) != 1 {
+		t.Fatalf("Expected only the enabled trigger to fire, got %v", payloads)
+	}
+	if payloads[0] != `{"message":"Policy \"ssh\" was disabled","severity":"warning"}` {
+		t.Errorf("Expected the custom template payload, got %s", payloads[0])
+	}
+}
+
+func TestNewEngine_InvalidConfig(t *testing.T) {
+	client := nbclient.New("http://localhost", "test-token")
+	tests := map[string]Config{
+		"no webhooks":     {},
+		"unknown trigger": {Webhooks: []Webhook{{URL: "http://localhost"}}, Triggers: []string{"peer_sneezed"}},
+		"unknown format":  {Webhooks: []Webhook{{URL: "http://localhost", Format: "teams"}}},
+		"bad template":    {Webhooks: []Webhook{{URL: "http://localhost", Template: "{{.Summary"}}},
+	}
+	for name, config := range tests {
+		if _, err := NewEngine(client, config); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/netbirdio/netbird/management/server/http/api"
+)
+
+// Event types fired by the engine
+const (
+	EventAdminUserAdded     = "admin_user_added"
+	EventPeerApproved       = "peer_approved"
+	EventUserBlocked        = "user_blocked"
+	EventPolicyDisabled     = "policy_disabled"
+	EventSetupKeyExpiring   = "setup_key_expiring"
+	EventNetworkRoutersLost = "network_routers_lost"
+)
+
+// EventTypes lists every event type
+var EventTypes = []string{
+	EventAdminUserAdded,
+	EventPeerApproved,
+	EventUserBlocked,
+	EventPolicyDisabled,
+	EventSetupKeyExpiring,
+	EventNetworkRoutersLost,
+}
+
+// Event severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Event is a significant change between two states of the account
+type Event struct {
+	// Key identifies the event for deduplication
+	Key      string            `json:"key"`
+	Type     string            `json:"type"`
+	Severity string            `json:"severity"`
+	Summary  string            `json:"summary"`
+	Kind     string            `json:"kind"`
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Details  map[string]string `json:"details,omitempty"`
+	Time     time.Time         `json:"time"`
+}
+
+// State holds the objects of the account compared between two checks
+type State struct {
+	Peers     []api.Peer
+	Users     []api.User
+	Policies  []api.Policy
+	SetupKeys []api.SetupKey
+	Networks  []api.Network
+
+	// Routers holds the routers of each network by network ID
+	Routers map[string][]api.NetworkRouter
+}
+
+// FetchState fetches the objects compared by the engine. Any failure fails the
+// whole fetch, so that missing objects are never mistaken for deleted ones.
+func FetchState(ctx context.Context, client *nbclient.Client) (*State, error) {
+	state := &State{}
+	var err error
+
+	if state.Peers, err = client.Peers.List(ctx); err != nil {
+		return nil, fmt.Errorf("fetch peers: %w", err)
+	}
+	if state.Users, err = client.Users.List(ctx); err != nil {
+		return nil, fmt.Errorf("fetch users: %w", err)
+	}
+	if state.Policies, err = client.Policies.List(ctx); err != nil {
+		return nil, fmt.Errorf("fetch policies: %w", err)
+	}
+	if state.SetupKeys, err = client.SetupKeys.List(ctx); err != nil {
+		return nil, fmt.Errorf("fetch setup keys: %w", err)
+	}
+	if state.Networks, err = client.Networks.List(ctx); err != nil {
+		return nil, fmt.Errorf("fetch networks: %w", err)
+	}
+	state.Routers = make(map[string][]api.NetworkRouter, len(state.Networks))
+	for _, network := range state.Networks {
+		routers, err := client.Networks.Routers(network.Id).List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("fetch routers of network %s: %w", network.Id, err)
+		}
+		state.Routers[network.Id] = routers
+	}
+	return state, nil
+}
+
+// onlineRouters returns the number of enabled routers of a network with at
+// least one connected routing peer, either its peer or a member of its peer
+// groups
+func (s *State) onlineRouters(networkID string) int {
+	online := 0
+	for _, router := range s.Routers[networkID] {
+		if !router.Enabled {
+			continue
+		}
+		for _, peer := range s.Peers {
+			if peer.Connected && routedBy(router, peer) {
+				online++
+				break
+			}
+		}
+	}
+	return online
+}
+
+// routedBy reports whether a peer is a routing peer of a router
+func routedBy(router api.NetworkRouter, peer api.Peer) bool {
+	if router.Peer != nil && *router.Peer == peer.Id {
+		return true
+	}
+	if router.PeerGroups == nil {
+		return false
+	}
+	for _, groupID := range *router.PeerGroups {
+		for _, group := range peer.Groups {
+			if group.Id == groupID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isAdmin reports whether a role has administrative rights
+func isAdmin(role string) bool {
+	return role == "admin" || role == "owner"
+}
+
+// Diff returns the events between the previous and the current state. Without a
+// previous state only the events derived from the current state alone (expiring
+// setup keys) are returned.
+func Diff(previous, current *State, now time.Time, expiryWarning time.Duration) []Event {
+	var events []Event
+
+	// Setup keys about to expire, fired again when the expiry changes
+	for _, key := range current.SetupKeys {
+		if !key.Valid || key.Revoked || key.Expires.IsZero() {
+			continue
+		}
+		left := key.Expires.Sub(now)
+		if left <= 0 || left > expiryWarning {
+			continue
+		}
+		events = append(events, Event{
+			Key:      fmt.Sprintf("%s/%s/%d", EventSetupKeyExpiring, key.Id, key.Expires.Unix()),
+			Type:     EventSetupKeyExpiring,
+			Severity: SeverityWarning,
+			Summary:  fmt.Sprintf("Setup key %s expires in %s", key.Name, left.Round(time.Hour)),
+			Kind:     "setup_key",
+			ID:       key.Id,
+			Name:     key.Name,
+			Details: map[string]string{
+				"expires": key.Expires.UTC().Format(time.RFC3339),
+				"type":    key.Type,
+			},
+		})
+	}
+
+	if previous == nil {
+		return stamp(events, now)
+	}
+
+	// Users who became admin, either new or promoted
+	previousUsers := make(map[string]api.User, len(previous.Users))
+	for _, user := range previous.Users {
+		previousUsers[user.Id] = user
+	}
+	for _, user := range current.Users {
+		before, existed := previousUsers[user.Id]
+		if isAdmin(user.Role) && (!existed || !isAdmin(before.Role)) {
+			summary := fmt.Sprintf("New %s user %s", user.Role, userName(user))
+			if existed {
+				summary = fmt.Sprintf("User %s promoted from %s to %s", userName(user), before.Role, user.Role)
+			}
+			events = append(events, Event{
+				Key:      EventAdminUserAdded + "/" + user.Id,
+				Type:     EventAdminUserAdded,
+				Severity: SeverityWarning,
+				Summary:  summary,
+				Kind:     "user",
+				ID:       user.Id,
+				Name:     userName(user),
+				Details: map[string]string{
+					"email":         user.Email,
+					"role":          user.Role,
+					"previous_role": before.Role,
+				},
+			})
+		}
+		if existed && user.IsBlocked && !before.IsBlocked {
+			events = append(events, Event{
+				Key:      EventUserBlocked + "/" + user.Id,
+				Type:     EventUserBlocked,
+				Severity: SeverityWarning,
+				Summary:  fmt.Sprintf("User %s was blocked", userName(user)),
+				Kind:     "user",
+				ID:       user.Id,
+				Name:     userName(user),
+				Details: map[string]string{
+					"email": user.Email,
+					"role":  user.Role,
+				},
+			})
+		}
+	}
+
+	// Peers no longer waiting for approval
+	previousPeers := make(map[string]api.Peer, len(previous.Peers))
+	for _, peer := range previous.Peers {
+		previousPeers[peer.Id] = peer
+	}
+	for _, peer := range current.Peers {
+		before, existed := previousPeers[peer.Id]
+		if existed && before.ApprovalRequired && !peer.ApprovalRequired {
+			events = append(events, Event{
+				Key:      EventPeerApproved + "/" + peer.Id,
+				Type:     EventPeerApproved,
+				Severity: SeverityInfo,
+				Summary:  fmt.Sprintf("Peer %s was approved", peer.Name),
+				Kind:     "peer",
+				ID:       peer.Id,
+				Name:     peer.Name,
+				Details: map[string]string{
+					"ip":      peer.Ip,
+					"os":      peer.Os,
+					"user_id": peer.UserId,
+				},
+			})
+		}
+	}
+
+	// Policies switched off
+	previousPolicies := make(map[string]api.Policy, len(previous.Policies))
+	for _, policy := range previous.Policies {
+		if policy.Id != nil {
+			previousPolicies[*policy.Id] = policy
+		}
+	}
+	for _, policy := range current.Policies {
+		if policy.Id == nil {
+			continue
+		}
+		before, existed := previousPolicies[*policy.Id]
+		if existed && before.Enabled && !policy.Enabled {
+			events = append(events, Event{
+				Key:      EventPolicyDisabled + "/" + *policy.Id,
+				Type:     EventPolicyDisabled,
+				Severity: SeverityWarning,
+				Summary:  fmt.Sprintf("Policy %s was disabled", policy.Name),
+				Kind:     "policy",
+				ID:       *policy.Id,
+				Name:     policy.Name,
+				Details: map[string]string{
+					"rules": strconv.Itoa(len(policy.Rules)),
+				},
+			})
+		}
+	}
+
+	// Networks left without any online router
+	previousNetworks := make(map[string]bool, len(previous.Networks))
+	for _, network := range previous.Networks {
+		previousNetworks[network.Id] = true
+	}
+	for _, network := range current.Networks {
+		if !previousNetworks[network.Id] {
+			continue
+		}
+		before := previous.onlineRouters(network.Id)
+		if before == 0 || current.onlineRouters(network.Id) > 0 {
+			continue
+		}
+		events = append(events, Event{
+			Key:      EventNetworkRoutersLost + "/" + network.Id,
+			Type:     EventNetworkRoutersLost,
+			Severity: SeverityCritical,
+			Summary:  fmt.Sprintf("Network %s lost all of its %d online routers", network.Name, before),
+			Kind:     "network",
+			ID:       network.Id,
+			Name:     network.Name,
+			Details: map[string]string{
+				"previous_online_routers": strconv.Itoa(before),
+				"routers":                 strconv.Itoa(len(current.Routers[network.Id])),
+				"resources":               strconv.Itoa(len(network.Resources)),
+			},
+		})
+	}
+
+	return stamp(events, now)
+}
+
+// stamp sets the time of the events
+func stamp(events []Event, now time.Time) []Event {
+	for i := range events {
+		events[i].Time = now.UTC()
+	}
+	return events
+}
+
+// userName returns the email of a user, or the name of service users
+func userName(user api.User) string {
+	if user.Email != "" {
+		return user.Email
+	}
+	return user.Name
+}
@@ -0,0 +1,186 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// eventsByType indexes events by type, failing on duplicates
+func eventsByType(t *testing.T, events []Event) map[string]Event {
+	t.Helper()
+	byType := make(map[string]Event)
+	for _, event := range events {
+		if _, ok := byType[event.Type]; ok {
+			t.Errorf("Expected a single %s event, got %+v", event.Type, events)
+		}
+		byType[event.Type] = event
+	}
+	return byType
+}
+
+func TestDiff(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	previous := &State{
+		Peers: []api.Peer{
+			{Id: "peer1", Name: "laptop", ApprovalRequired: true},
+			{Id: "peer2", Name: "server", ApprovalRequired: true},
+			{Id: "router1", Name: "office-gw1", Connected: true},
+			{Id: "router2", Name: "office-gw2", Connected: true, Groups: []api.GroupMinimum{{Id: "gateways"}}},
+			{Id: "router3", Name: "lab-gw", Connected: true},
+		},
+		Users: []api.User{
+			{Id: "user1", Email: "alice@example.com", Role: "user"},
+			{Id: "user2", Email: "bob@example.com", Role: "user"},
+			{Id: "user3", Email: "carol@example.com", Role: "admin"},
+		},
+		Policies: []api.Policy{
+			{Id: stringPtr("policy1"), Name: "ssh", Enabled: true},
+			{Id: stringPtr("policy2"), Name: "web", Enabled: true},
+		},
+		Networks: []api.Network{
+			{Id: "net1", Name: "office", Routers: []string{"nr1", "nr2"}},
+			{Id: "net2", Name: "lab", Routers: []string{"nr3"}},
+		},
+		Routers: map[string][]api.NetworkRouter{
+			"net1": {
+				{Id: "nr1", Peer: stringPtr("router1"), Enabled: true},
+				{Id: "nr2", PeerGroups: &[]string{"gateways"}, Enabled: true},
+			},
+			"net2": {{Id: "nr3", Peer: stringPtr("router3"), Enabled: true}},
+		},
+	}
+	current := &State{
+		Peers: []api.Peer{
+			{Id: "peer1", Name: "laptop", ApprovalRequired: false},
+			{Id: "peer2", Name: "server", ApprovalRequired: true},
+			{Id: "router1", Name: "office-gw1", Connected: false},
+			{Id: "router2", Name: "office-gw2", Connected: false, Groups: []api.GroupMinimum{{Id: "gateways"}}},
+			{Id: "router3", Name: "lab-gw", Connected: true},
+		},
+		Users: []api.User{
+			{Id: "user1", Email: "alice@example.com", Role: "admin"},
+			{Id: "user2", Email: "bob@example.com", Role: "user", IsBlocked: true},
+			{Id: "user3", Email: "carol@example.com", Role: "admin"},
+		},
+		Policies: []api.Policy{
+			{Id: stringPtr("policy1"), Name: "ssh", Enabled: false},
+			{Id: stringPtr("policy2"), Name: "web", Enabled: true},
+		},
+		SetupKeys: []api.SetupKey{
+			{Id: "key1", Name: "ci", Valid: true, Expires: now.Add(3 * 24 * time.Hour)},
+			{Id: "key2", Name: "later", Valid: true, Expires: now.Add(30 * 24 * time.Hour)},
+			{Id: "key3", Name: "revoked", Valid: true, Revoked: true, Expires: now.Add(time.Hour)},
+			{Id: "key4", Name: "expired", Valid: false, Expires: now.Add(-time.Hour)},
+		},
+		// The routers of the office network are still configured but offline
+		Networks: []api.Network{
+			{Id: "net1", Name: "office", Routers: []string{"nr1", "nr2"}},
+			{Id: "net2", Name: "lab", Routers: []string{"nr3"}},
+		},
+		Routers: map[string][]api.NetworkRouter{
+			"net1": {
+				{Id: "nr1", Peer: stringPtr("router1"), Enabled: true},
+				{Id: "nr2", PeerGroups: &[]string{"gateways"}, Enabled: true},
+			},
+			"net2": {{Id: "nr3", Peer: stringPtr("router3"), Enabled: true}},
+		},
+	}
+
+	events := eventsByType(t, Diff(previous, current, now, 7*24*time.Hour))
+	expected := map[string]string{
+		EventAdminUserAdded:     "user1",
+		EventUserBlocked:        "user2",
+		EventPeerApproved:       "peer1",
+		EventPolicyDisabled:     "policy1",
+		EventSetupKeyExpiring:   "key1",
+		EventNetworkRoutersLost: "net1",
+	}
+	if len(events) != len(expected) {
+		t.Errorf("Expected %d events, got %+v", len(expected), events)
+	}
+	for eventType, id := range expected {
+		event, ok := events[eventType]
+		if !ok {
+			t.Errorf("Expected %s event", eventType)
+			continue
+		}
+		if event.ID != id {
+			t.Errorf("Expected %s event for %s, got %s", eventType, id, event.ID)
+		}
+		if !event.Time.Equal(now) {
+			t.Errorf("Expected %s event at %v, got %v", eventType, now, event.Time)
+		}
+	}
+
+	if events[EventAdminUserAdded].Details["previous_role"] != "user" {
+		t.Errorf("Expected previous role in details, got %v", events[EventAdminUserAdded].Details)
+	}
+	if events[EventNetworkRoutersLost].Severity != SeverityCritical {
+		t.Errorf("Expected critical severity for lost routers, got %s", events[EventNetworkRoutersLost].Severity)
+	}
+	if events[EventNetworkRoutersLost].Details["previous_online_routers"] != "2" {
+		t.Errorf("Expected 2 previous online routers in details, got %v", events[EventNetworkRoutersLost].Details)
+	}
+}
+
+func TestDiff_NetworkRoutersLost(t *testing.T) {
+	now := time.Now()
+	state := func(connected, enabled bool) *State {
+		return &State{
+			Peers:    []api.Peer{{Id: "router1", Connected: connected}},
+			Networks: []api.Network{{Id: "net1", Name: "office", Routers: []string{"nr1"}}},
+			Routers: map[string][]api.NetworkRouter{
+				"net1": {{Id: "nr1", Peer: stringPtr("router1"), Enabled: enabled}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name              string
+		previous, current *State
+		fired             bool
+	}{
+		{"router went offline", state(true, true), state(false, true), true},
+		{"router disabled", state(true, true), state(true, false), true},
+		{"router removed", state(true, true), &State{Networks: state(true, true).Networks}, true},
+		{"router still online", state(true, true), state(true, true), false},
+		{"router already offline", state(false, true), state(false, true), false},
+		{"router came back", state(false, true), state(true, true), false},
+		{"network deleted", state(true, true), &State{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := Diff(tt.previous, tt.current, now, time.Hour)
+			if fired := len(events) == 1 && events[0].Type == EventNetworkRoutersLost; fired != tt.fired || len(events) > 1 {
+				t.Errorf("Expected network_routers_lost fired=%v, got %+v", tt.fired, events)
+			}
+		})
+	}
+}
+
+func TestDiff_Baseline(t *testing.T) {
+	now := time.Now()
+	current := &State{
+		Users:     []api.User{{Id: "user1", Role: "owner"}},
+		SetupKeys: []api.SetupKey{{Id: "key1", Name: "ci", Valid: true, Expires: now.Add(time.Hour)}},
+	}
+
+	// Without a previous state only expiring setup keys are reported
+	events := Diff(nil, current, now, 7*24*time.Hour)
+	if len(events) != 1 || events[0].Type != EventSetupKeyExpiring {
+		t.Errorf("Expected only the setup key event, got %+v", events)
+	}
+
+	// New admin users are reported once a previous state exists
+	events = Diff(&State{}, current, now, 7*24*time.Hour)
+	byType := eventsByType(t, events)
+	if _, ok := byType[EventAdminUserAdded]; !ok {
+		t.Errorf("Expected admin_user_added for a new owner, got %+v", events)
+	}
+}
@@ -0,0 +1,122 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+)
+
+// Webhook payload formats
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+)
+
+// slackTemplate renders an event as a Slack incoming webhook message
+const slackTemplate = `{"text":{{json (printf "%s *%s*\n%s %s (%s)" (emoji .Severity) .Summary .Kind .Name .ID)}}}`
+
+// Webhook is an HTTP endpoint notified of every event
+type Webhook struct {
+	// URL the events are posted to
+	URL string
+
+	// Format is FormatJSON (the event as a JSON object) or FormatSlack.
+	// Defaults to FormatJSON.
+	Format string
+
+	// Template replaces the payload of the format. It is a Go text/template
+	// executed with the Event; the json function encodes a value as JSON.
+	Template string
+}
+
+// webhookTarget is a webhook with its parsed payload template
+type webhookTarget struct {
+	url      string
+	template *template.Template
+}
+
+// errNonRetryable marks webhook responses that will fail again when retried
+var errNonRetryable = errors.New("non-retryable webhook response")
+
+var templateFuncs = template.FuncMap{
+	"json": func(value any) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"emoji": func(severity string) string {
+		switch severity {
+		case SeverityCritical:
+			return ":rotating_light:"
+		case SeverityWarning:
+			return ":warning:"
+		default:
+			return ":information_source:"
+		}
+	},
+}
+
+// newWebhookTarget parses the payload template of a webhook
+func newWebhookTarget(webhook Webhook) (*webhookTarget, error) {
+	if webhook.URL == "" {
+		return nil, fmt.Errorf("webhook URL is required")
+	}
+
+	text := webhook.Template
+	if text == "" {
+		switch webhook.Format {
+		case "", FormatJSON:
+			text = "{{json .}}"
+		case FormatSlack:
+			text = slackTemplate
+		default:
+			return nil, fmt.Errorf("unsupported webhook format %q, expected %q or %q", webhook.Format, FormatJSON, FormatSlack)
+		}
+	}
+
+	tmpl, err := template.New(webhook.URL).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse webhook template: %w", err)
+	}
+	return &webhookTarget{url: webhook.URL, template: tmpl}, nil
+}
+
+// payload renders the body of an event
+func (t *webhookTarget) payload(event Event) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.template.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("render webhook payload: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// send posts a payload to the webhook
+func (t *webhookTarget) send(ctx context.Context, client *http.Client, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNonRetryable, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "netbird-api-exporter")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	// Server errors and rate limiting are worth retrying, other client errors are not
+	if resp.StatusCode/100 != 5 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %v", errNonRetryable, err)
+	}
+	return err
+}
@@ -11,25 +11,57 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// DNSConfig holds optional settings for the DNS exporter
+type DNSConfig struct {
+	// ProbeEnabled sends a test query from the exporter to every nameserver of
+	// the enabled nameserver groups on each scrape.
+	ProbeEnabled bool
+
+	// ProbeQueryName is queried for nameserver groups without match domains.
+	// Defaults to netbird.io.
+	ProbeQueryName string
+
+	// ProbeTimeout bounds each test query. Defaults to 2 seconds.
+	ProbeTimeout time.Duration
+}
+
 // DNSExporter handles DNS-specific metrics collection
 type DNSExporter struct {
 	client *nbclient.Client
+	config DNSConfig
+	store  *Store
+	prober *dnsProber
 
 	// Prometheus metrics
-	nameserverGroupsTotal   *prometheus.GaugeVec
-	nameserverGroupsEnabled *prometheus.GaugeVec
-	nameserverGroupsPrimary *prometheus.GaugeVec
-	nameserverGroupDomains  *prometheus.GaugeVec
-	nameserversTotal        *prometheus.GaugeVec
-	nameserversByType       *prometheus.GaugeVec
-	nameserversByPort       *prometheus.GaugeVec
-	dnsManagementDisabled   *prometheus.GaugeVec
+	nameserverGroupsTotal       *prometheus.GaugeVec
+	nameserverGroupsEnabled     *prometheus.GaugeVec
+	nameserverGroupsPrimary     *prometheus.GaugeVec
+	nameserverGroupDomains      *prometheus.GaugeVec
+	nameserversTotal            *prometheus.GaugeVec
+	nameserversByType           *prometheus.GaugeVec
+	nameserversByPort           *prometheus.GaugeVec
+	dnsManagementDisabled       *prometheus.GaugeVec
+	nameserverGroupInfo         *prometheus.GaugeVec
+	nameserverGroupDistribution *prometheus.GaugeVec
+	nameserverInfo              *prometheus.GaugeVec
+	probeSuccess                *prometheus.GaugeVec
+	probeRcode                  *prometheus.GaugeVec
+	probeDuration               *prometheus.GaugeVec
+	scrapeErrorsTotal           *prometheus.CounterVec
+	scrapeDuration              *prometheus.HistogramVec
 }
 
 // NewDNSExporter creates a new DNS exporter
 func NewDNSExporter(client *nbclient.Client) *DNSExporter {
+	return NewDNSExporterWithConfig(client, DNSConfig{})
+}
+
+// NewDNSExporterWithConfig creates a new DNS exporter with the given settings
+func NewDNSExporterWithConfig(client *nbclient.Client, config DNSConfig) *DNSExporter {
 	return &DNSExporter{
 		client: client,
+		config: config,
+		prober: newDNSProber(config),
 
 		nameserverGroupsTotal: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
@@ -94,6 +126,70 @@ func NewDNSExporter(client *nbclient.Client) *DNSExporter {
 			},
 			[]string{},
 		),
+
+		nameserverGroupInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_dns_nameserver_group_info",
+				Help: "Information about NetBird nameserver groups (always 1)",
+			},
+			[]string{"group_id", "group_name", "enabled", "primary", "search_domains_enabled"},
+		),
+
+		nameserverGroupDistribution: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_dns_nameserver_group_distribution_groups",
+				Help: "Number of peer groups each nameserver group is distributed to",
+			},
+			[]string{"group_id", "group_name"},
+		),
+
+		nameserverInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_dns_nameserver_info",
+				Help: "Information about each nameserver of NetBird nameserver groups (always 1)",
+			},
+			[]string{"group_id", "group_name", "ip", "ns_type", "port"},
+		),
+
+		probeSuccess: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_dns_probe_success",
+				Help: "Whether the last test query to each nameserver got an answer (1 for yes, 0 for no)",
+			},
+			[]string{"group_id", "group_name", "ip", "ns_type", "port", "query"},
+		),
+
+		probeRcode: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_dns_probe_rcode",
+				Help: "DNS response code of the last test query to each nameserver (-1 when there was no response)",
+			},
+			[]string{"group_id", "group_name", "ip", "ns_type", "port", "query"},
+		),
+
+		probeDuration: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_dns_probe_duration_seconds",
+				Help: "Round-trip time of the last answered test query to each nameserver",
+			},
+			[]string{"group_id", "group_name", "ip", "ns_type", "port", "query"},
+		),
+
+		scrapeErrorsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_dns_scrape_errors_total",
+				Help: "Total number of errors encountered while scraping DNS",
+			},
+			[]string{"error_type"},
+		),
+
+		scrapeDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "netbird_dns_scrape_duration_seconds",
+				Help: "Time spent scraping DNS from the NetBird API",
+			},
+			[]string{},
+		),
 	}
 }
 
@@ -107,10 +203,21 @@ func (e *DNSExporter) Describe(ch chan<- *prometheus.Desc) {
 	e.nameserversByType.Describe(ch)
 	e.nameserversByPort.Describe(ch)
 	e.dnsManagementDisabled.Describe(ch)
+	e.nameserverGroupInfo.Describe(ch)
+	e.nameserverGroupDistribution.Describe(ch)
+	e.nameserverInfo.Describe(ch)
+	e.probeSuccess.Describe(ch)
+	e.probeRcode.Describe(ch)
+	e.probeDuration.Describe(ch)
+	e.scrapeErrorsTotal.Describe(ch)
+	e.scrapeDuration.Describe(ch)
 }
 
 // Collect implements prometheus.Collector
 func (e *DNSExporter) Collect(ch chan<- prometheus.Metric) {
+	timer := prometheus.NewTimer(e.scrapeDuration.WithLabelValues())
+	defer timer.ObserveDuration()
+
 	// Reset metrics before collecting new values
 	e.nameserverGroupsTotal.Reset()
 	e.nameserverGroupsEnabled.Reset()
@@ -120,6 +227,12 @@ func (e *DNSExporter) Collect(ch chan<- prometheus.Metric) {
 	e.nameserversByType.Reset()
 	e.nameserversByPort.Reset()
 	e.dnsManagementDisabled.Reset()
+	e.nameserverGroupInfo.Reset()
+	e.nameserverGroupDistribution.Reset()
+	e.nameserverInfo.Reset()
+	e.probeSuccess.Reset()
+	e.probeRcode.Reset()
+	e.probeDuration.Reset()
 
 	ctx, cancelNS := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancelNS()
@@ -127,8 +240,13 @@ func (e *DNSExporter) Collect(ch chan<- prometheus.Metric) {
 	nameserverGroups, err := e.client.DNS.ListNameserverGroups(ctx)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to fetch nameserver groups")
+		e.scrapeErrorsTotal.WithLabelValues("fetch_nameserver_groups").Inc()
 	} else {
+		e.store.SetNameserverGroups(nameserverGroups)
 		e.updateNameserverMetrics(nameserverGroups)
+		if e.config.ProbeEnabled {
+			e.updateProbeMetrics(e.prober.probeGroups(ctx, nameserverGroups))
+		}
 	}
 
 	ctx, cancelSettings := context.WithTimeout(context.Background(), 30*time.Second)
@@ -138,6 +256,7 @@ func (e *DNSExporter) Collect(ch chan<- prometheus.Metric) {
 	dnsSettings, err := e.client.DNS.GetSettings(ctx)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to fetch DNS settings")
+		e.scrapeErrorsTotal.WithLabelValues("fetch_dns_settings").Inc()
 	} else {
 		e.updateDNSSettingsMetrics(dnsSettings)
 	}
@@ -151,6 +270,14 @@ func (e *DNSExporter) Collect(ch chan<- prometheus.Metric) {
 	e.nameserversByType.Collect(ch)
 	e.nameserversByPort.Collect(ch)
 	e.dnsManagementDisabled.Collect(ch)
+	e.nameserverGroupInfo.Collect(ch)
+	e.nameserverGroupDistribution.Collect(ch)
+	e.nameserverInfo.Collect(ch)
+	e.probeSuccess.Collect(ch)
+	e.probeRcode.Collect(ch)
+	e.probeDuration.Collect(ch)
+	e.scrapeErrorsTotal.Collect(ch)
+	e.scrapeDuration.Collect(ch)
 }
 
 // updateNameserverMetrics updates Prometheus metrics based on nameserver group data
@@ -178,10 +305,18 @@ func (e *DNSExporter) updateNameserverMetrics(nameserverGroups []api.NameserverG
 		// Count nameservers per group
 		e.nameserversTotal.WithLabelValues(group.Id, group.Name).Set(float64(len(group.Nameservers)))
 
+		// Group settings and distribution
+		e.nameserverGroupInfo.WithLabelValues(
+			group.Id, group.Name, strconv.FormatBool(group.Enabled),
+			strconv.FormatBool(group.Primary), strconv.FormatBool(group.SearchDomainsEnabled),
+		).Set(1)
+		e.nameserverGroupDistribution.WithLabelValues(group.Id, group.Name).Set(float64(len(group.Groups)))
+
 		// Count nameserver types and ports
 		for _, ns := range group.Nameservers {
 			typeCounter[string(ns.NsType)]++
 			portCounter[strconv.Itoa(ns.Port)]++
+			e.nameserverInfo.WithLabelValues(group.Id, group.Name, ns.Ip, string(ns.NsType), strconv.Itoa(ns.Port)).Set(1)
 		}
 	}
 
@@ -221,3 +356,31 @@ func (e *DNSExporter) updateDNSSettingsMetrics(dnsSettings *api.DNSSettings) {
 
 	logrus.WithField("disabled_management_groups", disabledCount).Debug("Updated DNS settings metrics")
 }
+
+// updateProbeMetrics updates Prometheus metrics based on nameserver probe results
+func (e *DNSExporter) updateProbeMetrics(results []dnsProbeResult) {
+	failed := 0
+	for _, result := range results {
+		labels := []string{
+			result.group.Id, result.group.Name, result.server.Ip,
+			string(result.server.NsType), strconv.Itoa(result.server.Port), result.query,
+		}
+
+		success := 0.0
+		if result.success {
+			success = 1
+		} else {
+			failed++
+		}
+		e.probeSuccess.WithLabelValues(labels...).Set(success)
+		e.probeRcode.WithLabelValues(labels...).Set(float64(result.rcode))
+		if result.rcode >= 0 {
+			e.probeDuration.WithLabelValues(labels...).Set(result.duration.Seconds())
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"probed_nameservers": len(results),
+		"failed_nameservers": failed,
+	}).Debug("Updated nameserver probe metrics")
+}
@@ -0,0 +1,134 @@
+package exporters
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/sirupsen/logrus"
+)
+
+// Defaults for the active nameserver prober
+const (
+	defaultDNSProbeQueryName   = "netbird.io"
+	defaultDNSProbeTimeout     = 2 * time.Second
+	defaultDNSProbeConcurrency = 8
+)
+
+// dnsProbeResult is the outcome of a single test query against a nameserver
+type dnsProbeResult struct {
+	group    api.NameserverGroup
+	server   api.Nameserver
+	query    string
+	success  bool
+	rcode    int
+	duration time.Duration
+}
+
+// dnsProber sends test queries from the exporter to configured nameservers
+type dnsProber struct {
+	queryName   string
+	timeout     time.Duration
+	concurrency int
+}
+
+func newDNSProber(config DNSConfig) *dnsProber {
+	prober := &dnsProber{
+		queryName:   config.ProbeQueryName,
+		timeout:     config.ProbeTimeout,
+		concurrency: defaultDNSProbeConcurrency,
+	}
+	if prober.queryName == "" {
+		prober.queryName = defaultDNSProbeQueryName
+	}
+	if prober.timeout <= 0 {
+		prober.timeout = defaultDNSProbeTimeout
+	}
+	return prober
+}
+
+// queryNameFor returns the name to query for a nameserver group, the first
+// match domain when the group has any, the configured test name otherwise
+func (p *dnsProber) queryNameFor(group api.NameserverGroup) string {
+	for _, domain := range group.Domains {
+		if domain = strings.TrimPrefix(strings.TrimSpace(domain), "*."); domain != "" {
+			return dns.Fqdn(domain)
+		}
+	}
+	return dns.Fqdn(p.queryName)
+}
+
+// probeGroups probes every nameserver of the enabled groups concurrently
+func (p *dnsProber) probeGroups(ctx context.Context, groups []api.NameserverGroup) []dnsProbeResult {
+	type target struct {
+		group  api.NameserverGroup
+		server api.Nameserver
+	}
+	targets := make([]target, 0)
+	for _, group := range groups {
+		if !group.Enabled {
+			continue
+		}
+		for _, server := range group.Nameservers {
+			targets = append(targets, target{group: group, server: server})
+		}
+	}
+
+	results := make([]dnsProbeResult, len(targets))
+	sem := make(chan struct{}, p.concurrency)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t target) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = p.probe(ctx, t.group, t.server)
+		}(i, t)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// probe sends a single A query to a nameserver over its configured transport
+func (p *dnsProber) probe(ctx context.Context, group api.NameserverGroup, server api.Nameserver) dnsProbeResult {
+	result := dnsProbeResult{
+		group:  group,
+		server: server,
+		query:  p.queryNameFor(group),
+		rcode:  -1,
+	}
+
+	network := "udp"
+	if strings.EqualFold(string(server.NsType), "tcp") {
+		network = "tcp"
+	}
+	client := &dns.Client{Net: network, Timeout: p.timeout}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(result.query, dns.TypeA)
+
+	address := net.JoinHostPort(server.Ip, strconv.Itoa(server.Port))
+	response, rtt, err := client.ExchangeContext(ctx, msg, address)
+	result.duration = rtt
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"group_id": group.Id,
+			"address":  address,
+			"network":  network,
+			"query":    result.query,
+		}).Debug("DNS probe failed")
+		return result
+	}
+
+	result.rcode = response.Rcode
+	// NXDOMAIN still proves the nameserver is answering
+	result.success = response.Rcode == dns.RcodeSuccess || response.Rcode == dns.RcodeNameError
+	return result
+}
@@ -0,0 +1,168 @@
+package exporters
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// startTestDNSServer starts a local stand-in nameserver answering A queries for
+// example.internal. and NXDOMAIN for anything else, and returns its port
+func startTestDNSServer(t *testing.T, network string) int {
+	t.Helper()
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetReply(r)
+		if r.Question[0].Name == "example.internal." {
+			msg.Answer = append(msg.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("10.0.0.1"),
+			})
+		} else {
+			msg.Rcode = dns.RcodeNameError
+		}
+		if err := w.WriteMsg(msg); err != nil {
+			t.Errorf("Failed to write DNS response: %v", err)
+		}
+	})
+
+	started := make(chan struct{})
+	server := &dns.Server{Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	switch network {
+	case "udp":
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen on UDP: %v", err)
+		}
+		server.PacketConn = conn
+	case "tcp":
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen on TCP: %v", err)
+		}
+		server.Listener = listener
+	}
+
+	go func() {
+		if err := server.ActivateAndServe(); err != nil {
+			t.Logf("DNS server stopped: %v", err)
+		}
+	}()
+	<-started
+	t.Cleanup(func() {
+		if err := server.Shutdown(); err != nil {
+			t.Logf("Failed to shut down DNS server: %v", err)
+		}
+	})
+
+	var address string
+	if server.PacketConn != nil {
+		address = server.PacketConn.LocalAddr().String()
+	} else {
+		address = server.Listener.Addr().String()
+	}
+	_, port, _ := net.SplitHostPort(address)
+	portNumber, _ := strconv.Atoi(port)
+	return portNumber
+}
+
+// unusedUDPPort returns a local UDP port with nothing listening on it
+func unusedUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Failed to close UDP listener: %v", err)
+	}
+	return port
+}
+
+func TestDNSProber_ProbeGroups(t *testing.T) {
+	udpPort := startTestDNSServer(t, "udp")
+	tcpPort := startTestDNSServer(t, "tcp")
+	deadPort := unusedUDPPort(t)
+
+	prober := newDNSProber(DNSConfig{ProbeQueryName: "missing.internal", ProbeTimeout: 500 * time.Millisecond})
+	results := prober.probeGroups(context.Background(), []api.NameserverGroup{
+		{
+			Id: "ns1", Name: "internal", Enabled: true, Domains: []string{"example.internal"},
+			Nameservers: []api.Nameserver{
+				{Ip: "127.0.0.1", NsType: api.NameserverNsTypeUdp, Port: udpPort},
+				{Ip: "127.0.0.1", NsType: "tcp", Port: tcpPort},
+				{Ip: "127.0.0.1", NsType: api.NameserverNsTypeUdp, Port: deadPort},
+			},
+		},
+		{
+			Id: "ns2", Name: "fallback", Enabled: true,
+			Nameservers: []api.Nameserver{{Ip: "127.0.0.1", NsType: api.NameserverNsTypeUdp, Port: udpPort}},
+		},
+		{
+			Id: "ns3", Name: "disabled", Enabled: false,
+			Nameservers: []api.Nameserver{{Ip: "127.0.0.1", NsType: api.NameserverNsTypeUdp, Port: deadPort}},
+		},
+	})
+
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 probe results (disabled groups skipped), got %d", len(results))
+	}
+
+	for _, result := range results[:2] {
+		if !result.success || result.rcode != dns.RcodeSuccess {
+			t.Errorf("Expected %s probe of %s to succeed, got success=%v rcode=%d", result.server.NsType, result.query, result.success, result.rcode)
+		}
+		if result.query != "example.internal." {
+			t.Errorf("Expected match domain to be queried, got %s", result.query)
+		}
+	}
+	if results[2].success || results[2].rcode != -1 {
+		t.Errorf("Expected probe of a dead nameserver to fail without rcode, got success=%v rcode=%d", results[2].success, results[2].rcode)
+	}
+	if results[3].query != "missing.internal." || results[3].rcode != dns.RcodeNameError || !results[3].success {
+		t.Errorf("Expected fallback query to answer NXDOMAIN successfully, got query=%s rcode=%d success=%v", results[3].query, results[3].rcode, results[3].success)
+	}
+}
+
+func TestDNSExporter_ProbeMetrics(t *testing.T) {
+	udpPort := startTestDNSServer(t, "udp")
+	deadPort := unusedUDPPort(t)
+
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewDNSExporterWithConfig(client, DNSConfig{ProbeEnabled: true, ProbeTimeout: 500 * time.Millisecond})
+
+	exporter.updateProbeMetrics(exporter.prober.probeGroups(context.Background(), []api.NameserverGroup{
+		{
+			Id: "ns1", Name: "internal", Enabled: true, Domains: []string{"example.internal"},
+			Nameservers: []api.Nameserver{
+				{Ip: "127.0.0.1", NsType: api.NameserverNsTypeUdp, Port: udpPort},
+				{Ip: "127.0.0.1", NsType: api.NameserverNsTypeUdp, Port: deadPort},
+			},
+		},
+	}))
+
+	alive := []string{"ns1", "internal", "127.0.0.1", "udp", strconv.Itoa(udpPort), "example.internal."}
+	dead := []string{"ns1", "internal", "127.0.0.1", "udp", strconv.Itoa(deadPort), "example.internal."}
+
+	if value := testutil.ToFloat64(exporter.probeSuccess.WithLabelValues(alive...)); value != 1 {
+		t.Errorf("Expected probe success 1 for the live nameserver, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.probeSuccess.WithLabelValues(dead...)); value != 0 {
+		t.Errorf("Expected probe success 0 for the dead nameserver, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.probeRcode.WithLabelValues(dead...)); value != -1 {
+		t.Errorf("Expected rcode -1 for the dead nameserver, got %f", value)
+	}
+	if count := testutil.CollectAndCount(exporter.probeDuration); count != 1 {
+		t.Errorf("Expected duration only for the answered probe, got %d series", count)
+	}
+}
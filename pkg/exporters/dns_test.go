@@ -1,15 +1,15 @@
 package exporters
 
 import (
-	"encoding/json"
 	"net/http"
-	"net/http/httptest"
-	"strings"
 	"testing"
 
 	nbclient "github.com/netbirdio/netbird/management/client/rest"
 	"github.com/netbirdio/netbird/management/server/http/api"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
 )
 
 func TestNewDNSExporter(t *testing.T) {
@@ -75,70 +75,13 @@ func TestDNSExporter_Describe(t *testing.T) {
 }
 
 func TestDNSExporter_Collect_Success(t *testing.T) {
-	// Create mock server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if !strings.HasPrefix(token, "Token ") {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		switch r.URL.Path {
-		case "/api/dns/nameservers":
-			nameserverGroups := []api.NameserverGroup{
-				{
-					Id:          "ns1",
-					Name:        "primary-dns",
-					Description: "Primary DNS servers",
-					Nameservers: []api.Nameserver{
-						{Ip: "8.8.8.8", NsType: "udp", Port: 53},
-						{Ip: "8.8.4.4", NsType: "udp", Port: 53},
-					},
-					Enabled:              true,
-					Groups:               []string{"group1", "group2"},
-					Primary:              true,
-					Domains:              []string{"example.com", "test.com"},
-					SearchDomainsEnabled: true,
-				},
-				{
-					Id:          "ns2",
-					Name:        "secondary-dns",
-					Description: "Secondary DNS servers",
-					Nameservers: []api.Nameserver{
-						{Ip: "1.1.1.1", NsType: "udp", Port: 53},
-					},
-					Enabled:              false,
-					Groups:               []string{"group3"},
-					Primary:              false,
-					Domains:              []string{"internal.com"},
-					SearchDomainsEnabled: false,
-				},
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			if err := json.NewEncoder(w).Encode(nameserverGroups); err != nil {
-				t.Errorf("Failed to encode nameserver groups: %v", err)
-			}
-
-		case "/api/dns/settings":
-			settings := api.DNSSettings{
-				DisabledManagementGroups: []string{"group4", "group5"},
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			if err := json.NewEncoder(w).Encode(settings); err != nil {
-				t.Errorf("Failed to encode settings: %v", err)
-			}
+	f := fakeapi.NewFixture("example.com")
+	f.Nameservers("primary-dns").Nameserver("8.8.8.8").Nameserver("8.8.4.4").Domains("example.com", "test.com").Primary().Groups("group1", "group2")
+	f.Nameservers("secondary-dns").Nameserver("1.1.1.1").Domains("internal.com").Groups("group3").Disabled()
+	f.DisableDNSManagement("group4").DisableDNSManagement("group5")
+	_, url := newTestAPI(t, f)
 
-		default:
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
-
-	client := nbclient.New(server.URL, "test-token")
+	client := nbclient.New(url, "test-token")
 	exporter := NewDNSExporter(client)
 
 	// Collect metrics
@@ -189,14 +132,12 @@ func TestDNSExporter_Collect_Success(t *testing.T) {
 }
 
 func TestDNSExporter_Collect_APIError(t *testing.T) {
-	// Create mock server that returns error
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-	}))
-	defer server.Close()
+	f := fakeapi.NewFixture("example.com")
+	f.Nameservers("primary-dns").Nameserver("8.8.8.8")
+	server, url := newTestAPI(t, f)
+	server.InjectError("/api/dns/nameservers", http.StatusInternalServerError, -1)
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewDNSExporter(client)
+	exporter := NewDNSExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 100)
@@ -205,39 +146,22 @@ func TestDNSExporter_Collect_APIError(t *testing.T) {
 		close(ch)
 	}()
 
-	// Should still complete without error (though may not collect useful data)
-	metricCount := 0
+	// Should complete without panic or hang
 	for range ch {
-		metricCount++
+		// Drain channel
+	}
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_nameserver_groups")); value != 1 {
+		t.Errorf("Expected 1 nameserver groups fetch error, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_dns_settings")); value != 0 {
+		t.Errorf("Expected the DNS settings to be fetched, got %f errors", value)
 	}
-
-	// Even with API errors, some metrics might still be collected
-	// This test ensures the collection doesn't panic or hang
 }
 
 func TestDNSExporter_Collect_EmptyResponse(t *testing.T) {
-	// Create mock server that returns empty responses
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-
-		switch r.URL.Path {
-		case "/api/dns/nameservers":
-			if _, err := w.Write([]byte(`[]`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		case "/api/dns/settings":
-			if _, err := w.Write([]byte(`{"items": {"disabled_management_groups": []}}`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		default:
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
+	_, url := newTestAPI(t, fakeapi.NewFixture("example.com"))
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewDNSExporter(client)
+	exporter := NewDNSExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 100)
@@ -318,3 +242,69 @@ func TestDNSExporter_UpdateNameserverMetrics(t *testing.T) {
 		}
 	}
 }
+
+func TestDNSExporter_NameserverGroupDetails(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewDNSExporter(client)
+
+	exporter.updateNameserverMetrics([]api.NameserverGroup{
+		{
+			Id:                   "ns1",
+			Name:                 "corp",
+			Enabled:              true,
+			Primary:              false,
+			SearchDomainsEnabled: true,
+			Domains:              []string{"corp.example.com"},
+			Groups:               []string{"group1", "group2"},
+			Nameservers: []api.Nameserver{
+				{Ip: "10.0.0.53", NsType: api.NameserverNsTypeUdp, Port: 53},
+				{Ip: "10.0.1.53", NsType: api.NameserverNsTypeUdp, Port: 5353},
+			},
+		},
+		{Id: "ns2", Name: "public", Enabled: false, Primary: true},
+	})
+
+	if value := testutil.ToFloat64(exporter.nameserverGroupInfo.WithLabelValues("ns1", "corp", "true", "false", "true")); value != 1 {
+		t.Errorf("Expected corp nameserver group info series, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.nameserverGroupInfo.WithLabelValues("ns2", "public", "false", "true", "false")); value != 1 {
+		t.Errorf("Expected public nameserver group info series, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.nameserverGroupDistribution.WithLabelValues("ns1", "corp")); value != 2 {
+		t.Errorf("Expected corp to target 2 groups, got %f", value)
+	}
+	if count := testutil.CollectAndCount(exporter.nameserverInfo); count != 2 {
+		t.Errorf("Expected 2 nameserver info series, got %d", count)
+	}
+	if value := testutil.ToFloat64(exporter.nameserverInfo.WithLabelValues("ns1", "corp", "10.0.1.53", "udp", "5353")); value != 1 {
+		t.Errorf("Expected nameserver info series for 10.0.1.53, got %f", value)
+	}
+}
+
+func TestDNSExporter_ScrapeErrors(t *testing.T) {
+	server, url := newTestAPI(t, fakeapi.NewFixture("example.com"))
+	server.InjectError("/api/dns/nameservers", http.StatusInternalServerError, -1)
+	server.InjectError("/api/dns/settings", http.StatusInternalServerError, -1)
+
+	client := nbclient.New(url, "test-token")
+	exporter := NewDNSExporter(client)
+
+	ch := make(chan prometheus.Metric, 50)
+	go func() {
+		exporter.Collect(ch)
+		close(ch)
+	}()
+	for range ch {
+		// Drain channel
+	}
+
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_nameserver_groups")); value != 1 {
+		t.Errorf("Expected 1 nameserver groups fetch error, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_dns_settings")); value != 1 {
+		t.Errorf("Expected 1 DNS settings fetch error, got %f", value)
+	}
+	if count := testutil.CollectAndCount(exporter.scrapeDuration); count != 1 {
+		t.Errorf("Expected scrape duration to be observed, got %d series", count)
+	}
+}
@@ -1,40 +1,118 @@
 package exporters
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 
 	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/netbirdio/netbird/management/server/http/api"
 )
 
 // NetBirdExporter represents the main Prometheus exporter for NetBird APIs
 type NetBirdExporter struct {
 	client           *nbclient.Client
+	store            *Store
 	peersExporter    *PeersExporter
 	groupsExporter   *GroupsExporter
 	usersExporter    *UsersExporter
 	dnsExporter      *DNSExporter
 	networksExporter *NetworksExporter
 
+	// setupKeysExporter is nil unless enabled
+	setupKeysExporter *SetupKeysExporter
+
 	// Common metrics
 	scrapeDuration prometheus.Histogram
 	scrapeErrors   prometheus.Counter
+
+	// collectMu serializes collections, e.g. a scrape and a push, which would
+	// otherwise reset each other's metrics
+	collectMu sync.Mutex
+}
+
+// Config holds optional settings for the sub-exporters
+type Config struct {
+	Peers     PeersConfig
+	Groups    GroupsConfig
+	Users     UsersConfig
+	Networks  NetworksConfig
+	DNS       DNSConfig
+	SetupKeys SetupKeysConfig
+
+	// Now is the clock of the time-based metrics, e.g. the time of a replayed
+	// recording (default: time.Now)
+	Now func() time.Time
+}
+
+// AllCollectorsConfig enables every optional collector, e.g. to describe every
+// metric the exporter can produce
+func AllCollectorsConfig() Config {
+	return Config{
+		Users:     UsersConfig{TrackTokenExpiry: true},
+		Networks:  NetworksConfig{CollectDetails: true},
+		DNS:       DNSConfig{ProbeEnabled: true},
+		SetupKeys: SetupKeysConfig{Enabled: true},
+	}
 }
 
 // NewNetBirdExporter creates a new NetBird exporter with all sub-exporters
 func NewNetBirdExporter(baseURL, token string) *NetBirdExporter {
+	return NewNetBirdExporterWithConfig(baseURL, token, Config{})
+}
+
+// NewNetBirdExporterWithConfig creates a new NetBird exporter with all sub-exporters
+// using the given settings
+func NewNetBirdExporterWithConfig(baseURL, token string, config Config) *NetBirdExporter {
+	return NewNetBirdExporterWithClient(nbclient.New(baseURL, token), config)
+}
 
-	client := nbclient.New(baseURL, token)
+// NewNetBirdExporterWithClient creates a new NetBird exporter with all
+// sub-exporters using a NetBird client, e.g. one recording or replaying the
+// API responses
+func NewNetBirdExporterWithClient(client *nbclient.Client, config Config) *NetBirdExporter {
+	store := NewStore()
+
+	// Peers are collected first, later sub-exporters reuse them from the store.
+	// Every sub-exporter keeps its objects in the store for the inventory.
+	peersExporter := NewPeersExporterWithConfig(client, config.Peers)
+	peersExporter.store = store
+	groupsExporter := NewGroupsExporterWithConfig(client, config.Groups)
+	groupsExporter.store = store
+	usersExporter := NewUsersExporterWithConfig(client, config.Users)
+	usersExporter.store = store
+	dnsExporter := NewDNSExporterWithConfig(client, config.DNS)
+	dnsExporter.store = store
+	networksExporter := NewNetworksExporterWithConfig(client, config.Networks)
+	networksExporter.store = store
+
+	var setupKeysExporter *SetupKeysExporter
+	if config.SetupKeys.Enabled {
+		setupKeysExporter = NewSetupKeysExporter(client)
+	}
+
+	if config.Now != nil {
+		peersExporter.now = config.Now
+		usersExporter.now = config.Now
+		if setupKeysExporter != nil {
+			setupKeysExporter.now = config.Now
+		}
+	}
 
 	return &NetBirdExporter{
 		client:           client,
-		peersExporter:    NewPeersExporter(client),
-		groupsExporter:   NewGroupsExporter(client),
-		usersExporter:    NewUsersExporter(client),
-		dnsExporter:      NewDNSExporter(client),
-		networksExporter: NewNetworksExporter(client),
+		store:            store,
+		peersExporter:    peersExporter,
+		groupsExporter:   groupsExporter,
+		usersExporter:    usersExporter,
+		dnsExporter:      dnsExporter,
+		networksExporter: networksExporter,
+
+		setupKeysExporter: setupKeysExporter,
 
 		scrapeDuration: prometheus.NewHistogram(
 			prometheus.HistogramOpts{
@@ -59,12 +137,19 @@ func (e *NetBirdExporter) Describe(ch chan<- *prometheus.Desc) {
 	e.usersExporter.Describe(ch)
 	e.dnsExporter.Describe(ch)
 	e.networksExporter.Describe(ch)
+	if e.setupKeysExporter != nil {
+		e.setupKeysExporter.Describe(ch)
+	}
 	e.scrapeDuration.Describe(ch)
 	e.scrapeErrors.Describe(ch)
 }
 
-// Collect implements prometheus.Collector
+// Collect implements prometheus.Collector. Concurrent collections, e.g. from
+// the metrics endpoint and a push mode, run one after the other.
 func (e *NetBirdExporter) Collect(ch chan<- prometheus.Metric) {
+	e.collectMu.Lock()
+	defer e.collectMu.Unlock()
+
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start)
@@ -75,6 +160,7 @@ func (e *NetBirdExporter) Collect(ch chan<- prometheus.Metric) {
 	}()
 
 	logrus.Debug("Starting NetBird metrics collection")
+	e.store.StartScrape()
 
 	// Collect from all sub-exporters
 	func() {
@@ -137,6 +223,32 @@ func (e *NetBirdExporter) Collect(ch chan<- prometheus.Metric) {
 		logrus.Debug("Completed networks collection")
 	}()
 
+	if e.setupKeysExporter != nil {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logrus.WithField("panic", r).Error("Panic during setup keys collection")
+					e.scrapeErrors.Inc()
+				}
+			}()
+			logrus.Debug("Starting setup keys collection")
+			e.setupKeysExporter.Collect(ch)
+			logrus.Debug("Completed setup keys collection")
+		}()
+	}
+
 	// Future exporters can be added here like:
 	// e.policiesExporter.Collect(ch)
 }
+
+// Account returns the NetBird account the API token belongs to
+func (e *NetBirdExporter) Account(ctx context.Context) (*api.Account, error) {
+	accounts, err := e.client.Accounts.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("no account returned by the NetBird API")
+	}
+	return &accounts[0], nil
+}
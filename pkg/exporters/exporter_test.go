@@ -3,14 +3,27 @@ package exporters
 import (
 	"net/http"
 	"net/http/httptest"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	nbclient "github.com/netbirdio/netbird/management/client/rest"
 	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
 )
 
+// newTestAPI serves a fixture with the fake NetBird API for the duration of a
+// test, accepting the test-token token, and returns the fake API and its URL
+func newTestAPI(t testing.TB, fixture *fakeapi.Fixture) (*fakeapi.Server, string) {
+	t.Helper()
+	server := fakeapi.NewServer(fixture, fakeapi.Config{Token: "test-token"})
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return server, httpServer.URL
+}
+
 func TestNewNetBirdExporter(t *testing.T) {
 	baseURL := "https://api.netbird.io"
 	token := "test-token"
@@ -77,126 +90,14 @@ func TestNetBirdExporter_Describe(t *testing.T) {
 }
 
 func TestNetBirdExporter_Collect_WithMockServer(t *testing.T) {
-	// Create mock server for testing
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if !strings.HasPrefix(token, "Token ") {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+	f := fakeapi.NewFixture("example.com")
+	f.Peer("test-peer").Connected().OS("linux", "6.1").Groups("test-group").Location("US", "New York").SSH()
+	f.User("test@example.com").Name("Test User").Role("admin")
+	f.Nameservers("test-ns").Nameserver("8.8.8.8").Domains("example.com").Primary()
+	f.Network("test-network")
+	_, url := newTestAPI(t, f)
 
-		switch r.URL.Path {
-		case "/api/peers":
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			if _, err := w.Write([]byte(`[
-				{
-					"id": "peer1",
-					"name": "test-peer",
-					"ip": "100.64.0.1",
-					"connected": true,
-					"last_seen": "2023-01-01T00:00:00Z",
-					"os": "linux",
-					"groups": [],
-					"ssh_enabled": true,
-					"hostname": "test-host",
-					"login_expired": false,
-					"approval_required": false,
-					"country_code": "US",
-					"city_name": "New York",
-					"accessible_peers_count": 5
-				}
-			]`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		case "/api/groups":
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			if _, err := w.Write([]byte(`[
-				{
-					"id": "group1",
-					"name": "test-group",
-					"peers_count": 1,
-					"resources_count": 0,
-					"issued": "api"
-				}
-			]`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		case "/api/users":
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			if _, err := w.Write([]byte(`[
-				{
-					"id": "user1",
-					"email": "test@example.com",
-					"name": "Test User",
-					"role": "admin",
-					"status": "active",
-					"last_login": "2023-01-01T00:00:00Z",
-					"auto_groups": [],
-					"is_service_user": false,
-					"is_blocked": false,
-					"issued": "api",
-					"permissions": {
-						"is_restricted": false,
-						"modules": {}
-					}
-				}
-			]`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		case "/api/dns/nameservers":
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			if _, err := w.Write([]byte(`[
-				{
-					"id": "ns1",
-					"name": "test-ns",
-					"description": "Test nameserver",
-					"nameservers": [{"ip": "8.8.8.8", "ns_type": "udp", "port": 53}],
-					"enabled": true,
-					"groups": [],
-					"primary": true,
-					"domains": ["example.com"],
-					"search_domains_enabled": true
-				}
-			]`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		case "/api/dns/settings":
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			if _, err := w.Write([]byte(`{
-				"items": {
-					"disabled_management_groups": []
-				}
-			}`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		case "/api/networks":
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			if _, err := w.Write([]byte(`[
-				{
-					"id": "net1",
-					"name": "test-network",
-					"description": "Test network",
-					"routers": [],
-					"routing_peers_count": 0,
-					"resources": [],
-					"policies": []
-				}
-			]`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		default:
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
-
-	exporter := NewNetBirdExporter(server.URL, "test-token")
+	exporter := NewNetBirdExporter(url, "test-token")
 
 	// Test collection
 	ch := make(chan prometheus.Metric, 100)
@@ -219,13 +120,14 @@ func TestNetBirdExporter_Collect_WithMockServer(t *testing.T) {
 }
 
 func TestNetBirdExporter_Collect_HandlesErrors(t *testing.T) {
-	// Create mock server that returns errors
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-	}))
-	defer server.Close()
+	f := fakeapi.NewFixture("example.com")
+	f.Peer("test-peer").Connected()
+	server, url := newTestAPI(t, f)
+	for _, path := range []string{"/api/peers", "/api/groups", "/api/users", "/api/dns/nameservers", "/api/dns/settings", "/api/networks"} {
+		server.InjectError(path, http.StatusInternalServerError, -1)
+	}
 
-	exporter := NewNetBirdExporter(server.URL, "test-token")
+	exporter := NewNetBirdExporter(url, "test-token")
 
 	// Test collection with errors
 	ch := make(chan prometheus.Metric, 100)
@@ -312,44 +214,11 @@ func TestNetBirdExporter_MetricsRegistration(t *testing.T) {
 }
 
 func TestNetBirdExporter_ScrapeMetrics(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Simulate slow response
-		time.Sleep(10 * time.Millisecond)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-
-		switch r.URL.Path {
-		case "/api/peers":
-			if _, err := w.Write([]byte(`[]`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		case "/api/groups":
-			if _, err := w.Write([]byte(`[]`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		case "/api/users":
-			if _, err := w.Write([]byte(`[]`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		case "/api/dns/nameservers":
-			if _, err := w.Write([]byte(`[]`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		case "/api/dns/settings":
-			if _, err := w.Write([]byte(`{"items": {"disabled_management_groups": []}}`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		case "/api/networks":
-			if _, err := w.Write([]byte(`[]`)); err != nil {
-				t.Errorf("Failed to write response: %v", err)
-			}
-		default:
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
+	server, url := newTestAPI(t, fakeapi.NewFixture("example.com"))
+	// Simulate slow responses
+	server.SetLatency(10 * time.Millisecond)
 
-	exporter := NewNetBirdExporter(server.URL, "test-token")
+	exporter := NewNetBirdExporter(url, "test-token")
 	registry := prometheus.NewRegistry()
 	registry.MustRegister(exporter)
 
@@ -375,3 +244,50 @@ func TestNetBirdExporter_ScrapeMetrics(t *testing.T) {
 		t.Error("Expected to find scrape duration metric")
 	}
 }
+
+func TestNetBirdExporter_ConcurrentCollect(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	for _, name := range []string{"peer-1", "peer-2", "peer-3"} {
+		f.Peer(name).Connected()
+	}
+	const latency = 20 * time.Millisecond
+	var requests atomic.Int64
+	api := fakeapi.NewServer(f, fakeapi.Config{Token: "test-token", Latency: latency})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		api.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	// The metrics endpoint and a push mode gather the same exporter from
+	// different registries
+	exporter := NewNetBirdExporter(server.URL, "test-token")
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(exporter)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			families, err := registry.Gather()
+			if err != nil {
+				t.Errorf("Failed to gather metrics: %v", err)
+				return
+			}
+			for _, family := range families {
+				if family.GetName() == "netbird_peer_info" && len(family.GetMetric()) != 3 {
+					t.Errorf("Expected 3 peers in every collection, got %d", len(family.GetMetric()))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every collection makes its requests one after the other, so the
+	// collections ran one after the other when all requests took as long as
+	// sequential requests
+	if elapsed, sequential := time.Since(start), time.Duration(requests.Load())*latency; elapsed < sequential {
+		t.Errorf("Expected the collections to be serialized, took %v for %d requests", elapsed, requests.Load())
+	}
+}
@@ -2,6 +2,9 @@ package exporters
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	nbclient "github.com/netbirdio/netbird/management/client/rest"
@@ -10,24 +13,89 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Kinds of objects that can reference a group, used as the referenced_by label
+const (
+	groupRefPolicy          = "policy"
+	groupRefRoute           = "route"
+	groupRefNetworkRouter   = "network_router"
+	groupRefNameserverGroup = "nameserver_group"
+	groupRefSetupKey        = "setup_key"
+	groupRefUser            = "user"
+)
+
+// allGroupName is the built-in group every peer belongs to, it can't be
+// deleted and is never reported as orphaned
+const allGroupName = "All"
+
+// GroupsConfig holds optional settings for the groups exporter
+type GroupsConfig struct {
+	// TrackReferences cross-references groups with policies, routes, network routers,
+	// nameserver groups, setup keys and users. This costs one extra API call per
+	// object kind, plus one per network, on every scrape.
+	TrackReferences bool
+
+	// SensitiveGroups lists group names or IDs whose membership changes are
+	// logged with the affected peers.
+	SensitiveGroups []string
+}
+
+// groupReferences maps a group ID to the number of referencing objects per kind
+type groupReferences map[string]map[string]int
+
+// add records a single object of the given kind referencing each of the group IDs,
+// duplicates within the same object are counted once
+func (r groupReferences) add(kind string, groupIDs ...string) {
+	seen := make(map[string]bool, len(groupIDs))
+	for _, id := range groupIDs {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if r[id] == nil {
+			r[id] = make(map[string]int)
+		}
+		r[id][kind]++
+	}
+}
+
 // GroupsExporter handles groups-specific metrics collection
 type GroupsExporter struct {
 	client *nbclient.Client
+	config GroupsConfig
+	store  *Store
+
+	// Peer members of each group from the previous collection, nil until the first one
+	previousMembers map[string]map[string]string
+	previousMu      sync.Mutex
 
 	// Prometheus metrics for groups
-	groupsTotal          *prometheus.GaugeVec
-	groupPeersCount      *prometheus.GaugeVec
-	groupResourcesCount  *prometheus.GaugeVec
-	groupInfo            *prometheus.GaugeVec
-	groupResourcesByType *prometheus.GaugeVec
-	scrapeErrorsTotal    *prometheus.CounterVec
-	scrapeDuration       *prometheus.HistogramVec
+	groupsTotal              *prometheus.GaugeVec
+	groupPeersCount          *prometheus.GaugeVec
+	groupResourcesCount      *prometheus.GaugeVec
+	groupInfo                *prometheus.GaugeVec
+	groupResourcesByType     *prometheus.GaugeVec
+	groupsByIssued           *prometheus.GaugeVec
+	groupMembershipsByIssued *prometheus.GaugeVec
+	peersOnlyInJWTGroups     *prometheus.GaugeVec
+	groupReferences          *prometheus.GaugeVec
+	groupOrphaned            *prometheus.GaugeVec
+	groupsOrphaned           *prometheus.GaugeVec
+	groupPeersAddedTotal     *prometheus.CounterVec
+	groupPeersRemovedTotal   *prometheus.CounterVec
+	scrapeErrorsTotal        *prometheus.CounterVec
+	scrapeDuration           *prometheus.HistogramVec
 }
 
 // NewGroupsExporter creates a new groups exporter
 func NewGroupsExporter(client *nbclient.Client) *GroupsExporter {
+	return NewGroupsExporterWithConfig(client, GroupsConfig{})
+}
+
+// NewGroupsExporterWithConfig creates a new groups exporter with the given settings
+func NewGroupsExporterWithConfig(client *nbclient.Client, config GroupsConfig) *GroupsExporter {
 	return &GroupsExporter{
 		client: client,
+		config: config,
 
 		groupsTotal: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
@@ -69,6 +137,70 @@ func NewGroupsExporter(client *nbclient.Client) *GroupsExporter {
 			[]string{"group_id", "group_name", "resource_type"},
 		),
 
+		groupsByIssued: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_groups_by_issued",
+				Help: "Number of NetBird groups by issued source (api, jwt, integration)",
+			},
+			[]string{"issued"},
+		),
+
+		groupMembershipsByIssued: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_group_peer_memberships_by_issued",
+				Help: "Number of peer memberships in NetBird groups other than All by issued source",
+			},
+			[]string{"issued"},
+		),
+
+		peersOnlyInJWTGroups: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peers_only_in_jwt_groups",
+				Help: "Number of peers whose group memberships, apart from All, all come from JWT group sync",
+			},
+			[]string{},
+		),
+
+		groupReferences: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_group_references",
+				Help: "Number of NetBird objects referencing each group by object kind",
+			},
+			[]string{"group_id", "group_name", "referenced_by"},
+		),
+
+		groupOrphaned: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_group_orphaned",
+				Help: "NetBird groups not referenced by any policy, route, network router, nameserver group, setup key or user (always 1)",
+			},
+			[]string{"group_id", "group_name", "issued"},
+		),
+
+		groupsOrphaned: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_groups_orphaned",
+				Help: "Number of NetBird groups not referenced by anything",
+			},
+			[]string{},
+		),
+
+		groupPeersAddedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_group_peers_added_total",
+				Help: "Total number of peers added to each NetBird group between scrapes",
+			},
+			[]string{"group_id", "group_name"},
+		),
+
+		groupPeersRemovedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_group_peers_removed_total",
+				Help: "Total number of peers removed from each NetBird group between scrapes",
+			},
+			[]string{"group_id", "group_name"},
+		),
+
 		scrapeErrorsTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "netbird_groups_scrape_errors_total",
@@ -94,6 +226,14 @@ func (e *GroupsExporter) Describe(ch chan<- *prometheus.Desc) {
 	e.groupResourcesCount.Describe(ch)
 	e.groupInfo.Describe(ch)
 	e.groupResourcesByType.Describe(ch)
+	e.groupsByIssued.Describe(ch)
+	e.groupMembershipsByIssued.Describe(ch)
+	e.peersOnlyInJWTGroups.Describe(ch)
+	e.groupReferences.Describe(ch)
+	e.groupOrphaned.Describe(ch)
+	e.groupsOrphaned.Describe(ch)
+	e.groupPeersAddedTotal.Describe(ch)
+	e.groupPeersRemovedTotal.Describe(ch)
 	e.scrapeErrorsTotal.Describe(ch)
 	e.scrapeDuration.Describe(ch)
 }
@@ -109,6 +249,12 @@ func (e *GroupsExporter) Collect(ch chan<- prometheus.Metric) {
 	e.groupResourcesCount.Reset()
 	e.groupInfo.Reset()
 	e.groupResourcesByType.Reset()
+	e.groupsByIssued.Reset()
+	e.groupMembershipsByIssued.Reset()
+	e.peersOnlyInJWTGroups.Reset()
+	e.groupReferences.Reset()
+	e.groupOrphaned.Reset()
+	e.groupsOrphaned.Reset()
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()
@@ -117,17 +263,36 @@ func (e *GroupsExporter) Collect(ch chan<- prometheus.Metric) {
 	if err != nil {
 		logrus.WithError(err).Error("Failed to fetch groups")
 		e.scrapeErrorsTotal.WithLabelValues("fetch_groups").Inc()
+		e.scrapeErrorsTotal.Collect(ch)
 		return
 	}
 
+	e.store.SetGroups(groups)
 	e.updateMetrics(groups)
 
+	if e.config.TrackReferences {
+		refs, err := e.fetchGroupReferences(ctx)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to fetch group references, skipping group reference metrics")
+		} else {
+			e.updateReferenceMetrics(groups, refs)
+		}
+	}
+
 	// Collect all metrics
 	e.groupsTotal.Collect(ch)
 	e.groupPeersCount.Collect(ch)
 	e.groupResourcesCount.Collect(ch)
 	e.groupInfo.Collect(ch)
 	e.groupResourcesByType.Collect(ch)
+	e.groupsByIssued.Collect(ch)
+	e.groupMembershipsByIssued.Collect(ch)
+	e.peersOnlyInJWTGroups.Collect(ch)
+	e.groupReferences.Collect(ch)
+	e.groupOrphaned.Collect(ch)
+	e.groupsOrphaned.Collect(ch)
+	e.groupPeersAddedTotal.Collect(ch)
+	e.groupPeersRemovedTotal.Collect(ch)
 	e.scrapeErrorsTotal.Collect(ch)
 	e.scrapeDuration.Collect(ch)
 }
@@ -141,6 +306,9 @@ func (e *GroupsExporter) updateMetrics(groups []api.Group) {
 	totalPeers := 0
 	totalResources := 0
 	resourceTypeTotals := make(map[string]int)
+	issuedCounts := make(map[string]int)
+	issuedMemberships := make(map[string]int)
+	peerIssuedSources := make(map[string]map[string]bool) // peer_id -> issued sources of its groups
 
 	for _, group := range groups {
 		issued := ""
@@ -149,6 +317,24 @@ func (e *GroupsExporter) updateMetrics(groups []api.Group) {
 		}
 		groupLabels := []string{group.Id, group.Name, issued}
 
+		// Issued source distribution
+		issuedKey := issued
+		if issuedKey == "" {
+			issuedKey = "unknown"
+		}
+		issuedCounts[issuedKey]++
+
+		// Every peer is in All, so it doesn't tell where access comes from
+		if group.Name != allGroupName {
+			issuedMemberships[issuedKey] += group.PeersCount
+			for _, peer := range group.Peers {
+				if peerIssuedSources[peer.Id] == nil {
+					peerIssuedSources[peer.Id] = make(map[string]bool)
+				}
+				peerIssuedSources[peer.Id][issuedKey] = true
+			}
+		}
+
 		// Set basic group metrics
 		e.groupPeersCount.WithLabelValues(groupLabels...).Set(float64(group.PeersCount))
 		e.groupResourcesCount.WithLabelValues(groupLabels...).Set(float64(group.ResourcesCount))
@@ -176,11 +362,235 @@ func (e *GroupsExporter) updateMetrics(groups []api.Group) {
 
 	e.groupsTotal.WithLabelValues().Set(float64(totalGroups))
 
+	// Issued source aggregates
+	for issued, count := range issuedCounts {
+		e.groupsByIssued.WithLabelValues(issued).Set(float64(count))
+		e.groupMembershipsByIssued.WithLabelValues(issued).Set(float64(issuedMemberships[issued]))
+	}
+
+	jwtOnlyPeers := 0
+	for _, sources := range peerIssuedSources {
+		if len(sources) == 1 && sources[string(api.GroupIssuedJwt)] {
+			jwtOnlyPeers++
+		}
+	}
+	e.peersOnlyInJWTGroups.WithLabelValues().Set(float64(jwtOnlyPeers))
+
+	e.updateMembershipMetrics(groups)
+
 	logrus.WithFields(logrus.Fields{
 		"total_groups":          totalGroups,
 		"total_peers_in_groups": totalPeers,
 		"total_resources":       totalResources,
 		"resource_types":        len(resourceTypeTotals),
 		"resource_type_counts":  resourceTypeTotals,
+		"issued_distributions":  issuedCounts,
+		"jwt_only_peers":        jwtOnlyPeers,
 	}).Debug("Updated group metrics")
 }
+
+// updateMembershipMetrics compares the peer members of each group with the
+// previous collection, counts added and removed peers and logs changes of
+// sensitive groups
+func (e *GroupsExporter) updateMembershipMetrics(groups []api.Group) {
+	e.previousMu.Lock()
+	defer e.previousMu.Unlock()
+
+	current := make(map[string]map[string]string, len(groups))
+	for _, group := range groups {
+		members := make(map[string]string, len(group.Peers))
+		for _, peer := range group.Peers {
+			members[peer.Id] = peer.Name
+		}
+		current[group.Id] = members
+	}
+
+	// The first collection only establishes the baseline, with the counters of
+	// every group starting at zero
+	if e.previousMembers == nil {
+		for _, group := range groups {
+			e.groupPeersAddedTotal.WithLabelValues(group.Id, group.Name)
+			e.groupPeersRemovedTotal.WithLabelValues(group.Id, group.Name)
+		}
+		e.previousMembers = current
+		return
+	}
+
+	sensitive := make(map[string]bool, len(e.config.SensitiveGroups))
+	for _, group := range e.config.SensitiveGroups {
+		sensitive[group] = true
+	}
+
+	for _, group := range groups {
+		previous := e.previousMembers[group.Id]
+		members := current[group.Id]
+
+		added := make([]api.PeerMinimum, 0)
+		for id, name := range members {
+			if _, existed := previous[id]; !existed {
+				added = append(added, api.PeerMinimum{Id: id, Name: name})
+			}
+		}
+		removed := make([]api.PeerMinimum, 0)
+		for id, name := range previous {
+			if _, exists := members[id]; !exists {
+				removed = append(removed, api.PeerMinimum{Id: id, Name: name})
+			}
+		}
+
+		e.groupPeersAddedTotal.WithLabelValues(group.Id, group.Name).Add(float64(len(added)))
+		e.groupPeersRemovedTotal.WithLabelValues(group.Id, group.Name).Add(float64(len(removed)))
+
+		if (len(added) > 0 || len(removed) > 0) && (sensitive[group.Id] || sensitive[group.Name]) {
+			sortPeerMinimums(added)
+			sortPeerMinimums(removed)
+			logrus.WithFields(logrus.Fields{
+				"group_id":      group.Id,
+				"group_name":    group.Name,
+				"peers_added":   added,
+				"peers_removed": removed,
+			}).Warn("Sensitive group membership changed")
+		}
+	}
+
+	// Drop the counters of deleted groups
+	for id := range e.previousMembers {
+		if _, exists := current[id]; !exists {
+			e.groupPeersAddedTotal.DeletePartialMatch(prometheus.Labels{"group_id": id})
+			e.groupPeersRemovedTotal.DeletePartialMatch(prometheus.Labels{"group_id": id})
+		}
+	}
+
+	e.previousMembers = current
+}
+
+// sortPeerMinimums sorts peers by name and ID for stable log output
+func sortPeerMinimums(peers []api.PeerMinimum) {
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Name != peers[j].Name {
+			return peers[i].Name < peers[j].Name
+		}
+		return peers[i].Id < peers[j].Id
+	})
+}
+
+// fetchGroupReferences lists every object kind that can reference a group and
+// counts the references per group. Any failed fetch fails the whole lookup, as
+// partial data would report referenced groups as orphaned.
+func (e *GroupsExporter) fetchGroupReferences(ctx context.Context) (groupReferences, error) {
+	refs := make(groupReferences)
+
+	policies, err := e.client.Policies.List(ctx)
+	if err != nil {
+		e.scrapeErrorsTotal.WithLabelValues("fetch_policies").Inc()
+		return nil, fmt.Errorf("fetch policies: %w", err)
+	}
+	for _, policy := range policies {
+		ids := make([]string, 0)
+		for _, rule := range policy.Rules {
+			if rule.Sources != nil {
+				for _, group := range *rule.Sources {
+					ids = append(ids, group.Id)
+				}
+			}
+			if rule.Destinations != nil {
+				for _, group := range *rule.Destinations {
+					ids = append(ids, group.Id)
+				}
+			}
+		}
+		refs.add(groupRefPolicy, ids...)
+	}
+
+	routes, err := e.client.Routes.List(ctx)
+	if err != nil {
+		e.scrapeErrorsTotal.WithLabelValues("fetch_routes").Inc()
+		return nil, fmt.Errorf("fetch routes: %w", err)
+	}
+	for _, route := range routes {
+		ids := append([]string{}, route.Groups...)
+		if route.PeerGroups != nil {
+			ids = append(ids, *route.PeerGroups...)
+		}
+		if route.AccessControlGroups != nil {
+			ids = append(ids, *route.AccessControlGroups...)
+		}
+		refs.add(groupRefRoute, ids...)
+	}
+
+	networks, err := e.client.Networks.List(ctx)
+	if err != nil {
+		e.scrapeErrorsTotal.WithLabelValues("fetch_networks").Inc()
+		return nil, fmt.Errorf("fetch networks: %w", err)
+	}
+	for _, network := range networks {
+		routers, err := e.client.Networks.Routers(network.Id).List(ctx)
+		if err != nil {
+			e.scrapeErrorsTotal.WithLabelValues("fetch_network_routers").Inc()
+			return nil, fmt.Errorf("fetch routers of network %s: %w", network.Id, err)
+		}
+		for _, router := range routers {
+			if router.PeerGroups != nil {
+				refs.add(groupRefNetworkRouter, *router.PeerGroups...)
+			}
+		}
+	}
+
+	nameserverGroups, err := e.client.DNS.ListNameserverGroups(ctx)
+	if err != nil {
+		e.scrapeErrorsTotal.WithLabelValues("fetch_nameserver_groups").Inc()
+		return nil, fmt.Errorf("fetch nameserver groups: %w", err)
+	}
+	for _, nsGroup := range nameserverGroups {
+		refs.add(groupRefNameserverGroup, nsGroup.Groups...)
+	}
+
+	setupKeys, err := e.client.SetupKeys.List(ctx)
+	if err != nil {
+		e.scrapeErrorsTotal.WithLabelValues("fetch_setup_keys").Inc()
+		return nil, fmt.Errorf("fetch setup keys: %w", err)
+	}
+	for _, key := range setupKeys {
+		refs.add(groupRefSetupKey, key.AutoGroups...)
+	}
+
+	users, err := e.client.Users.List(ctx)
+	if err != nil {
+		e.scrapeErrorsTotal.WithLabelValues("fetch_users").Inc()
+		return nil, fmt.Errorf("fetch users: %w", err)
+	}
+	for _, user := range users {
+		refs.add(groupRefUser, user.AutoGroups...)
+	}
+
+	return refs, nil
+}
+
+// updateReferenceMetrics updates group reference and orphaned group metrics
+func (e *GroupsExporter) updateReferenceMetrics(groups []api.Group, refs groupReferences) {
+	orphaned := 0
+
+	for _, group := range groups {
+		for kind, count := range refs[group.Id] {
+			e.groupReferences.WithLabelValues(group.Id, group.Name, kind).Set(float64(count))
+		}
+
+		if len(refs[group.Id]) > 0 || group.Name == allGroupName {
+			continue
+		}
+
+		issued := ""
+		if group.Issued != nil {
+			issued = string(*group.Issued)
+		}
+		e.groupOrphaned.WithLabelValues(group.Id, group.Name, issued).Set(1)
+		orphaned++
+	}
+
+	e.groupsOrphaned.WithLabelValues().Set(float64(orphaned))
+
+	logrus.WithFields(logrus.Fields{
+		"referenced_groups": len(refs),
+		"orphaned_groups":   orphaned,
+	}).Debug("Updated group reference metrics")
+}
@@ -1,15 +1,17 @@
 package exporters
 
 import (
-	"encoding/json"
 	"net/http"
-	"net/http/httptest"
-	"strings"
 	"testing"
 
 	nbclient "github.com/netbirdio/netbird/management/client/rest"
 	"github.com/netbirdio/netbird/management/server/http/api"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
 )
 
 func TestNewGroupsExporter(t *testing.T) {
@@ -66,71 +68,19 @@ func TestGroupsExporter_Describe(t *testing.T) {
 }
 
 func TestGroupsExporter_Collect_Success(t *testing.T) {
-	// Create mock server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/api/groups" {
-			http.NotFound(w, r)
-			return
-		}
-
-		token := r.Header.Get("Authorization")
-		if !strings.HasPrefix(token, "Token ") {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		issuedAPI := api.GroupIssuedApi
-		issuedIntegration := api.GroupIssuedIntegration
-		groups := []api.Group{
-			{
-				Id:             "group1",
-				Name:           "admin-group",
-				PeersCount:     5,
-				ResourcesCount: 2,
-				Issued:         &issuedAPI,
-				Peers: []api.PeerMinimum{
-					{Id: "peer1", Name: "peer-1"},
-					{Id: "peer2", Name: "peer-2"},
-				},
-				Resources: []api.Resource{
-					{Id: "resource1", Type: "host"},
-				},
-			},
-			{
-				Id:             "group2",
-				Name:           "user-group",
-				PeersCount:     10,
-				ResourcesCount: 0,
-				Issued:         &issuedIntegration,
-				Peers: []api.PeerMinimum{
-					{Id: "peer3", Name: "peer-3"},
-					{Id: "peer4", Name: "peer-4"},
-					{Id: "peer5", Name: "peer-5"},
-				},
-				Resources: []api.Resource{},
-			},
-			{
-				Id:             "group3",
-				Name:           "service-group",
-				PeersCount:     2,
-				ResourcesCount: 3,
-				Issued:         &issuedAPI,
-				Peers:          []api.PeerMinimum{},
-				Resources: []api.Resource{
-					{Id: "resource2", Type: "domain"},
-					{Id: "resource3", Type: "subnet"},
-				},
-			},
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(groups); err != nil {
-			t.Errorf("Failed to encode groups: %v", err)
-		}
-	}))
-	defer server.Close()
-
-	client := nbclient.New(server.URL, "test-token")
+	f := fakeapi.NewFixture("example.com")
+	f.Peer("peer-1").Groups("admin-group")
+	f.Peer("peer-2").Groups("admin-group")
+	f.Peer("peer-3").Groups("user-group")
+	f.Peer("peer-4").Groups("user-group")
+	f.Peer("peer-5").Groups("user-group")
+	f.Network("office").
+		Resource("db", "10.0.0.5/32", "admin-group").
+		Resource("wiki", "wiki.example.com", "service-group").
+		Resource("lan", "10.0.1.0/24", "service-group")
+	_, url := newTestAPI(t, f)
+
+	client := nbclient.New(url, "test-token")
 	exporter := NewGroupsExporter(client)
 
 	// Collect metrics
@@ -160,15 +110,15 @@ func TestGroupsExporter_Collect_Success(t *testing.T) {
 		t.Fatalf("Failed to gather metrics: %v", err)
 	}
 
-	// Check groups total
+	// Check groups total, the All group included
 	totalFound := false
 	for _, family := range families {
 		if family.GetName() == "netbird_groups" {
 			totalFound = true
 			if len(family.GetMetric()) > 0 {
 				value := family.GetMetric()[0].GetGauge().GetValue()
-				if value != 3 {
-					t.Errorf("Expected groups total to be 3, got %f", value)
+				if value != 4 {
+					t.Errorf("Expected groups total to be 4, got %f", value)
 				}
 			}
 			break
@@ -178,17 +128,19 @@ func TestGroupsExporter_Collect_Success(t *testing.T) {
 	if !totalFound {
 		t.Error("Expected to find groups total metric")
 	}
+
+	if value := testutil.ToFloat64(exporter.groupPeersCount.WithLabelValues(fakeapi.GroupID("user-group"), "user-group", "api")); value != 3 {
+		t.Errorf("Expected 3 peers in user-group, got %f", value)
+	}
 }
 
 func TestGroupsExporter_Collect_APIError(t *testing.T) {
-	// Create mock server that returns error
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-	}))
-	defer server.Close()
+	f := fakeapi.NewFixture("example.com")
+	f.Group("devs")
+	server, url := newTestAPI(t, f)
+	server.InjectError("/api/groups", http.StatusInternalServerError, -1)
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewGroupsExporter(client)
+	exporter := NewGroupsExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 50)
@@ -197,29 +149,20 @@ func TestGroupsExporter_Collect_APIError(t *testing.T) {
 		close(ch)
 	}()
 
-	// Should still complete without error (though may not collect useful data)
-	metricCount := 0
+	// Should complete without panic or hang
 	for range ch {
-		metricCount++
+		// Drain channel
+	}
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_groups")); value != 1 {
+		t.Errorf("Expected 1 fetch_groups error, got %f", value)
 	}
-
-	// Even with API errors, some metrics might still be collected
-	// This test ensures the collection doesn't panic or hang
 }
 
 func TestGroupsExporter_Collect_EmptyResponse(t *testing.T) {
-	// Create mock server that returns empty array
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte(`[]`)); err != nil {
-			t.Errorf("Failed to write response: %v", err)
-		}
-	}))
-	defer server.Close()
+	server, url := newTestAPI(t, fakeapi.NewFixture("example.com"))
+	server.InjectBody("/api/groups", "[]", -1)
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewGroupsExporter(client)
+	exporter := NewGroupsExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 50)
@@ -240,18 +183,10 @@ func TestGroupsExporter_Collect_EmptyResponse(t *testing.T) {
 }
 
 func TestGroupsExporter_Collect_InvalidJSON(t *testing.T) {
-	// Create mock server that returns invalid JSON
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte(`invalid json`)); err != nil {
-			t.Errorf("Failed to write response: %v", err)
-		}
-	}))
-	defer server.Close()
+	server, url := newTestAPI(t, fakeapi.NewFixture("example.com"))
+	server.InjectBody("/api/groups", "invalid json", -1)
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewGroupsExporter(client)
+	exporter := NewGroupsExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 50)
@@ -264,6 +199,9 @@ func TestGroupsExporter_Collect_InvalidJSON(t *testing.T) {
 	for range ch {
 		// Drain channel
 	}
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_groups")); value != 1 {
+		t.Errorf("Expected 1 fetch_groups error, got %f", value)
+	}
 }
 
 func TestGroupsExporter_UpdateMetrics(t *testing.T) {
@@ -395,3 +333,174 @@ func TestGroupsExporter_MetricLabels(t *testing.T) {
 		t.Error("Expected to find metrics with labels")
 	}
 }
+
+func TestGroupsExporter_References(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	f.Group("devs").Group("servers").Group("dns-clients").JWTGroup("stale-jwt")
+	f.Policy("devs-to-servers").Rule("devs", "servers", "tcp").Rule("devs", "servers", "udp")
+	f.HARoute("10.0.0.0/24", "servers", "devs")
+	f.Network("office").RouterGroup("servers")
+	f.Nameservers("internal").Nameserver("10.0.0.53").Groups("dns-clients")
+	f.SetupKey("servers").AutoGroups("servers")
+	f.User("alice@example.com").AutoGroups("devs")
+	_, url := newTestAPI(t, f)
+
+	client := nbclient.New(url, "test-token")
+	exporter := NewGroupsExporterWithConfig(client, GroupsConfig{TrackReferences: true})
+
+	ch := make(chan prometheus.Metric, 100)
+	go func() {
+		exporter.Collect(ch)
+		close(ch)
+	}()
+	for range ch {
+		// Drain channel
+	}
+
+	expected := map[[2]string]float64{
+		{"devs", groupRefPolicy}:                 1,
+		{"servers", groupRefPolicy}:              1,
+		{"devs", groupRefRoute}:                  1,
+		{"servers", groupRefRoute}:               1,
+		{"servers", groupRefNetworkRouter}:       1,
+		{"dns-clients", groupRefNameserverGroup}: 1,
+		{"servers", groupRefSetupKey}:            1,
+		{"devs", groupRefUser}:                   1,
+	}
+	if count := testutil.CollectAndCount(exporter.groupReferences); count != len(expected) {
+		t.Errorf("Expected %d reference series, got %d", len(expected), count)
+	}
+	for key, value := range expected {
+		if got := testutil.ToFloat64(exporter.groupReferences.WithLabelValues(fakeapi.GroupID(key[0]), key[0], key[1])); got != value {
+			t.Errorf("Expected %s referenced by %s %f times, got %f", key[0], key[1], value, got)
+		}
+	}
+
+	// "All" is never orphaned
+	if value := testutil.ToFloat64(exporter.groupsOrphaned.WithLabelValues()); value != 1 {
+		t.Errorf("Expected 1 orphaned group, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.groupOrphaned.WithLabelValues(fakeapi.GroupID("stale-jwt"), "stale-jwt", "jwt")); value != 1 {
+		t.Errorf("Expected stale-jwt to be orphaned, got %f", value)
+	}
+}
+
+func TestGroupsExporter_ReferencesFetchError(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	f.Group("devs")
+	server, url := newTestAPI(t, f)
+	for _, path := range []string{"/api/policies", "/api/routes", "/api/networks", "/api/dns/nameservers", "/api/setup-keys", "/api/users"} {
+		server.InjectError(path, http.StatusInternalServerError, -1)
+	}
+
+	client := nbclient.New(url, "test-token")
+	exporter := NewGroupsExporterWithConfig(client, GroupsConfig{TrackReferences: true})
+
+	ch := make(chan prometheus.Metric, 100)
+	go func() {
+		exporter.Collect(ch)
+		close(ch)
+	}()
+	for range ch {
+		// Drain channel
+	}
+
+	// Partial data must not report every group as orphaned
+	if count := testutil.CollectAndCount(exporter.groupsOrphaned); count != 0 {
+		t.Errorf("Expected no orphaned groups metric on fetch error, got %d series", count)
+	}
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_policies")); value != 1 {
+		t.Errorf("Expected 1 policies fetch error, got %f", value)
+	}
+}
+
+func TestGroupsExporter_MembershipChanges(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewGroupsExporterWithConfig(client, GroupsConfig{SensitiveGroups: []string{"prod-admins"}})
+
+	hook := logtest.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	exporter.updateMetrics([]api.Group{
+		{Id: "group1", Name: "prod-admins", Peers: []api.PeerMinimum{{Id: "peer1", Name: "alice-laptop"}}},
+		{Id: "group2", Name: "devs", Peers: []api.PeerMinimum{{Id: "peer2", Name: "bob-laptop"}, {Id: "peer3", Name: "carol-laptop"}}},
+	})
+	if count := testutil.CollectAndCount(exporter.groupPeersAddedTotal); count != 2 {
+		t.Errorf("Expected the counters of both groups from the first collection, got %d series", count)
+	}
+	if value := testutil.ToFloat64(exporter.groupPeersAddedTotal.WithLabelValues("group2", "devs")); value != 0 {
+		t.Errorf("Expected no membership changes counted on the first collection, got %f", value)
+	}
+
+	exporter.updateMetrics([]api.Group{
+		{Id: "group1", Name: "prod-admins", Peers: []api.PeerMinimum{{Id: "peer1", Name: "alice-laptop"}, {Id: "peer4", Name: "mallory-laptop"}}},
+		{Id: "group2", Name: "devs", Peers: []api.PeerMinimum{{Id: "peer2", Name: "bob-laptop"}}},
+	})
+
+	if value := testutil.ToFloat64(exporter.groupPeersAddedTotal.WithLabelValues("group1", "prod-admins")); value != 1 {
+		t.Errorf("Expected 1 peer added to prod-admins, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.groupPeersRemovedTotal.WithLabelValues("group2", "devs")); value != 1 {
+		t.Errorf("Expected 1 peer removed from devs, got %f", value)
+	}
+
+	var sensitiveEntries []*logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "Sensitive group membership changed" {
+			sensitiveEntries = append(sensitiveEntries, entry)
+		}
+	}
+	if len(sensitiveEntries) != 1 {
+		t.Fatalf("Expected 1 sensitive group log entry, got %d", len(sensitiveEntries))
+	}
+	added, ok := sensitiveEntries[0].Data["peers_added"].([]api.PeerMinimum)
+	if !ok || len(added) != 1 || added[0].Name != "mallory-laptop" {
+		t.Errorf("Expected mallory-laptop in peers_added, got %v", sensitiveEntries[0].Data["peers_added"])
+	}
+
+	// Deleted groups drop their counters
+	exporter.updateMetrics([]api.Group{
+		{Id: "group1", Name: "prod-admins", Peers: []api.PeerMinimum{{Id: "peer1", Name: "alice-laptop"}, {Id: "peer4", Name: "mallory-laptop"}}},
+	})
+	if count := testutil.CollectAndCount(exporter.groupPeersRemovedTotal); count != 1 {
+		t.Errorf("Expected removed counters only for remaining groups, got %d series", count)
+	}
+}
+
+func TestGroupsExporter_IssuedBreakdown(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewGroupsExporter(client)
+
+	apiIssued := api.GroupIssuedApi
+	jwtIssued := api.GroupIssuedJwt
+	integrationIssued := api.GroupIssuedIntegration
+
+	exporter.updateMetrics([]api.Group{
+		{Id: "all", Name: "All", Issued: &apiIssued, PeersCount: 3, Peers: []api.PeerMinimum{{Id: "peer1"}, {Id: "peer2"}, {Id: "peer3"}}},
+		{Id: "group1", Name: "idp-devs", Issued: &jwtIssued, PeersCount: 2, Peers: []api.PeerMinimum{{Id: "peer1"}, {Id: "peer2"}}},
+		{Id: "group2", Name: "idp-ops", Issued: &jwtIssued, PeersCount: 1, Peers: []api.PeerMinimum{{Id: "peer1"}}},
+		{Id: "group3", Name: "servers", Issued: &apiIssued, PeersCount: 1, Peers: []api.PeerMinimum{{Id: "peer2"}}},
+		{Id: "group4", Name: "okta-sync", Issued: &integrationIssued, PeersCount: 1, Peers: []api.PeerMinimum{{Id: "peer3"}}},
+		{Id: "group5", Name: "legacy", PeersCount: 0},
+	})
+
+	expectedGroups := map[string]float64{"api": 2, "jwt": 2, "integration": 1, "unknown": 1}
+	for issued, value := range expectedGroups {
+		if got := testutil.ToFloat64(exporter.groupsByIssued.WithLabelValues(issued)); got != value {
+			t.Errorf("Expected %f groups issued by %s, got %f", value, issued, got)
+		}
+	}
+
+	// All is not counted, every peer is in it
+	expectedMemberships := map[string]float64{"api": 1, "jwt": 3, "integration": 1, "unknown": 0}
+	for issued, value := range expectedMemberships {
+		if got := testutil.ToFloat64(exporter.groupMembershipsByIssued.WithLabelValues(issued)); got != value {
+			t.Errorf("Expected %f memberships issued by %s, got %f", value, issued, got)
+		}
+	}
+
+	// Only peer1 is in JWT groups exclusively, peer2 is also in an API group
+	if value := testutil.ToFloat64(exporter.peersOnlyInJWTGroups.WithLabelValues()); value != 1 {
+		t.Errorf("Expected 1 peer only in JWT groups, got %f", value)
+	}
+}
@@ -0,0 +1,241 @@
+package exporters
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/sirupsen/logrus"
+)
+
+// Inventory object kinds, also the prefixes of redacted fields
+const (
+	inventoryPeers            = "peers"
+	inventoryUsers            = "users"
+	inventoryGroups           = "groups"
+	inventoryNetworks         = "networks"
+	inventoryNameserverGroups = "nameserver_groups"
+)
+
+// redactedValue replaces the value of redacted fields
+const redactedValue = "[REDACTED]"
+
+// Inventory is the most recent NetBird objects fetched by the exporter
+type Inventory struct {
+	GeneratedAt      time.Time         `json:"generated_at"`
+	Filters          map[string]string `json:"filters"`
+	Peers            *InventorySection `json:"peers"`
+	Users            *InventorySection `json:"users"`
+	Groups           *InventorySection `json:"groups"`
+	Networks         *InventorySection `json:"networks"`
+	NameserverGroups *InventorySection `json:"nameserver_groups"`
+}
+
+// InventorySection holds the objects of one kind, it is nil in the inventory
+// until the objects have been fetched once
+type InventorySection struct {
+	UpdatedAt time.Time        `json:"updated_at"`
+	Count     int              `json:"count"`
+	Items     []map[string]any `json:"items"`
+}
+
+// peerFilter selects the peers of the inventory from the query parameters
+type peerFilter struct {
+	group     string
+	os        string
+	connected *bool
+	country   string
+}
+
+// newPeerFilter parses the group, os, connected and country query parameters
+func newPeerFilter(r *http.Request) (peerFilter, map[string]string, error) {
+	query := r.URL.Query()
+	filter := peerFilter{
+		group:   query.Get("group"),
+		os:      strings.ToLower(query.Get("os")),
+		country: strings.ToUpper(query.Get("country")),
+	}
+	if value := query.Get("connected"); value != "" {
+		connected, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, nil, err
+		}
+		filter.connected = &connected
+	}
+
+	applied := make(map[string]string)
+	for _, key := range []string{"group", "os", "connected", "country"} {
+		if value := query.Get(key); value != "" {
+			applied[key] = value
+		}
+	}
+	return filter, applied, nil
+}
+
+// matches reports whether a peer passes the filter. Groups match by name or ID,
+// the OS by case-insensitive prefix (e.g. "linux") and the country by code.
+func (f peerFilter) matches(peer api.Peer) bool {
+	if f.connected != nil && peer.Connected != *f.connected {
+		return false
+	}
+	if f.os != "" && !strings.HasPrefix(strings.ToLower(peer.Os), f.os) {
+		return false
+	}
+	if f.country != "" && strings.ToUpper(peer.CountryCode) != f.country {
+		return false
+	}
+	if f.group != "" {
+		for _, group := range peer.Groups {
+			if group.Id == f.group || group.Name == f.group {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// parseRedactFields groups the redacted fields by kind. Fields are given as
+// kind.field with the JSON field name, e.g. users.email.
+func parseRedactFields(fields []string) map[string][]string {
+	kinds := map[string]bool{
+		inventoryPeers:            true,
+		inventoryUsers:            true,
+		inventoryGroups:           true,
+		inventoryNetworks:         true,
+		inventoryNameserverGroups: true,
+	}
+
+	redact := make(map[string][]string)
+	for _, field := range fields {
+		kind, name, ok := strings.Cut(field, ".")
+		if !ok || !kinds[kind] || name == "" {
+			logrus.WithField("field", field).Warn("Ignoring invalid inventory redact field, expected kind.field")
+			continue
+		}
+		redact[kind] = append(redact[kind], name)
+	}
+	return redact
+}
+
+// newInventorySection converts objects to JSON objects and redacts their fields
+func newInventorySection[T any](objects []T, updated time.Time, redact []string) (*InventorySection, error) {
+	data, err := json.Marshal(objects)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]any, 0, len(objects))
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		for _, field := range redact {
+			if _, ok := item[field]; ok {
+				item[field] = redactedValue
+			}
+		}
+	}
+	return &InventorySection{UpdatedAt: updated, Count: len(items), Items: items}, nil
+}
+
+// buildInventory assembles the inventory from the store, ok is false when
+// nothing has been fetched yet
+func (e *NetBirdExporter) buildInventory(filter peerFilter, redact map[string][]string) (*Inventory, bool, error) {
+	inventory := &Inventory{GeneratedAt: time.Now()}
+	found := false
+	var err error
+
+	if peers, updated, ok := e.store.Peers(); ok {
+		found = true
+		selected := make([]api.Peer, 0, len(peers))
+		for _, peer := range peers {
+			if filter.matches(peer) {
+				selected = append(selected, peer)
+			}
+		}
+		if inventory.Peers, err = newInventorySection(selected, updated, redact[inventoryPeers]); err != nil {
+			return nil, false, err
+		}
+	}
+	if users, updated, ok := e.store.Users(); ok {
+		found = true
+		if inventory.Users, err = newInventorySection(users, updated, redact[inventoryUsers]); err != nil {
+			return nil, false, err
+		}
+	}
+	if groups, updated, ok := e.store.Groups(); ok {
+		found = true
+		if inventory.Groups, err = newInventorySection(groups, updated, redact[inventoryGroups]); err != nil {
+			return nil, false, err
+		}
+	}
+	if networks, updated, ok := e.store.Networks(); ok {
+		found = true
+		if inventory.Networks, err = newInventorySection(networks, updated, redact[inventoryNetworks]); err != nil {
+			return nil, false, err
+		}
+	}
+	if nameserverGroups, updated, ok := e.store.NameserverGroups(); ok {
+		found = true
+		if inventory.NameserverGroups, err = newInventorySection(nameserverGroups, updated, redact[inventoryNameserverGroups]); err != nil {
+			return nil, false, err
+		}
+	}
+	return inventory, found, nil
+}
+
+// InventoryHandlerConfig holds the configuration of the inventory endpoint
+type InventoryHandlerConfig struct {
+	// RedactFields lists the fields replaced with "[REDACTED]" as kind.field,
+	// e.g. users.email
+	RedactFields []string
+	// Token is required as a bearer token on every request when set, the
+	// inventory holds user emails and peer IPs
+	Token string
+}
+
+// InventoryHandler serves the objects fetched by the latest collection as JSON.
+// Peers can be filtered with the group, os, connected and country query
+// parameters.
+func (e *NetBirdExporter) InventoryHandler(config InventoryHandlerConfig) http.Handler {
+	redact := parseRedactFields(config.RedactFields)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.Token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(config.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="inventory"`)
+				http.Error(w, "invalid or missing bearer token", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		filter, applied, err := newPeerFilter(r)
+		if err != nil {
+			http.Error(w, "invalid connected filter, expected true or false", http.StatusBadRequest)
+			return
+		}
+
+		inventory, ok, err := e.buildInventory(filter, redact)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to build inventory")
+			http.Error(w, "failed to build inventory", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "inventory not available yet", http.StatusServiceUnavailable)
+			return
+		}
+		inventory.Filters = applied
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(inventory); err != nil {
+			logrus.WithError(err).Error("Failed to write inventory")
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package exporters
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+)
+
+// getInventory requests the inventory and decodes the response
+func getInventory(t *testing.T, handler http.Handler, target string) (int, Inventory) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+	var inventory Inventory
+	if rec.Code == http.StatusOK {
+		if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("Expected JSON content type, got %s", contentType)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &inventory); err != nil {
+			t.Fatalf("Failed to decode inventory: %v", err)
+		}
+	}
+	return rec.Code, inventory
+}
+
+// peerIDs returns the IDs of the peers in the inventory
+func peerIDs(inventory Inventory) []string {
+	if inventory.Peers == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(inventory.Peers.Items))
+	for _, item := range inventory.Peers.Items {
+		ids = append(ids, item["id"].(string))
+	}
+	return ids
+}
+
+func TestNetBirdExporter_InventoryHandler(t *testing.T) {
+	exporter := NewNetBirdExporter("https://api.netbird.io", "test-token")
+	handler := exporter.InventoryHandler(InventoryHandlerConfig{})
+
+	// No collection yet
+	if code, _ := getInventory(t, handler, "/api/v1/inventory"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 before the first collection, got %d", code)
+	}
+
+	exporter.store.SetPeers([]api.Peer{
+		{Id: "peer1", Os: "Linux 6.1", Connected: true, CountryCode: "DE", Groups: []api.GroupMinimum{{Id: "group1", Name: "servers"}}},
+		{Id: "peer2", Os: "Darwin 14.5", Connected: false, CountryCode: "US", Groups: []api.GroupMinimum{{Id: "group2", Name: "laptops"}}},
+		{Id: "peer3", Os: "linux", Connected: false, CountryCode: "de", Groups: []api.GroupMinimum{{Id: "group1", Name: "servers"}}},
+	})
+	exporter.store.SetUsers([]api.User{{Id: "user1", Email: "alice@example.com"}})
+
+	code, inventory := getInventory(t, handler, "/api/v1/inventory")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if inventory.Peers == nil || inventory.Peers.Count != 3 || inventory.Peers.UpdatedAt.IsZero() {
+		t.Errorf("Expected 3 peers with an update time, got %+v", inventory.Peers)
+	}
+	if inventory.Users == nil || inventory.Users.Count != 1 {
+		t.Errorf("Expected 1 user, got %+v", inventory.Users)
+	}
+	if inventory.Groups != nil {
+		t.Errorf("Expected no groups section before groups are fetched, got %+v", inventory.Groups)
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"group=servers", []string{"peer1", "peer3"}},
+		{"group=group2", []string{"peer2"}},
+		{"os=linux", []string{"peer1", "peer3"}},
+		{"connected=false", []string{"peer2", "peer3"}},
+		{"country=de", []string{"peer1", "peer3"}},
+		{"group=servers&connected=true", []string{"peer1"}},
+		{"group=unknown", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			code, inventory := getInventory(t, handler, "/api/v1/inventory?"+tt.query)
+			if code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", code)
+			}
+			ids := peerIDs(inventory)
+			if len(ids) != len(tt.expected) {
+				t.Fatalf("Expected peers %v, got %v", tt.expected, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.expected[i] {
+					t.Errorf("Expected peers %v, got %v", tt.expected, ids)
+				}
+			}
+			if len(inventory.Filters) == 0 {
+				t.Error("Expected the applied filters in the response")
+			}
+		})
+	}
+
+	if code, _ := getInventory(t, handler, "/api/v1/inventory?connected=maybe"); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid connected filter, got %d", code)
+	}
+}
+
+func TestNetBirdExporter_InventoryRedaction(t *testing.T) {
+	exporter := NewNetBirdExporter("https://api.netbird.io", "test-token")
+	handler := exporter.InventoryHandler(InventoryHandlerConfig{RedactFields: []string{"peers.connection_ip", "users.email", "invalid", "secrets.token"}})
+
+	exporter.store.SetPeers([]api.Peer{{Id: "peer1", Name: "server", ConnectionIp: "203.0.113.10"}})
+	exporter.store.SetUsers([]api.User{{Id: "user1", Name: "Alice", Email: "alice@example.com"}})
+
+	code, inventory := getInventory(t, handler, "/api/v1/inventory")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+
+	peer := inventory.Peers.Items[0]
+	if peer["connection_ip"] != redactedValue {
+		t.Errorf("Expected redacted connection_ip, got %v", peer["connection_ip"])
+	}
+	if peer["name"] != "server" {
+		t.Errorf("Expected peer name to be kept, got %v", peer["name"])
+	}
+
+	user := inventory.Users.Items[0]
+	if user["email"] != redactedValue {
+		t.Errorf("Expected redacted email, got %v", user["email"])
+	}
+	if user["name"] != "Alice" {
+		t.Errorf("Expected user name to be kept, got %v", user["name"])
+	}
+}
+
+func TestNetBirdExporter_InventoryToken(t *testing.T) {
+	exporter := NewNetBirdExporter("https://api.netbird.io", "test-token")
+	exporter.store.SetPeers([]api.Peer{{Id: "peer1"}})
+	handler := exporter.InventoryHandler(InventoryHandlerConfig{Token: "secret"})
+
+	for _, authorization := range []string{"", "Bearer wrong", "secret", "Token secret"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/inventory", nil)
+		req.Header.Set("Authorization", authorization)
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Expected status 401 for %q, got %d", authorization, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/inventory", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with the token, got %d", rec.Code)
+	}
+}
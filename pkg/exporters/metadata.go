@@ -0,0 +1,99 @@
+package exporters
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxLabels bounds the number of variable labels tried for a descriptor
+const maxLabels = 32
+
+// Metric describes a metric produced by the exporters
+type Metric struct {
+	Name   string
+	Help   string
+	Labels []string
+}
+
+// describedCollector collects one sample for each descriptor of a collector.
+// As prometheus.Desc does not export its fields, each variable label gets its
+// position as value, so that the gathered samples give the labels in order.
+type describedCollector struct {
+	descs []*prometheus.Desc
+}
+
+// Describe implements prometheus.Collector
+func (c *describedCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *describedCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, desc := range c.descs {
+		var err error
+		values := make([]string, 0, maxLabels)
+		for len(values) <= maxLabels {
+			var metric prometheus.Metric
+			if metric, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, 0, values...); err == nil {
+				ch <- metric
+				break
+			}
+			values = append(values, strconv.Itoa(len(values)))
+		}
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(desc, err)
+		}
+	}
+}
+
+// Metrics returns the metrics described by a collector, sorted by name
+func Metrics(collector prometheus.Collector) ([]Metric, error) {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		collector.Describe(ch)
+		close(ch)
+	}()
+
+	seen := make(map[*prometheus.Desc]bool)
+	described := &describedCollector{}
+	for desc := range ch {
+		if seen[desc] {
+			continue
+		}
+		seen[desc] = true
+		described.descs = append(described.descs, desc)
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(described); err != nil {
+		return nil, fmt.Errorf("registering the descriptors: %w", err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, fmt.Errorf("gathering the descriptors: %w", err)
+	}
+
+	metrics := make([]Metric, 0, len(families))
+	for _, family := range families {
+		pairs := family.GetMetric()[0].GetLabel()
+		labels := make([]string, len(pairs))
+		for _, pair := range pairs {
+			position, err := strconv.Atoi(pair.GetValue())
+			if err != nil || position >= len(labels) {
+				return nil, fmt.Errorf("metric %s has an unexpected label %s", family.GetName(), pair.GetName())
+			}
+			labels[position] = pair.GetName()
+		}
+		if len(labels) == 0 {
+			labels = nil
+		}
+		metrics = append(metrics, Metric{Name: family.GetName(), Help: family.GetHelp(), Labels: labels})
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics, nil
+}
@@ -0,0 +1,63 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetrics(t *testing.T) {
+	exporter := NewNetBirdExporterWithConfig("http://localhost", "test-token", AllCollectorsConfig())
+	metrics, err := Metrics(exporter)
+	if err != nil {
+		t.Fatalf("Failed to describe the metrics: %v", err)
+	}
+
+	var peersConnected *Metric
+	for i, metric := range metrics {
+		if metric.Name == "netbird_peers_connected" {
+			peersConnected = &metrics[i]
+		}
+	}
+	if peersConnected == nil {
+		t.Fatal("Expected netbird_peers_connected to be described")
+	}
+	if peersConnected.Help != "Number of connected NetBird peers" {
+		t.Errorf("Expected the help text, got %q", peersConnected.Help)
+	}
+	if len(peersConnected.Labels) != 1 || peersConnected.Labels[0] != "connected" {
+		t.Errorf("Expected the connected label, got %v", peersConnected.Labels)
+	}
+
+	// Every descriptor has its Metric, none is skipped
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		exporter.Describe(ch)
+		close(ch)
+	}()
+	described := 0
+	for range ch {
+		described++
+	}
+	if described != len(metrics) {
+		t.Errorf("Expected a Metric for each of the %d descriptors, got %d", described, len(metrics))
+	}
+}
+
+func TestMetrics_LabelOrder(t *testing.T) {
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "ordered", Help: "Labels out of alphabetical order"}, []string{"zone", "app", "mode"})
+	metrics, err := Metrics(vec)
+	if err != nil {
+		t.Fatalf("Failed to describe the metrics: %v", err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("Expected one metric, got %v", metrics)
+	}
+	if labels := strings.Join(metrics[0].Labels, ","); labels != "zone,app,mode" {
+		t.Errorf("Expected the labels in declaration order, got %s", labels)
+	}
+	if metrics[0].Help != "Labels out of alphabetical order" {
+		t.Errorf("Expected the help text, got %q", metrics[0].Help)
+	}
+}
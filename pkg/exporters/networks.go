@@ -2,6 +2,9 @@ package exporters
 
 import (
 	"context"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	nbclient "github.com/netbirdio/netbird/management/client/rest"
@@ -10,25 +13,53 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// NetworksConfig holds optional settings for the networks exporter
+type NetworksConfig struct {
+	// CollectDetails fetches the routers and resources of every network and the
+	// routes, and joins them with peer connection state. This costs one extra API
+	// call plus two per network on every scrape.
+	CollectDetails bool
+}
+
 // NetworksExporter handles networks-specific metrics collection
 type NetworksExporter struct {
 	client *nbclient.Client
+	config NetworksConfig
+	store  *Store
 
 	// Prometheus metrics for networks
-	networksTotal            *prometheus.GaugeVec
-	networkRoutersCount      *prometheus.GaugeVec
-	networkResourcesCount    *prometheus.GaugeVec
-	networkPoliciesCount     *prometheus.GaugeVec
-	networkRoutingPeersCount *prometheus.GaugeVec
-	networkInfo              *prometheus.GaugeVec
-	scrapeErrorsTotal        *prometheus.CounterVec
-	scrapeDuration           *prometheus.HistogramVec
+	networksTotal               *prometheus.GaugeVec
+	networkRoutersCount         *prometheus.GaugeVec
+	networkResourcesCount       *prometheus.GaugeVec
+	networkPoliciesCount        *prometheus.GaugeVec
+	networkRoutingPeersCount    *prometheus.GaugeVec
+	networkInfo                 *prometheus.GaugeVec
+	networkRouterInfo           *prometheus.GaugeVec
+	networkRouterMetric         *prometheus.GaugeVec
+	networkRouterPeers          *prometheus.GaugeVec
+	networkResourceInfo         *prometheus.GaugeVec
+	networkHARoutersOnline      *prometheus.GaugeVec
+	networkHARoutersTotal       *prometheus.GaugeVec
+	networkHARatio              *prometheus.GaugeVec
+	networkSinglePointOfFailure *prometheus.GaugeVec
+	routeHARoutersOnline        *prometheus.GaugeVec
+	routeHARoutersTotal         *prometheus.GaugeVec
+	routeHARatio                *prometheus.GaugeVec
+	routeSinglePointOfFailure   *prometheus.GaugeVec
+	scrapeErrorsTotal           *prometheus.CounterVec
+	scrapeDuration              *prometheus.HistogramVec
 }
 
 // NewNetworksExporter creates a new networks exporter
 func NewNetworksExporter(client *nbclient.Client) *NetworksExporter {
+	return NewNetworksExporterWithConfig(client, NetworksConfig{})
+}
+
+// NewNetworksExporterWithConfig creates a new networks exporter with the given settings
+func NewNetworksExporterWithConfig(client *nbclient.Client, config NetworksConfig) *NetworksExporter {
 	return &NetworksExporter{
 		client: client,
+		config: config,
 
 		networksTotal: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
@@ -78,6 +109,102 @@ func NewNetworksExporter(client *nbclient.Client) *NetworksExporter {
 			[]string{"network_id", "network_name", "description"},
 		),
 
+		networkRouterInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_network_router_info",
+				Help: "Information about NetBird network routers (always 1)",
+			},
+			[]string{"network_id", "network_name", "router_id", "assignment", "peer_id", "peer_groups", "masquerade", "enabled"},
+		),
+
+		networkRouterMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_network_router_metric",
+				Help: "Route metric of each NetBird network router, lower is preferred",
+			},
+			[]string{"network_id", "network_name", "router_id"},
+		),
+
+		networkRouterPeers: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_network_router_peers",
+				Help: "Number of peers backing each NetBird network router by connection status",
+			},
+			[]string{"network_id", "network_name", "router_id", "connected"},
+		),
+
+		networkResourceInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_network_resource_info",
+				Help: "Information about NetBird network resources (always 1)",
+			},
+			[]string{"network_id", "network_name", "resource_id", "resource_name", "type", "address", "enabled"},
+		),
+
+		networkHARoutersOnline: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_network_ha_routers_online",
+				Help: "Number of online routers, enabled and with at least one connected peer, of each NetBird network",
+			},
+			[]string{"network_id", "network_name"},
+		),
+
+		networkHARoutersTotal: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_network_ha_routers_total",
+				Help: "Number of enabled routers in each NetBird network",
+			},
+			[]string{"network_id", "network_name"},
+		),
+
+		networkHARatio: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_network_ha_ratio",
+				Help: "Ratio of online to enabled routers of each NetBird network",
+			},
+			[]string{"network_id", "network_name"},
+		),
+
+		networkSinglePointOfFailure: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_network_single_point_of_failure",
+				Help: "Whether exactly one routing peer of each NetBird network is connected (1 for yes, 0 for no)",
+			},
+			[]string{"network_id", "network_name"},
+		),
+
+		routeHARoutersOnline: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_route_ha_routers_online",
+				Help: "Number of enabled NetBird routes with at least one connected peer for each route network identifier",
+			},
+			[]string{"route_network"},
+		),
+
+		routeHARoutersTotal: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_route_ha_routers_total",
+				Help: "Number of enabled NetBird routes for each route network identifier",
+			},
+			[]string{"route_network"},
+		),
+
+		routeHARatio: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_route_ha_ratio",
+				Help: "Ratio of online to enabled NetBird routes for each route network identifier",
+			},
+			[]string{"route_network"},
+		),
+
+		routeSinglePointOfFailure: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_route_single_point_of_failure",
+				Help: "Whether exactly one routing peer of each NetBird route network identifier is connected (1 for yes, 0 for no)",
+			},
+			[]string{"route_network"},
+		),
+
 		scrapeErrorsTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "netbird_networks_scrape_errors_total",
@@ -104,6 +231,18 @@ func (e *NetworksExporter) Describe(ch chan<- *prometheus.Desc) {
 	e.networkPoliciesCount.Describe(ch)
 	e.networkRoutingPeersCount.Describe(ch)
 	e.networkInfo.Describe(ch)
+	e.networkRouterInfo.Describe(ch)
+	e.networkRouterMetric.Describe(ch)
+	e.networkRouterPeers.Describe(ch)
+	e.networkResourceInfo.Describe(ch)
+	e.networkHARoutersOnline.Describe(ch)
+	e.networkHARoutersTotal.Describe(ch)
+	e.networkHARatio.Describe(ch)
+	e.networkSinglePointOfFailure.Describe(ch)
+	e.routeHARoutersOnline.Describe(ch)
+	e.routeHARoutersTotal.Describe(ch)
+	e.routeHARatio.Describe(ch)
+	e.routeSinglePointOfFailure.Describe(ch)
 	e.scrapeErrorsTotal.Describe(ch)
 	e.scrapeDuration.Describe(ch)
 }
@@ -120,6 +259,18 @@ func (e *NetworksExporter) Collect(ch chan<- prometheus.Metric) {
 	e.networkPoliciesCount.Reset()
 	e.networkRoutingPeersCount.Reset()
 	e.networkInfo.Reset()
+	e.networkRouterInfo.Reset()
+	e.networkRouterMetric.Reset()
+	e.networkRouterPeers.Reset()
+	e.networkResourceInfo.Reset()
+	e.networkHARoutersOnline.Reset()
+	e.networkHARoutersTotal.Reset()
+	e.networkHARatio.Reset()
+	e.networkSinglePointOfFailure.Reset()
+	e.routeHARoutersOnline.Reset()
+	e.routeHARoutersTotal.Reset()
+	e.routeHARatio.Reset()
+	e.routeSinglePointOfFailure.Reset()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -128,11 +279,17 @@ func (e *NetworksExporter) Collect(ch chan<- prometheus.Metric) {
 	if err != nil {
 		logrus.WithError(err).Error("Failed to fetch networks")
 		e.scrapeErrorsTotal.WithLabelValues("fetch_networks").Inc()
+		e.scrapeErrorsTotal.Collect(ch)
 		return
 	}
 
+	e.store.SetNetworks(networks)
 	e.updateMetrics(networks)
 
+	if e.config.CollectDetails {
+		e.collectDetails(ctx, networks)
+	}
+
 	// Collect all metrics
 	e.networksTotal.Collect(ch)
 	e.networkRoutersCount.Collect(ch)
@@ -140,6 +297,18 @@ func (e *NetworksExporter) Collect(ch chan<- prometheus.Metric) {
 	e.networkPoliciesCount.Collect(ch)
 	e.networkRoutingPeersCount.Collect(ch)
 	e.networkInfo.Collect(ch)
+	e.networkRouterInfo.Collect(ch)
+	e.networkRouterMetric.Collect(ch)
+	e.networkRouterPeers.Collect(ch)
+	e.networkResourceInfo.Collect(ch)
+	e.networkHARoutersOnline.Collect(ch)
+	e.networkHARoutersTotal.Collect(ch)
+	e.networkHARatio.Collect(ch)
+	e.networkSinglePointOfFailure.Collect(ch)
+	e.routeHARoutersOnline.Collect(ch)
+	e.routeHARoutersTotal.Collect(ch)
+	e.routeHARatio.Collect(ch)
+	e.routeSinglePointOfFailure.Collect(ch)
 	e.scrapeErrorsTotal.Collect(ch)
 	e.scrapeDuration.Collect(ch)
 }
@@ -188,3 +357,235 @@ func (e *NetworksExporter) updateMetrics(networks []api.Network) {
 		"total_routing_peers": totalRoutingPeers,
 	}).Debug("Updated network metrics")
 }
+
+// collectDetails fetches the routers and resources of each network, as well as
+// the routes, and updates the detail and high-availability metrics. Networks
+// whose sub-resources can't be fetched are skipped.
+func (e *NetworksExporter) collectDetails(ctx context.Context, networks []api.Network) {
+	peers, err := e.peers(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch peers for network routers")
+		e.scrapeErrorsTotal.WithLabelValues("fetch_peers").Inc()
+		return
+	}
+	index := newPeerIndex(peers)
+
+	routes, err := e.client.Routes.List(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch routes")
+		e.scrapeErrorsTotal.WithLabelValues("fetch_routes").Inc()
+	} else {
+		e.updateRouteHAMetrics(routes, index)
+	}
+
+	for _, network := range networks {
+		routers, err := e.client.Networks.Routers(network.Id).List(ctx)
+		if err != nil {
+			logrus.WithError(err).WithField("network_id", network.Id).Error("Failed to fetch network routers")
+			e.scrapeErrorsTotal.WithLabelValues("fetch_network_routers").Inc()
+		} else {
+			e.updateRouterMetrics(network, routers, index)
+		}
+
+		resources, err := e.client.Networks.Resources(network.Id).List(ctx)
+		if err != nil {
+			logrus.WithError(err).WithField("network_id", network.Id).Error("Failed to fetch network resources")
+			e.scrapeErrorsTotal.WithLabelValues("fetch_network_resources").Inc()
+		} else {
+			e.updateResourceMetrics(network, resources)
+		}
+	}
+}
+
+// peers returns the peers collected by the peers exporter during this scrape,
+// or fetches them when the exporter runs standalone or the peers exporter
+// failed to fetch them
+func (e *NetworksExporter) peers(ctx context.Context) ([]api.Peer, error) {
+	if peers, ok := e.store.CurrentPeers(); ok {
+		return peers, nil
+	}
+	return e.client.Peers.List(ctx)
+}
+
+// peerIndex looks up peers by ID and by group membership
+type peerIndex struct {
+	byID    map[string]api.Peer
+	byGroup map[string][]api.Peer
+}
+
+func newPeerIndex(peers []api.Peer) peerIndex {
+	index := peerIndex{
+		byID:    make(map[string]api.Peer, len(peers)),
+		byGroup: make(map[string][]api.Peer),
+	}
+	for _, peer := range peers {
+		index.byID[peer.Id] = peer
+		for _, group := range peer.Groups {
+			index.byGroup[group.Id] = append(index.byGroup[group.Id], peer)
+		}
+	}
+	return index
+}
+
+// backingPeers returns the distinct peers behind a router or route, either
+// its single peer or the members of its peer groups
+func (i peerIndex) backingPeers(peerID *string, peerGroups *[]string) []api.Peer {
+	seen := make(map[string]bool)
+	peers := make([]api.Peer, 0)
+	add := func(peer api.Peer) {
+		if !seen[peer.Id] {
+			seen[peer.Id] = true
+			peers = append(peers, peer)
+		}
+	}
+
+	if peerID != nil && *peerID != "" {
+		if peer, ok := i.byID[*peerID]; ok {
+			add(peer)
+		}
+	}
+	if peerGroups != nil {
+		for _, groupID := range *peerGroups {
+			for _, peer := range i.byGroup[groupID] {
+				add(peer)
+			}
+		}
+	}
+	return peers
+}
+
+// haHealth counts enabled routers, how many of them are online, i.e. have at
+// least one connected routing peer, and the distinct connected routing peers
+// across them
+type haHealth struct {
+	online int
+	total  int
+	// connected holds the IDs of the connected routing peers, a peer-group
+	// router with several of them is not a single point of failure
+	connected map[string]bool
+}
+
+func newHAHealth() *haHealth {
+	return &haHealth{connected: make(map[string]bool)}
+}
+
+// add counts an enabled router backed by the given peers
+func (h *haHealth) add(peers []api.Peer) {
+	h.total++
+	online := false
+	for _, peer := range peers {
+		if peer.Connected {
+			h.connected[peer.Id] = true
+			online = true
+		}
+	}
+	if online {
+		h.online++
+	}
+}
+
+// set exports the health to the given online, total, ratio and single point
+// of failure gauges. The ratio is omitted when there are no enabled routers.
+func (h *haHealth) set(labels []string, online, total, ratio, spof *prometheus.GaugeVec) {
+	online.WithLabelValues(labels...).Set(float64(h.online))
+	total.WithLabelValues(labels...).Set(float64(h.total))
+	if h.total > 0 {
+		ratio.WithLabelValues(labels...).Set(float64(h.online) / float64(h.total))
+	}
+	singlePoint := 0.0
+	if len(h.connected) == 1 {
+		singlePoint = 1
+	}
+	spof.WithLabelValues(labels...).Set(singlePoint)
+}
+
+// updateRouterMetrics updates the per-router metrics of a network
+func (e *NetworksExporter) updateRouterMetrics(network api.Network, routers []api.NetworkRouter, index peerIndex) {
+	health := newHAHealth()
+
+	for _, router := range routers {
+		assignment := "peer"
+		peerID := ""
+		if router.Peer != nil {
+			peerID = *router.Peer
+		}
+		peerGroups := ""
+		if router.PeerGroups != nil && len(*router.PeerGroups) > 0 {
+			assignment = "peer_group"
+			groups := append([]string{}, *router.PeerGroups...)
+			sort.Strings(groups)
+			peerGroups = strings.Join(groups, ",")
+		}
+
+		e.networkRouterInfo.WithLabelValues(
+			network.Id, network.Name, router.Id, assignment, peerID, peerGroups,
+			strconv.FormatBool(router.Masquerade), strconv.FormatBool(router.Enabled),
+		).Set(1)
+		e.networkRouterMetric.WithLabelValues(network.Id, network.Name, router.Id).Set(float64(router.Metric))
+
+		routerPeers := index.backingPeers(router.Peer, router.PeerGroups)
+		if router.Enabled {
+			health.add(routerPeers)
+		}
+
+		connected, disconnected := 0, 0
+		for _, peer := range routerPeers {
+			if peer.Connected {
+				connected++
+			} else {
+				disconnected++
+			}
+		}
+		e.networkRouterPeers.WithLabelValues(network.Id, network.Name, router.Id, "true").Set(float64(connected))
+		e.networkRouterPeers.WithLabelValues(network.Id, network.Name, router.Id, "false").Set(float64(disconnected))
+	}
+
+	health.set([]string{network.Id, network.Name},
+		e.networkHARoutersOnline, e.networkHARoutersTotal, e.networkHARatio, e.networkSinglePointOfFailure)
+
+	logrus.WithFields(logrus.Fields{
+		"network_id":      network.Id,
+		"routers":         len(routers),
+		"enabled_routers": health.total,
+		"online_routers":  health.online,
+	}).Debug("Updated network router metrics")
+}
+
+// updateRouteHAMetrics updates the high-availability metrics of the routes.
+// NetBird makes routes sharing a network identifier highly available, so each
+// enabled route of a network identifier counts as one of its routers.
+func (e *NetworksExporter) updateRouteHAMetrics(routes []api.Route, index peerIndex) {
+	healthByNetwork := make(map[string]*haHealth)
+	for _, route := range routes {
+		if !route.Enabled {
+			continue
+		}
+
+		health, ok := healthByNetwork[route.NetworkId]
+		if !ok {
+			health = newHAHealth()
+			healthByNetwork[route.NetworkId] = health
+		}
+		health.add(index.backingPeers(route.Peer, route.PeerGroups))
+	}
+
+	for network, health := range healthByNetwork {
+		health.set([]string{network},
+			e.routeHARoutersOnline, e.routeHARoutersTotal, e.routeHARatio, e.routeSinglePointOfFailure)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"routes":         len(routes),
+		"route_networks": len(healthByNetwork),
+	}).Debug("Updated route high-availability metrics")
+}
+
+// updateResourceMetrics updates the per-resource metrics of a network
+func (e *NetworksExporter) updateResourceMetrics(network api.Network, resources []api.NetworkResource) {
+	for _, resource := range resources {
+		e.networkResourceInfo.WithLabelValues(
+			network.Id, network.Name, resource.Id, resource.Name, string(resource.Type),
+			resource.Address, strconv.FormatBool(resource.Enabled),
+		).Set(1)
+	}
+}
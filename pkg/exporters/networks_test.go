@@ -1,15 +1,15 @@
 package exporters
 
 import (
-	"encoding/json"
 	"net/http"
-	"net/http/httptest"
-	"strings"
 	"testing"
 
 	nbclient "github.com/netbirdio/netbird/management/client/rest"
 	"github.com/netbirdio/netbird/management/server/http/api"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
 )
 
 func TestNewNetworksExporter(t *testing.T) {
@@ -69,51 +69,18 @@ func TestNetworksExporter_Describe(t *testing.T) {
 }
 
 func TestNetworksExporter_Collect_Success(t *testing.T) {
-	// Create mock server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/api/networks" {
-			http.NotFound(w, r)
-			return
-		}
-
-		token := r.Header.Get("Authorization")
-		if !strings.HasPrefix(token, "Token ") {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		description1 := "Production network"
-		description2 := "Development network"
-		networks := []api.Network{
-			{
-				Id:                "net1",
-				Name:              "production-network",
-				Description:       &description1,
-				Routers:           []string{"router1", "router2"},
-				RoutingPeersCount: 5,
-				Resources:         []string{"resource1", "resource2", "resource3"},
-				Policies:          []string{"policy1"},
-			},
-			{
-				Id:                "net2",
-				Name:              "development-network",
-				Description:       &description2,
-				Routers:           []string{"router3"},
-				RoutingPeersCount: 2,
-				Resources:         []string{"resource4"},
-				Policies:          []string{"policy2", "policy3"},
-			},
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(networks); err != nil {
-			t.Errorf("Failed to encode networks: %v", err)
-		}
-	}))
-	defer server.Close()
-
-	client := nbclient.New(server.URL, "test-token")
+	f := fakeapi.NewFixture("example.com")
+	f.Peer("gw-1").Connected()
+	f.Peer("gw-2").Connected().Groups("dev-routers")
+	f.Network("production-network").Router("gw-1").
+		Resource("db", "10.0.0.10/32", "servers").
+		Resource("lan", "10.0.0.0/24", "servers").
+		Resource("wiki", "wiki.example.com", "servers")
+	f.Network("development-network").RouterGroup("dev-routers").
+		Resource("build", "10.1.0.10/32", "servers")
+	_, url := newTestAPI(t, f)
+
+	client := nbclient.New(url, "test-token")
 	exporter := NewNetworksExporter(client)
 
 	// Collect metrics
@@ -164,14 +131,12 @@ func TestNetworksExporter_Collect_Success(t *testing.T) {
 }
 
 func TestNetworksExporter_Collect_APIError(t *testing.T) {
-	// Create mock server that returns error
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-	}))
-	defer server.Close()
+	f := fakeapi.NewFixture("example.com")
+	f.Network("office").Resource("db", "10.0.0.10/32", "servers")
+	server, url := newTestAPI(t, f)
+	server.InjectError("/api/networks", http.StatusInternalServerError, -1)
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewNetworksExporter(client)
+	exporter := NewNetworksExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 50)
@@ -180,29 +145,19 @@ func TestNetworksExporter_Collect_APIError(t *testing.T) {
 		close(ch)
 	}()
 
-	// Should still complete without error (though may not collect useful data)
-	metricCount := 0
+	// Should complete without panic or hang
 	for range ch {
-		metricCount++
+		// Drain channel
+	}
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_networks")); value != 1 {
+		t.Errorf("Expected 1 fetch_networks error, got %f", value)
 	}
-
-	// Even with API errors, some metrics might still be collected
-	// This test ensures the collection doesn't panic or hang
 }
 
 func TestNetworksExporter_Collect_EmptyResponse(t *testing.T) {
-	// Create mock server that returns empty array
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte(`[]`)); err != nil {
-			t.Errorf("Failed to write response: %v", err)
-		}
-	}))
-	defer server.Close()
+	_, url := newTestAPI(t, fakeapi.NewFixture("example.com"))
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewNetworksExporter(client)
+	exporter := NewNetworksExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 50)
@@ -223,18 +178,10 @@ func TestNetworksExporter_Collect_EmptyResponse(t *testing.T) {
 }
 
 func TestNetworksExporter_Collect_InvalidJSON(t *testing.T) {
-	// Create mock server that returns invalid JSON
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte(`invalid json`)); err != nil {
-			t.Errorf("Failed to write response: %v", err)
-		}
-	}))
-	defer server.Close()
+	server, url := newTestAPI(t, fakeapi.NewFixture("example.com"))
+	server.InjectBody("/api/networks", "invalid json", -1)
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewNetworksExporter(client)
+	exporter := NewNetworksExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 50)
@@ -247,6 +194,9 @@ func TestNetworksExporter_Collect_InvalidJSON(t *testing.T) {
 	for range ch {
 		// Drain channel
 	}
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_networks")); value != 1 {
+		t.Errorf("Expected 1 fetch_networks error, got %f", value)
+	}
 }
 
 func TestNetworksExporter_UpdateMetrics(t *testing.T) {
@@ -338,3 +288,218 @@ func TestNetworksExporter_MetricsReset(t *testing.T) {
 		}
 	}
 }
+
+// networkDetailsAPI serves the office network, routed by gw-1 and by the peers
+// of two groups, and legacy routes, returning the URL of the fake API
+func networkDetailsAPI(t *testing.T) string {
+	t.Helper()
+
+	f := fakeapi.NewFixture("example.com")
+	f.Peer("gw-1")
+	f.Peer("gw-2").Connected().Groups("routers-a")
+	f.Peer("gw-3").Groups("routers-a", "routers-b")
+	f.Network("office").Router("gw-1").RouterGroup("routers-b", "routers-a").
+		Resource("db", "10.0.0.10/32", "servers").
+		Resource("intranet", "*.corp.example.com", "servers").
+		DisableResource("intranet")
+	f.Route("legacy-lan", "gw-1")
+	f.HARoute("legacy-dc", "routers-a")
+	f.HARoute("disabled", "routers-a").DisableRoute("disabled")
+	f.Route("legacy-dc", "gw-1")
+	_, url := newTestAPI(t, f)
+	return url
+}
+
+func TestNetworksExporter_CollectDetails(t *testing.T) {
+	client := nbclient.New(networkDetailsAPI(t), "test-token")
+	exporter := NewNetworksExporterWithConfig(client, NetworksConfig{CollectDetails: true})
+
+	ch := make(chan prometheus.Metric, 100)
+	go func() {
+		exporter.Collect(ch)
+		close(ch)
+	}()
+	for range ch {
+		// Drain channel
+	}
+
+	if value := testutil.ToFloat64(exporter.networkRouterInfo.WithLabelValues(fakeapi.NetworkID("office"), "office", fakeapi.NetworkID("office")+"-router-1", "peer", fakeapi.PeerID("gw-1"), "", "true", "true")); value != 1 {
+		t.Errorf("Expected router1 info series, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.networkRouterInfo.WithLabelValues(fakeapi.NetworkID("office"), "office", fakeapi.NetworkID("office")+"-router-2", "peer_group", "", fakeapi.GroupID("routers-a")+","+fakeapi.GroupID("routers-b"), "true", "true")); value != 1 {
+		t.Errorf("Expected router2 info series, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.networkRouterMetric.WithLabelValues(fakeapi.NetworkID("office"), "office", fakeapi.NetworkID("office")+"-router-2")); value != 9999 {
+		t.Errorf("Expected router2 metric 9999, got %f", value)
+	}
+
+	// router2 is backed by gw-2 (connected) and gw-3 (counted once despite two groups)
+	if value := testutil.ToFloat64(exporter.networkRouterPeers.WithLabelValues(fakeapi.NetworkID("office"), "office", fakeapi.NetworkID("office")+"-router-2", "true")); value != 1 {
+		t.Errorf("Expected 1 connected peer behind router2, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.networkRouterPeers.WithLabelValues(fakeapi.NetworkID("office"), "office", fakeapi.NetworkID("office")+"-router-2", "false")); value != 1 {
+		t.Errorf("Expected 1 disconnected peer behind router2, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.networkHARoutersOnline.WithLabelValues(fakeapi.NetworkID("office"), "office")); value != 1 {
+		t.Errorf("Expected 1 online router, got %f", value)
+	}
+
+	if count := testutil.CollectAndCount(exporter.networkResourceInfo); count != 2 {
+		t.Errorf("Expected 2 resource info series, got %d", count)
+	}
+	if value := testutil.ToFloat64(exporter.networkResourceInfo.WithLabelValues(fakeapi.NetworkID("office"), "office", fakeapi.NetworkID("office")+"-resource-2", "intranet", "domain", "*.corp.example.com", "false")); value != 1 {
+		t.Errorf("Expected intranet resource info series, got %f", value)
+	}
+}
+
+func TestNetworksExporter_DetailsDisabledByDefault(t *testing.T) {
+	client := nbclient.New(networkDetailsAPI(t), "test-token")
+	exporter := NewNetworksExporter(client)
+
+	ch := make(chan prometheus.Metric, 100)
+	go func() {
+		exporter.Collect(ch)
+		close(ch)
+	}()
+	for range ch {
+		// Drain channel
+	}
+
+	if count := testutil.CollectAndCount(exporter.networkRouterInfo); count != 0 {
+		t.Errorf("Expected no router details by default, got %d series", count)
+	}
+}
+
+func TestNetworksExporter_UsesStoredPeers(t *testing.T) {
+	client := nbclient.New(networkDetailsAPI(t), "test-token")
+	exporter := NewNetworksExporterWithConfig(client, NetworksConfig{CollectDetails: true})
+
+	// The stored peers take precedence over the API, all routers are online here
+	exporter.store = NewStore()
+	exporter.store.SetPeers([]api.Peer{
+		{Id: fakeapi.PeerID("gw-1"), Connected: true},
+		{Id: fakeapi.PeerID("gw-2"), Connected: true, Groups: []api.GroupMinimum{{Id: fakeapi.GroupID("routers-a")}}},
+	})
+
+	ch := make(chan prometheus.Metric, 100)
+	go func() {
+		exporter.Collect(ch)
+		close(ch)
+	}()
+	for range ch {
+		// Drain channel
+	}
+
+	if value := testutil.ToFloat64(exporter.networkHARoutersOnline.WithLabelValues(fakeapi.NetworkID("office"), "office")); value != 2 {
+		t.Errorf("Expected 2 online routers from stored peers, got %f", value)
+	}
+}
+
+func TestNetworksExporter_IgnoresStalePeers(t *testing.T) {
+	client := nbclient.New(networkDetailsAPI(t), "test-token")
+	exporter := NewNetworksExporterWithConfig(client, NetworksConfig{CollectDetails: true})
+
+	// The peers were stored by an earlier scrape, e.g. before the peers exporter
+	// failed to fetch them, so they are fetched again
+	exporter.store = NewStore()
+	exporter.store.SetPeers([]api.Peer{
+		{Id: fakeapi.PeerID("gw-1"), Connected: true},
+		{Id: fakeapi.PeerID("gw-2"), Connected: true, Groups: []api.GroupMinimum{{Id: fakeapi.GroupID("routers-a")}}},
+	})
+	exporter.store.StartScrape()
+
+	ch := make(chan prometheus.Metric, 100)
+	go func() {
+		exporter.Collect(ch)
+		close(ch)
+	}()
+	for range ch {
+		// Drain channel
+	}
+
+	if value := testutil.ToFloat64(exporter.networkHARoutersOnline.WithLabelValues(fakeapi.NetworkID("office"), "office")); value != 1 {
+		t.Errorf("Expected 1 online router from the fetched peers, got %f", value)
+	}
+}
+
+func TestNetworksExporter_HAMetrics(t *testing.T) {
+	client := nbclient.New(networkDetailsAPI(t), "test-token")
+	exporter := NewNetworksExporterWithConfig(client, NetworksConfig{CollectDetails: true})
+
+	ch := make(chan prometheus.Metric, 100)
+	go func() {
+		exporter.Collect(ch)
+		close(ch)
+	}()
+	for range ch {
+		// Drain channel
+	}
+
+	// office is routed by router1 on gw-1 (offline) and router2 on gw-2 and gw-3
+	// through groups, only router2 is online through gw-2
+	networkLabels := []string{fakeapi.NetworkID("office"), "office"}
+	expectedNetwork := map[*prometheus.GaugeVec]float64{
+		exporter.networkHARoutersOnline:      1,
+		exporter.networkHARoutersTotal:       2,
+		exporter.networkHARatio:              0.5,
+		exporter.networkSinglePointOfFailure: 1,
+	}
+	for gauge, value := range expectedNetwork {
+		if got := testutil.ToFloat64(gauge.WithLabelValues(networkLabels...)); got != value {
+			t.Errorf("Expected network HA value %f, got %f", value, got)
+		}
+	}
+
+	// legacy-lan is down entirely, which is an outage rather than a single point of failure
+	if value := testutil.ToFloat64(exporter.routeHARoutersOnline.WithLabelValues("legacy-lan")); value != 0 {
+		t.Errorf("Expected no online routes for legacy-lan, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.routeSinglePointOfFailure.WithLabelValues("legacy-lan")); value != 0 {
+		t.Errorf("Expected legacy-lan not to be a single point of failure, got %f", value)
+	}
+
+	// legacy-dc is routed by the HA route on gw-2 and gw-3 and a route on gw-1,
+	// only the HA route is online
+	if value := testutil.ToFloat64(exporter.routeHARoutersTotal.WithLabelValues("legacy-dc")); value != 2 {
+		t.Errorf("Expected 2 routes for legacy-dc, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.routeHARatio.WithLabelValues("legacy-dc")); value != 0.5 {
+		t.Errorf("Expected legacy-dc HA ratio 0.5, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.routeSinglePointOfFailure.WithLabelValues("legacy-dc")); value != 1 {
+		t.Errorf("Expected legacy-dc to be a single point of failure, got %f", value)
+	}
+
+	// Disabled routes are skipped
+	if count := testutil.CollectAndCount(exporter.routeHARoutersTotal); count != 2 {
+		t.Errorf("Expected HA metrics for 2 route networks, got %d", count)
+	}
+}
+
+func TestNetworksExporter_HAMetrics_PeerGroupRouter(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	for _, name := range []string{"gw-1", "gw-2", "gw-3"} {
+		f.Peer(name).Connected().Groups("routers")
+	}
+	f.Network("office").RouterGroup("routers").Resource("db", "10.0.0.10/32", "servers")
+	f.HARoute("legacy-dc", "routers")
+	_, url := newTestAPI(t, f)
+
+	exporter := NewNetworksExporterWithConfig(nbclient.New(url, "test-token"), NetworksConfig{CollectDetails: true})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	// A single router made of three connected peers survives the loss of one
+	if value := testutil.ToFloat64(exporter.networkHARoutersOnline.WithLabelValues(fakeapi.NetworkID("office"), "office")); value != 1 {
+		t.Errorf("Expected 1 online router, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.networkSinglePointOfFailure.WithLabelValues(fakeapi.NetworkID("office"), "office")); value != 0 {
+		t.Errorf("Expected a router with 3 connected peers not to be a single point of failure, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.routeSinglePointOfFailure.WithLabelValues("legacy-dc")); value != 0 {
+		t.Errorf("Expected a route with 3 connected peers not to be a single point of failure, got %f", value)
+	}
+}
@@ -3,7 +3,9 @@ package exporters
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	nbclient "github.com/netbirdio/netbird/management/client/rest"
@@ -12,9 +14,44 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// PeersConfig holds optional settings for the peers exporter
+type PeersConfig struct {
+	// MinSupportedVersion is the oldest NetBird agent version considered up to date.
+	// When empty, outdated peers are not counted.
+	MinSupportedVersion string
+
+	// HideConnectionIP drops the connection_ip label, the public IP of the
+	// peer, from netbird_peer_info.
+	HideConnectionIP bool
+
+	// StaleAfterDays marks peers not seen for this many days as stale.
+	// Zero disables stale peer detection.
+	StaleAfterDays int
+
+	// StaleExcludedGroups lists group names or IDs whose peers are never reported as stale.
+	StaleExcludedGroups []string
+
+	// TrackPeerFlaps exports a per-peer connection state change counter.
+	TrackPeerFlaps bool
+
+	// ExportSerialNumber adds the serial_number label to netbird_peer_info.
+	ExportSerialNumber bool
+}
+
 // PeersExporter handles peers-specific metrics collection
 type PeersExporter struct {
 	client *nbclient.Client
+	config PeersConfig
+	store  *Store
+	now    func() time.Time
+
+	// Latest stale peers report, rebuilt on every collection
+	staleReport   *StalePeersReport
+	staleReportMu sync.RWMutex
+
+	// Connection state of each peer from the previous collection, nil until the first one
+	previousConnected map[string]bool
+	previousMu        sync.Mutex
 
 	// Prometheus metrics
 	peersTotal                 *prometheus.GaugeVec
@@ -28,12 +65,35 @@ type PeersExporter struct {
 	peersApprovalRequired      *prometheus.GaugeVec
 	accessiblePeersCount       *prometheus.GaugeVec
 	peerConnectionStatusByName *prometheus.GaugeVec
+	peersByVersion             *prometheus.GaugeVec
+	peersByOSVersion           *prometheus.GaugeVec
+	peerInfo                   *prometheus.GaugeVec
+	peersOutdated              *prometheus.GaugeVec
+	peerLoginExpiresIn         *prometheus.GaugeVec
+	peerLastSeenAge            *prometheus.GaugeVec
+	peersByLastSeen            *prometheus.GaugeVec
+	peersStale                 *prometheus.GaugeVec
+	peersStaleByGroup          *prometheus.GaugeVec
+	peersStaleByOS             *prometheus.GaugeVec
+	peerConnectsTotal          *prometheus.CounterVec
+	peerDisconnectsTotal       *prometheus.CounterVec
+	peersAddedTotal            *prometheus.CounterVec
+	peersRemovedTotal          *prometheus.CounterVec
+	peerFlapsTotal             *prometheus.CounterVec
+	scrapeErrorsTotal          *prometheus.CounterVec
 }
 
 // NewPeersExporter creates a new peers exporter
 func NewPeersExporter(client *nbclient.Client) *PeersExporter {
-	return &PeersExporter{
+	return NewPeersExporterWithConfig(client, PeersConfig{})
+}
+
+// NewPeersExporterWithConfig creates a new peers exporter with the given settings
+func NewPeersExporterWithConfig(client *nbclient.Client, config PeersConfig) *PeersExporter {
+	e := &PeersExporter{
 		client: client,
+		config: config,
+		now:    time.Now,
 
 		peersTotal: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
@@ -122,7 +182,157 @@ func NewPeersExporter(client *nbclient.Client) *PeersExporter {
 			},
 			[]string{"peer_name", "peer_id", "connected"},
 		),
+
+		peersByVersion: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peers_by_version",
+				Help: "Number of NetBird peers by agent version",
+			},
+			[]string{"version"},
+		),
+
+		peersByOSVersion: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peers_by_os_version",
+				Help: "Number of NetBird peers by operating system and kernel version",
+			},
+			[]string{"os", "kernel_version"},
+		),
+
+		peerInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peer_info",
+				Help: "Information about NetBird peers (always 1)",
+			},
+			peerInfoLabels(config),
+		),
+
+		peersOutdated: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peers_outdated",
+				Help: "Number of NetBird peers running an agent older than the minimum supported version",
+			},
+			[]string{"min_version"},
+		),
+
+		peerLoginExpiresIn: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peer_login_expires_in_seconds",
+				Help: "Seconds until the login of each NetBird peer expires (negative once expired)",
+			},
+			[]string{"peer_id", "peer_name", "user_id"},
+		),
+
+		peerLastSeenAge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peer_last_seen_age_seconds",
+				Help: "Seconds since each NetBird peer was last seen (0 while connected)",
+			},
+			[]string{"peer_id", "peer_name"},
+		),
+
+		peersByLastSeen: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peers_by_last_seen",
+				Help: "Number of NetBird peers by time since last seen (5m, 1h, 1d, 7d, older)",
+			},
+			[]string{"last_seen"},
+		),
+
+		peersStale: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peers_stale",
+				Help: "Number of non-ephemeral NetBird peers not seen for longer than the stale threshold",
+			},
+			[]string{"stale_after_days"},
+		),
+
+		peersStaleByGroup: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peers_stale_by_group",
+				Help: "Number of stale NetBird peers by group",
+			},
+			[]string{"group_id", "group_name"},
+		),
+
+		peersStaleByOS: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peers_stale_by_os",
+				Help: "Number of stale NetBird peers by operating system",
+			},
+			[]string{"os"},
+		),
+
+		peerConnectsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_peer_connects_total",
+				Help: "Total number of NetBird peer transitions from disconnected to connected between scrapes",
+			},
+			[]string{},
+		),
+
+		peerDisconnectsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_peer_disconnects_total",
+				Help: "Total number of NetBird peer transitions from connected to disconnected between scrapes",
+			},
+			[]string{},
+		),
+
+		peersAddedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_peers_added_total",
+				Help: "Total number of NetBird peers that appeared between scrapes",
+			},
+			[]string{},
+		),
+
+		peersRemovedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_peers_removed_total",
+				Help: "Total number of NetBird peers that disappeared between scrapes",
+			},
+			[]string{},
+		),
+
+		peerFlapsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_peer_flaps_total",
+				Help: "Total number of connection state changes of each NetBird peer between scrapes",
+			},
+			[]string{"peer_id", "peer_name"},
+		),
+
+		scrapeErrorsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_peers_scrape_errors_total",
+				Help: "Total number of errors encountered while scraping peers",
+			},
+			[]string{"error_type"},
+		),
+	}
+
+	// The churn counters start at zero, so that the first increase is visible
+	// to rate() and increase()
+	e.peerConnectsTotal.WithLabelValues()
+	e.peerDisconnectsTotal.WithLabelValues()
+	e.peersAddedTotal.WithLabelValues()
+	e.peersRemovedTotal.WithLabelValues()
+	return e
+}
+
+// peerInfoLabels returns the labels of netbird_peer_info. The serial number
+// identifies the device and is unique per peer, so it is only added on request.
+func peerInfoLabels(config PeersConfig) []string {
+	labels := []string{"peer_id", "peer_name", "ip", "dns_label"}
+	if !config.HideConnectionIP {
+		labels = append(labels, "connection_ip")
 	}
+	labels = append(labels, "os", "version", "ui_version", "kernel_version")
+	if config.ExportSerialNumber {
+		labels = append(labels, "serial_number")
+	}
+	return labels
 }
 
 // Describe implements prometheus.Collector
@@ -138,6 +348,22 @@ func (e *PeersExporter) Describe(ch chan<- *prometheus.Desc) {
 	e.peersApprovalRequired.Describe(ch)
 	e.accessiblePeersCount.Describe(ch)
 	e.peerConnectionStatusByName.Describe(ch)
+	e.peersByVersion.Describe(ch)
+	e.peersByOSVersion.Describe(ch)
+	e.peerInfo.Describe(ch)
+	e.peersOutdated.Describe(ch)
+	e.peerLoginExpiresIn.Describe(ch)
+	e.peerLastSeenAge.Describe(ch)
+	e.peersByLastSeen.Describe(ch)
+	e.peersStale.Describe(ch)
+	e.peersStaleByGroup.Describe(ch)
+	e.peersStaleByOS.Describe(ch)
+	e.peerConnectsTotal.Describe(ch)
+	e.peerDisconnectsTotal.Describe(ch)
+	e.peersAddedTotal.Describe(ch)
+	e.peersRemovedTotal.Describe(ch)
+	e.peerFlapsTotal.Describe(ch)
+	e.scrapeErrorsTotal.Describe(ch)
 }
 
 // Collect implements prometheus.Collector
@@ -154,6 +380,16 @@ func (e *PeersExporter) Collect(ch chan<- prometheus.Metric) {
 	e.peersApprovalRequired.Reset()
 	e.accessiblePeersCount.Reset()
 	e.peerConnectionStatusByName.Reset()
+	e.peersByVersion.Reset()
+	e.peersByOSVersion.Reset()
+	e.peerInfo.Reset()
+	e.peersOutdated.Reset()
+	e.peerLoginExpiresIn.Reset()
+	e.peerLastSeenAge.Reset()
+	e.peersByLastSeen.Reset()
+	e.peersStale.Reset()
+	e.peersStaleByGroup.Reset()
+	e.peersStaleByOS.Reset()
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()
@@ -161,11 +397,24 @@ func (e *PeersExporter) Collect(ch chan<- prometheus.Metric) {
 	peers, err := e.client.Peers.List(ctx)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to fetch peers")
+		e.scrapeErrorsTotal.WithLabelValues("fetch_peers").Inc()
+		e.scrapeErrorsTotal.Collect(ch)
 		return
 	}
 
+	e.store.SetPeers(peers)
 	e.updateMetrics(peers)
 
+	// Login expiry depends on the account settings, peers metrics are still
+	// exported when they cannot be fetched
+	accounts, err := e.client.Accounts.List(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to fetch account settings, skipping peer login expiry metrics")
+		e.scrapeErrorsTotal.WithLabelValues("fetch_accounts").Inc()
+	} else if len(accounts) > 0 {
+		e.updateLoginExpiryMetrics(peers, accounts[0].Settings, e.now())
+	}
+
 	// Collect all metrics
 	e.peersTotal.Collect(ch)
 	e.peersConnected.Collect(ch)
@@ -178,6 +427,22 @@ func (e *PeersExporter) Collect(ch chan<- prometheus.Metric) {
 	e.peersApprovalRequired.Collect(ch)
 	e.accessiblePeersCount.Collect(ch)
 	e.peerConnectionStatusByName.Collect(ch)
+	e.peersByVersion.Collect(ch)
+	e.peersByOSVersion.Collect(ch)
+	e.peerInfo.Collect(ch)
+	e.peersOutdated.Collect(ch)
+	e.peerLoginExpiresIn.Collect(ch)
+	e.peerLastSeenAge.Collect(ch)
+	e.peersByLastSeen.Collect(ch)
+	e.peersStale.Collect(ch)
+	e.peersStaleByGroup.Collect(ch)
+	e.peersStaleByOS.Collect(ch)
+	e.peerConnectsTotal.Collect(ch)
+	e.peerDisconnectsTotal.Collect(ch)
+	e.peersAddedTotal.Collect(ch)
+	e.peersRemovedTotal.Collect(ch)
+	e.peerFlapsTotal.Collect(ch)
+	e.scrapeErrorsTotal.Collect(ch)
 }
 
 // updateMetrics updates Prometheus metrics based on peer data
@@ -197,6 +462,14 @@ func (e *PeersExporter) updateMetrics(peers []api.Peer) {
 	loginValidCount := 0
 	approvalRequiredCount := 0
 	approvalNotRequiredCount := 0
+	versionCounts := make(map[string]int)
+	osVersionCounts := make(map[[2]string]int)
+	outdatedCount := 0
+
+	minVersion, checkOutdated := parseVersion(e.config.MinSupportedVersion)
+	if e.config.MinSupportedVersion != "" && !checkOutdated {
+		logrus.WithField("min_supported_version", e.config.MinSupportedVersion).Warn("Invalid minimum supported peer version, outdated peers will not be counted")
+	}
 
 	for _, peer := range peers {
 		// Connection status
@@ -258,8 +531,42 @@ func (e *PeersExporter) updateMetrics(peers []api.Peer) {
 			connectionValue = 1.0
 		}
 		e.peerConnectionStatusByName.WithLabelValues(peer.Name, peer.Id, connectedStr).Set(connectionValue)
+
+		// Software inventory
+		versionKey := peer.Version
+		if versionKey == "" {
+			versionKey = "unknown"
+		}
+		versionCounts[versionKey]++
+
+		kernelKey := peer.KernelVersion
+		if kernelKey == "" {
+			kernelKey = "unknown"
+		}
+		osVersionCounts[[2]string{osKey, kernelKey}]++
+
+		infoValues := []string{peer.Id, peer.Name, peer.Ip, peer.DnsLabel}
+		if !e.config.HideConnectionIP {
+			infoValues = append(infoValues, peer.ConnectionIp)
+		}
+		infoValues = append(infoValues, peer.Os, peer.Version, peer.UiVersion, peer.KernelVersion)
+		if e.config.ExportSerialNumber {
+			infoValues = append(infoValues, peer.SerialNumber)
+		}
+		e.peerInfo.WithLabelValues(infoValues...).Set(1)
+
+		// Outdated agents, peers with an unparsable version are not counted
+		if checkOutdated {
+			if version, ok := parseVersion(peer.Version); ok && compareVersions(version, minVersion) < 0 {
+				outdatedCount++
+			}
+		}
 	}
 
+	e.updateLastSeenMetrics(peers, e.now())
+	e.updateStaleMetrics(peers, e.now())
+	e.updateChurnMetrics(peers)
+
 	// Set metrics
 	e.peersTotal.WithLabelValues().Set(float64(totalPeers))
 	e.peersConnected.WithLabelValues("true").Set(float64(connectedCount))
@@ -296,6 +603,19 @@ func (e *PeersExporter) updateMetrics(peers []api.Peer) {
 	e.peersSSHEnabled.WithLabelValues("true").Set(float64(sshEnabledCount))
 	e.peersSSHEnabled.WithLabelValues("false").Set(float64(sshDisabledCount))
 
+	// Version distribution
+	for version, count := range versionCounts {
+		e.peersByVersion.WithLabelValues(version).Set(float64(count))
+	}
+
+	for osVersion, count := range osVersionCounts {
+		e.peersByOSVersion.WithLabelValues(osVersion[0], osVersion[1]).Set(float64(count))
+	}
+
+	if checkOutdated {
+		e.peersOutdated.WithLabelValues(e.config.MinSupportedVersion).Set(float64(outdatedCount))
+	}
+
 	// Login status
 	e.peersLoginExpired.WithLabelValues("true").Set(float64(loginExpiredCount))
 	e.peersLoginExpired.WithLabelValues("false").Set(float64(loginValidCount))
@@ -316,5 +636,200 @@ func (e *PeersExporter) updateMetrics(peers []api.Peer) {
 		"os_distributions":        len(osCounts),
 		"country_distributions":   len(countryCounts),
 		"group_memberships":       len(groupCounts),
+		"version_distributions":   len(versionCounts),
+		"outdated_peers":          outdatedCount,
 	}).Debug("Updated peer metrics")
 }
+
+// updateChurnMetrics compares the connection state of each peer with the
+// previous collection and counts transitions, added and removed peers
+func (e *PeersExporter) updateChurnMetrics(peers []api.Peer) {
+	e.previousMu.Lock()
+	defer e.previousMu.Unlock()
+
+	current := make(map[string]bool, len(peers))
+	names := make(map[string]string, len(peers))
+	for _, peer := range peers {
+		current[peer.Id] = peer.Connected
+		names[peer.Id] = peer.Name
+	}
+
+	// The first collection only establishes the baseline
+	if e.previousConnected == nil {
+		if e.config.TrackPeerFlaps {
+			for id := range current {
+				e.peerFlapsTotal.WithLabelValues(id, names[id])
+			}
+		}
+		e.previousConnected = current
+		return
+	}
+
+	connects, disconnects, added, removed := 0, 0, 0, 0
+	for id, connected := range current {
+		wasConnected, existed := e.previousConnected[id]
+		if !existed {
+			added++
+			if e.config.TrackPeerFlaps {
+				e.peerFlapsTotal.WithLabelValues(id, names[id])
+			}
+			continue
+		}
+		if connected == wasConnected {
+			continue
+		}
+
+		if connected {
+			connects++
+		} else {
+			disconnects++
+		}
+		if e.config.TrackPeerFlaps {
+			e.peerFlapsTotal.WithLabelValues(id, names[id]).Inc()
+		}
+	}
+
+	for id := range e.previousConnected {
+		if _, exists := current[id]; !exists {
+			removed++
+			if e.config.TrackPeerFlaps {
+				e.peerFlapsTotal.DeletePartialMatch(prometheus.Labels{"peer_id": id})
+			}
+		}
+	}
+
+	e.peerConnectsTotal.WithLabelValues().Add(float64(connects))
+	e.peerDisconnectsTotal.WithLabelValues().Add(float64(disconnects))
+	e.peersAddedTotal.WithLabelValues().Add(float64(added))
+	e.peersRemovedTotal.WithLabelValues().Add(float64(removed))
+	e.previousConnected = current
+
+	logrus.WithFields(logrus.Fields{
+		"peer_connects":    connects,
+		"peer_disconnects": disconnects,
+		"peers_added":      added,
+		"peers_removed":    removed,
+	}).Debug("Updated peer churn metrics")
+}
+
+// lastSeenBuckets are the upper bounds used by netbird_peers_by_last_seen, peers
+// seen longer ago than the last bound are reported as "older"
+var lastSeenBuckets = []struct {
+	label string
+	bound time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+	{"1d", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+}
+
+// updateLastSeenMetrics updates per-peer inactivity and the last seen buckets.
+// Connected peers are considered seen at now.
+func (e *PeersExporter) updateLastSeenMetrics(peers []api.Peer, now time.Time) {
+	bucketCounts := make(map[string]int)
+	for _, bucket := range lastSeenBuckets {
+		bucketCounts[bucket.label] = 0
+	}
+	bucketCounts["older"] = 0
+
+	for _, peer := range peers {
+		age := time.Duration(0)
+		if !peer.Connected {
+			if peer.LastSeen.IsZero() {
+				bucketCounts["older"]++
+				continue
+			}
+			age = now.Sub(peer.LastSeen)
+			if age < 0 {
+				age = 0
+			}
+		}
+
+		e.peerLastSeenAge.WithLabelValues(peer.Id, peer.Name).Set(age.Seconds())
+
+		bucket := "older"
+		for _, b := range lastSeenBuckets {
+			if age < b.bound {
+				bucket = b.label
+				break
+			}
+		}
+		bucketCounts[bucket]++
+	}
+
+	for bucket, count := range bucketCounts {
+		e.peersByLastSeen.WithLabelValues(bucket).Set(float64(count))
+	}
+}
+
+// updateLoginExpiryMetrics updates the per-peer login expiry countdown based on
+// the account's peer login expiration setting. Peers without login expiration
+// (e.g. added with a setup key) are skipped.
+func (e *PeersExporter) updateLoginExpiryMetrics(peers []api.Peer, settings api.AccountSettings, now time.Time) {
+	if !settings.PeerLoginExpirationEnabled || settings.PeerLoginExpiration <= 0 {
+		logrus.Debug("Peer login expiration disabled for account, skipping login expiry metrics")
+		return
+	}
+
+	expiration := time.Duration(settings.PeerLoginExpiration) * time.Second
+	expiringCount := 0
+	for _, peer := range peers {
+		if !peer.LoginExpirationEnabled || peer.LastLogin.IsZero() {
+			continue
+		}
+
+		expiresIn := peer.LastLogin.Add(expiration).Sub(now)
+		e.peerLoginExpiresIn.WithLabelValues(peer.Id, peer.Name, peer.UserId).Set(expiresIn.Seconds())
+		expiringCount++
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"peer_login_expiration": expiration,
+		"peers_with_expiry":     expiringCount,
+	}).Debug("Updated peer login expiry metrics")
+}
+
+// parseVersion parses a NetBird agent version such as "0.28.4" or "v0.28.4-rc1"
+// into its numeric components. Pre-release and build suffixes are ignored.
+func parseVersion(version string) ([]int, bool) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		version = version[:i]
+	}
+	if version == "" {
+		return nil, false
+	}
+
+	parts := strings.Split(version, ".")
+	numbers := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, true
+}
+
+// compareVersions returns -1, 0 or 1 when a is older than, equal to or newer than b.
+// Missing components are treated as zero.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return 0
+}
@@ -1,16 +1,16 @@
 package exporters
 
 import (
-	"encoding/json"
 	"net/http"
-	"net/http/httptest"
-	"strings"
 	"testing"
 	"time"
 
 	nbclient "github.com/netbirdio/netbird/management/client/rest"
 	"github.com/netbirdio/netbird/management/server/http/api"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
 )
 
 func TestNewPeersExporter(t *testing.T) {
@@ -85,61 +85,13 @@ func TestPeersExporter_Describe(t *testing.T) {
 }
 
 func TestPeersExporter_Collect_Success(t *testing.T) {
-	// Create mock server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/api/peers" {
-			http.NotFound(w, r)
-			return
-		}
-
-		token := r.Header.Get("Authorization")
-		if !strings.HasPrefix(token, "Token ") {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		peers := []api.Peer{
-			{
-				Id:               "peer1",
-				Name:             "test-peer-1",
-				Ip:               "100.64.0.1",
-				Connected:        true,
-				LastSeen:         time.Now(),
-				Os:               "linux",
-				Groups:           []api.GroupMinimum{{Id: "group1", Name: "test-group"}},
-				SshEnabled:       true,
-				Hostname:         "test-host-1",
-				LoginExpired:     false,
-				ApprovalRequired: false,
-				CountryCode:      "US",
-				CityName:         "New York",
-			},
-			{
-				Id:               "peer2",
-				Name:             "test-peer-2",
-				Ip:               "100.64.0.2",
-				Connected:        false,
-				LastSeen:         time.Now().Add(-time.Hour),
-				Os:               "windows",
-				Groups:           []api.GroupMinimum{{Id: "group2", Name: "another-group"}},
-				SshEnabled:       false,
-				Hostname:         "test-host-2",
-				LoginExpired:     true,
-				ApprovalRequired: true,
-				CountryCode:      "CA",
-				CityName:         "Toronto",
-			},
-		}
+	f := fakeapi.NewFixture("example.com")
+	f.Peer("test-peer-1").Connected().OS("linux", "").Groups("test-group").SSH().Location("US", "New York")
+	f.Peer("test-peer-2").OS("windows", "").Groups("another-group").LastSeen(time.Hour).
+		LoginExpired().ApprovalRequired().Location("CA", "Toronto")
+	_, url := newTestAPI(t, f)
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(peers); err != nil {
-			t.Errorf("Failed to encode peers: %v", err)
-		}
-	}))
-	defer server.Close()
-
-	client := nbclient.New(server.URL, "test-token")
+	client := nbclient.New(url, "test-token")
 	exporter := NewPeersExporter(client)
 
 	// Collect metrics
@@ -190,45 +142,35 @@ func TestPeersExporter_Collect_Success(t *testing.T) {
 }
 
 func TestPeersExporter_Collect_APIError(t *testing.T) {
-	// Create mock server that returns error
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-	}))
-	defer server.Close()
+	f := fakeapi.NewFixture("example.com")
+	f.Peer("test-peer-1").Connected()
+	server, url := newTestAPI(t, f)
+	server.InjectError("/api/peers", http.StatusInternalServerError, -1)
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewPeersExporter(client)
-
-	// Collect metrics
-	ch := make(chan prometheus.Metric, 50)
-	go func() {
-		exporter.Collect(ch)
-		close(ch)
-	}()
+	exporter := NewPeersExporter(nbclient.New(url, "test-token"))
 
-	// Should still complete without error (though may not collect useful data)
-	metricCount := 0
-	for range ch {
-		metricCount++
+	// The collection completes with the fetch error counted and no peer metrics
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == "netbird_peers" {
+			t.Errorf("Expected no peers total when the peers cannot be fetched, got %v", family.GetMetric())
+		}
+	}
+	if errors := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_peers")); errors != 1 {
+		t.Errorf("Expected 1 fetch_peers error, got %v", errors)
 	}
-
-	// Even with API errors, some metrics might still be collected (like error counters)
-	// This test ensures the collection doesn't panic or hang
 }
 
 func TestPeersExporter_Collect_InvalidJSON(t *testing.T) {
-	// Create mock server that returns invalid JSON
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte(`invalid json`)); err != nil {
-			t.Errorf("Failed to write response: %v", err)
-		}
-	}))
-	defer server.Close()
+	server, url := newTestAPI(t, fakeapi.NewFixture("example.com"))
+	server.InjectBody("/api/peers", "invalid json", -1)
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewPeersExporter(client)
+	exporter := NewPeersExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 50)
@@ -241,21 +183,15 @@ func TestPeersExporter_Collect_InvalidJSON(t *testing.T) {
 	for range ch {
 		// Drain channel
 	}
+	if errors := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_peers")); errors != 1 {
+		t.Errorf("Expected 1 fetch_peers error, got %v", errors)
+	}
 }
 
 func TestPeersExporter_Collect_EmptyResponse(t *testing.T) {
-	// Create mock server that returns empty array
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte(`[]`)); err != nil {
-			t.Errorf("Failed to write response: %v", err)
-		}
-	}))
-	defer server.Close()
+	_, url := newTestAPI(t, fakeapi.NewFixture("example.com"))
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewPeersExporter(client)
+	exporter := NewPeersExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 50)
@@ -276,22 +212,9 @@ func TestPeersExporter_Collect_EmptyResponse(t *testing.T) {
 }
 
 func TestPeersExporter_Collect_Unauthorized(t *testing.T) {
-	// Create mock server that requires authentication
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		validToken := "Token valid-token" // #nosec G101 -- This is a test token, not a real credential
-		if token != validToken {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		if _, err := w.Write([]byte(`[]`)); err != nil {
-			t.Errorf("Failed to write response: %v", err)
-		}
-	}))
-	defer server.Close()
+	_, url := newTestAPI(t, fakeapi.NewFixture("example.com"))
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewPeersExporter(client)
+	exporter := NewPeersExporter(nbclient.New(url, "invalid-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 50)
@@ -304,6 +227,9 @@ func TestPeersExporter_Collect_Unauthorized(t *testing.T) {
 	for range ch {
 		// Drain channel
 	}
+	if errors := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_peers")); errors != 1 {
+		t.Errorf("Expected 1 fetch_peers error for an invalid token, got %v", errors)
+	}
 }
 
 func TestPeersExporter_UpdateMetrics(t *testing.T) {
@@ -525,3 +451,338 @@ func TestPeersExporter_ConnectionStatusByName(t *testing.T) {
 		t.Error("Expected to find disconnected peer metric")
 	}
 }
+
+func TestPeersExporter_VersionMetrics(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewPeersExporterWithConfig(client, PeersConfig{MinSupportedVersion: "0.28.0"})
+
+	peers := []api.Peer{
+		{Id: "peer1", Name: "old-peer", Os: "linux", KernelVersion: "5.15.0", Version: "0.27.4"},
+		{Id: "peer2", Name: "new-peer", Os: "linux", KernelVersion: "5.15.0", Version: "0.28.0", UiVersion: "0.28.0"},
+		{Id: "peer3", Name: "dev-peer", Os: "darwin", KernelVersion: "23.1.0", Version: "development"},
+		{Id: "peer4", Name: "rc-peer", Os: "windows", Version: "v0.27.9-rc1"},
+	}
+
+	exporter.updateMetrics(peers)
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(exporter.peersByVersion, exporter.peersByOSVersion, exporter.peerInfo, exporter.peersOutdated)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, family := range families {
+		found[family.GetName()] = true
+		switch family.GetName() {
+		case "netbird_peers_by_version":
+			if len(family.GetMetric()) != 4 {
+				t.Errorf("Expected 4 version series, got %d", len(family.GetMetric()))
+			}
+		case "netbird_peers_by_os_version":
+			for _, metric := range family.GetMetric() {
+				labels := make(map[string]string)
+				for _, label := range metric.GetLabel() {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if labels["os"] == "linux" && metric.GetGauge().GetValue() != 2 {
+					t.Errorf("Expected 2 linux peers on kernel 5.15.0, got %f", metric.GetGauge().GetValue())
+				}
+				if labels["os"] == "windows" && labels["kernel_version"] != "unknown" {
+					t.Errorf("Expected unknown kernel version for windows peer, got %s", labels["kernel_version"])
+				}
+			}
+		case "netbird_peer_info":
+			if len(family.GetMetric()) != 4 {
+				t.Errorf("Expected 4 peer info series, got %d", len(family.GetMetric()))
+			}
+		case "netbird_peers_outdated":
+			if len(family.GetMetric()) != 1 {
+				t.Fatalf("Expected 1 outdated series, got %d", len(family.GetMetric()))
+			}
+			// old-peer and rc-peer are outdated, dev-peer has no parsable version
+			if value := family.GetMetric()[0].GetGauge().GetValue(); value != 2 {
+				t.Errorf("Expected 2 outdated peers, got %f", value)
+			}
+		}
+	}
+
+	for _, name := range []string{"netbird_peers_by_version", "netbird_peers_by_os_version", "netbird_peer_info", "netbird_peers_outdated"} {
+		if !found[name] {
+			t.Errorf("Expected to find metric %s", name)
+		}
+	}
+}
+
+func TestPeersExporter_OutdatedDisabledWithoutMinVersion(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewPeersExporter(client)
+
+	exporter.updateMetrics([]api.Peer{{Id: "peer1", Version: "0.1.0"}})
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(exporter.peersOutdated)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if len(families) != 0 {
+		t.Errorf("Expected no outdated metric without a minimum version, got %d families", len(families))
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"0.28.0", "0.28.0", 0},
+		{"0.27.9", "0.28.0", -1},
+		{"0.28.1", "0.28.0", 1},
+		{"0.28", "0.28.0", 0},
+		{"v1.0.0", "0.99.99", 1},
+		{"0.28.0-rc1", "0.28.0", 0},
+	}
+
+	for _, tt := range tests {
+		a, ok := parseVersion(tt.a)
+		if !ok {
+			t.Fatalf("Expected %q to parse", tt.a)
+		}
+		b, ok := parseVersion(tt.b)
+		if !ok {
+			t.Fatalf("Expected %q to parse", tt.b)
+		}
+		if got := compareVersions(a, b); got != tt.expected {
+			t.Errorf("compareVersions(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+
+	for _, invalid := range []string{"", "development", "1.x.0"} {
+		if _, ok := parseVersion(invalid); ok {
+			t.Errorf("Expected %q not to parse", invalid)
+		}
+	}
+}
+
+func TestPeersExporter_PeerInfoAddresses(t *testing.T) {
+	peers := []api.Peer{
+		{
+			Id:           "peer1",
+			Name:         "test-peer",
+			Ip:           "100.64.0.1",
+			DnsLabel:     "test-peer.netbird.cloud",
+			ConnectionIp: "203.0.113.10",
+			Os:           "linux",
+			Version:      "0.28.0",
+			SerialNumber: "C02XK1ABJG5H",
+		},
+	}
+
+	tests := []struct {
+		name                 string
+		config               PeersConfig
+		expectedConnectionIP bool
+		expectedSerialNumber bool
+	}{
+		{name: "connection IP exported by default", config: PeersConfig{}, expectedConnectionIP: true},
+		{name: "connection IP hidden", config: PeersConfig{HideConnectionIP: true}},
+		{name: "serial number exported", config: PeersConfig{ExportSerialNumber: true}, expectedConnectionIP: true, expectedSerialNumber: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := nbclient.New("https://api.netbird.io", "test-token")
+			exporter := NewPeersExporterWithConfig(client, tt.config)
+			exporter.updateMetrics(peers)
+
+			registry := prometheus.NewPedanticRegistry()
+			registry.MustRegister(exporter.peerInfo)
+
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatalf("Failed to gather metrics: %v", err)
+			}
+			if len(families) != 1 || len(families[0].GetMetric()) != 1 {
+				t.Fatalf("Expected a single netbird_peer_info series")
+			}
+
+			labels := make(map[string]string)
+			for _, label := range families[0].GetMetric()[0].GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			if labels["ip"] != "100.64.0.1" {
+				t.Errorf("Expected ip label '100.64.0.1', got '%s'", labels["ip"])
+			}
+			if labels["dns_label"] != "test-peer.netbird.cloud" {
+				t.Errorf("Expected dns_label 'test-peer.netbird.cloud', got '%s'", labels["dns_label"])
+			}
+			if connectionIP, ok := labels["connection_ip"]; ok != tt.expectedConnectionIP || (ok && connectionIP != "203.0.113.10") {
+				t.Errorf("Expected connection_ip label only when not hidden, got %q", connectionIP)
+			}
+			if serialNumber, ok := labels["serial_number"]; ok != tt.expectedSerialNumber || (ok && serialNumber != "C02XK1ABJG5H") {
+				t.Errorf("Expected serial_number label only when exported, got %q", serialNumber)
+			}
+			if families[0].GetMetric()[0].GetGauge().GetValue() != 1 {
+				t.Error("Expected netbird_peer_info value to be 1")
+			}
+		})
+	}
+}
+
+func TestPeersExporter_LastSeenMetrics(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewPeersExporter(client)
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	peers := []api.Peer{
+		{Id: "peer1", Name: "online", Connected: true, LastSeen: now.Add(-48 * time.Hour)},
+		{Id: "peer2", Name: "recent", LastSeen: now.Add(-2 * time.Minute)},
+		{Id: "peer3", Name: "today", LastSeen: now.Add(-3 * time.Hour)},
+		{Id: "peer4", Name: "this-week", LastSeen: now.Add(-72 * time.Hour)},
+		{Id: "peer5", Name: "abandoned", LastSeen: now.Add(-30 * 24 * time.Hour)},
+		{Id: "peer6", Name: "never-seen"},
+	}
+
+	exporter.updateLastSeenMetrics(peers, now)
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(exporter.peerLastSeenAge, exporter.peersByLastSeen)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	expectedBuckets := map[string]float64{"5m": 2, "1h": 0, "1d": 1, "7d": 1, "older": 2}
+	expectedAges := map[string]float64{"online": 0, "recent": 120, "abandoned": 30 * 24 * 3600}
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			value := metric.GetGauge().GetValue()
+
+			switch family.GetName() {
+			case "netbird_peers_by_last_seen":
+				if expected := expectedBuckets[labels["last_seen"]]; value != expected {
+					t.Errorf("Expected %f peers in bucket %s, got %f", expected, labels["last_seen"], value)
+				}
+			case "netbird_peer_last_seen_age_seconds":
+				if labels["peer_name"] == "never-seen" {
+					t.Error("Expected no age series for a peer that was never seen")
+				}
+				if expected, ok := expectedAges[labels["peer_name"]]; ok && value != expected {
+					t.Errorf("Expected age %f for %s, got %f", expected, labels["peer_name"], value)
+				}
+			}
+		}
+	}
+}
+
+func TestPeersExporter_LoginExpiryMetrics(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewPeersExporter(client)
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	peers := []api.Peer{
+		{Id: "peer1", Name: "laptop", UserId: "user1", LoginExpirationEnabled: true, LastLogin: now.Add(-23 * time.Hour)},
+		{Id: "peer2", Name: "expired", UserId: "user2", LoginExpirationEnabled: true, LastLogin: now.Add(-25 * time.Hour)},
+		{Id: "peer3", Name: "server", LoginExpirationEnabled: false, LastLogin: now.Add(-100 * time.Hour)},
+	}
+
+	// Disabled on the account: nothing exported
+	exporter.updateLoginExpiryMetrics(peers, api.AccountSettings{PeerLoginExpiration: 86400}, now)
+	if count := testutil.CollectAndCount(exporter.peerLoginExpiresIn); count != 0 {
+		t.Errorf("Expected no login expiry series when expiration is disabled, got %d", count)
+	}
+
+	exporter.updateLoginExpiryMetrics(peers, api.AccountSettings{PeerLoginExpirationEnabled: true, PeerLoginExpiration: 86400}, now)
+
+	if count := testutil.CollectAndCount(exporter.peerLoginExpiresIn); count != 2 {
+		t.Fatalf("Expected 2 login expiry series, got %d", count)
+	}
+	if value := testutil.ToFloat64(exporter.peerLoginExpiresIn.WithLabelValues("peer1", "laptop", "user1")); value != 3600 {
+		t.Errorf("Expected laptop login to expire in 3600s, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.peerLoginExpiresIn.WithLabelValues("peer2", "expired", "user2")); value != -3600 {
+		t.Errorf("Expected expired login to report -3600s, got %f", value)
+	}
+}
+
+func TestPeersExporter_ChurnMetrics(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewPeersExporterWithConfig(client, PeersConfig{TrackPeerFlaps: true})
+
+	// First collection only sets the baseline
+	exporter.updateChurnMetrics([]api.Peer{
+		{Id: "peer1", Name: "relay-1", Connected: true},
+		{Id: "peer2", Name: "laptop", Connected: false},
+		{Id: "peer3", Name: "old-vm", Connected: true},
+	})
+	for _, counter := range []*prometheus.CounterVec{exporter.peerConnectsTotal, exporter.peerDisconnectsTotal, exporter.peersAddedTotal, exporter.peersRemovedTotal} {
+		if count := testutil.CollectAndCount(counter); count != 1 {
+			t.Errorf("Expected the churn counter to be exported from the first collection, got %d series", count)
+		}
+		if value := testutil.ToFloat64(counter.WithLabelValues()); value != 0 {
+			t.Errorf("Expected no churn counted on the first collection, got %f", value)
+		}
+	}
+	if count := testutil.CollectAndCount(exporter.peerFlapsTotal); count != 3 {
+		t.Errorf("Expected flap series for the 3 baseline peers, got %d", count)
+	}
+
+	exporter.updateChurnMetrics([]api.Peer{
+		{Id: "peer1", Name: "relay-1", Connected: false},
+		{Id: "peer2", Name: "laptop", Connected: true},
+		{Id: "peer4", Name: "new-vm", Connected: true},
+	})
+	exporter.updateChurnMetrics([]api.Peer{
+		{Id: "peer1", Name: "relay-1", Connected: true},
+		{Id: "peer2", Name: "laptop", Connected: true},
+		{Id: "peer4", Name: "new-vm", Connected: true},
+	})
+
+	expected := map[*prometheus.CounterVec]float64{
+		exporter.peerConnectsTotal:    2,
+		exporter.peerDisconnectsTotal: 1,
+		exporter.peersAddedTotal:      1,
+		exporter.peersRemovedTotal:    1,
+	}
+	for counter, value := range expected {
+		if got := testutil.ToFloat64(counter.WithLabelValues()); got != value {
+			t.Errorf("Expected counter value %f, got %f", value, got)
+		}
+	}
+
+	if value := testutil.ToFloat64(exporter.peerFlapsTotal.WithLabelValues("peer1", "relay-1")); value != 2 {
+		t.Errorf("Expected relay-1 to flap twice, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.peerFlapsTotal.WithLabelValues("peer4", "new-vm")); value != 0 {
+		t.Errorf("Expected new-vm to start with no flaps, got %f", value)
+	}
+	if count := testutil.CollectAndCount(exporter.peerFlapsTotal); count != 3 {
+		t.Errorf("Expected flap series for the 3 current peers, got %d", count)
+	}
+}
+
+func TestPeersExporter_ChurnFlapsOptIn(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewPeersExporter(client)
+
+	exporter.updateChurnMetrics([]api.Peer{{Id: "peer1", Connected: true}})
+	exporter.updateChurnMetrics([]api.Peer{{Id: "peer1", Connected: false}})
+
+	if count := testutil.CollectAndCount(exporter.peerFlapsTotal); count != 0 {
+		t.Errorf("Expected no per-peer flap series by default, got %d", count)
+	}
+	if value := testutil.ToFloat64(exporter.peerDisconnectsTotal.WithLabelValues()); value != 1 {
+		t.Errorf("Expected 1 disconnect, got %f", value)
+	}
+}
@@ -4,46 +4,36 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"net/http/httptest"
 	"runtime"
-	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	nbclient "github.com/netbirdio/netbird/management/client/rest"
 	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
 )
 
+// performanceFixture returns a fixture with connected peers, a user, a
+// nameserver group and a network
+func performanceFixture(peers int) *fakeapi.Fixture {
+	f := fakeapi.NewFixture("example.com")
+	for i := 0; i < peers; i++ {
+		f.Peer(fmt.Sprintf("peer-%d", i)).Connected().OS("linux", "6.1").Groups("test").Location("US", "City").SSH()
+	}
+	f.User("test@example.com").Role("admin")
+	f.Nameservers("test").Nameserver("8.8.8.8")
+	f.Network("test")
+	return f
+}
+
 func TestExporters_Performance_ConcurrentCollections(t *testing.T) {
-	// Create a mock server that responds to all endpoints
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Add some latency to simulate real API calls
-		time.Sleep(10 * time.Millisecond)
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-
-		switch r.URL.Path {
-		case "/api/peers":
-			_, _ = w.Write([]byte(`[{"id":"peer1","name":"test","ip":"100.64.0.1","connected":true}]`))
-		case "/api/groups":
-			_, _ = w.Write([]byte(`[{"id":"group1","name":"test","peers_count":1}]`))
-		case "/api/users":
-			_, _ = w.Write([]byte(`[{"id":"user1","email":"test@example.com","role":"admin"}]`))
-		case "/api/dns/nameservers":
-			_, _ = w.Write([]byte(`[{"id":"ns1","name":"test","enabled":true}]`))
-		case "/api/dns/settings":
-			_, _ = w.Write([]byte(`{"items":{"disabled_management_groups":[]}}`))
-		case "/api/networks":
-			_, _ = w.Write([]byte(`[{"id":"net1","name":"test"}]`))
-		default:
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
+	server, url := newTestAPI(t, performanceFixture(1))
+	// Add some latency to simulate real API calls
+	server.SetLatency(10 * time.Millisecond)
 
-	exporter := NewNetBirdExporter(server.URL, "test-token")
+	exporter := NewNetBirdExporter(url, "test-token")
 
 	// Test concurrent collections
 	const numGoroutines = 10
@@ -109,36 +99,10 @@ func TestExporters_Performance_ConcurrentCollections(t *testing.T) {
 }
 
 func TestExporters_Performance_MemoryUsage(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-
-		// Return larger datasets to test memory usage
-		switch r.URL.Path {
-		case "/api/peers":
-			// Generate larger peer dataset
-			peers := make([]string, 100)
-			for i := 0; i < 100; i++ {
-				peers[i] = fmt.Sprintf(`{"id":"peer%d","name":"test","ip":"100.64.0.1","connected":true}`, i)
-			}
-			_, _ = w.Write([]byte(`[` + strings.Join(peers, ",") + `]`))
-		case "/api/groups":
-			_, _ = w.Write([]byte(`[{"id":"group1","name":"test","peers_count":1}]`))
-		case "/api/users":
-			_, _ = w.Write([]byte(`[{"id":"user1","email":"test@example.com","role":"admin"}]`))
-		case "/api/dns/nameservers":
-			_, _ = w.Write([]byte(`[{"id":"ns1","name":"test","enabled":true}]`))
-		case "/api/dns/settings":
-			_, _ = w.Write([]byte(`{"items":{"disabled_management_groups":[]}}`))
-		case "/api/networks":
-			_, _ = w.Write([]byte(`[{"id":"net1","name":"test"}]`))
-		default:
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
+	// Return larger datasets to test memory usage
+	_, url := newTestAPI(t, performanceFixture(100))
 
-	exporter := NewNetBirdExporter(server.URL, "test-token")
+	exporter := NewNetBirdExporter(url, "test-token")
 
 	// Force garbage collection before measuring
 	runtime.GC()
@@ -191,34 +155,11 @@ func TestExporters_Performance_MemoryUsage(t *testing.T) {
 }
 
 func TestExporters_Performance_HighLatencyAPI(t *testing.T) {
-	// Create a server with high latency to test timeout handling
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Simulate high latency (but not timeout)
-		time.Sleep(2 * time.Second)
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-
-		switch r.URL.Path {
-		case "/api/peers":
-			_, _ = w.Write([]byte(`[{"id":"peer1","name":"test","ip":"100.64.0.1","connected":true}]`))
-		case "/api/groups":
-			_, _ = w.Write([]byte(`[{"id":"group1","name":"test","peers_count":1}]`))
-		case "/api/users":
-			_, _ = w.Write([]byte(`[{"id":"user1","email":"test@example.com","role":"admin"}]`))
-		case "/api/dns/nameservers":
-			_, _ = w.Write([]byte(`[{"id":"ns1","name":"test","enabled":true}]`))
-		case "/api/dns/settings":
-			_, _ = w.Write([]byte(`{"items":{"disabled_management_groups":[]}}`))
-		case "/api/networks":
-			_, _ = w.Write([]byte(`[{"id":"net1","name":"test"}]`))
-		default:
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
+	// Simulate high latency (but not timeout) to test timeout handling
+	server, url := newTestAPI(t, performanceFixture(1))
+	server.SetLatency(2 * time.Second)
 
-	exporter := NewNetBirdExporter(server.URL, "test-token")
+	exporter := NewNetBirdExporter(url, "test-token")
 
 	// Test collection with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -259,40 +200,13 @@ func TestExporters_Performance_HighLatencyAPI(t *testing.T) {
 }
 
 func TestExporters_Performance_ErrorRecovery(t *testing.T) {
-	// Create a server that sometimes fails
-	requestCount := 0
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestCount++
-
-		// Fail every 3rd request to test error recovery
-		if requestCount%3 == 0 {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-
-		switch r.URL.Path {
-		case "/api/peers":
-			_, _ = w.Write([]byte(`[{"id":"peer1","name":"test","ip":"100.64.0.1","connected":true}]`))
-		case "/api/groups":
-			_, _ = w.Write([]byte(`[{"id":"group1","name":"test","peers_count":1}]`))
-		case "/api/users":
-			_, _ = w.Write([]byte(`[{"id":"user1","email":"test@example.com","role":"admin"}]`))
-		case "/api/dns/nameservers":
-			_, _ = w.Write([]byte(`[{"id":"ns1","name":"test","enabled":true}]`))
-		case "/api/dns/settings":
-			_, _ = w.Write([]byte(`{"items":{"disabled_management_groups":[]}}`))
-		case "/api/networks":
-			_, _ = w.Write([]byte(`[{"id":"net1","name":"test"}]`))
-		default:
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
+	// Fail the first requests of some endpoints to test error recovery
+	server, url := newTestAPI(t, performanceFixture(1))
+	server.InjectError("/api/peers", http.StatusInternalServerError, 3)
+	server.InjectError("/api/groups", http.StatusInternalServerError, 3)
+	server.InjectError("/api/users", http.StatusServiceUnavailable, 3)
 
-	exporter := NewNetBirdExporter(server.URL, "test-token")
+	exporter := NewNetBirdExporter(url, "test-token")
 
 	// Perform multiple collections with intermittent failures
 	successCount := 0
@@ -327,30 +241,9 @@ func TestExporters_Performance_ErrorRecovery(t *testing.T) {
 }
 
 func BenchmarkExporter_Collect(b *testing.B) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-
-		switch r.URL.Path {
-		case "/api/peers":
-			_, _ = w.Write([]byte(`[{"id":"peer1","name":"test","ip":"100.64.0.1","connected":true}]`))
-		case "/api/groups":
-			_, _ = w.Write([]byte(`[{"id":"group1","name":"test","peers_count":1}]`))
-		case "/api/users":
-			_, _ = w.Write([]byte(`[{"id":"user1","email":"test@example.com","role":"admin"}]`))
-		case "/api/dns/nameservers":
-			_, _ = w.Write([]byte(`[{"id":"ns1","name":"test","enabled":true}]`))
-		case "/api/dns/settings":
-			_, _ = w.Write([]byte(`{"items":{"disabled_management_groups":[]}}`))
-		case "/api/networks":
-			_, _ = w.Write([]byte(`[{"id":"net1","name":"test"}]`))
-		default:
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
+	_, url := newTestAPI(b, performanceFixture(1))
 
-	exporter := NewNetBirdExporter(server.URL, "test-token")
+	exporter := NewNetBirdExporter(url, "test-token")
 
 	b.ResetTimer()
 
@@ -368,20 +261,14 @@ func BenchmarkExporter_Collect(b *testing.B) {
 }
 
 func BenchmarkPeersExporter_Collect(b *testing.B) {
-	// Create a mock peers response
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`[
-			{"id":"peer1","name":"test-peer-1","ip":"100.64.0.1","connected":true},
-			{"id":"peer2","name":"test-peer-2","ip":"100.64.0.2","connected":false},
-			{"id":"peer3","name":"test-peer-3","ip":"100.64.0.3","connected":true}
-		]`))
-	}))
-	defer server.Close()
+	f := fakeapi.NewFixture("example.com")
+	f.Peer("test-peer-1").Connected()
+	f.Peer("test-peer-2")
+	f.Peer("test-peer-3").Connected()
+	_, url := newTestAPI(b, f)
 
 	// Create exporter with test server client
-	exporter := NewPeersExporter(nbclient.New(server.URL, "test-token"))
+	exporter := NewPeersExporter(nbclient.New(url, "test-token"))
 
 	b.ResetTimer()
 
@@ -399,36 +286,10 @@ func BenchmarkPeersExporter_Collect(b *testing.B) {
 }
 
 func TestExporters_StressTest_ManyMetrics(t *testing.T) {
-	// Create a server that returns many metrics
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-
-		switch r.URL.Path {
-		case "/api/peers":
-			// Generate 1000 peers
-			peers := make([]string, 1000)
-			for i := 0; i < 1000; i++ {
-				peers[i] = fmt.Sprintf(`{"id":"peer%d","name":"test","ip":"100.64.0.1","connected":true,"last_seen":"2023-01-01T00:00:00Z","os":"linux","groups":[],"ssh_enabled":true,"hostname":"host","login_expired":false,"approval_required":false,"country_code":"US","city_name":"City","accessible_peers_count":5}`, i)
-			}
-			_, _ = w.Write([]byte(`[` + strings.Join(peers, ",") + `]`))
-		case "/api/groups":
-			_, _ = w.Write([]byte(`[{"id":"group1","name":"test","peers_count":1000}]`))
-		case "/api/users":
-			_, _ = w.Write([]byte(`[{"id":"user1","email":"test@example.com","role":"admin"}]`))
-		case "/api/dns/nameservers":
-			_, _ = w.Write([]byte(`[{"id":"ns1","name":"test","enabled":true}]`))
-		case "/api/dns/settings":
-			_, _ = w.Write([]byte(`{"items":{"disabled_management_groups":[]}}`))
-		case "/api/networks":
-			_, _ = w.Write([]byte(`[{"id":"net1","name":"test"}]`))
-		default:
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
+	// Generate 1000 peers
+	_, url := newTestAPI(t, performanceFixture(1000))
 
-	exporter := NewNetBirdExporter(server.URL, "test-token")
+	exporter := NewNetBirdExporter(url, "test-token")
 
 	startTime := time.Now()
 
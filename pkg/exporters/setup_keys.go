@@ -0,0 +1,136 @@
+package exporters
+
+import (
+	"context"
+	"time"
+
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// SetupKeysConfig holds optional settings for the setup keys exporter
+type SetupKeysConfig struct {
+	// Enabled collects setup key metrics, one extra API call per scrape
+	Enabled bool
+}
+
+// SetupKeysExporter handles setup keys-specific metrics collection
+type SetupKeysExporter struct {
+	client *nbclient.Client
+	now    func() time.Time
+
+	// Prometheus metrics for setup keys
+	setupKeysTotal    *prometheus.GaugeVec
+	setupKeyExpiresIn *prometheus.GaugeVec
+	setupKeyUsedTimes *prometheus.GaugeVec
+	scrapeErrorsTotal *prometheus.CounterVec
+	scrapeDuration    *prometheus.HistogramVec
+}
+
+// NewSetupKeysExporter creates a new setup keys exporter
+func NewSetupKeysExporter(client *nbclient.Client) *SetupKeysExporter {
+	return &SetupKeysExporter{
+		client: client,
+		now:    time.Now,
+
+		setupKeysTotal: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_setup_keys",
+				Help: "Total number of NetBird setup keys by type and state",
+			},
+			[]string{"type", "state"},
+		),
+
+		setupKeyExpiresIn: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_setup_key_expires_in_seconds",
+				Help: "Seconds until each valid NetBird setup key expires",
+			},
+			[]string{"key_id", "key_name", "type"},
+		),
+
+		setupKeyUsedTimes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_setup_key_used_times",
+				Help: "Number of times each valid NetBird setup key was used",
+			},
+			[]string{"key_id", "key_name", "type"},
+		),
+
+		scrapeErrorsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_setup_keys_scrape_errors_total",
+				Help: "Total number of errors encountered while scraping setup keys",
+			},
+			[]string{"error_type"},
+		),
+
+		scrapeDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "netbird_setup_keys_scrape_duration_seconds",
+				Help: "Time spent scraping setup keys from the NetBird API",
+			},
+			[]string{},
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (e *SetupKeysExporter) Describe(ch chan<- *prometheus.Desc) {
+	e.setupKeysTotal.Describe(ch)
+	e.setupKeyExpiresIn.Describe(ch)
+	e.setupKeyUsedTimes.Describe(ch)
+	e.scrapeErrorsTotal.Describe(ch)
+	e.scrapeDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (e *SetupKeysExporter) Collect(ch chan<- prometheus.Metric) {
+	timer := prometheus.NewTimer(e.scrapeDuration.WithLabelValues())
+	defer timer.ObserveDuration()
+
+	// Reset metrics before collecting new values
+	e.setupKeysTotal.Reset()
+	e.setupKeyExpiresIn.Reset()
+	e.setupKeyUsedTimes.Reset()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	keys, err := e.client.SetupKeys.List(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch setup keys")
+		e.scrapeErrorsTotal.WithLabelValues("fetch_setup_keys").Inc()
+		e.scrapeErrorsTotal.Collect(ch)
+		return
+	}
+
+	e.updateMetrics(keys, e.now())
+
+	// Collect all metrics
+	e.setupKeysTotal.Collect(ch)
+	e.setupKeyExpiresIn.Collect(ch)
+	e.setupKeyUsedTimes.Collect(ch)
+	e.scrapeErrorsTotal.Collect(ch)
+	e.scrapeDuration.Collect(ch)
+}
+
+// updateMetrics updates Prometheus metrics based on setup keys data. Only valid
+// keys get per-key series, revoked, expired and overused keys are just counted.
+func (e *SetupKeysExporter) updateMetrics(keys []api.SetupKey, now time.Time) {
+	for _, key := range keys {
+		e.setupKeysTotal.WithLabelValues(key.Type, key.State).Inc()
+
+		if !key.Valid || key.Revoked {
+			continue
+		}
+		e.setupKeyUsedTimes.WithLabelValues(key.Id, key.Name, key.Type).Set(float64(key.UsedTimes))
+		if !key.Expires.IsZero() {
+			e.setupKeyExpiresIn.WithLabelValues(key.Id, key.Name, key.Type).Set(key.Expires.Sub(now).Seconds())
+		}
+	}
+
+	logrus.WithField("setup_keys", len(keys)).Debug("Updated setup keys metrics")
+}
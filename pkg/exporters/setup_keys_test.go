@@ -0,0 +1,64 @@
+package exporters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
+)
+
+func TestSetupKeysExporter_UpdateMetrics(t *testing.T) {
+	now := time.Now()
+	exporter := NewSetupKeysExporter(nil)
+
+	exporter.updateMetrics([]api.SetupKey{
+		{Id: "key1", Name: "ci", Type: "reusable", State: "valid", Valid: true, UsedTimes: 12, Expires: now.Add(48 * time.Hour)},
+		{Id: "key2", Name: "laptop", Type: "one-off", State: "overused", Valid: false, UsedTimes: 1, Expires: now.Add(48 * time.Hour)},
+		{Id: "key3", Name: "old", Type: "reusable", State: "revoked", Valid: true, Revoked: true, Expires: now.Add(time.Hour)},
+		{Id: "key4", Name: "forever", Type: "reusable", State: "valid", Valid: true},
+	}, now)
+
+	if value := testutil.ToFloat64(exporter.setupKeysTotal.WithLabelValues("reusable", "valid")); value != 2 {
+		t.Errorf("Expected 2 valid reusable keys, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.setupKeyExpiresIn.WithLabelValues("key1", "ci", "reusable")); value != (48 * time.Hour).Seconds() {
+		t.Errorf("Expected key1 to expire in 48h, got %fs", value)
+	}
+	if count := testutil.CollectAndCount(exporter.setupKeyExpiresIn); count != 1 {
+		t.Errorf("Expected expiry only for valid keys with an expiry date, got %d series", count)
+	}
+	if value := testutil.ToFloat64(exporter.setupKeyUsedTimes.WithLabelValues("key1", "ci", "reusable")); value != 12 {
+		t.Errorf("Expected key1 used 12 times, got %f", value)
+	}
+}
+
+func TestNetBirdExporter_SetupKeysDisabledByDefault(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	f.SetupKey("ci").Reusable()
+	_, url := newTestAPI(t, f)
+
+	if exporter := NewNetBirdExporter(url, "test-token"); exporter.setupKeysExporter != nil {
+		t.Error("Expected setup keys collection to be disabled by default")
+	}
+
+	exporter := NewNetBirdExporterWithConfig(url, "test-token", Config{SetupKeys: SetupKeysConfig{Enabled: true}})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	found := false
+	for _, family := range families {
+		if family.GetName() == "netbird_setup_keys" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected netbird_setup_keys when setup keys collection is enabled")
+	}
+}
@@ -0,0 +1,159 @@
+package exporters
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/sirupsen/logrus"
+)
+
+// StalePeersReport lists peers that have not been seen for longer than the
+// configured threshold and still hold valid keys
+type StalePeersReport struct {
+	GeneratedAt    time.Time   `json:"generated_at"`
+	StaleAfterDays int         `json:"stale_after_days"`
+	ExcludedGroups []string    `json:"excluded_groups"`
+	Count          int         `json:"count"`
+	Peers          []StalePeer `json:"peers"`
+}
+
+// StalePeer is a single entry of the stale peers report
+type StalePeer struct {
+	ID            string             `json:"id"`
+	Name          string             `json:"name"`
+	Hostname      string             `json:"hostname"`
+	IP            string             `json:"ip"`
+	OS            string             `json:"os"`
+	Version       string             `json:"version"`
+	UserID        string             `json:"user_id"`
+	LastSeen      time.Time          `json:"last_seen"`
+	DaysSinceSeen int                `json:"days_since_seen"`
+	LoginExpired  bool               `json:"login_expired"`
+	Groups        []api.GroupMinimum `json:"groups"`
+}
+
+// isStalePeer reports whether a peer is stale at now. Connected and ephemeral
+// peers are never stale, nor are peers in one of the excluded groups.
+func isStalePeer(peer api.Peer, threshold time.Duration, excluded map[string]bool, now time.Time) bool {
+	if peer.Connected || peer.Ephemeral {
+		return false
+	}
+	for _, group := range peer.Groups {
+		if excluded[group.Id] || excluded[group.Name] {
+			return false
+		}
+	}
+	return now.Sub(peer.LastSeen) > threshold
+}
+
+// updateStaleMetrics classifies stale peers, updates the stale peer metrics
+// and replaces the stale peers report
+func (e *PeersExporter) updateStaleMetrics(peers []api.Peer, now time.Time) {
+	if e.config.StaleAfterDays <= 0 {
+		return
+	}
+
+	threshold := time.Duration(e.config.StaleAfterDays) * 24 * time.Hour
+	excluded := make(map[string]bool, len(e.config.StaleExcludedGroups))
+	for _, group := range e.config.StaleExcludedGroups {
+		excluded[group] = true
+	}
+
+	report := &StalePeersReport{
+		GeneratedAt:    now,
+		StaleAfterDays: e.config.StaleAfterDays,
+		ExcludedGroups: e.config.StaleExcludedGroups,
+		Peers:          make([]StalePeer, 0),
+	}
+	if report.ExcludedGroups == nil {
+		report.ExcludedGroups = []string{}
+	}
+
+	groupCounts := make(map[[2]string]int)
+	osCounts := make(map[string]int)
+
+	for _, peer := range peers {
+		if !isStalePeer(peer, threshold, excluded, now) {
+			continue
+		}
+
+		for _, group := range peer.Groups {
+			groupCounts[[2]string{group.Id, group.Name}]++
+		}
+
+		osKey := peer.Os
+		if osKey == "" {
+			osKey = "unknown"
+		}
+		osCounts[osKey]++
+
+		groups := peer.Groups
+		if groups == nil {
+			groups = []api.GroupMinimum{}
+		}
+		report.Peers = append(report.Peers, StalePeer{
+			ID:            peer.Id,
+			Name:          peer.Name,
+			Hostname:      peer.Hostname,
+			IP:            peer.Ip,
+			OS:            peer.Os,
+			Version:       peer.Version,
+			UserID:        peer.UserId,
+			LastSeen:      peer.LastSeen,
+			DaysSinceSeen: int(now.Sub(peer.LastSeen).Hours() / 24),
+			LoginExpired:  peer.LoginExpired,
+			Groups:        groups,
+		})
+	}
+
+	// Longest unseen peers first
+	sort.Slice(report.Peers, func(i, j int) bool {
+		return report.Peers[i].LastSeen.Before(report.Peers[j].LastSeen)
+	})
+	report.Count = len(report.Peers)
+
+	e.peersStale.WithLabelValues(strconv.Itoa(e.config.StaleAfterDays)).Set(float64(report.Count))
+	for group, count := range groupCounts {
+		e.peersStaleByGroup.WithLabelValues(group[0], group[1]).Set(float64(count))
+	}
+	for os, count := range osCounts {
+		e.peersStaleByOS.WithLabelValues(os).Set(float64(count))
+	}
+
+	e.staleReportMu.Lock()
+	e.staleReport = report
+	e.staleReportMu.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"stale_peers":      report.Count,
+		"stale_after_days": e.config.StaleAfterDays,
+	}).Debug("Updated stale peer metrics")
+}
+
+// StalePeersReport returns the stale peers report from the latest collection,
+// or nil when stale peer detection is disabled or no collection has run yet
+func (e *PeersExporter) StalePeersReport() *StalePeersReport {
+	e.staleReportMu.RLock()
+	defer e.staleReportMu.RUnlock()
+	return e.staleReport
+}
+
+// StalePeersHandler serves the latest stale peers report as JSON
+func (e *NetBirdExporter) StalePeersHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := e.peersExporter.StalePeersReport()
+		if report == nil {
+			http.Error(w, "stale peers report not available yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logrus.WithError(err).Error("Failed to write stale peers report")
+		}
+	})
+}
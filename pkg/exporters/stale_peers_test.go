@@ -0,0 +1,107 @@
+package exporters
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPeersExporter_StaleMetrics(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewPeersExporterWithConfig(client, PeersConfig{
+		StaleAfterDays:      30,
+		StaleExcludedGroups: []string{"servers"},
+	})
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	devs := api.GroupMinimum{Id: "group1", Name: "devs"}
+	servers := api.GroupMinimum{Id: "group2", Name: "servers"}
+	peers := []api.Peer{
+		{Id: "peer1", Name: "old-laptop", Os: "darwin", LastSeen: now.Add(-60 * 24 * time.Hour), Groups: []api.GroupMinimum{devs}},
+		{Id: "peer2", Name: "older-laptop", Os: "windows", LastSeen: now.Add(-90 * 24 * time.Hour), Groups: []api.GroupMinimum{devs}},
+		{Id: "peer3", Name: "active-laptop", Os: "linux", LastSeen: now.Add(-24 * time.Hour), Groups: []api.GroupMinimum{devs}},
+		{Id: "peer4", Name: "ci-runner", Os: "linux", Ephemeral: true, LastSeen: now.Add(-60 * 24 * time.Hour)},
+		{Id: "peer5", Name: "backup-server", Os: "linux", LastSeen: now.Add(-60 * 24 * time.Hour), Groups: []api.GroupMinimum{devs, servers}},
+		{Id: "peer6", Name: "online", Os: "linux", Connected: true, LastSeen: now.Add(-60 * 24 * time.Hour)},
+	}
+
+	exporter.updateStaleMetrics(peers, now)
+
+	if value := testutil.ToFloat64(exporter.peersStale.WithLabelValues("30")); value != 2 {
+		t.Errorf("Expected 2 stale peers, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.peersStaleByGroup.WithLabelValues("group1", "devs")); value != 2 {
+		t.Errorf("Expected 2 stale peers in devs, got %f", value)
+	}
+	if count := testutil.CollectAndCount(exporter.peersStaleByOS); count != 2 {
+		t.Errorf("Expected stale peers on 2 operating systems, got %d", count)
+	}
+
+	report := exporter.StalePeersReport()
+	if report == nil {
+		t.Fatal("Expected stale peers report to be available")
+	}
+	if report.Count != 2 || len(report.Peers) != 2 {
+		t.Fatalf("Expected 2 peers in report, got %d", report.Count)
+	}
+	if report.Peers[0].Name != "older-laptop" {
+		t.Errorf("Expected longest unseen peer first, got %s", report.Peers[0].Name)
+	}
+	if report.Peers[0].DaysSinceSeen != 90 {
+		t.Errorf("Expected 90 days since seen, got %d", report.Peers[0].DaysSinceSeen)
+	}
+}
+
+func TestPeersExporter_StaleDisabledByDefault(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewPeersExporter(client)
+
+	exporter.updateStaleMetrics([]api.Peer{{Id: "peer1"}}, time.Now())
+
+	if count := testutil.CollectAndCount(exporter.peersStale); count != 0 {
+		t.Errorf("Expected no stale metric when disabled, got %d", count)
+	}
+	if exporter.StalePeersReport() != nil {
+		t.Error("Expected no stale peers report when disabled")
+	}
+}
+
+func TestNetBirdExporter_StalePeersHandler(t *testing.T) {
+	exporter := NewNetBirdExporterWithConfig("https://api.netbird.io", "test-token", Config{
+		Peers: PeersConfig{StaleAfterDays: 7},
+	})
+
+	// No collection yet
+	rec := httptest.NewRecorder()
+	exporter.StalePeersHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/stale-peers", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 before the first collection, got %d", rec.Code)
+	}
+
+	exporter.peersExporter.updateStaleMetrics([]api.Peer{
+		{Id: "peer1", Name: "gone", LastSeen: time.Now().Add(-10 * 24 * time.Hour)},
+	}, time.Now())
+
+	rec = httptest.NewRecorder()
+	exporter.StalePeersHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/stale-peers", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", contentType)
+	}
+
+	var report StalePeersReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Count != 1 || report.Peers[0].ID != "peer1" {
+		t.Errorf("Expected report with peer1, got %+v", report)
+	}
+}
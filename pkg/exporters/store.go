@@ -0,0 +1,174 @@
+package exporters
+
+import (
+	"sync"
+	"time"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+)
+
+// Store keeps the most recent objects fetched by the sub-exporters so that
+// other sub-exporters can reuse them within a scrape instead of calling the
+// NetBird API again. All methods are safe to call on a nil Store.
+type Store struct {
+	mu sync.RWMutex
+
+	// scrapeStarted is the start of the current scrape, objects stored before
+	// it are left over from an earlier scrape
+	scrapeStarted time.Time
+
+	peers        []api.Peer
+	peersUpdated time.Time
+
+	users        []api.User
+	usersUpdated time.Time
+
+	groups        []api.Group
+	groupsUpdated time.Time
+
+	networks        []api.Network
+	networksUpdated time.Time
+
+	nameserverGroups        []api.NameserverGroup
+	nameserverGroupsUpdated time.Time
+}
+
+// NewStore creates an empty store
+func NewStore() *Store {
+	return &Store{}
+}
+
+// StartScrape marks the start of a scrape. Objects stored before it are still
+// returned by the getters, e.g. for the inventory, but not by CurrentPeers.
+func (s *Store) StartScrape() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scrapeStarted = time.Now()
+}
+
+// SetPeers replaces the stored peers
+func (s *Store) SetPeers(peers []api.Peer) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peers = peers
+	s.peersUpdated = time.Now()
+}
+
+// Peers returns the stored peers and when they were fetched, ok is false when
+// no peers have been stored yet
+func (s *Store) Peers() (peers []api.Peer, updated time.Time, ok bool) {
+	if s == nil {
+		return nil, time.Time{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.peers, s.peersUpdated, !s.peersUpdated.IsZero()
+}
+
+// CurrentPeers returns the peers stored during the current scrape, ok is false
+// when the peers exporter has not stored them yet or failed to fetch them
+func (s *Store) CurrentPeers() (peers []api.Peer, ok bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.peersUpdated.IsZero() || s.peersUpdated.Before(s.scrapeStarted) {
+		return nil, false
+	}
+	return s.peers, true
+}
+
+// SetUsers replaces the stored users
+func (s *Store) SetUsers(users []api.User) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = users
+	s.usersUpdated = time.Now()
+}
+
+// Users returns the stored users and when they were fetched, ok is false when
+// no users have been stored yet
+func (s *Store) Users() (users []api.User, updated time.Time, ok bool) {
+	if s == nil {
+		return nil, time.Time{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users, s.usersUpdated, !s.usersUpdated.IsZero()
+}
+
+// SetGroups replaces the stored groups
+func (s *Store) SetGroups(groups []api.Group) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups = groups
+	s.groupsUpdated = time.Now()
+}
+
+// Groups returns the stored groups and when they were fetched, ok is false when
+// no groups have been stored yet
+func (s *Store) Groups() (groups []api.Group, updated time.Time, ok bool) {
+	if s == nil {
+		return nil, time.Time{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.groups, s.groupsUpdated, !s.groupsUpdated.IsZero()
+}
+
+// SetNetworks replaces the stored networks
+func (s *Store) SetNetworks(networks []api.Network) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.networks = networks
+	s.networksUpdated = time.Now()
+}
+
+// Networks returns the stored networks and when they were fetched, ok is false
+// when no networks have been stored yet
+func (s *Store) Networks() (networks []api.Network, updated time.Time, ok bool) {
+	if s == nil {
+		return nil, time.Time{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.networks, s.networksUpdated, !s.networksUpdated.IsZero()
+}
+
+// SetNameserverGroups replaces the stored nameserver groups
+func (s *Store) SetNameserverGroups(groups []api.NameserverGroup) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nameserverGroups = groups
+	s.nameserverGroupsUpdated = time.Now()
+}
+
+// NameserverGroups returns the stored nameserver groups and when they were
+// fetched, ok is false when no nameserver groups have been stored yet
+func (s *Store) NameserverGroups() (groups []api.NameserverGroup, updated time.Time, ok bool) {
+	if s == nil {
+		return nil, time.Time{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nameserverGroups, s.nameserverGroupsUpdated, !s.nameserverGroupsUpdated.IsZero()
+}
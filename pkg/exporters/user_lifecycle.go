@@ -0,0 +1,107 @@
+package exporters
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/sirupsen/logrus"
+)
+
+// userRole returns the role label of a user
+func userRole(user api.User) string {
+	if user.Role == "" {
+		return "unknown"
+	}
+	return user.Role
+}
+
+// isServiceUser reports whether a user is a service user, which never logs in
+func isServiceUser(user api.User) bool {
+	return user.IsServiceUser != nil && *user.IsServiceUser
+}
+
+// updateLifecycleMetrics counts pending invitations, active users who never
+// logged in and dormant users by role. Service users are skipped as they never
+// log in to the dashboard.
+func (e *UsersExporter) updateLifecycleMetrics(users []api.User, now time.Time) {
+	invitedCounts := make(map[string]int)
+	neverLoggedInCounts := make(map[string]int)
+	dormantCounts := make(map[string]int)
+	threshold := time.Duration(e.config.DormantAfterDays) * 24 * time.Hour
+
+	for _, user := range users {
+		if isServiceUser(user) {
+			continue
+		}
+
+		role := userRole(user)
+		switch user.Status {
+		case api.UserStatusInvited:
+			invitedCounts[role]++
+		case api.UserStatusActive:
+			if user.LastLogin == nil || user.LastLogin.IsZero() {
+				neverLoggedInCounts[role]++
+			} else if e.config.DormantAfterDays > 0 && now.Sub(*user.LastLogin) > threshold {
+				dormantCounts[role]++
+			}
+		}
+	}
+
+	for role, count := range invitedCounts {
+		e.usersInvitesPending.WithLabelValues(role).Set(float64(count))
+	}
+	for role, count := range neverLoggedInCounts {
+		e.usersNeverLoggedIn.WithLabelValues(role).Set(float64(count))
+	}
+
+	if e.config.DormantAfterDays > 0 {
+		days := strconv.Itoa(e.config.DormantAfterDays)
+		for role, count := range dormantCounts {
+			e.usersDormant.WithLabelValues(role, days).Set(float64(count))
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"invites_pending":    invitedCounts,
+		"never_logged_in":    neverLoggedInCounts,
+		"dormant":            dormantCounts,
+		"dormant_after_days": e.config.DormantAfterDays,
+	}).Debug("Updated user lifecycle metrics")
+}
+
+// fetchInviteTimes returns the time of the first invitation event of every
+// user found in the audit events
+func (e *UsersExporter) fetchInviteTimes(ctx context.Context) (map[string]time.Time, error) {
+	events, err := e.client.Events.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invited := make(map[string]time.Time)
+	for _, event := range events {
+		if event.ActivityCode != api.EventActivityCodeUserInvite {
+			continue
+		}
+		if first, ok := invited[event.TargetId]; !ok || event.Timestamp.Before(first) {
+			invited[event.TargetId] = event.Timestamp
+		}
+	}
+	return invited, nil
+}
+
+// updateInviteAgeMetrics sets the age of every pending invitation. Invitations
+// older than the audit event retention have no event and are skipped.
+func (e *UsersExporter) updateInviteAgeMetrics(users []api.User, invited map[string]time.Time, now time.Time) {
+	for _, user := range users {
+		if user.Status != api.UserStatusInvited {
+			continue
+		}
+		sentAt, ok := invited[user.Id]
+		if !ok {
+			continue
+		}
+		e.userInviteAge.WithLabelValues(user.Id, user.Email, user.Name, userRole(user)).Set(now.Sub(sentAt).Seconds())
+	}
+}
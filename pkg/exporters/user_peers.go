@@ -0,0 +1,77 @@
+package exporters
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/sirupsen/logrus"
+)
+
+// peers returns the peers collected by the peers exporter in this scrape, or
+// fetches them when the exporter runs standalone or the peers exporter failed
+// to fetch them
+func (e *UsersExporter) peers(ctx context.Context) ([]api.Peer, error) {
+	if peers, ok := e.store.CurrentPeers(); ok {
+		return peers, nil
+	}
+	return e.client.Peers.List(ctx)
+}
+
+// updateOwnershipMetrics joins peers to the users that enrolled them. Peers
+// enrolled with a setup key have no owning user and are skipped.
+func (e *UsersExporter) updateOwnershipMetrics(users []api.User, peers []api.Peer) {
+	usersByID := make(map[string]api.User, len(users))
+	for _, user := range users {
+		usersByID[user.Id] = user
+	}
+
+	owned := make(map[string]int)
+	connected := make(map[string]int)
+	orphaned := 0
+
+	for _, peer := range peers {
+		if peer.UserId == "" {
+			continue
+		}
+		if _, ok := usersByID[peer.UserId]; !ok {
+			e.peerOrphanedOwner.WithLabelValues(peer.Id, peer.Name, peer.UserId).Set(1)
+			orphaned++
+			continue
+		}
+		owned[peer.UserId]++
+		if peer.Connected {
+			connected[peer.UserId]++
+		}
+	}
+
+	overLimit := 0
+	maxPeers := strconv.Itoa(e.config.MaxPeersPerUser)
+	for userID, count := range owned {
+		user := usersByID[userID]
+		userLabels := []string{user.Id, user.Email, user.Name}
+
+		e.userPeers.WithLabelValues(userLabels...).Set(float64(count))
+		e.userPeersConnected.WithLabelValues(userLabels...).Set(float64(connected[userID]))
+
+		if e.config.MaxPeersPerUser > 0 && count > e.config.MaxPeersPerUser {
+			e.userOverPeerLimit.WithLabelValues(append(userLabels, maxPeers)...).Set(1)
+			overLimit++
+		}
+
+		if user.IsBlocked && connected[userID] > 0 {
+			e.userBlockedConnectedPeers.WithLabelValues(userLabels...).Set(float64(connected[userID]))
+		}
+	}
+
+	if e.config.MaxPeersPerUser > 0 {
+		e.usersOverPeerLimit.WithLabelValues(maxPeers).Set(float64(overLimit))
+	}
+	e.peersOrphanedOwner.WithLabelValues().Set(float64(orphaned))
+
+	logrus.WithFields(logrus.Fields{
+		"owners":          len(owned),
+		"over_peer_limit": overLimit,
+		"orphaned_peers":  orphaned,
+	}).Debug("Updated user peer ownership metrics")
+}
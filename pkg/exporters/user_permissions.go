@@ -0,0 +1,179 @@
+package exporters
+
+import (
+	"strconv"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/sirupsen/logrus"
+)
+
+// permissionKey identifies a single permission of a module
+type permissionKey struct {
+	module     string
+	permission string
+}
+
+// userPermissionValue returns whether a user is granted a permission. Missing
+// modules and permissions are not granted.
+func userPermissionValue(user api.User, key permissionKey) bool {
+	if user.Permissions == nil {
+		return false
+	}
+	return user.Permissions.Modules[key.module][key.permission]
+}
+
+// Baselines the permissions of a user are compared to
+const (
+	// baselineRoleDefault is the permission NetBird grants a built-in role
+	baselineRoleDefault = "role_default"
+	// baselineRoleMajority is the permission of the majority of the users of
+	// a role NetBird has no defaults for, ties count as not granted
+	baselineRoleMajority = "role_majority"
+)
+
+// permissionModules are the modules NetBird grants permissions on
+var permissionModules = map[string]bool{
+	"networks": true, "peers": true, "groups": true, "settings": true, "accounts": true,
+	"dns": true, "nameservers": true, "events": true, "policies": true, "routes": true,
+	"users": true, "setup_keys": true, "pats": true,
+}
+
+// rolePermissions are the permissions of a built-in NetBird role: the
+// operations granted on the listed modules, and on every other module
+type rolePermissions struct {
+	modules map[string]map[string]bool
+	others  map[string]bool
+}
+
+func allOperations(granted bool) map[string]bool {
+	return map[string]bool{"read": granted, "create": granted, "update": granted, "delete": granted}
+}
+
+func readOnly() map[string]bool {
+	return map[string]bool{"read": true, "create": false, "update": false, "delete": false}
+}
+
+// defaultRolePermissions are the permissions NetBird grants its built-in roles,
+// as defined in management/server/permissions/roles of NetBird v0.48.0. Modules
+// a role does not list get the operations of its AutoAllowNew.
+var defaultRolePermissions = map[string]rolePermissions{
+	"owner": {others: allOperations(true)},
+	"admin": {
+		modules: map[string]map[string]bool{"accounts": readOnly()},
+		others:  allOperations(true),
+	},
+	"network_admin": {
+		modules: map[string]map[string]bool{
+			"networks": allOperations(true), "groups": allOperations(true), "dns": allOperations(true),
+			"nameservers": allOperations(true), "policies": allOperations(true), "routes": allOperations(true),
+			"pats": allOperations(true), "settings": readOnly(), "accounts": readOnly(), "events": readOnly(),
+			"users": readOnly(), "setup_keys": readOnly(), "peers": readOnly(),
+		},
+		others: allOperations(false),
+	},
+	"auditor": {others: readOnly()},
+	"user":    {others: allOperations(false)},
+}
+
+// RoleDefaultPermissions returns the operations NetBird grants a built-in role
+// by module, ok is false for custom roles. GET /api/users only returns the
+// permissions of the token owner, this fills in the others.
+func RoleDefaultPermissions(role string) (modules map[string]map[string]bool, ok bool) {
+	permissions, ok := defaultRolePermissions[role]
+	if !ok {
+		return nil, false
+	}
+	modules = make(map[string]map[string]bool, len(permissionModules))
+	for module := range permissionModules {
+		operations, ok := permissions.modules[module]
+		if !ok {
+			operations = permissions.others
+		}
+		modules[module] = make(map[string]bool, len(operations))
+		for operation, granted := range operations {
+			modules[module][operation] = granted
+		}
+	}
+	return modules, true
+}
+
+// roleDefault returns whether NetBird grants a built-in role a permission, ok
+// is false for custom roles and unknown modules or operations
+func roleDefault(role string, key permissionKey) (granted, ok bool) {
+	permissions, ok := defaultRolePermissions[role]
+	if !ok || !permissionModules[key.module] {
+		return false, false
+	}
+	operations, ok := permissions.modules[key.module]
+	if !ok {
+		operations = permissions.others
+	}
+	granted, ok = operations[key.permission]
+	return granted, ok
+}
+
+// updatePermissionMetrics counts the users granted each permission, optionally
+// per role, and flags users whose permissions differ from their role. Users of
+// the built-in roles are compared to the NetBird defaults of their role, users
+// of other roles to the majority of the users of their role. Users without
+// permissions, which NetBird only returns for the token owner, are not
+// compared, so that they do not all show up as deviations.
+func (e *UsersExporter) updatePermissionMetrics(users []api.User) {
+	keys := make(map[permissionKey]bool)
+	usersByRole := make(map[string][]api.User)
+	for _, user := range users {
+		usersByRole[userRole(user)] = append(usersByRole[userRole(user)], user)
+		if user.Permissions == nil {
+			continue
+		}
+		for module, permissions := range user.Permissions.Modules {
+			for permission := range permissions {
+				keys[permissionKey{module: module, permission: permission}] = true
+			}
+		}
+	}
+
+	deviations := 0
+	for key := range keys {
+		total := 0
+		for role, roleUsers := range usersByRole {
+			granted, known := 0, 0
+			for _, user := range roleUsers {
+				if user.Permissions != nil {
+					known++
+				}
+				if userPermissionValue(user, key) {
+					granted++
+				}
+			}
+			total += granted
+
+			if e.config.PermissionsByRole {
+				e.usersWithPermissionByRole.WithLabelValues(role, key.module, key.permission).Set(float64(granted))
+			}
+
+			expected, ok := roleDefault(role, key)
+			baseline := baselineRoleDefault
+			if !ok {
+				expected = granted*2 > known
+				baseline = baselineRoleMajority
+			}
+			for _, user := range roleUsers {
+				if user.Permissions == nil {
+					continue
+				}
+				if value := userPermissionValue(user, key); value != expected {
+					e.userPermissionDeviation.WithLabelValues(user.Id, user.Email, role, key.module, key.permission, strconv.FormatBool(value), baseline).Set(1)
+					deviations++
+				}
+			}
+		}
+		e.usersWithPermission.WithLabelValues(key.module, key.permission).Set(float64(total))
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"permissions": len(keys),
+		"roles":       len(usersByRole),
+		"deviations":  deviations,
+	}).Debug("Updated user permission metrics")
+}
@@ -0,0 +1,27 @@
+package exporters
+
+import (
+	"context"
+	"time"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+)
+
+// updateTokenExpiryMetrics sets when each personal access token of the current
+// user expires. Tokens of other users would cost one API call per user, the
+// current one is the user the exporter depends on.
+func (e *UsersExporter) updateTokenExpiryMetrics(ctx context.Context, users []api.User, now time.Time) error {
+	for _, user := range users {
+		if user.IsCurrent == nil || !*user.IsCurrent {
+			continue
+		}
+		tokens, err := e.client.Tokens.List(ctx, user.Id)
+		if err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			e.userTokenExpiresIn.WithLabelValues(user.Id, user.Email, user.Name, token.Id, token.Name).Set(token.ExpirationDate.Sub(now).Seconds())
+		}
+	}
+	return nil
+}
@@ -10,29 +10,79 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// UsersConfig holds optional settings for the users exporter
+type UsersConfig struct {
+	// DormantAfterDays marks active users without a login for this many days as dormant.
+	// Zero disables dormant user detection.
+	DormantAfterDays int
+
+	// TrackInviteAge fetches the audit events to export how long each invitation has been pending.
+	TrackInviteAge bool
+
+	// HideUserPermissions drops the per-user netbird_user_permissions series, which
+	// grow with users × permissions. The aggregated counts are always exported.
+	HideUserPermissions bool
+
+	// PermissionsByRole exports the permission counts broken down by role.
+	PermissionsByRole bool
+
+	// MaxPeersPerUser flags users owning more peers than this.
+	// Zero disables the peer limit metrics.
+	MaxPeersPerUser int
+
+	// TrackTokenExpiry fetches the personal access tokens of the user owning the
+	// API token to export when they expire, one extra API call per scrape.
+	TrackTokenExpiry bool
+}
+
 // UsersExporter handles users-specific metrics collection
 type UsersExporter struct {
 	client *nbclient.Client
+	config UsersConfig
+	store  *Store
+	now    func() time.Time
 
 	// Prometheus metrics for users
-	usersTotal           *prometheus.GaugeVec
-	usersByRole          *prometheus.GaugeVec
-	usersByStatus        *prometheus.GaugeVec
-	usersServiceUsers    *prometheus.GaugeVec
-	usersBlocked         *prometheus.GaugeVec
-	usersByIssued        *prometheus.GaugeVec
-	usersLastLogin       *prometheus.GaugeVec
-	usersAutoGroupsCount *prometheus.GaugeVec
-	usersRestricted      *prometheus.GaugeVec
-	usersPermissions     *prometheus.GaugeVec
-	scrapeErrorsTotal    *prometheus.CounterVec
-	scrapeDuration       *prometheus.HistogramVec
+	usersTotal                *prometheus.GaugeVec
+	usersByRole               *prometheus.GaugeVec
+	usersByStatus             *prometheus.GaugeVec
+	usersServiceUsers         *prometheus.GaugeVec
+	usersBlocked              *prometheus.GaugeVec
+	usersByIssued             *prometheus.GaugeVec
+	usersLastLogin            *prometheus.GaugeVec
+	usersAutoGroupsCount      *prometheus.GaugeVec
+	usersRestricted           *prometheus.GaugeVec
+	usersPermissions          *prometheus.GaugeVec
+	usersWithPermission       *prometheus.GaugeVec
+	usersWithPermissionByRole *prometheus.GaugeVec
+	userPermissionDeviation   *prometheus.GaugeVec
+	userPeers                 *prometheus.GaugeVec
+	userPeersConnected        *prometheus.GaugeVec
+	usersOverPeerLimit        *prometheus.GaugeVec
+	userOverPeerLimit         *prometheus.GaugeVec
+	userBlockedConnectedPeers *prometheus.GaugeVec
+	peersOrphanedOwner        *prometheus.GaugeVec
+	peerOrphanedOwner         *prometheus.GaugeVec
+	usersInvitesPending       *prometheus.GaugeVec
+	userInviteAge             *prometheus.GaugeVec
+	usersNeverLoggedIn        *prometheus.GaugeVec
+	usersDormant              *prometheus.GaugeVec
+	userTokenExpiresIn        *prometheus.GaugeVec
+	scrapeErrorsTotal         *prometheus.CounterVec
+	scrapeDuration            *prometheus.HistogramVec
 }
 
 // NewUsersExporter creates a new users exporter
 func NewUsersExporter(client *nbclient.Client) *UsersExporter {
+	return NewUsersExporterWithConfig(client, UsersConfig{})
+}
+
+// NewUsersExporterWithConfig creates a new users exporter with the given settings
+func NewUsersExporterWithConfig(client *nbclient.Client, config UsersConfig) *UsersExporter {
 	return &UsersExporter{
 		client: client,
+		config: config,
+		now:    time.Now,
 
 		usersTotal: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
@@ -114,6 +164,126 @@ func NewUsersExporter(client *nbclient.Client) *UsersExporter {
 			[]string{"user_id", "user_email", "module", "permission", "value"},
 		),
 
+		usersWithPermission: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_users_with_permission",
+				Help: "Number of NetBird users granted each permission",
+			},
+			[]string{"module", "permission"},
+		),
+
+		usersWithPermissionByRole: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_users_with_permission_by_role",
+				Help: "Number of NetBird users of each role granted each permission",
+			},
+			[]string{"role", "module", "permission"},
+		),
+
+		userPermissionDeviation: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_user_permission_deviation",
+				Help: "Permissions of a NetBird user that differ from the NetBird default of a built-in role, or from the majority of the users of a custom role",
+			},
+			[]string{"user_id", "user_email", "role", "module", "permission", "value", "baseline"},
+		),
+
+		userPeers: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_user_peers",
+				Help: "Number of peers owned by each NetBird user",
+			},
+			[]string{"user_id", "user_email", "user_name"},
+		),
+
+		userPeersConnected: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_user_peers_connected",
+				Help: "Number of connected peers owned by each NetBird user",
+			},
+			[]string{"user_id", "user_email", "user_name"},
+		),
+
+		usersOverPeerLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_users_over_peer_limit",
+				Help: "Number of NetBird users owning more peers than the configured limit",
+			},
+			[]string{"max_peers"},
+		),
+
+		userOverPeerLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_user_over_peer_limit",
+				Help: "NetBird users owning more peers than the configured limit",
+			},
+			[]string{"user_id", "user_email", "user_name", "max_peers"},
+		),
+
+		userBlockedConnectedPeers: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_user_blocked_connected_peers",
+				Help: "Number of connected peers owned by each blocked NetBird user",
+			},
+			[]string{"user_id", "user_email", "user_name"},
+		),
+
+		peersOrphanedOwner: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peers_orphaned_owner",
+				Help: "Number of peers whose owning user no longer exists",
+			},
+			[]string{},
+		),
+
+		peerOrphanedOwner: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_peer_orphaned_owner",
+				Help: "Peers whose owning user no longer exists",
+			},
+			[]string{"peer_id", "peer_name", "user_id"},
+		),
+
+		usersInvitesPending: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_users_invites_pending",
+				Help: "Number of invited NetBird users who have not accepted their invitation yet",
+			},
+			[]string{"role"},
+		),
+
+		userInviteAge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_user_invite_age_seconds",
+				Help: "Seconds since each pending invitation was first sent",
+			},
+			[]string{"user_id", "user_email", "user_name", "role"},
+		),
+
+		usersNeverLoggedIn: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_users_never_logged_in",
+				Help: "Number of active NetBird users who have never logged in",
+			},
+			[]string{"role"},
+		),
+
+		usersDormant: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_users_dormant",
+				Help: "Number of active NetBird users without a login for more than the configured number of days",
+			},
+			[]string{"role", "dormant_after_days"},
+		),
+
+		userTokenExpiresIn: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "netbird_user_token_expires_in_seconds",
+				Help: "Seconds until each personal access token of the user owning the API token expires (negative once expired)",
+			},
+			[]string{"user_id", "user_email", "user_name", "token_id", "token_name"},
+		),
+
 		scrapeErrorsTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "netbird_users_scrape_errors_total",
@@ -144,6 +314,21 @@ func (e *UsersExporter) Describe(ch chan<- *prometheus.Desc) {
 	e.usersAutoGroupsCount.Describe(ch)
 	e.usersRestricted.Describe(ch)
 	e.usersPermissions.Describe(ch)
+	e.usersWithPermission.Describe(ch)
+	e.usersWithPermissionByRole.Describe(ch)
+	e.userPermissionDeviation.Describe(ch)
+	e.userPeers.Describe(ch)
+	e.userPeersConnected.Describe(ch)
+	e.usersOverPeerLimit.Describe(ch)
+	e.userOverPeerLimit.Describe(ch)
+	e.userBlockedConnectedPeers.Describe(ch)
+	e.peersOrphanedOwner.Describe(ch)
+	e.peerOrphanedOwner.Describe(ch)
+	e.usersInvitesPending.Describe(ch)
+	e.userInviteAge.Describe(ch)
+	e.usersNeverLoggedIn.Describe(ch)
+	e.usersDormant.Describe(ch)
+	e.userTokenExpiresIn.Describe(ch)
 	e.scrapeErrorsTotal.Describe(ch)
 	e.scrapeDuration.Describe(ch)
 }
@@ -164,6 +349,21 @@ func (e *UsersExporter) Collect(ch chan<- prometheus.Metric) {
 	e.usersAutoGroupsCount.Reset()
 	e.usersRestricted.Reset()
 	e.usersPermissions.Reset()
+	e.usersWithPermission.Reset()
+	e.usersWithPermissionByRole.Reset()
+	e.userPermissionDeviation.Reset()
+	e.userPeers.Reset()
+	e.userPeersConnected.Reset()
+	e.usersOverPeerLimit.Reset()
+	e.userOverPeerLimit.Reset()
+	e.userBlockedConnectedPeers.Reset()
+	e.peersOrphanedOwner.Reset()
+	e.peerOrphanedOwner.Reset()
+	e.usersInvitesPending.Reset()
+	e.userInviteAge.Reset()
+	e.usersNeverLoggedIn.Reset()
+	e.usersDormant.Reset()
+	e.userTokenExpiresIn.Reset()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -172,11 +372,38 @@ func (e *UsersExporter) Collect(ch chan<- prometheus.Metric) {
 	if err != nil {
 		logrus.WithError(err).Error("Failed to fetch users")
 		e.scrapeErrorsTotal.WithLabelValues("fetch_users").Inc()
+		e.scrapeErrorsTotal.Collect(ch)
 		return
 	}
 
+	e.store.SetUsers(users)
 	e.updateMetrics(users)
 
+	if e.config.TrackInviteAge {
+		invited, err := e.fetchInviteTimes(ctx)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to fetch events, skipping invitation age metrics")
+			e.scrapeErrorsTotal.WithLabelValues("fetch_events").Inc()
+		} else {
+			e.updateInviteAgeMetrics(users, invited, e.now())
+		}
+	}
+
+	if e.config.TrackTokenExpiry {
+		if err := e.updateTokenExpiryMetrics(ctx, users, e.now()); err != nil {
+			logrus.WithError(err).Error("Failed to fetch tokens, skipping token expiry metrics")
+			e.scrapeErrorsTotal.WithLabelValues("fetch_tokens").Inc()
+		}
+	}
+
+	peers, err := e.peers(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch peers, skipping user peer ownership metrics")
+		e.scrapeErrorsTotal.WithLabelValues("fetch_peers").Inc()
+	} else {
+		e.updateOwnershipMetrics(users, peers)
+	}
+
 	// Collect all metrics
 	e.usersTotal.Collect(ch)
 	e.usersByRole.Collect(ch)
@@ -188,6 +415,21 @@ func (e *UsersExporter) Collect(ch chan<- prometheus.Metric) {
 	e.usersAutoGroupsCount.Collect(ch)
 	e.usersRestricted.Collect(ch)
 	e.usersPermissions.Collect(ch)
+	e.usersWithPermission.Collect(ch)
+	e.usersWithPermissionByRole.Collect(ch)
+	e.userPermissionDeviation.Collect(ch)
+	e.userPeers.Collect(ch)
+	e.userPeersConnected.Collect(ch)
+	e.usersOverPeerLimit.Collect(ch)
+	e.userOverPeerLimit.Collect(ch)
+	e.userBlockedConnectedPeers.Collect(ch)
+	e.peersOrphanedOwner.Collect(ch)
+	e.peerOrphanedOwner.Collect(ch)
+	e.usersInvitesPending.Collect(ch)
+	e.userInviteAge.Collect(ch)
+	e.usersNeverLoggedIn.Collect(ch)
+	e.usersDormant.Collect(ch)
+	e.userTokenExpiresIn.Collect(ch)
 	e.scrapeErrorsTotal.Collect(ch)
 	e.scrapeDuration.Collect(ch)
 }
@@ -274,7 +516,9 @@ func (e *UsersExporter) updateMetrics(users []api.User) {
 				if value {
 					valueStr = "true"
 				}
-				e.usersPermissions.WithLabelValues(user.Id, user.Email, module, permission, valueStr).Set(1)
+				if !e.config.HideUserPermissions {
+					e.usersPermissions.WithLabelValues(user.Id, user.Email, module, permission, valueStr).Set(1)
+				}
 				totalPermissionsCount++
 			}
 		}
@@ -310,6 +554,9 @@ func (e *UsersExporter) updateMetrics(users []api.User) {
 	e.usersRestricted.WithLabelValues("true").Set(float64(restrictedCount))
 	e.usersRestricted.WithLabelValues("false").Set(float64(unrestrictedCount))
 
+	e.updateLifecycleMetrics(users, e.now())
+	e.updatePermissionMetrics(users)
+
 	logrus.WithFields(logrus.Fields{
 		"total_users":             totalUsers,
 		"service_users":           serviceUserCount,
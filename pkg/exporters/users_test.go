@@ -1,17 +1,21 @@
 package exporters
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
-	"net/http/httptest"
-	"strings"
 	"testing"
 	"time"
 
 	nbclient "github.com/netbirdio/netbird/management/client/rest"
 	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/netbirdio/netbird/management/server/permissions/modules"
+	"github.com/netbirdio/netbird/management/server/permissions/operations"
+	"github.com/netbirdio/netbird/management/server/permissions/roles"
 	"github.com/netbirdio/netbird/util"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
 )
 
 func TestNewUsersExporter(t *testing.T) {
@@ -73,99 +77,13 @@ func TestUsersExporter_Describe(t *testing.T) {
 }
 
 func TestUsersExporter_Collect_Success(t *testing.T) {
-	// Create mock server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/api/users" {
-			http.NotFound(w, r)
-			return
-		}
-
-		token := r.Header.Get("Authorization")
-		if !strings.HasPrefix(token, "Token ") {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+	f := fakeapi.NewFixture("example.com")
+	f.User("admin@example.com").Name("Admin User").Role("admin").AutoGroups("group1", "group2")
+	f.User("service@example.com").Name("Service User").ServiceUser().AutoGroups("group1")
+	f.User("blocked@example.com").Name("Blocked User").Blocked().LastLogin(24 * time.Hour)
+	_, url := newTestAPI(t, f)
 
-		lastTimeNow := time.Now()
-		lastTime24 := lastTimeNow.Add(-time.Hour * 24)
-		lastTime1 := lastTimeNow.Add(-time.Hour * 1)
-		issuedAPI := "api"
-		issuedIntegration := "integration"
-		users := []api.User{
-			{
-				Id:            "user1",
-				Email:         "admin@example.com",
-				Name:          "Admin User",
-				Role:          "admin",
-				Status:        "active",
-				LastLogin:     &lastTimeNow,
-				AutoGroups:    []string{"group1", "group2"},
-				IsCurrent:     util.False(),
-				IsServiceUser: util.False(),
-				IsBlocked:     false,
-				Issued:        &issuedAPI,
-				Permissions: &api.UserPermissions{
-					IsRestricted: false,
-					Modules: map[string]map[string]bool{
-						"peers": {
-							"read":   true,
-							"write":  true,
-							"delete": true,
-						},
-					},
-				},
-			},
-			{
-				Id:            "user2",
-				Email:         "service@example.com",
-				Name:          "Service User",
-				Role:          "user",
-				Status:        "active",
-				LastLogin:     &lastTime1,
-				AutoGroups:    []string{"group1"},
-				IsCurrent:     util.False(),
-				IsServiceUser: util.True(),
-				IsBlocked:     false,
-				Issued:        &issuedIntegration,
-				Permissions: &api.UserPermissions{
-					IsRestricted: true,
-					Modules: map[string]map[string]bool{
-						"peers": {
-							"read":   true,
-							"write":  false,
-							"delete": false,
-						},
-					},
-				},
-			},
-			{
-				Id:            "user3",
-				Email:         "blocked@example.com",
-				Name:          "Blocked User",
-				Role:          "user",
-				Status:        "inactive",
-				LastLogin:     &lastTime24,
-				AutoGroups:    []string{},
-				IsCurrent:     util.False(),
-				IsServiceUser: util.False(),
-				IsBlocked:     true,
-				Issued:        &issuedAPI,
-				Permissions: &api.UserPermissions{
-					IsRestricted: false,
-					Modules:      map[string]map[string]bool{},
-				},
-			},
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(users); err != nil {
-			t.Errorf("Failed to encode users: %v", err)
-		}
-	}))
-	defer server.Close()
-
-	client := nbclient.New(server.URL, "test-token")
+	client := nbclient.New(url, "test-token")
 	exporter := NewUsersExporter(client)
 
 	// Collect metrics
@@ -216,14 +134,12 @@ func TestUsersExporter_Collect_Success(t *testing.T) {
 }
 
 func TestUsersExporter_Collect_APIError(t *testing.T) {
-	// Create mock server that returns error
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-	}))
-	defer server.Close()
+	f := fakeapi.NewFixture("example.com")
+	f.User("admin@example.com").Role("admin")
+	server, url := newTestAPI(t, f)
+	server.InjectError("/api/users", http.StatusInternalServerError, -1)
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewUsersExporter(client)
+	exporter := NewUsersExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 100)
@@ -232,29 +148,19 @@ func TestUsersExporter_Collect_APIError(t *testing.T) {
 		close(ch)
 	}()
 
-	// Should still complete without error (though may not collect useful data)
-	metricCount := 0
+	// Should complete without panic or hang
 	for range ch {
-		metricCount++
+		// Drain channel
+	}
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_users")); value != 1 {
+		t.Errorf("Expected 1 fetch_users error, got %f", value)
 	}
-
-	// Even with API errors, some metrics might still be collected (like error counters)
-	// This test ensures the collection doesn't panic or hang
 }
 
 func TestUsersExporter_Collect_EmptyResponse(t *testing.T) {
-	// Create mock server that returns empty array
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte(`[]`)); err != nil {
-			t.Errorf("Failed to write response: %v", err)
-		}
-	}))
-	defer server.Close()
+	_, url := newTestAPI(t, fakeapi.NewFixture("example.com"))
 
-	client := nbclient.New(server.URL, "test-token")
-	exporter := NewUsersExporter(client)
+	exporter := NewUsersExporter(nbclient.New(url, "test-token"))
 
 	// Collect metrics
 	ch := make(chan prometheus.Metric, 100)
@@ -382,3 +288,376 @@ func TestUsersExporter_MetricsReset(t *testing.T) {
 		}
 	}
 }
+
+func TestUsersExporter_LifecycleMetrics(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewUsersExporterWithConfig(client, UsersConfig{DormantAfterDays: 90})
+
+	now := time.Now()
+	recent := now.Add(-24 * time.Hour)
+	old := now.Add(-120 * 24 * time.Hour)
+	users := []api.User{
+		{Id: "user1", Role: "admin", Status: api.UserStatusActive, LastLogin: &recent},
+		{Id: "user2", Role: "admin", Status: api.UserStatusActive, LastLogin: &old},
+		{Id: "user3", Role: "user", Status: api.UserStatusActive, LastLogin: &old},
+		{Id: "user4", Role: "user", Status: api.UserStatusActive},
+		{Id: "user5", Role: "user", Status: api.UserStatusInvited},
+		{Id: "user6", Role: "user", Status: api.UserStatusInvited},
+		{Id: "user7", Role: "user", Status: api.UserStatusBlocked, LastLogin: &old},
+		{Id: "user8", Role: "user", Status: api.UserStatusActive, IsServiceUser: util.True()},
+	}
+
+	exporter.updateLifecycleMetrics(users, now)
+
+	if value := testutil.ToFloat64(exporter.usersInvitesPending.WithLabelValues("user")); value != 2 {
+		t.Errorf("Expected 2 pending invitations, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.usersNeverLoggedIn.WithLabelValues("user")); value != 1 {
+		t.Errorf("Expected 1 user who never logged in (service users skipped), got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.usersDormant.WithLabelValues("admin", "90")); value != 1 {
+		t.Errorf("Expected 1 dormant admin, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.usersDormant.WithLabelValues("user", "90")); value != 1 {
+		t.Errorf("Expected 1 dormant user (blocked users skipped), got %f", value)
+	}
+}
+
+func TestUsersExporter_DormantDisabledByDefault(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewUsersExporter(client)
+
+	old := time.Now().Add(-365 * 24 * time.Hour)
+	exporter.updateLifecycleMetrics([]api.User{
+		{Id: "user1", Role: "admin", Status: api.UserStatusActive, LastLogin: &old},
+	}, time.Now())
+
+	if count := testutil.CollectAndCount(exporter.usersDormant); count != 0 {
+		t.Errorf("Expected no dormant user metrics without USERS_DORMANT_DAYS, got %d", count)
+	}
+}
+
+func TestUsersExporter_InviteAge(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	f.User("new@example.com").Name("New User").Invited()
+	f.User("old@example.com").Name("Old User").Invited()
+	f.User("active@example.com").Name("Active User")
+	invite, join := string(api.EventActivityCodeUserInvite), string(api.EventActivityCodeUserJoin)
+	f.Event(invite, "User invited", "admin@example.com", fakeapi.UserID("new@example.com"), 2*time.Hour)
+	f.Event(invite, "User invited", "admin@example.com", fakeapi.UserID("new@example.com"), 48*time.Hour)
+	f.Event(join, "User joined", "admin@example.com", fakeapi.UserID("new@example.com"), 72*time.Hour)
+	f.Event(invite, "User invited", "admin@example.com", fakeapi.UserID("active@example.com"), 72*time.Hour)
+	_, url := newTestAPI(t, f)
+
+	client := nbclient.New(url, "test-token")
+	exporter := NewUsersExporterWithConfig(client, UsersConfig{TrackInviteAge: true})
+	exporter.now = func() time.Time { return f.Now }
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	age := testutil.ToFloat64(exporter.userInviteAge.WithLabelValues(fakeapi.UserID("new@example.com"), "new@example.com", "New User", "user"))
+	if age != (48 * time.Hour).Seconds() {
+		t.Errorf("Expected invite age of 48h from the first invitation, got %fs", age)
+	}
+	if count := testutil.CollectAndCount(exporter.userInviteAge); count != 1 {
+		t.Errorf("Expected invite age only for pending invitations with an event, got %d series", count)
+	}
+}
+
+func TestUsersExporter_InviteAge_FetchError(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	f.User("new@example.com").Invited()
+	server, url := newTestAPI(t, f)
+	server.InjectError("/api/events", http.StatusInternalServerError, -1)
+
+	client := nbclient.New(url, "test-token")
+	exporter := NewUsersExporterWithConfig(client, UsersConfig{TrackInviteAge: true})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_events")); value != 1 {
+		t.Errorf("Expected 1 fetch_events error, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.usersInvitesPending.WithLabelValues("user")); value != 1 {
+		t.Errorf("Expected pending invitations to be counted despite the events error, got %f", value)
+	}
+}
+
+func permissionUser(id, role string, modules map[string]map[string]bool) api.User {
+	return api.User{
+		Id:          id,
+		Email:       id + "@example.com",
+		Role:        role,
+		Status:      api.UserStatusActive,
+		Permissions: &api.UserPermissions{Modules: modules},
+	}
+}
+
+func TestUsersExporter_PermissionMetrics(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewUsersExporterWithConfig(client, UsersConfig{PermissionsByRole: true})
+
+	users := []api.User{
+		permissionUser("admin1", "admin", map[string]map[string]bool{"peers": {"read": true, "delete": true}}),
+		permissionUser("admin2", "admin", map[string]map[string]bool{"peers": {"read": true, "delete": true}}),
+		permissionUser("user1", "user", map[string]map[string]bool{"peers": {"read": false, "delete": false}}),
+		permissionUser("user2", "user", map[string]map[string]bool{"peers": {"read": true, "delete": false}}),
+		permissionUser("user3", "user", map[string]map[string]bool{"peers": {"read": true, "delete": true}}),
+		permissionUser("ops1", "ops", map[string]map[string]bool{"peers": {"read": true, "delete": false}}),
+		permissionUser("ops2", "ops", map[string]map[string]bool{"peers": {"read": true, "delete": false}}),
+		permissionUser("ops3", "ops", map[string]map[string]bool{"peers": {"read": false, "delete": false}}),
+		// NetBird only returns the permissions of the token owner, users
+		// without permissions are not compared
+		{Id: "admin3", Email: "admin3@example.com", Role: "admin", Status: api.UserStatusActive},
+		{Id: "ops4", Email: "ops4@example.com", Role: "ops", Status: api.UserStatusActive},
+	}
+
+	exporter.updatePermissionMetrics(users)
+
+	if value := testutil.ToFloat64(exporter.usersWithPermission.WithLabelValues("peers", "read")); value != 6 {
+		t.Errorf("Expected 6 users with peers read, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.usersWithPermission.WithLabelValues("peers", "delete")); value != 3 {
+		t.Errorf("Expected 3 users with peers delete, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.usersWithPermissionByRole.WithLabelValues("user", "peers", "delete")); value != 1 {
+		t.Errorf("Expected 1 user role member with peers delete, got %f", value)
+	}
+
+	// The user role has no permissions by default, even when most users of the
+	// role are granted one
+	expected := [][]string{
+		{"user2", "user2@example.com", "user", "peers", "read", "true", "role_default"},
+		{"user3", "user3@example.com", "user", "peers", "read", "true", "role_default"},
+		{"user3", "user3@example.com", "user", "peers", "delete", "true", "role_default"},
+		// ops is a custom role without NetBird defaults, ops3 is granted less than the majority
+		{"ops3", "ops3@example.com", "ops", "peers", "read", "false", "role_majority"},
+	}
+	for _, labels := range expected {
+		if value := testutil.ToFloat64(exporter.userPermissionDeviation.WithLabelValues(labels...)); value != 1 {
+			t.Errorf("Expected deviation %v, got %f", labels, value)
+		}
+	}
+	if count := testutil.CollectAndCount(exporter.userPermissionDeviation); count != len(expected) {
+		t.Errorf("Expected only the %d outliers to be exported, got %d series", len(expected), count)
+	}
+}
+
+func TestRoleDefault(t *testing.T) {
+	tests := []struct {
+		role       string
+		module     string
+		permission string
+		granted    bool
+		ok         bool
+	}{
+		{"owner", "accounts", "delete", true, true},
+		{"admin", "peers", "delete", true, true},
+		{"admin", "accounts", "update", false, true},
+		{"network_admin", "routes", "create", true, true},
+		{"network_admin", "peers", "delete", false, true},
+		{"auditor", "users", "read", true, true},
+		{"auditor", "users", "update", false, true},
+		{"user", "peers", "read", false, true},
+		{"custom", "peers", "read", false, false},
+		{"admin", "unknown", "read", false, false},
+	}
+	for _, tt := range tests {
+		granted, ok := roleDefault(tt.role, permissionKey{module: tt.module, permission: tt.permission})
+		if granted != tt.granted || ok != tt.ok {
+			t.Errorf("roleDefault(%s, %s, %s) = %t, %t, expected %t, %t", tt.role, tt.module, tt.permission, granted, ok, tt.granted, tt.ok)
+		}
+	}
+}
+
+// TestDefaultRolePermissions fails when the roles of the NetBird module no
+// longer match defaultRolePermissions, e.g. after upgrading NetBird
+func TestDefaultRolePermissions(t *testing.T) {
+	if len(roles.RolesMap) != len(defaultRolePermissions) {
+		t.Errorf("Expected %d built-in roles, NetBird defines %d", len(defaultRolePermissions), len(roles.RolesMap))
+	}
+	if len(modules.All) != len(permissionModules) {
+		t.Errorf("Expected %d permission modules, NetBird defines %d", len(permissionModules), len(modules.All))
+	}
+
+	ops := []operations.Operation{operations.Read, operations.Create, operations.Update, operations.Delete}
+	for role, rolePermissions := range roles.RolesMap {
+		defaults, ok := RoleDefaultPermissions(string(role))
+		if !ok {
+			t.Errorf("Expected defaults for the %s role", role)
+			continue
+		}
+		for module := range modules.All {
+			for _, operation := range ops {
+				expected, listed := rolePermissions.Permissions[module][operation]
+				if !listed {
+					expected = rolePermissions.AutoAllowNew[operation]
+				}
+				if granted := defaults[string(module)][string(operation)]; granted != expected {
+					t.Errorf("Expected %s to be granted %s on %s: %t, got %t", role, operation, module, expected, granted)
+				}
+			}
+		}
+	}
+}
+
+func TestUsersExporter_HideUserPermissions(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewUsersExporterWithConfig(client, UsersConfig{HideUserPermissions: true})
+
+	exporter.updateMetrics([]api.User{
+		permissionUser("user1", "user", map[string]map[string]bool{"peers": {"read": true}}),
+	})
+
+	if count := testutil.CollectAndCount(exporter.usersPermissions); count != 0 {
+		t.Errorf("Expected no per-user permission series, got %d", count)
+	}
+	if count := testutil.CollectAndCount(exporter.usersWithPermissionByRole); count != 0 {
+		t.Errorf("Expected no per-role permission series by default, got %d", count)
+	}
+	if value := testutil.ToFloat64(exporter.usersWithPermission.WithLabelValues("peers", "read")); value != 1 {
+		t.Errorf("Expected aggregated permission count to be exported, got %f", value)
+	}
+}
+
+func TestUsersExporter_OwnershipMetrics(t *testing.T) {
+	client := nbclient.New("https://api.netbird.io", "test-token")
+	exporter := NewUsersExporterWithConfig(client, UsersConfig{MaxPeersPerUser: 2})
+
+	users := []api.User{
+		{Id: "user1", Email: "alice@example.com", Name: "Alice"},
+		{Id: "user2", Email: "bob@example.com", Name: "Bob", IsBlocked: true},
+		{Id: "user3", Email: "carol@example.com", Name: "Carol"},
+	}
+	peers := []api.Peer{
+		{Id: "peer1", Name: "alice-laptop", UserId: "user1", Connected: true},
+		{Id: "peer2", Name: "alice-phone", UserId: "user1", Connected: false},
+		{Id: "peer3", Name: "alice-tablet", UserId: "user1", Connected: true},
+		{Id: "peer4", Name: "bob-laptop", UserId: "user2", Connected: true},
+		{Id: "peer5", Name: "dave-laptop", UserId: "user4", Connected: true},
+		{Id: "peer6", Name: "router", UserId: "", Connected: true},
+	}
+
+	exporter.updateOwnershipMetrics(users, peers)
+
+	alice := []string{"user1", "alice@example.com", "Alice"}
+	bob := []string{"user2", "bob@example.com", "Bob"}
+
+	if value := testutil.ToFloat64(exporter.userPeers.WithLabelValues(alice...)); value != 3 {
+		t.Errorf("Expected Alice to own 3 peers, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.userPeersConnected.WithLabelValues(alice...)); value != 2 {
+		t.Errorf("Expected Alice to have 2 connected peers, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.usersOverPeerLimit.WithLabelValues("2")); value != 1 {
+		t.Errorf("Expected 1 user over the peer limit, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.userOverPeerLimit.WithLabelValues(append(alice, "2")...)); value != 1 {
+		t.Errorf("Expected Alice to be flagged over the peer limit, got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.userBlockedConnectedPeers.WithLabelValues(bob...)); value != 1 {
+		t.Errorf("Expected blocked Bob to have 1 connected peer, got %f", value)
+	}
+	if count := testutil.CollectAndCount(exporter.userBlockedConnectedPeers); count != 1 {
+		t.Errorf("Expected only blocked users to be reported, got %d series", count)
+	}
+	if value := testutil.ToFloat64(exporter.peersOrphanedOwner.WithLabelValues()); value != 1 {
+		t.Errorf("Expected 1 peer with a deleted owner (setup key peers skipped), got %f", value)
+	}
+	if value := testutil.ToFloat64(exporter.peerOrphanedOwner.WithLabelValues("peer5", "dave-laptop", "user4")); value != 1 {
+		t.Errorf("Expected peer5 to be reported with a deleted owner, got %f", value)
+	}
+	if count := testutil.CollectAndCount(exporter.userPeers); count != 2 {
+		t.Errorf("Expected peer counts only for users owning peers, got %d series", count)
+	}
+}
+
+func TestUsersExporter_OwnershipFromStore(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	f.User("alice@example.com").Name("Alice")
+	server, url := newTestAPI(t, f)
+
+	client := nbclient.New(url, "test-token")
+	exporter := NewUsersExporter(client)
+	exporter.store = NewStore()
+	exporter.store.SetPeers([]api.Peer{{Id: "peer1", UserId: fakeapi.UserID("alice@example.com"), Connected: true}})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	if requests := server.Requests("/api/peers"); requests != 0 {
+		t.Errorf("Expected stored peers to be reused instead of fetching them, got %d requests", requests)
+	}
+	if value := testutil.ToFloat64(exporter.userPeersConnected.WithLabelValues(fakeapi.UserID("alice@example.com"), "alice@example.com", "Alice")); value != 1 {
+		t.Errorf("Expected 1 connected peer from the store, got %f", value)
+	}
+}
+
+func TestUsersExporter_OwnershipIgnoresStalePeers(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	f.User("alice@example.com").Name("Alice")
+	f.Peer("laptop").Owner("alice@example.com")
+	_, url := newTestAPI(t, f)
+
+	client := nbclient.New(url, "test-token")
+	exporter := NewUsersExporter(client)
+
+	// The peers were stored by an earlier scrape, so they are fetched again
+	exporter.store = NewStore()
+	exporter.store.SetPeers([]api.Peer{{Id: fakeapi.PeerID("laptop"), UserId: fakeapi.UserID("alice@example.com"), Connected: true}})
+	exporter.store.StartScrape()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	if value := testutil.ToFloat64(exporter.userPeersConnected.WithLabelValues(fakeapi.UserID("alice@example.com"), "alice@example.com", "Alice")); value != 0 {
+		t.Errorf("Expected no connected peers from the fetched peers, got %f", value)
+	}
+}
+
+func TestUsersExporter_TokenExpiry(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	f.User("exporter@example.com").Name("Exporter").Role("admin").Current().Token("exporter", 10*24*time.Hour)
+	f.User("other@example.com").Name("Other").Token("laptop", 24*time.Hour)
+	_, url := newTestAPI(t, f)
+
+	client := nbclient.New(url, "test-token")
+	exporter := NewUsersExporterWithConfig(client, UsersConfig{TrackTokenExpiry: true})
+	exporter.now = func() time.Time { return f.Now }
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	userID := fakeapi.UserID("exporter@example.com")
+	tokens, err := client.Tokens.List(context.Background(), userID)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("Failed to list the exporter tokens: %v", err)
+	}
+	expiresIn := testutil.ToFloat64(exporter.userTokenExpiresIn.WithLabelValues(userID, "exporter@example.com", "Exporter", tokens[0].Id, "exporter"))
+	if expiresIn != (10 * 24 * time.Hour).Seconds() {
+		t.Errorf("Expected token to expire in 10 days, got %fs", expiresIn)
+	}
+	if count := testutil.CollectAndCount(exporter.userTokenExpiresIn); count != 1 {
+		t.Errorf("Expected only the tokens of the current user, got %d series", count)
+	}
+	if value := testutil.ToFloat64(exporter.scrapeErrorsTotal.WithLabelValues("fetch_tokens")); value != 0 {
+		t.Errorf("Expected no fetch_tokens errors, got %f", value)
+	}
+}
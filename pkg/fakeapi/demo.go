@@ -0,0 +1,110 @@
+package fakeapi
+
+import (
+	"math/rand"
+	"time"
+)
+
+// DemoToken is the token the demo mode uses for the fake API
+const DemoToken = "nbp_demo"
+
+// Demo returns a sample account of a small company with offices in two
+// countries, exercising every collector
+func Demo(now time.Time) *Fixture {
+	day := 24 * time.Hour
+	f := NewFixture("demo.example.com")
+	f.Now = now.UTC().Truncate(time.Second)
+
+	f.User("owner@demo.example.com").Name("Olivia Owner").Role("owner").Current().
+		Token("exporter", 90*day).Token("ci", 10*day)
+	f.User("alice@demo.example.com").Name("Alice Admin").Role("admin").AutoGroups("engineering").LastLogin(2 * time.Hour)
+	f.User("bob@demo.example.com").Name("Bob Builder").AutoGroups("engineering").LastLogin(3 * day)
+	f.User("carol@demo.example.com").Name("Carol Sales").AutoGroups("sales").LastLogin(45 * day)
+	f.User("dave@demo.example.com").Name("Dave New").Invited()
+	f.User("eve@demo.example.com").Name("Eve Former").Blocked().LastLogin(120 * day)
+	f.User("ci@demo.example.com").Name("CI").ServiceUser()
+	f.JWTGroup("sso-contractors")
+
+	f.Peer("alice-macbook").Connected().OS("Darwin", "14.5").Version("0.48.0").
+		Owner("alice@demo.example.com").Groups("engineering").Location("DE", "Berlin").SSH()
+	f.Peer("bob-thinkpad").Connected().OS("Linux", "6.8.0").Version("0.47.2").
+		Owner("bob@demo.example.com").Groups("engineering").Location("DE", "Munich")
+	f.Peer("bob-phone").OS("Android", "14").Version("0.45.0").
+		Owner("bob@demo.example.com").Groups("engineering", "mobile").Location("DE", "Munich").LastSeen(6 * time.Hour)
+	f.Peer("carol-laptop").Connected().OS("Windows", "11").Version("0.48.0").
+		Owner("carol@demo.example.com").Groups("sales").Location("US", "New York")
+	f.Peer("carol-ipad").OS("iOS", "17.5").Version("0.44.1").
+		Owner("carol@demo.example.com").Groups("sales", "mobile").Location("US", "New York").LastSeen(40 * day).LoginExpired()
+	f.Peer("contractor-laptop").OS("Windows", "10").Version("0.40.0").
+		Groups("sso-contractors").Location("GB", "London").LastSeen(90 * day).ApprovalRequired()
+	f.Peer("berlin-gw-1").Connected().OS("Linux", "6.1.0").Version("0.48.0").
+		Owner("owner@demo.example.com").Groups("routers", "berlin-routers").Location("DE", "Berlin").SSH()
+	f.Peer("berlin-gw-2").OS("Linux", "6.1.0").Version("0.48.0").
+		Owner("owner@demo.example.com").Groups("routers", "berlin-routers").Location("DE", "Berlin").LastSeen(20 * time.Minute)
+	f.Peer("nyc-gw").Connected().OS("Linux", "5.15.0").Version("0.46.0").
+		Owner("owner@demo.example.com").Groups("routers").Location("US", "New York")
+	f.Peer("k8s-node-1").Connected().OS("Linux", "6.8.0").Version("0.48.0").
+		Owner("ci@demo.example.com").Groups("servers").Location("NL", "Amsterdam").Ephemeral()
+	f.Peer("k8s-node-2").Connected().OS("Linux", "6.8.0").Version("0.48.0").
+		Owner("ci@demo.example.com").Groups("servers").Location("NL", "Amsterdam").Ephemeral()
+	f.Group("legacy-vpn")
+
+	f.Policy("engineering to servers").Rule("engineering", "servers", "tcp", "22", "443")
+	f.Policy("sales to crm").Rule("sales", "crm", "tcp", "443")
+	f.Policy("everyone to dns").Rule(AllGroup, "dns", "udp", "53")
+	f.Policy("contractors").Rule("sso-contractors", "servers", "all").Disabled()
+
+	f.Route("10.10.0.0/16", "nyc-gw", "sales")
+	f.HARoute("10.20.0.0/16", "berlin-routers", "engineering")
+
+	f.Network("berlin-office").RouterGroup("berlin-routers").
+		Resource("build-server", "10.20.1.10", "servers").
+		Resource("office-lan", "10.20.0.0/24", "engineering").
+		Resource("wiki", "wiki.demo.internal", "engineering")
+	f.Network("nyc-office").Router("nyc-gw").
+		Resource("crm", "crm.demo.internal", "crm").
+		Resource("dns", "10.10.0.53/32", "dns")
+	f.Network("staging")
+
+	f.Nameservers("Cloudflare").Nameserver("1.1.1.1").Nameserver("1.0.0.1").Primary()
+	f.Nameservers("Internal").Nameserver("10.10.0.53").Domains("demo.internal").Groups("engineering", "sales")
+	f.Nameservers("Legacy").Nameserver("192.0.2.53").Disabled()
+	f.DisableDNSManagement("servers")
+
+	f.SetupKey("k8s-nodes").Reusable().AutoGroups("servers").UsedTimes(14).ExpiresIn(5 * day)
+	f.SetupKey("office-onboarding").Reusable().AutoGroups("engineering").UsedTimes(3).ExpiresIn(60 * day)
+	f.SetupKey("bob-phone").AutoGroups("mobile").UsedTimes(1)
+	f.SetupKey("old-rollout").Reusable().ExpiresIn(-10 * day)
+	f.SetupKey("leaked").Reusable().Revoked()
+
+	f.Event("user.invite", "User invited", "alice@demo.example.com", UserID("dave@demo.example.com"), 5*day)
+	f.Event("user.block", "User blocked", "owner@demo.example.com", UserID("eve@demo.example.com"), 30*day)
+	f.Event("peer.user.add", "Peer added", "bob@demo.example.com", PeerID("bob-phone"), 10*day)
+	f.Event("setupkey.add", "Setup key created", "owner@demo.example.com", "setup-key-k8s-nodes", 25*day)
+	f.Event("policy.update", "Policy updated", "alice@demo.example.com", "policy-contractors", 2*day)
+	return f
+}
+
+// Churn changes the demo account a little, so dashboards show some movement:
+// a peer connects or disconnects, and sometimes a user logs in
+func (s *Server) Churn(rng *rand.Rand) {
+	s.Update(func(f *Fixture) {
+		f.Now = time.Now().UTC().Truncate(time.Second)
+		if len(f.peers) == 0 {
+			return
+		}
+		p := f.peers[rng.Intn(len(f.peers))]
+		if p.peer.LoginExpired || p.peer.ApprovalRequired {
+			return
+		}
+		p.peer.Connected = !p.peer.Connected
+		p.peer.LastSeen = f.Now
+		if len(f.users) > 0 && rng.Intn(4) == 0 {
+			u := f.users[rng.Intn(len(f.users))]
+			if u.user.LastLogin != nil && !u.user.IsBlocked {
+				lastLogin := f.Now
+				u.user.LastLogin = &lastLogin
+			}
+		}
+	})
+}
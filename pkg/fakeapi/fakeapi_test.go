@@ -0,0 +1,313 @@
+package fakeapi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/exporters"
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
+)
+
+const testToken = "test-token"
+
+func newTestServer(t *testing.T, fixture *fakeapi.Fixture, config fakeapi.Config) (*fakeapi.Server, string) {
+	t.Helper()
+	server := fakeapi.NewServer(fixture, config)
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return server, httpServer.URL
+}
+
+func TestFixture_DerivedFields(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	f.User("admin@example.com").Role("admin").Current().Token("exporter", 24*time.Hour)
+	f.Peer("laptop").Connected().Groups("devs").Owner("admin@example.com")
+	f.Peer("gw-1").Connected().Groups("routers")
+	f.Peer("gw-2").Groups("routers")
+	f.Network("office").RouterGroup("routers").Router("laptop").
+		Resource("db", "10.0.0.5/32", "devs").
+		Resource("lan", "10.0.0.0/24", "devs").
+		Resource("wiki", "wiki.internal", "devs")
+	f.Policy("devs to devs").Rule("devs", "devs", "tcp", "443")
+	_, url := newTestServer(t, f, fakeapi.Config{Token: testToken})
+
+	client := nbclient.New(url, testToken)
+	ctx := context.Background()
+
+	groups, err := client.Groups.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list groups: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, group := range groups {
+		counts[group.Name] = group.PeersCount
+		if group.Name == "devs" && group.ResourcesCount != 3 {
+			t.Errorf("Expected 3 resources in devs, got %d", group.ResourcesCount)
+		}
+	}
+	expected := map[string]int{fakeapi.AllGroup: 3, "devs": 1, "routers": 2}
+	for name, count := range expected {
+		if counts[name] != count {
+			t.Errorf("Expected %d peers in %s, got %d", count, name, counts[name])
+		}
+	}
+
+	peers, err := client.Peers.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list peers: %v", err)
+	}
+	if len(peers) != 3 || len(peers[0].Groups) != 2 || peers[0].Groups[0].Name != fakeapi.AllGroup || peers[0].UserId != fakeapi.UserID("admin@example.com") {
+		t.Errorf("Expected the laptop in All and devs, got %+v", peers[0])
+	}
+
+	networks, err := client.Networks.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list networks: %v", err)
+	}
+	if len(networks) != 1 || len(networks[0].Routers) != 2 || len(networks[0].Resources) != 3 || networks[0].RoutingPeersCount != 3 || len(networks[0].Policies) != 1 {
+		t.Errorf("Expected the office network with derived fields, got %+v", networks)
+	}
+
+	resources, err := client.Networks.Resources(networks[0].Id).List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list network resources: %v", err)
+	}
+	types := []api.NetworkResourceType{api.NetworkResourceTypeHost, api.NetworkResourceTypeSubnet, api.NetworkResourceTypeDomain}
+	for i, resource := range resources {
+		if resource.Type != types[i] {
+			t.Errorf("Expected resource %s of type %s, got %s", resource.Name, types[i], resource.Type)
+		}
+	}
+
+	// Like NetBird, only the current user comes with permissions
+	users, err := client.Users.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list users: %v", err)
+	}
+	if len(users) != 1 || users[0].Permissions != nil {
+		t.Errorf("Expected the users without permissions, got %+v", users)
+	}
+	current, err := client.Users.Current(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get the current user: %v", err)
+	}
+	if current.Permissions == nil || !current.Permissions.Modules["peers"]["delete"] {
+		t.Errorf("Expected the permissions of the current admin, got %+v", current.Permissions)
+	}
+	tokens, err := client.Tokens.List(ctx, current.Id)
+	if err != nil {
+		t.Fatalf("Failed to list tokens: %v", err)
+	}
+	if len(tokens) != 1 || !tokens[0].ExpirationDate.Equal(f.Now.Add(24*time.Hour)) {
+		t.Errorf("Expected the exporter token, got %+v", tokens)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	server, url := newTestServer(t, fakeapi.NewFixture("example.com"), fakeapi.Config{Token: testToken})
+	ctx := context.Background()
+
+	if _, err := nbclient.New(url, "wrong").Peers.List(ctx); err == nil || err.Error() != "token invalid" {
+		t.Errorf("Expected an invalid token error, got %v", err)
+	}
+
+	client := nbclient.New(url, testToken)
+	server.InjectError("/api/peers", http.StatusInternalServerError, 1)
+	if _, err := client.Peers.List(ctx); err == nil || err.Error() != "internal server error" {
+		t.Errorf("Expected the injected error, got %v", err)
+	}
+	if _, err := client.Peers.List(ctx); err != nil {
+		t.Errorf("Expected the injected error to be used up, got %v", err)
+	}
+
+	server.InjectError("/api/users", http.StatusServiceUnavailable, -1)
+	for i := 0; i < 3; i++ {
+		if _, err := client.Users.List(ctx); err == nil {
+			t.Error("Expected the injected error until cleared")
+		}
+	}
+	server.ClearErrors()
+	if _, err := client.Users.List(ctx); err != nil {
+		t.Errorf("Expected no error once cleared, got %v", err)
+	}
+
+	server.InjectBody("/api/groups", "invalid json", 1)
+	if _, err := client.Groups.List(ctx); err == nil {
+		t.Error("Expected a decoding error for the injected body")
+	}
+	if _, err := client.Groups.List(ctx); err != nil {
+		t.Errorf("Expected the injected body to be used up, got %v", err)
+	}
+
+	if requests := server.Requests("/api/peers"); requests != 3 {
+		t.Errorf("Expected 3 requests to /api/peers, got %d", requests)
+	}
+	if _, err := client.Peers.Get(ctx, "missing"); err == nil {
+		t.Error("Expected an error for an unknown endpoint")
+	}
+}
+
+func TestServer_Update(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	f.Peer("laptop")
+	server, url := newTestServer(t, f, fakeapi.Config{})
+	client := nbclient.New(url, testToken)
+	ctx := context.Background()
+
+	if peers, err := client.Peers.List(ctx); err != nil || len(peers) != 1 {
+		t.Fatalf("Expected 1 peer, got %d: %v", len(peers), err)
+	}
+	server.Update(func(f *fakeapi.Fixture) { f.Peer("desktop") })
+	if peers, err := client.Peers.List(ctx); err != nil || len(peers) != 2 {
+		t.Errorf("Expected the cached response to be replaced after an update, got %d peers: %v", len(peers), err)
+	}
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	_, url := newTestServer(t, fakeapi.NewFixture("example.com"), fakeapi.Config{RateLimit: 2, RateLimitWindow: time.Minute})
+
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		resp, err := http.Get(url + "/api/groups")
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("Expected status %d for request %d, got %d", expected, i, resp.StatusCode)
+		}
+		if expected == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != "60" {
+			t.Errorf("Expected Retry-After: 60, got %q", resp.Header.Get("Retry-After"))
+		}
+	}
+}
+
+func TestServer_Latency(t *testing.T) {
+	server, url := newTestServer(t, fakeapi.NewFixture("example.com"), fakeapi.Config{Latency: time.Second})
+	client := nbclient.New(url, testToken)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Peers.List(ctx); err == nil {
+		t.Error("Expected a timeout with latency above the deadline")
+	}
+
+	server.SetLatency(0)
+	if _, err := client.Peers.List(context.Background()); err != nil {
+		t.Errorf("Expected no error without latency, got %v", err)
+	}
+}
+
+// gather collects the exporter and returns the metric families by name
+func gather(t *testing.T, exporter prometheus.Collector) map[string]*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName
+}
+
+// value returns the value of the series of a family with the labels
+func value(family *dto.MetricFamily, labels map[string]string) (float64, bool) {
+	for _, metric := range family.GetMetric() {
+		matched := 0
+		for _, label := range metric.GetLabel() {
+			if v, ok := labels[label.GetName()]; ok && v == label.GetValue() {
+				matched++
+			}
+		}
+		if matched != len(labels) {
+			continue
+		}
+		if metric.GetCounter() != nil {
+			return metric.GetCounter().GetValue(), true
+		}
+		return metric.GetGauge().GetValue(), true
+	}
+	return 0, false
+}
+
+// scrapeErrors sums the scrape errors of every collector
+func scrapeErrors(families map[string]*dto.MetricFamily) float64 {
+	total := 0.0
+	for name, family := range families {
+		if !strings.HasSuffix(name, "_scrape_errors_total") {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			total += metric.GetCounter().GetValue()
+		}
+	}
+	return total
+}
+
+// demoConfig enables every collector but the DNS probe, which would query the
+// demo nameservers
+func demoConfig() exporters.Config {
+	config := exporters.AllCollectorsConfig()
+	config.DNS.ProbeEnabled = false
+	return config
+}
+
+func TestDemo_Exporter(t *testing.T) {
+	_, url := newTestServer(t, fakeapi.Demo(time.Now()), fakeapi.Config{Token: fakeapi.DemoToken})
+	families := gather(t, exporters.NewNetBirdExporterWithConfig(url, fakeapi.DemoToken, demoConfig()))
+
+	if errors := scrapeErrors(families); errors != 0 {
+		t.Errorf("Expected no scrape errors against the demo account, got %v", errors)
+	}
+
+	expected := []struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{"netbird_peers", nil, 11},
+		{"netbird_peers_connected", map[string]string{"connected": "true"}, 7},
+		{"netbird_group_peers_count", map[string]string{"group_name": "routers"}, 3},
+		{"netbird_network_ha_routers_online", map[string]string{"network_name": "berlin-office"}, 1},
+		{"netbird_network_ha_routers_online", map[string]string{"network_name": "staging"}, 0},
+		{"netbird_setup_keys", map[string]string{"type": "reusable", "state": "revoked"}, 1},
+		{"netbird_setup_keys", map[string]string{"type": "one-off", "state": "overused"}, 1},
+	}
+	for _, e := range expected {
+		family, ok := families[e.name]
+		if !ok {
+			t.Errorf("Expected metric %s", e.name)
+			continue
+		}
+		if v, ok := value(family, e.labels); !ok || v != e.value {
+			t.Errorf("Expected %s%v = %v, got %v (found: %t)", e.name, e.labels, e.value, v, ok)
+		}
+	}
+	if _, ok := families["netbird_user_token_expires_in_seconds"]; !ok {
+		t.Error("Expected the token expiry of the current user")
+	}
+}
+
+func TestDemo_RateLimited(t *testing.T) {
+	_, url := newTestServer(t, fakeapi.Demo(time.Now()), fakeapi.Config{RateLimit: 1, RateLimitWindow: time.Minute})
+	families := gather(t, exporters.NewNetBirdExporterWithConfig(url, testToken, demoConfig()))
+
+	if errors := scrapeErrors(families); errors == 0 {
+		t.Error("Expected scrape errors when the API rate limits the exporter")
+	}
+	if _, ok := families["netbird_peers"]; !ok {
+		t.Error("Expected the metrics of the request within the rate limit")
+	}
+}
@@ -0,0 +1,649 @@
+package fakeapi
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+)
+
+// AllGroup is the group NetBird puts every peer in
+const AllGroup = "All"
+
+// Fixture is the account served by the fake API. It is built with the fluent
+// builders returned by its methods, which refer to other objects by name:
+//
+//	f := fakeapi.NewFixture("example.com")
+//	f.User("alice@example.com").Role("admin").Current()
+//	f.Peer("laptop").Connected().Groups("devs").Owner("alice@example.com")
+//	f.Network("office").Router("gateway").Resource("db", "10.0.0.5/32", "devs")
+//
+// Groups are created on first reference and derived fields, such as group
+// members and counts, are computed when the objects are served.
+type Fixture struct {
+	// Now is the reference time of relative times, e.g. LastSeen(time.Hour)
+	Now time.Time
+
+	account     api.Account
+	peers       []*PeerBuilder
+	users       []*UserBuilder
+	groups      []*api.Group
+	policies    []*PolicyBuilder
+	routes      []*api.Route
+	networks    []*NetworkBuilder
+	nameservers []*NameserverGroupBuilder
+	dnsSettings api.DNSSettings
+	setupKeys   []*SetupKeyBuilder
+	events      []api.Event
+}
+
+// NewFixture creates an empty account for a domain with the All group
+func NewFixture(domain string) *Fixture {
+	f := &Fixture{
+		Now: time.Now().UTC().Truncate(time.Second),
+		account: api.Account{
+			Id:             id("account", domain),
+			Domain:         domain,
+			DomainCategory: "private",
+			CreatedBy:      id("user", "owner@"+domain),
+		},
+		dnsSettings: api.DNSSettings{DisabledManagementGroups: []string{}},
+	}
+	f.account.CreatedAt = f.Now.Add(-365 * 24 * time.Hour)
+	f.group(AllGroup)
+	return f
+}
+
+// id derives a stable object ID from its kind and name
+func id(kind, name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return kind + "-" + b.String()
+}
+
+// GroupID returns the ID of the group with a name
+func GroupID(name string) string { return id("group", name) }
+
+// PeerID returns the ID of the peer with a name
+func PeerID(name string) string { return id("peer", name) }
+
+// UserID returns the ID of the user with an email
+func UserID(email string) string { return id("user", email) }
+
+// NetworkID returns the ID of the network with a name
+func NetworkID(name string) string { return id("network", name) }
+
+// group returns the group with a name, creating it on first reference
+func (f *Fixture) group(name string) *api.Group {
+	for _, group := range f.groups {
+		if group.Name == name {
+			return group
+		}
+	}
+	issued := api.GroupIssuedApi
+	group := &api.Group{Id: GroupID(name), Name: name, Issued: &issued}
+	f.groups = append(f.groups, group)
+	return group
+}
+
+// groupIDs resolves group names to IDs, creating the missing groups
+func (f *Fixture) groupIDs(names []string) []string {
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		ids = append(ids, f.group(name).Id)
+	}
+	return ids
+}
+
+// Group declares a group, e.g. one without peers
+func (f *Fixture) Group(name string) *Fixture {
+	f.group(name)
+	return f
+}
+
+// JWTGroup declares a group issued from JWT claims
+func (f *Fixture) JWTGroup(name string) *Fixture {
+	issued := api.GroupIssuedJwt
+	f.group(name).Issued = &issued
+	return f
+}
+
+// DisableDNSManagement disables DNS management for the peers of a group
+func (f *Fixture) DisableDNSManagement(group string) *Fixture {
+	f.dnsSettings.DisabledManagementGroups = append(f.dnsSettings.DisabledManagementGroups, f.group(group).Id)
+	return f
+}
+
+// Event adds an audit event, initiated by a user, that happened ago
+func (f *Fixture) Event(activityCode, activity, initiator, targetID string, ago time.Duration) *Fixture {
+	f.events = append(f.events, api.Event{
+		Id:             fmt.Sprintf("%d", len(f.events)+1),
+		Activity:       activity,
+		ActivityCode:   api.EventActivityCode(activityCode),
+		InitiatorEmail: initiator,
+		InitiatorId:    UserID(initiator),
+		InitiatorName:  strings.Split(initiator, "@")[0],
+		TargetId:       targetID,
+		Meta:           map[string]string{},
+		Timestamp:      f.Now.Add(-ago),
+	})
+	return f
+}
+
+// PeerBuilder configures a peer
+type PeerBuilder struct {
+	f      *Fixture
+	peer   api.Peer
+	groups []string
+}
+
+// Peer adds a disconnected Linux peer seen a minute ago
+func (f *Fixture) Peer(name string) *PeerBuilder {
+	p := &PeerBuilder{f: f, peer: api.Peer{
+		Id:                     PeerID(name),
+		Name:                   name,
+		Hostname:               name,
+		DnsLabel:               name + "." + f.account.Domain,
+		ExtraDnsLabels:         []string{},
+		Ip:                     fmt.Sprintf("100.64.%d.%d", (len(f.peers)+1)/250, (len(f.peers)+1)%250+1),
+		ConnectionIp:           fmt.Sprintf("203.0.113.%d", len(f.peers)%250+1),
+		Os:                     "Linux 6.8",
+		KernelVersion:          "6.8.0",
+		Version:                "0.48.0",
+		UiVersion:              "netbird-desktop-ui/0.48.0",
+		LastSeen:               f.Now.Add(-time.Minute),
+		LastLogin:              f.Now.Add(-24 * time.Hour),
+		LoginExpirationEnabled: true,
+	}}
+	f.peers = append(f.peers, p)
+	return p
+}
+
+// Connected marks the peer connected and seen now
+func (p *PeerBuilder) Connected() *PeerBuilder {
+	p.peer.Connected = true
+	p.peer.LastSeen = p.f.Now
+	return p
+}
+
+// OS sets the operating system and its version, e.g. OS("Darwin", "14.5")
+func (p *PeerBuilder) OS(name, version string) *PeerBuilder {
+	p.peer.Os = strings.TrimSpace(name + " " + version)
+	p.peer.KernelVersion = version
+	return p
+}
+
+// Version sets the NetBird agent version
+func (p *PeerBuilder) Version(version string) *PeerBuilder {
+	p.peer.Version = version
+	p.peer.UiVersion = "netbird-desktop-ui/" + version
+	return p
+}
+
+// Groups adds the peer to groups
+func (p *PeerBuilder) Groups(names ...string) *PeerBuilder {
+	p.groups = append(p.groups, p.f.groupIDs(names)...)
+	return p
+}
+
+// Owner sets the user the peer belongs to
+func (p *PeerBuilder) Owner(email string) *PeerBuilder {
+	p.peer.UserId = UserID(email)
+	return p
+}
+
+// Location sets the country code and city of the connection IP
+func (p *PeerBuilder) Location(countryCode, city string) *PeerBuilder {
+	p.peer.CountryCode = countryCode
+	p.peer.CityName = city
+	return p
+}
+
+// LastSeen sets how long ago the peer was seen
+func (p *PeerBuilder) LastSeen(ago time.Duration) *PeerBuilder {
+	p.peer.LastSeen = p.f.Now.Add(-ago)
+	return p
+}
+
+// LoginExpired marks the peer login expired
+func (p *PeerBuilder) LoginExpired() *PeerBuilder {
+	p.peer.LoginExpired = true
+	return p
+}
+
+// ApprovalRequired marks the peer waiting for approval
+func (p *PeerBuilder) ApprovalRequired() *PeerBuilder {
+	p.peer.ApprovalRequired = true
+	return p
+}
+
+// SSH enables the SSH server of the peer
+func (p *PeerBuilder) SSH() *PeerBuilder {
+	p.peer.SshEnabled = true
+	return p
+}
+
+// Ephemeral marks the peer ephemeral
+func (p *PeerBuilder) Ephemeral() *PeerBuilder {
+	p.peer.Ephemeral = true
+	return p
+}
+
+// UserBuilder configures a user
+type UserBuilder struct {
+	f      *Fixture
+	user   api.User
+	tokens []api.PersonalAccessToken
+}
+
+// User adds an active user who logged in an hour ago
+func (f *Fixture) User(email string) *UserBuilder {
+	issued := "api"
+	serviceUser := false
+	lastLogin := f.Now.Add(-time.Hour)
+	u := &UserBuilder{f: f, user: api.User{
+		Id:            UserID(email),
+		Email:         email,
+		Name:          strings.Split(email, "@")[0],
+		Role:          "user",
+		Status:        api.UserStatusActive,
+		AutoGroups:    []string{},
+		Issued:        &issued,
+		IsServiceUser: &serviceUser,
+		LastLogin:     &lastLogin,
+		Permissions: &api.UserPermissions{
+			Modules: map[string]map[string]bool{
+				"peers":  {"read": false, "create": false, "update": false, "delete": false},
+				"groups": {"read": false, "create": false, "update": false, "delete": false},
+			},
+		},
+	}}
+	f.users = append(f.users, u)
+	return u
+}
+
+// Role sets the role, admins and owners get every permission and auditors
+// read permissions like in NetBird. The permissions are only served from
+// /api/users/current.
+func (u *UserBuilder) Role(role string) *UserBuilder {
+	u.user.Role = role
+	for _, permissions := range u.user.Permissions.Modules {
+		for action := range permissions {
+			permissions[action] = role == "admin" || role == "owner" || (role == "auditor" && action == "read")
+		}
+	}
+	return u
+}
+
+// Name sets the display name
+func (u *UserBuilder) Name(name string) *UserBuilder {
+	u.user.Name = name
+	return u
+}
+
+// Invited marks the user invited and never logged in
+func (u *UserBuilder) Invited() *UserBuilder {
+	u.user.Status = api.UserStatusInvited
+	u.user.LastLogin = nil
+	return u
+}
+
+// Blocked blocks the user
+func (u *UserBuilder) Blocked() *UserBuilder {
+	u.user.Status = api.UserStatusBlocked
+	u.user.IsBlocked = true
+	return u
+}
+
+// ServiceUser marks the user a service user
+func (u *UserBuilder) ServiceUser() *UserBuilder {
+	serviceUser := true
+	u.user.IsServiceUser = &serviceUser
+	u.user.LastLogin = nil
+	return u
+}
+
+// LastLogin sets how long ago the user logged in
+func (u *UserBuilder) LastLogin(ago time.Duration) *UserBuilder {
+	lastLogin := u.f.Now.Add(-ago)
+	u.user.LastLogin = &lastLogin
+	return u
+}
+
+// AutoGroups sets the groups assigned to the peers the user adds
+func (u *UserBuilder) AutoGroups(names ...string) *UserBuilder {
+	u.user.AutoGroups = append(u.user.AutoGroups, u.f.groupIDs(names)...)
+	return u
+}
+
+// Current marks the user as the owner of the API token
+func (u *UserBuilder) Current() *UserBuilder {
+	current := true
+	u.user.IsCurrent = &current
+	return u
+}
+
+// Token adds a personal access token expiring in expiresIn
+func (u *UserBuilder) Token(name string, expiresIn time.Duration) *UserBuilder {
+	u.tokens = append(u.tokens, api.PersonalAccessToken{
+		Id:             id("token", u.user.Email+"-"+name),
+		Name:           name,
+		CreatedBy:      u.user.Id,
+		CreatedAt:      u.f.Now.Add(-30 * 24 * time.Hour),
+		ExpirationDate: u.f.Now.Add(expiresIn),
+	})
+	return u
+}
+
+// PolicyBuilder configures a policy
+type PolicyBuilder struct {
+	f      *Fixture
+	policy api.Policy
+}
+
+// Policy adds an enabled policy without rules
+func (f *Fixture) Policy(name string) *PolicyBuilder {
+	policyID := id("policy", name)
+	p := &PolicyBuilder{f: f, policy: api.Policy{
+		Id:                  &policyID,
+		Name:                name,
+		Enabled:             true,
+		Rules:               []api.PolicyRule{},
+		SourcePostureChecks: []string{},
+	}}
+	f.policies = append(f.policies, p)
+	return p
+}
+
+// Rule adds an accepting bidirectional rule between groups for a protocol,
+// with optional ports
+func (p *PolicyBuilder) Rule(source, destination, protocol string, ports ...string) *PolicyBuilder {
+	ruleID := fmt.Sprintf("%s-rule-%d", *p.policy.Id, len(p.policy.Rules)+1)
+	sources := []api.GroupMinimum{{Id: p.f.group(source).Id, Name: source}}
+	destinations := []api.GroupMinimum{{Id: p.f.group(destination).Id, Name: destination}}
+	rule := api.PolicyRule{
+		Id:            &ruleID,
+		Name:          fmt.Sprintf("%s to %s", source, destination),
+		Enabled:       true,
+		Action:        api.PolicyRuleActionAccept,
+		Bidirectional: true,
+		Protocol:      api.PolicyRuleProtocol(protocol),
+		Sources:       &sources,
+		Destinations:  &destinations,
+	}
+	if len(ports) > 0 {
+		rule.Ports = &ports
+	}
+	p.policy.Rules = append(p.policy.Rules, rule)
+	return p
+}
+
+// Disabled disables the policy
+func (p *PolicyBuilder) Disabled() *PolicyBuilder {
+	p.policy.Enabled = false
+	return p
+}
+
+// Route adds an enabled route of a network through a routing peer, distributed
+// to groups
+func (f *Fixture) Route(network, peer string, groups ...string) *Fixture {
+	peerID := PeerID(peer)
+	f.routes = append(f.routes, &api.Route{
+		Id:          id("route", network),
+		NetworkId:   network,
+		Network:     &network,
+		NetworkType: "IPv4",
+		Description: "Route to " + network,
+		Enabled:     true,
+		Masquerade:  true,
+		Metric:      9999,
+		Peer:        &peerID,
+		Groups:      f.groupIDs(groups),
+	})
+	return f
+}
+
+// HARoute adds an enabled route of a network through the peers of a group
+func (f *Fixture) HARoute(network, peerGroup string, groups ...string) *Fixture {
+	peerGroups := []string{f.group(peerGroup).Id}
+	f.routes = append(f.routes, &api.Route{
+		Id:          id("route", network),
+		NetworkId:   network,
+		Network:     &network,
+		NetworkType: "IPv4",
+		Description: "Route to " + network,
+		Enabled:     true,
+		Masquerade:  true,
+		Metric:      9999,
+		PeerGroups:  &peerGroups,
+		Groups:      f.groupIDs(groups),
+	})
+	return f
+}
+
+// DisableRoute disables the routes of a network
+func (f *Fixture) DisableRoute(network string) *Fixture {
+	for _, r := range f.routes {
+		if r.NetworkId == network {
+			r.Enabled = false
+		}
+	}
+	return f
+}
+
+// NetworkBuilder configures a network
+type NetworkBuilder struct {
+	f         *Fixture
+	network   api.Network
+	routers   []api.NetworkRouter
+	resources []*resource
+}
+
+// resource is a network resource with the names of its groups
+type resource struct {
+	resource api.NetworkResource
+	groups   []string
+}
+
+// Network adds a network without routers and resources
+func (f *Fixture) Network(name string) *NetworkBuilder {
+	description := "The " + name + " network"
+	n := &NetworkBuilder{f: f, network: api.Network{
+		Id:          NetworkID(name),
+		Name:        name,
+		Description: &description,
+		Policies:    []string{},
+	}}
+	f.networks = append(f.networks, n)
+	return n
+}
+
+// Router adds an enabled routing peer
+func (n *NetworkBuilder) Router(peer string) *NetworkBuilder {
+	peerID := PeerID(peer)
+	n.routers = append(n.routers, api.NetworkRouter{
+		Id:         fmt.Sprintf("%s-router-%d", n.network.Id, len(n.routers)+1),
+		Enabled:    true,
+		Masquerade: true,
+		Metric:     9999,
+		Peer:       &peerID,
+	})
+	return n
+}
+
+// RouterGroup adds an enabled router made of the peers of groups
+func (n *NetworkBuilder) RouterGroup(groups ...string) *NetworkBuilder {
+	peerGroups := n.f.groupIDs(groups)
+	n.routers = append(n.routers, api.NetworkRouter{
+		Id:         fmt.Sprintf("%s-router-%d", n.network.Id, len(n.routers)+1),
+		Enabled:    true,
+		Masquerade: true,
+		Metric:     9999,
+		PeerGroups: &peerGroups,
+	})
+	return n
+}
+
+// Resource adds an enabled resource in groups. The type is derived from the
+// address: a domain, a host /32 or a subnet.
+func (n *NetworkBuilder) Resource(name, address string, groups ...string) *NetworkBuilder {
+	resourceType := api.NetworkResourceTypeDomain
+	if prefix, err := netip.ParsePrefix(address); err == nil {
+		resourceType = api.NetworkResourceTypeSubnet
+		if prefix.IsSingleIP() {
+			resourceType = api.NetworkResourceTypeHost
+		}
+	} else if _, err := netip.ParseAddr(address); err == nil {
+		resourceType = api.NetworkResourceTypeHost
+	}
+	n.f.groupIDs(groups)
+	n.resources = append(n.resources, &resource{
+		resource: api.NetworkResource{
+			Id:      fmt.Sprintf("%s-resource-%d", n.network.Id, len(n.resources)+1),
+			Name:    name,
+			Address: address,
+			Type:    resourceType,
+			Enabled: true,
+		},
+		groups: groups,
+	})
+	return n
+}
+
+// DisableResource disables the resources of the network with a name
+func (n *NetworkBuilder) DisableResource(name string) *NetworkBuilder {
+	for _, r := range n.resources {
+		if r.resource.Name == name {
+			r.resource.Enabled = false
+		}
+	}
+	return n
+}
+
+// NameserverGroupBuilder configures a nameserver group
+type NameserverGroupBuilder struct {
+	f     *Fixture
+	group api.NameserverGroup
+}
+
+// Nameservers adds an enabled nameserver group distributed to the All group
+func (f *Fixture) Nameservers(name string) *NameserverGroupBuilder {
+	n := &NameserverGroupBuilder{f: f, group: api.NameserverGroup{
+		Id:          id("nameservers", name),
+		Name:        name,
+		Description: name + " nameservers",
+		Enabled:     true,
+		Domains:     []string{},
+		Groups:      []string{f.group(AllGroup).Id},
+		Nameservers: []api.Nameserver{},
+	}}
+	f.nameservers = append(f.nameservers, n)
+	return n
+}
+
+// Nameserver adds a UDP nameserver on port 53
+func (n *NameserverGroupBuilder) Nameserver(ip string) *NameserverGroupBuilder {
+	n.group.Nameservers = append(n.group.Nameservers, api.Nameserver{Ip: ip, NsType: api.NameserverNsTypeUdp, Port: 53})
+	return n
+}
+
+// Domains restricts the group to match domains
+func (n *NameserverGroupBuilder) Domains(domains ...string) *NameserverGroupBuilder {
+	n.group.Domains = append(n.group.Domains, domains...)
+	n.group.SearchDomainsEnabled = true
+	return n
+}
+
+// Primary makes the group resolve every domain
+func (n *NameserverGroupBuilder) Primary() *NameserverGroupBuilder {
+	n.group.Primary = true
+	return n
+}
+
+// Groups replaces the groups the nameservers are distributed to
+func (n *NameserverGroupBuilder) Groups(names ...string) *NameserverGroupBuilder {
+	n.group.Groups = n.f.groupIDs(names)
+	return n
+}
+
+// Disabled disables the nameserver group
+func (n *NameserverGroupBuilder) Disabled() *NameserverGroupBuilder {
+	n.group.Enabled = false
+	return n
+}
+
+// SetupKeyBuilder configures a setup key
+type SetupKeyBuilder struct {
+	f   *Fixture
+	key api.SetupKey
+}
+
+// SetupKey adds a valid one-off setup key expiring in 30 days
+func (f *Fixture) SetupKey(name string) *SetupKeyBuilder {
+	k := &SetupKeyBuilder{f: f, key: api.SetupKey{
+		Id:         id("setup-key", name),
+		Name:       name,
+		Key:        "****",
+		Type:       "one-off",
+		State:      "valid",
+		Valid:      true,
+		AutoGroups: []string{},
+		UsageLimit: 1,
+		Expires:    f.Now.Add(30 * 24 * time.Hour),
+		UpdatedAt:  f.Now.Add(-24 * time.Hour),
+	}}
+	f.setupKeys = append(f.setupKeys, k)
+	return k
+}
+
+// Reusable makes the key reusable without usage limit
+func (k *SetupKeyBuilder) Reusable() *SetupKeyBuilder {
+	k.key.Type = "reusable"
+	k.key.UsageLimit = 0
+	return k
+}
+
+// ExpiresIn sets when the key expires, negative for expired keys
+func (k *SetupKeyBuilder) ExpiresIn(d time.Duration) *SetupKeyBuilder {
+	k.key.Expires = k.f.Now.Add(d)
+	if d <= 0 {
+		k.key.State = "expired"
+		k.key.Valid = false
+	}
+	return k
+}
+
+// UsedTimes sets how many peers used the key, a used one-off key is overused
+func (k *SetupKeyBuilder) UsedTimes(n int) *SetupKeyBuilder {
+	k.key.UsedTimes = n
+	if n > 0 {
+		k.key.LastUsed = k.f.Now.Add(-time.Hour)
+	}
+	if k.key.UsageLimit > 0 && n >= k.key.UsageLimit && k.key.Valid {
+		k.key.State = "overused"
+		k.key.Valid = false
+	}
+	return k
+}
+
+// Revoked revokes the key
+func (k *SetupKeyBuilder) Revoked() *SetupKeyBuilder {
+	k.key.Revoked = true
+	k.key.State = "revoked"
+	k.key.Valid = false
+	return k
+}
+
+// AutoGroups sets the groups of the peers added with the key
+func (k *SetupKeyBuilder) AutoGroups(names ...string) *SetupKeyBuilder {
+	k.key.AutoGroups = append(k.key.AutoGroups, k.f.groupIDs(names)...)
+	return k
+}
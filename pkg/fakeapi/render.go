@@ -0,0 +1,266 @@
+package fakeapi
+
+import (
+	"slices"
+
+	"github.com/netbirdio/netbird/management/server/http/api"
+)
+
+// The render methods build the API objects served for the fixture, filling in
+// the fields NetBird derives from other objects
+
+// members returns the peers of a group, every peer is in the All group
+func (f *Fixture) members(group *api.Group) []*PeerBuilder {
+	var members []*PeerBuilder
+	for _, p := range f.peers {
+		if group.Name == AllGroup || slices.Contains(p.groups, group.Id) {
+			members = append(members, p)
+		}
+	}
+	return members
+}
+
+// resources returns the network resources in a group
+func (f *Fixture) resources(group *api.Group) []*resource {
+	var resources []*resource
+	for _, n := range f.networks {
+		for _, r := range n.resources {
+			if slices.Contains(r.groups, group.Name) {
+				resources = append(resources, r)
+			}
+		}
+	}
+	return resources
+}
+
+func (f *Fixture) groupMinimum(group *api.Group) api.GroupMinimum {
+	minimum := api.GroupMinimum{
+		Id:             group.Id,
+		Name:           group.Name,
+		PeersCount:     len(f.members(group)),
+		ResourcesCount: len(f.resources(group)),
+	}
+	if group.Issued != nil {
+		issued := api.GroupMinimumIssued(*group.Issued)
+		minimum.Issued = &issued
+	}
+	return minimum
+}
+
+func (f *Fixture) groupByID(groupID string) *api.Group {
+	for _, group := range f.groups {
+		if group.Id == groupID {
+			return group
+		}
+	}
+	return nil
+}
+
+func (f *Fixture) renderAccounts() []api.Account {
+	return []api.Account{f.account}
+}
+
+func (f *Fixture) renderPeers() []api.Peer {
+	// Every peer is in the All group, so the group minimums are computed once
+	// rather than per peer
+	minimums := make(map[string]api.GroupMinimum)
+	minimum := func(group *api.Group) api.GroupMinimum {
+		if m, ok := minimums[group.Id]; ok {
+			return m
+		}
+		minimums[group.Id] = f.groupMinimum(group)
+		return minimums[group.Id]
+	}
+
+	peers := make([]api.Peer, 0, len(f.peers))
+	for _, p := range f.peers {
+		peer := p.peer
+		peer.Groups = []api.GroupMinimum{minimum(f.group(AllGroup))}
+		for _, groupID := range p.groups {
+			peer.Groups = append(peer.Groups, minimum(f.groupByID(groupID)))
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+func (f *Fixture) renderGroups() []api.Group {
+	groups := make([]api.Group, 0, len(f.groups))
+	for _, g := range f.groups {
+		group := *g
+		group.Peers = []api.PeerMinimum{}
+		for _, p := range f.members(g) {
+			group.Peers = append(group.Peers, api.PeerMinimum{Id: p.peer.Id, Name: p.peer.Name})
+		}
+		group.PeersCount = len(group.Peers)
+		group.Resources = []api.Resource{}
+		for _, r := range f.resources(g) {
+			group.Resources = append(group.Resources, api.Resource{Id: r.resource.Id, Type: api.ResourceType(r.resource.Type)})
+		}
+		group.ResourcesCount = len(group.Resources)
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// renderUsers lists the users without permissions, which NetBird only returns
+// from /api/users/current
+func (f *Fixture) renderUsers() []api.User {
+	users := make([]api.User, 0, len(f.users))
+	for _, u := range f.users {
+		user := u.user
+		user.Permissions = nil
+		users = append(users, user)
+	}
+	return users
+}
+
+// currentUser returns the owner of the API token, the first user when none is
+// marked current
+func (f *Fixture) currentUser() *UserBuilder {
+	for _, u := range f.users {
+		if u.user.IsCurrent != nil && *u.user.IsCurrent {
+			return u
+		}
+	}
+	if len(f.users) > 0 {
+		return f.users[0]
+	}
+	return nil
+}
+
+func (f *Fixture) renderTokens(userID string) ([]api.PersonalAccessToken, bool) {
+	for _, u := range f.users {
+		if u.user.Id == userID {
+			return append([]api.PersonalAccessToken{}, u.tokens...), true
+		}
+	}
+	return nil, false
+}
+
+func (f *Fixture) renderPolicies() []api.Policy {
+	policies := make([]api.Policy, 0, len(f.policies))
+	for _, p := range f.policies {
+		policies = append(policies, p.policy)
+	}
+	return policies
+}
+
+func (f *Fixture) renderRoutes() []api.Route {
+	routes := make([]api.Route, 0, len(f.routes))
+	for _, r := range f.routes {
+		routes = append(routes, *r)
+	}
+	return routes
+}
+
+// routingPeers counts the distinct peers routing a network
+func (f *Fixture) routingPeers(n *NetworkBuilder) int {
+	peers := make(map[string]bool)
+	for _, router := range n.routers {
+		if router.Peer != nil {
+			peers[*router.Peer] = true
+		}
+		if router.PeerGroups != nil {
+			for _, groupID := range *router.PeerGroups {
+				for _, p := range f.members(f.groupByID(groupID)) {
+					peers[p.peer.Id] = true
+				}
+			}
+		}
+	}
+	return len(peers)
+}
+
+// networkPolicies returns the IDs of the policies with a destination group
+// containing a resource of the network
+func (f *Fixture) networkPolicies(n *NetworkBuilder) []string {
+	policies := []string{}
+	for _, p := range f.policies {
+		for _, rule := range p.policy.Rules {
+			if rule.Destinations == nil || slices.Contains(policies, *p.policy.Id) {
+				continue
+			}
+			for _, destination := range *rule.Destinations {
+				if slices.ContainsFunc(n.resources, func(r *resource) bool { return slices.Contains(r.groups, destination.Name) }) {
+					policies = append(policies, *p.policy.Id)
+					break
+				}
+			}
+		}
+	}
+	return policies
+}
+
+func (f *Fixture) renderNetworks() []api.Network {
+	networks := make([]api.Network, 0, len(f.networks))
+	for _, n := range f.networks {
+		network := n.network
+		network.Routers = []string{}
+		for _, router := range n.routers {
+			network.Routers = append(network.Routers, router.Id)
+		}
+		network.Resources = []string{}
+		for _, r := range n.resources {
+			network.Resources = append(network.Resources, r.resource.Id)
+		}
+		network.RoutingPeersCount = f.routingPeers(n)
+		network.Policies = f.networkPolicies(n)
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func (f *Fixture) network(networkID string) *NetworkBuilder {
+	for _, n := range f.networks {
+		if n.network.Id == networkID {
+			return n
+		}
+	}
+	return nil
+}
+
+func (f *Fixture) renderRouters(networkID string) ([]api.NetworkRouter, bool) {
+	n := f.network(networkID)
+	if n == nil {
+		return nil, false
+	}
+	return append([]api.NetworkRouter{}, n.routers...), true
+}
+
+func (f *Fixture) renderResources(networkID string) ([]api.NetworkResource, bool) {
+	n := f.network(networkID)
+	if n == nil {
+		return nil, false
+	}
+	resources := make([]api.NetworkResource, 0, len(n.resources))
+	for _, r := range n.resources {
+		networkResource := r.resource
+		networkResource.Groups = []api.GroupMinimum{}
+		for _, name := range r.groups {
+			networkResource.Groups = append(networkResource.Groups, f.groupMinimum(f.group(name)))
+		}
+		resources = append(resources, networkResource)
+	}
+	return resources, true
+}
+
+func (f *Fixture) renderNameservers() []api.NameserverGroup {
+	groups := make([]api.NameserverGroup, 0, len(f.nameservers))
+	for _, n := range f.nameservers {
+		groups = append(groups, n.group)
+	}
+	return groups
+}
+
+func (f *Fixture) renderSetupKeys() []api.SetupKey {
+	keys := make([]api.SetupKey, 0, len(f.setupKeys))
+	for _, k := range f.setupKeys {
+		keys = append(keys, k.key)
+	}
+	return keys
+}
+
+func (f *Fixture) renderEvents() []api.Event {
+	return append([]api.Event{}, f.events...)
+}
@@ -0,0 +1,287 @@
+// Package fakeapi serves a fake NetBird management API from an in-memory
+// fixture. It answers the read-only endpoints the exporter uses, and can add
+// latency, inject errors and rate limit requests to exercise error handling
+// without a NetBird account.
+package fakeapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config holds the configuration of the fake API server
+type Config struct {
+	// Token is the personal access token clients must send, any token is
+	// accepted when empty
+	Token string
+	// Latency is added to every response
+	Latency time.Duration
+	// RateLimit is the number of requests allowed per RateLimitWindow before
+	// answering 429 Too Many Requests, 0 disables rate limiting
+	RateLimit int
+	// RateLimitWindow is the rate limit window (default: 1s)
+	RateLimitWindow time.Duration
+}
+
+// injectedError is an error or a body returned instead of the fixture
+type injectedError struct {
+	status int
+	// body replaces the error message when set, e.g. a malformed response
+	body string
+	// remaining is the number of responses left, negative for every response
+	remaining int
+}
+
+// Server is a fake NetBird management API. It is an http.Handler, so it can be
+// served by httptest.NewServer, or started on an address with Start.
+type Server struct {
+	config Config
+
+	mu      sync.Mutex
+	fixture *Fixture
+	// responses caches the encoded responses until the fixture is updated
+	responses   map[string][]byte
+	errors      map[string]*injectedError
+	requests    map[string]int
+	windowStart time.Time
+	windowCount int
+
+	server *http.Server
+}
+
+// NewServer creates a fake API server for a fixture. The fixture must only be
+// changed with Update once it is served, as the responses are cached.
+func NewServer(fixture *Fixture, config Config) *Server {
+	if config.RateLimitWindow <= 0 {
+		config.RateLimitWindow = time.Second
+	}
+	return &Server{
+		config:    config,
+		fixture:   fixture,
+		responses: make(map[string][]byte),
+		errors:    make(map[string]*injectedError),
+		requests:  make(map[string]int),
+	}
+}
+
+// Update changes the fixture while no request is being served
+func (s *Server) Update(update func(*Fixture)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(s.fixture)
+	s.responses = make(map[string][]byte)
+}
+
+// SetLatency changes the latency added to every response
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config.Latency = latency
+}
+
+// InjectError answers the next times requests to a path, e.g. /api/peers,
+// with an error status. A negative times fails every request until
+// ClearErrors is called.
+func (s *Server) InjectError(path string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[path] = &injectedError{status: status, remaining: times}
+}
+
+// InjectBody answers the next times requests to a path with a successful
+// response carrying body, e.g. malformed JSON. A negative times answers every
+// request until ClearErrors is called.
+func (s *Server) InjectBody(path, body string, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[path] = &injectedError{status: http.StatusOK, body: body, remaining: times}
+}
+
+// ClearErrors removes the injected errors and bodies
+func (s *Server) ClearErrors() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors = make(map[string]*injectedError)
+}
+
+// Requests returns the number of requests received for a path, including the
+// rejected ones
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Start serves the API on an address, e.g. 127.0.0.1:0 for a random port, and
+// returns its URL
+func (s *Server) Start(addr string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.WithError(err).Error("Fake NetBird API server error")
+		}
+	}()
+	return "http://" + listener.Addr().String(), nil
+}
+
+// Close stops a server started with Start
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// ServeHTTP answers an API request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	latency := s.config.Latency
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if s.config.Token != "" && r.Header.Get("Authorization") != "Token "+s.config.Token {
+		writeError(w, http.StatusUnauthorized, "token invalid")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.limited() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(s.config.RateLimitWindow.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+	if injected, ok := s.errors[r.URL.Path]; ok && injected.remaining != 0 {
+		if injected.remaining > 0 {
+			injected.remaining--
+		}
+		if injected.body != "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(injected.status)
+			_, _ = w.Write([]byte(injected.body))
+			return
+		}
+		writeError(w, injected.status, strings.ToLower(http.StatusText(injected.status)))
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "the fake API is read-only")
+		return
+	}
+
+	response, ok := s.responses[r.URL.Path]
+	if !ok {
+		body, found := s.route(r.URL.Path)
+		if !found {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		var err error
+		if response, err = json.Marshal(body); err != nil {
+			logrus.WithError(err).Error("Failed to encode fake API response")
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		s.responses[r.URL.Path] = response
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(response); err != nil {
+		logrus.WithError(err).Error("Failed to write fake API response")
+	}
+}
+
+// limited counts a request against the rate limit and reports whether it is
+// exceeded
+func (s *Server) limited() bool {
+	if s.config.RateLimit <= 0 {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(s.windowStart) >= s.config.RateLimitWindow {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	s.windowCount++
+	return s.windowCount > s.config.RateLimit
+}
+
+// route returns the response of a path
+func (s *Server) route(path string) (any, bool) {
+	f := s.fixture
+	switch path {
+	case "/api/accounts":
+		return f.renderAccounts(), true
+	case "/api/peers":
+		return f.renderPeers(), true
+	case "/api/users":
+		return f.renderUsers(), true
+	case "/api/users/current":
+		if u := f.currentUser(); u != nil {
+			return u.user, true
+		}
+		return nil, false
+	case "/api/groups":
+		return f.renderGroups(), true
+	case "/api/policies":
+		return f.renderPolicies(), true
+	case "/api/posture-checks":
+		return []any{}, true
+	case "/api/routes":
+		return f.renderRoutes(), true
+	case "/api/networks":
+		return f.renderNetworks(), true
+	case "/api/dns/nameservers":
+		return f.renderNameservers(), true
+	case "/api/dns/settings":
+		return f.dnsSettings, true
+	case "/api/setup-keys":
+		return f.renderSetupKeys(), true
+	case "/api/events":
+		return f.renderEvents(), true
+	}
+
+	parts := strings.Split(strings.TrimPrefix(path, "/api/"), "/")
+	switch {
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "tokens":
+		return f.renderTokens(parts[1])
+	case len(parts) == 3 && parts[0] == "networks" && parts[2] == "routers":
+		return f.renderRouters(parts[1])
+	case len(parts) == 3 && parts[0] == "networks" && parts[2] == "resources":
+		return f.renderResources(parts[1])
+	}
+	return nil, false
+}
+
+// writeError writes an error the way the management API does, the client
+// returns its message
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"message": message, "code": status})
+}
@@ -0,0 +1,118 @@
+package oneshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/sirupsen/logrus"
+)
+
+// Stdout is the Output value writing the metrics to standard output
+const Stdout = "-"
+
+// DefaultJob is the Pushgateway job name used when none is configured
+const DefaultJob = "netbird_api_exporter"
+
+// Config holds the destinations of a one-shot collection
+type Config struct {
+	// Output is a file the metrics are written to in text exposition format,
+	// or Stdout. The file is replaced atomically, as expected by the
+	// node_exporter textfile collector.
+	Output string
+
+	// PushgatewayURL is a Pushgateway the metrics are pushed to, replacing
+	// the metrics of the same job
+	PushgatewayURL string
+
+	// Job is the Pushgateway job name. Defaults to DefaultJob.
+	Job string
+
+	// Username and Password enable basic auth against the Pushgateway
+	Username string
+	Password string
+}
+
+// Run collects the metrics of collector once and writes and pushes them to the
+// configured destinations. It returns the number of collection failures
+// reported by the *_scrape_errors_total counters; the metrics are written and
+// pushed even when the collection partly failed.
+func Run(ctx context.Context, collector prometheus.Collector, config Config, stdout io.Writer) (int, error) {
+	if config.Output == "" && config.PushgatewayURL == "" {
+		return 0, fmt.Errorf("no output file or Pushgateway configured")
+	}
+	if config.Job == "" {
+		config.Job = DefaultJob
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(collector); err != nil {
+		return 0, fmt.Errorf("register collector: %w", err)
+	}
+
+	// Gather once, every destination gets the same metrics
+	families, err := registry.Gather()
+	if err != nil {
+		return 0, fmt.Errorf("gather metrics: %w", err)
+	}
+	gathered := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	})
+
+	failures := countFailures(families)
+	logrus.WithFields(logrus.Fields{
+		"metric_families": len(families),
+		"failures":        failures,
+	}).Info("Collected metrics once")
+
+	switch config.Output {
+	case "":
+	case Stdout:
+		encoder := expfmt.NewEncoder(stdout, expfmt.NewFormat(expfmt.TypeTextPlain))
+		for _, family := range families {
+			if err := encoder.Encode(family); err != nil {
+				return failures, fmt.Errorf("write metrics to stdout: %w", err)
+			}
+		}
+	default:
+		if err := prometheus.WriteToTextfile(config.Output, gathered); err != nil {
+			return failures, fmt.Errorf("write metrics to %s: %w", config.Output, err)
+		}
+		logrus.WithField("file", config.Output).Info("Wrote metrics to textfile")
+	}
+
+	if config.PushgatewayURL != "" {
+		pusher := push.New(config.PushgatewayURL, config.Job).Gatherer(gathered)
+		if config.Username != "" {
+			pusher = pusher.BasicAuth(config.Username, config.Password)
+		}
+		if err := pusher.PushContext(ctx); err != nil {
+			return failures, fmt.Errorf("push metrics to Pushgateway: %w", err)
+		}
+		logrus.WithFields(logrus.Fields{
+			"url": config.PushgatewayURL,
+			"job": config.Job,
+		}).Info("Pushed metrics to Pushgateway")
+	}
+
+	return failures, nil
+}
+
+// countFailures sums the *_scrape_errors_total counters of the gathered metrics
+func countFailures(families []*dto.MetricFamily) int {
+	failures := 0.0
+	for _, family := range families {
+		if family.GetType() != dto.MetricType_COUNTER || !strings.HasSuffix(family.GetName(), "_scrape_errors_total") {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			failures += metric.GetCounter().GetValue()
+		}
+	}
+	return int(failures)
+}
@@ -0,0 +1,124 @@
+package oneshot
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// testCollector stands in for the NetBird exporter with a gauge and a scrape error counter
+type testCollector struct {
+	peers        *prometheus.GaugeVec
+	scrapeErrors *prometheus.CounterVec
+}
+
+func newTestCollector(errors float64) *testCollector {
+	c := &testCollector{
+		peers:        prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "netbird_peers", Help: "Total number of NetBird peers"}, []string{}),
+		scrapeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "netbird_peers_scrape_errors_total", Help: "Total number of errors"}, []string{"error_type"}),
+	}
+	c.peers.WithLabelValues().Set(3)
+	if errors > 0 {
+		c.scrapeErrors.WithLabelValues("fetch_peers").Add(errors)
+	}
+	return c
+}
+
+func (c *testCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.peers.Describe(ch)
+	c.scrapeErrors.Describe(ch)
+}
+
+func (c *testCollector) Collect(ch chan<- prometheus.Metric) {
+	c.peers.Collect(ch)
+	c.scrapeErrors.Collect(ch)
+}
+
+func TestRun_Stdout(t *testing.T) {
+	var stdout bytes.Buffer
+	failures, err := Run(context.Background(), newTestCollector(0), Config{Output: Stdout}, &stdout)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if failures != 0 {
+		t.Errorf("Expected no failures, got %d", failures)
+	}
+	if !strings.Contains(stdout.String(), "netbird_peers 3") {
+		t.Errorf("Expected metrics in text exposition format, got:\n%s", stdout.String())
+	}
+}
+
+func TestRun_TextfileWithFailures(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "netbird.prom")
+
+	failures, err := Run(context.Background(), newTestCollector(2), Config{Output: output}, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if failures != 2 {
+		t.Errorf("Expected 2 failures from the scrape error counters, got %d", failures)
+	}
+
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Failed to read textfile: %v", err)
+	}
+	if !strings.Contains(string(content), "netbird_peers 3") {
+		t.Errorf("Expected metrics to be written despite the failures, got:\n%s", content)
+	}
+}
+
+func TestRun_Pushgateway(t *testing.T) {
+	var method, path, auth string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, auth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := Run(context.Background(), newTestCollector(0), Config{
+		PushgatewayURL: server.URL,
+		Username:       "user",
+		Password:       "pass",
+	}, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if method != http.MethodPut || path != "/metrics/job/"+DefaultJob {
+		t.Errorf("Expected PUT /metrics/job/%s, got %s %s", DefaultJob, method, path)
+	}
+	if !strings.HasPrefix(auth, "Basic ") {
+		t.Errorf("Expected basic auth, got %q", auth)
+	}
+	if len(body) == 0 {
+		t.Error("Expected metrics in the push body")
+	}
+}
+
+func TestRun_PushgatewayError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	if _, err := Run(context.Background(), newTestCollector(0), Config{PushgatewayURL: server.URL, Job: "cron"}, io.Discard); err == nil {
+		t.Error("Expected an error when the Pushgateway rejects the push")
+	}
+}
+
+func TestRun_NoDestination(t *testing.T) {
+	if _, err := Run(context.Background(), newTestCollector(0), Config{}, io.Discard); err == nil {
+		t.Error("Expected an error without output or Pushgateway")
+	}
+}
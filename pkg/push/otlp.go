@@ -0,0 +1,147 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	otelprometheus "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// OTLP protocols supported by the OTLP push mode
+const (
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http"
+)
+
+const defaultOTLPInterval = 60 * time.Second
+
+// OTLPConfig holds the settings of the OTLP push mode
+type OTLPConfig struct {
+	// Endpoint of the OTLP receiver, either host:port or a URL
+	// (e.g. http://collector:4318/v1/metrics)
+	Endpoint string
+
+	// Protocol is OTLPProtocolGRPC or OTLPProtocolHTTP. Defaults to gRPC.
+	Protocol string
+
+	// Insecure disables TLS when Endpoint is given as host:port
+	Insecure bool
+
+	// Headers are sent with every export request, e.g. for authentication
+	Headers map[string]string
+
+	// Interval between two pushes. Defaults to 60s.
+	Interval time.Duration
+
+	// Attributes are added to the resource of every push, next to the ones
+	// from OTEL_RESOURCE_ATTRIBUTES
+	Attributes map[string]string
+}
+
+// OTLPPusher periodically gathers metrics from Prometheus collectors and pushes
+// them to an OTLP receiver. The collectors stay the single source of truth; the
+// pusher only converts what they produce.
+type OTLPPusher struct {
+	provider *sdkmetric.MeterProvider
+}
+
+// NewOTLPPusher starts pushing the metrics of gatherer to the configured OTLP
+// receiver on every interval until Shutdown is called
+func NewOTLPPusher(ctx context.Context, gatherer prometheus.Gatherer, config OTLPConfig) (*OTLPPusher, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("OTLP endpoint is required")
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultOTLPInterval
+	}
+
+	exporter, err := newOTLPExporter(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := make([]attribute.KeyValue, 0, len(config.Attributes))
+	for key, value := range config.Attributes {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+		resource.WithAttributes(attributes...),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("build OTLP resource: %w", err)
+	}
+
+	// Export failures of the periodic reader are reported through the global handler
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logrus.WithError(err).Error("Failed to push OTLP metrics")
+	}))
+
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(config.Interval),
+		sdkmetric.WithProducer(otelprometheus.NewMetricProducer(otelprometheus.WithGatherer(gatherer))),
+	)
+
+	logrus.WithFields(logrus.Fields{
+		"endpoint": config.Endpoint,
+		"protocol": config.Protocol,
+		"interval": config.Interval,
+	}).Info("Pushing metrics to OTLP receiver")
+
+	return &OTLPPusher{
+		provider: sdkmetric.NewMeterProvider(sdkmetric.WithResource(res), sdkmetric.WithReader(reader)),
+	}, nil
+}
+
+// newOTLPExporter creates the OTLP metric exporter for the configured protocol
+func newOTLPExporter(ctx context.Context, config OTLPConfig) (sdkmetric.Exporter, error) {
+	isURL := strings.Contains(config.Endpoint, "://")
+
+	switch config.Protocol {
+	case "", OTLPProtocolGRPC:
+		options := []otlpmetricgrpc.Option{otlpmetricgrpc.WithHeaders(config.Headers)}
+		if isURL {
+			options = append(options, otlpmetricgrpc.WithEndpointURL(config.Endpoint))
+		} else {
+			options = append(options, otlpmetricgrpc.WithEndpoint(config.Endpoint))
+			if config.Insecure {
+				options = append(options, otlpmetricgrpc.WithInsecure())
+			}
+		}
+		return otlpmetricgrpc.New(ctx, options...)
+	case OTLPProtocolHTTP:
+		options := []otlpmetrichttp.Option{otlpmetrichttp.WithHeaders(config.Headers)}
+		if isURL {
+			options = append(options, otlpmetrichttp.WithEndpointURL(config.Endpoint))
+		} else {
+			options = append(options, otlpmetrichttp.WithEndpoint(config.Endpoint))
+			if config.Insecure {
+				options = append(options, otlpmetrichttp.WithInsecure())
+			}
+		}
+		return otlpmetrichttp.New(ctx, options...)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q, expected %q or %q", config.Protocol, OTLPProtocolGRPC, OTLPProtocolHTTP)
+	}
+}
+
+// ForceFlush gathers and pushes the metrics immediately
+func (p *OTLPPusher) ForceFlush(ctx context.Context) error {
+	return p.provider.ForceFlush(ctx)
+}
+
+// Shutdown pushes the metrics one last time and stops the pusher
+func (p *OTLPPusher) Shutdown(ctx context.Context) error {
+	return p.provider.Shutdown(ctx)
+}
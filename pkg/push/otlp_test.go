@@ -0,0 +1,211 @@
+package push
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpReceiver is a local OTLP receiver stand-in recording the export requests
+type otlpReceiver struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+
+	mu       sync.Mutex
+	requests []*colmetricpb.ExportMetricsServiceRequest
+	headers  []map[string]string
+}
+
+func (r *otlpReceiver) record(request *colmetricpb.ExportMetricsServiceRequest, headers map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, request)
+	r.headers = append(r.headers, headers)
+}
+
+func (r *otlpReceiver) Export(ctx context.Context, request *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	headers := make(map[string]string)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for key, values := range md {
+			headers[key] = strings.Join(values, ",")
+		}
+	}
+	r.record(request, headers)
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+func (r *otlpReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/v1/metrics" {
+		http.NotFound(w, req)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request := &colmetricpb.ExportMetricsServiceRequest{}
+	if err := proto.Unmarshal(body, request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	headers := make(map[string]string)
+	for key := range req.Header {
+		headers[strings.ToLower(key)] = req.Header.Get(key)
+	}
+	r.record(request, headers)
+
+	response, _ := proto.Marshal(&colmetricpb.ExportMetricsServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(response)
+}
+
+// lastRequest returns the last export request and its headers
+func (r *otlpReceiver) lastRequest(t *testing.T) (*colmetricpb.ExportMetricsServiceRequest, map[string]string) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.requests) == 0 {
+		t.Fatal("Expected the receiver to get an export request")
+	}
+	return r.requests[len(r.requests)-1], r.headers[len(r.headers)-1]
+}
+
+// testGatherer returns a registry with one gauge and one counter
+func testGatherer() prometheus.Gatherer {
+	registry := prometheus.NewRegistry()
+	peers := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "netbird_peers", Help: "Total number of NetBird peers"}, []string{})
+	peers.WithLabelValues().Set(3)
+	errors := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "netbird_peers_scrape_errors_total", Help: "Total number of errors"}, []string{"error_type"})
+	errors.WithLabelValues("fetch_peers").Add(2)
+	registry.MustRegister(peers, errors)
+	return registry
+}
+
+// assertExport checks that the export request carries the gathered metrics and
+// the configured resource attributes
+func assertExport(t *testing.T, request *colmetricpb.ExportMetricsServiceRequest) {
+	t.Helper()
+
+	if len(request.ResourceMetrics) != 1 {
+		t.Fatalf("Expected 1 resource, got %d", len(request.ResourceMetrics))
+	}
+	resourceMetrics := request.ResourceMetrics[0]
+
+	attributes := make(map[string]string)
+	for _, attribute := range resourceMetrics.Resource.Attributes {
+		attributes[attribute.Key] = attribute.Value.GetStringValue()
+	}
+	if attributes["netbird.account.id"] != "account-1" {
+		t.Errorf("Expected netbird.account.id resource attribute, got %v", attributes)
+	}
+	if attributes["service.instance.id"] != "exporter-1" {
+		t.Errorf("Expected service.instance.id resource attribute, got %v", attributes)
+	}
+
+	values := make(map[string]float64)
+	for _, scope := range resourceMetrics.ScopeMetrics {
+		for _, metric := range scope.Metrics {
+			switch {
+			case metric.GetGauge() != nil:
+				values[metric.Name] = metric.GetGauge().DataPoints[0].GetAsDouble()
+			case metric.GetSum() != nil:
+				values[metric.Name] = metric.GetSum().DataPoints[0].GetAsDouble()
+			}
+		}
+	}
+	if values["netbird_peers"] != 3 {
+		t.Errorf("Expected netbird_peers gauge of 3, got %v", values)
+	}
+	if values["netbird_peers_scrape_errors_total"] != 2 {
+		t.Errorf("Expected netbird_peers_scrape_errors_total sum of 2, got %v", values)
+	}
+}
+
+func testOTLPConfig(endpoint, protocol string) OTLPConfig {
+	return OTLPConfig{
+		Endpoint: endpoint,
+		Protocol: protocol,
+		Insecure: true,
+		Headers:  map[string]string{"x-api-key": "secret"},
+		Interval: time.Hour,
+		Attributes: map[string]string{
+			"netbird.account.id":  "account-1",
+			"service.instance.id": "exporter-1",
+		},
+	}
+}
+
+func TestOTLPPusher_HTTP(t *testing.T) {
+	receiver := &otlpReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	ctx := context.Background()
+	pusher, err := NewOTLPPusher(ctx, testGatherer(), testOTLPConfig(strings.TrimPrefix(server.URL, "http://"), OTLPProtocolHTTP))
+	if err != nil {
+		t.Fatalf("Failed to create OTLP pusher: %v", err)
+	}
+	defer func() { _ = pusher.Shutdown(ctx) }()
+
+	if err := pusher.ForceFlush(ctx); err != nil {
+		t.Fatalf("Failed to push metrics: %v", err)
+	}
+
+	request, headers := receiver.lastRequest(t)
+	assertExport(t, request)
+	if headers["x-api-key"] != "secret" {
+		t.Errorf("Expected x-api-key header, got %v", headers)
+	}
+}
+
+func TestOTLPPusher_GRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	receiver := &otlpReceiver{}
+	server := grpc.NewServer()
+	colmetricpb.RegisterMetricsServiceServer(server, receiver)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	ctx := context.Background()
+	pusher, err := NewOTLPPusher(ctx, testGatherer(), testOTLPConfig(listener.Addr().String(), OTLPProtocolGRPC))
+	if err != nil {
+		t.Fatalf("Failed to create OTLP pusher: %v", err)
+	}
+
+	// Shutdown pushes the metrics one last time
+	if err := pusher.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shut down OTLP pusher: %v", err)
+	}
+
+	request, headers := receiver.lastRequest(t)
+	assertExport(t, request)
+	if headers["x-api-key"] != "secret" {
+		t.Errorf("Expected x-api-key metadata, got %v", headers)
+	}
+}
+
+func TestNewOTLPPusher_InvalidConfig(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := NewOTLPPusher(ctx, testGatherer(), OTLPConfig{}); err == nil {
+		t.Error("Expected an error without endpoint")
+	}
+	if _, err := NewOTLPPusher(ctx, testGatherer(), OTLPConfig{Endpoint: "localhost:4317", Protocol: "udp"}); err == nil {
+		t.Error("Expected an error for an unsupported protocol")
+	}
+}
@@ -0,0 +1,476 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	defaultRemoteWriteInterval   = 60 * time.Second
+	defaultRemoteWriteTimeout    = 30 * time.Second
+	defaultRemoteWriteQueueSize  = 30
+	defaultRemoteWriteMaxRetries = 3
+	defaultRemoteWriteMinBackoff = time.Second
+)
+
+// RemoteWriteConfig holds the settings of the remote-write push mode
+type RemoteWriteConfig struct {
+	// URL of the remote-write endpoint, e.g. https://prometheus/api/v1/write
+	URL string
+
+	// Username and Password enable basic auth
+	Username string
+	Password string
+
+	// BearerToken enables bearer auth, it takes precedence over basic auth
+	BearerToken string
+
+	// ExternalLabels are added to every series that does not have them already
+	ExternalLabels map[string]string
+
+	// Interval between two gathers. Defaults to 60s.
+	Interval time.Duration
+
+	// Timeout of each request. Defaults to 30s.
+	Timeout time.Duration
+
+	// QueueSize is the number of gathered batches kept in memory while the
+	// endpoint is unreachable. The oldest batch is dropped when the queue is
+	// full. Defaults to 30.
+	QueueSize int
+
+	// MaxRetries is the number of retries of a failed request before the batch
+	// is left queued for the next interval. Defaults to 3, negative disables retries.
+	MaxRetries int
+
+	// MinBackoff is the wait before the first retry, doubled on every retry.
+	// Defaults to 1s.
+	MinBackoff time.Duration
+}
+
+// remoteWriteBatch is a snappy-compressed WriteRequest of a single gather
+type remoteWriteBatch struct {
+	data    []byte
+	samples int
+}
+
+// RemoteWritePusher periodically gathers metrics from Prometheus collectors and
+// pushes them to a remote-write endpoint, queueing the batches that could not be
+// sent. It is itself a prometheus.Collector exporting the push pipeline metrics.
+type RemoteWritePusher struct {
+	config   RemoteWriteConfig
+	gatherer prometheus.Gatherer
+	client   *http.Client
+
+	// mu serializes gathers and flushes of the queue
+	mu    sync.Mutex
+	queue []remoteWriteBatch
+
+	// cancel stops the periodic pushes and aborts pending retries
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Prometheus metrics
+	requestsTotal        *prometheus.CounterVec
+	samplesSentTotal     prometheus.Counter
+	samplesDroppedTotal  *prometheus.CounterVec
+	queueLength          prometheus.Gauge
+	requestDuration      prometheus.Histogram
+	lastSuccessTimestamp prometheus.Gauge
+}
+
+// errNonRetryable marks responses that will fail again when retried
+var errNonRetryable = errors.New("non-retryable remote-write response")
+
+// NewRemoteWritePusher starts pushing the metrics of gatherer to the configured
+// remote-write endpoint on every interval until Shutdown is called
+func NewRemoteWritePusher(gatherer prometheus.Gatherer, config RemoteWriteConfig) (*RemoteWritePusher, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("remote-write URL is required")
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultRemoteWriteInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultRemoteWriteTimeout
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultRemoteWriteQueueSize
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = defaultRemoteWriteMaxRetries
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultRemoteWriteMinBackoff
+	}
+
+	p := &RemoteWritePusher{
+		config:   config,
+		gatherer: gatherer,
+		client:   &http.Client{Timeout: config.Timeout},
+		done:     make(chan struct{}),
+
+		requestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_remote_write_requests_total",
+				Help: "Total number of remote-write requests by result",
+			},
+			[]string{"result"},
+		),
+
+		samplesSentTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "netbird_remote_write_samples_sent_total",
+				Help: "Total number of samples accepted by the remote-write endpoint",
+			},
+		),
+
+		samplesDroppedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "netbird_remote_write_samples_dropped_total",
+				Help: "Total number of samples dropped without being sent",
+			},
+			[]string{"reason"},
+		),
+
+		queueLength: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "netbird_remote_write_queue_length",
+				Help: "Number of gathered batches waiting to be sent",
+			},
+		),
+
+		requestDuration: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name: "netbird_remote_write_request_duration_seconds",
+				Help: "Time spent sending remote-write requests",
+			},
+		),
+
+		lastSuccessTimestamp: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "netbird_remote_write_last_success_timestamp_seconds",
+				Help: "Timestamp of the last batch accepted by the remote-write endpoint",
+			},
+		),
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"url":        config.URL,
+		"interval":   config.Interval,
+		"queue_size": config.QueueSize,
+	}).Info("Pushing metrics to remote-write endpoint")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.run(ctx)
+	return p, nil
+}
+
+// Describe implements prometheus.Collector
+func (p *RemoteWritePusher) Describe(ch chan<- *prometheus.Desc) {
+	p.requestsTotal.Describe(ch)
+	p.samplesSentTotal.Describe(ch)
+	p.samplesDroppedTotal.Describe(ch)
+	p.queueLength.Describe(ch)
+	p.requestDuration.Describe(ch)
+	p.lastSuccessTimestamp.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (p *RemoteWritePusher) Collect(ch chan<- prometheus.Metric) {
+	p.requestsTotal.Collect(ch)
+	p.samplesSentTotal.Collect(ch)
+	p.samplesDroppedTotal.Collect(ch)
+	p.queueLength.Collect(ch)
+	p.requestDuration.Collect(ch)
+	p.lastSuccessTimestamp.Collect(ch)
+}
+
+// run pushes on every interval until ctx is cancelled
+func (p *RemoteWritePusher) run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.ForceFlush(ctx); err != nil {
+				logrus.WithError(err).Error("Failed to push metrics to remote-write endpoint")
+			}
+		}
+	}
+}
+
+// ForceFlush gathers the metrics, queues them and sends every queued batch
+func (p *RemoteWritePusher) ForceFlush(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		// Gather returns what it could collect next to the error
+		logrus.WithError(err).Warn("Gathered metrics with errors")
+	}
+	data, samples := encodeWriteRequest(families, p.config.ExternalLabels, time.Now())
+	p.enqueue(remoteWriteBatch{data: snappy.Encode(nil, data), samples: samples})
+
+	return p.flush(ctx)
+}
+
+// enqueue appends a batch, dropping the oldest one when the queue is full
+func (p *RemoteWritePusher) enqueue(batch remoteWriteBatch) {
+	if len(p.queue) >= p.config.QueueSize {
+		dropped := p.queue[0]
+		p.queue = p.queue[1:]
+		p.samplesDroppedTotal.WithLabelValues("queue_full").Add(float64(dropped.samples))
+		logrus.WithField("samples", dropped.samples).Warn("Remote-write queue full, dropped the oldest batch")
+	}
+	p.queue = append(p.queue, batch)
+	p.queueLength.Set(float64(len(p.queue)))
+}
+
+// flush sends the queued batches in order. A batch that still fails after the
+// retries stays queued for the next interval.
+func (p *RemoteWritePusher) flush(ctx context.Context) error {
+	defer func() { p.queueLength.Set(float64(len(p.queue))) }()
+
+	for len(p.queue) > 0 {
+		batch := p.queue[0]
+		err := p.sendWithRetries(ctx, batch)
+		if errors.Is(err, errNonRetryable) {
+			p.queue = p.queue[1:]
+			p.samplesDroppedTotal.WithLabelValues("non_retryable").Add(float64(batch.samples))
+			logrus.WithError(err).Error("Remote-write endpoint rejected batch, dropping it")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		p.queue = p.queue[1:]
+		p.samplesSentTotal.Add(float64(batch.samples))
+		p.lastSuccessTimestamp.SetToCurrentTime()
+	}
+	return nil
+}
+
+// sendWithRetries sends a batch, retrying with exponential backoff
+func (p *RemoteWritePusher) sendWithRetries(ctx context.Context, batch remoteWriteBatch) error {
+	backoff := p.config.MinBackoff
+	for attempt := 0; ; attempt++ {
+		err := p.send(ctx, batch)
+		if err == nil {
+			p.requestsTotal.WithLabelValues("success").Inc()
+			return nil
+		}
+		if errors.Is(err, errNonRetryable) || attempt >= p.config.MaxRetries {
+			p.requestsTotal.WithLabelValues("failed").Inc()
+			return err
+		}
+
+		p.requestsTotal.WithLabelValues("retry").Inc()
+		logrus.WithError(err).WithField("backoff", backoff).Debug("Retrying remote-write request")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send posts a batch to the remote-write endpoint
+func (p *RemoteWritePusher) send(ctx context.Context, batch remoteWriteBatch) error {
+	timer := prometheus.NewTimer(p.requestDuration)
+	defer timer.ObserveDuration()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.URL, bytes.NewReader(batch.data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNonRetryable, err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "netbird-api-exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if p.config.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.config.BearerToken)
+	} else if p.config.Username != "" {
+		req.SetBasicAuth(p.config.Username, p.config.Password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logrus.WithError(err).Debug("Failed to close remote-write response body")
+		}
+	}()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote-write endpoint returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	// Server errors and rate limiting are worth retrying, other client errors are not
+	if resp.StatusCode/100 != 5 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %v", errNonRetryable, err)
+	}
+	return err
+}
+
+// Shutdown stops the periodic pushes and pushes the metrics one last time
+func (p *RemoteWritePusher) Shutdown(ctx context.Context) error {
+	p.cancel()
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.ForceFlush(ctx)
+}
+
+// remoteWriteLabel is a label of a remote-write series
+type remoteWriteLabel struct {
+	name  string
+	value string
+}
+
+// encodeWriteRequest encodes gathered metric families as a remote-write 1.0
+// WriteRequest protobuf message and returns it with the number of samples.
+// Histograms and summaries are flattened into their classic series.
+func encodeWriteRequest(families []*dto.MetricFamily, externalLabels map[string]string, now time.Time) ([]byte, int) {
+	var buf []byte
+	samples := 0
+
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.GetMetric() {
+			timestamp := now.UnixMilli()
+			if metric.TimestampMs != nil {
+				timestamp = metric.GetTimestampMs()
+			}
+			labels := metric.GetLabel()
+
+			add := func(seriesName string, value float64, extra ...remoteWriteLabel) {
+				buf = appendTimeSeries(buf, seriesLabels(seriesName, labels, externalLabels, extra...), value, timestamp)
+				samples++
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, metric.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					add(name, quantile.GetValue(), remoteWriteLabel{"quantile", formatFloat(quantile.GetQuantile())})
+				}
+				add(name+"_sum", summary.GetSampleSum())
+				add(name+"_count", float64(summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				infSeen := false
+				for _, bucket := range histogram.GetBucket() {
+					if math.IsInf(bucket.GetUpperBound(), 1) {
+						infSeen = true
+					}
+					add(name+"_bucket", float64(bucket.GetCumulativeCount()), remoteWriteLabel{"le", formatFloat(bucket.GetUpperBound())})
+				}
+				if !infSeen {
+					add(name+"_bucket", float64(histogram.GetSampleCount()), remoteWriteLabel{"le", "+Inf"})
+				}
+				add(name+"_sum", histogram.GetSampleSum())
+				add(name+"_count", float64(histogram.GetSampleCount()))
+			}
+		}
+	}
+	return buf, samples
+}
+
+// seriesLabels builds the sorted labels of a series. External labels never
+// override labels of the series.
+func seriesLabels(name string, pairs []*dto.LabelPair, externalLabels map[string]string, extra ...remoteWriteLabel) []remoteWriteLabel {
+	labels := make([]remoteWriteLabel, 0, len(pairs)+len(extra)+len(externalLabels)+1)
+	seen := make(map[string]bool, cap(labels))
+
+	labels = append(labels, remoteWriteLabel{"__name__", name})
+	seen["__name__"] = true
+	for _, pair := range pairs {
+		labels = append(labels, remoteWriteLabel{pair.GetName(), pair.GetValue()})
+		seen[pair.GetName()] = true
+	}
+	for _, label := range extra {
+		labels = append(labels, label)
+		seen[label.name] = true
+	}
+	for key, value := range externalLabels {
+		if !seen[key] {
+			labels = append(labels, remoteWriteLabel{key, value})
+		}
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels
+}
+
+// appendTimeSeries appends a single-sample TimeSeries as field 1 of a WriteRequest
+func appendTimeSeries(buf []byte, labels []remoteWriteLabel, value float64, timestamp int64) []byte {
+	var series []byte
+	for _, label := range labels {
+		var encoded []byte
+		encoded = protowire.AppendTag(encoded, 1, protowire.BytesType)
+		encoded = protowire.AppendString(encoded, label.name)
+		encoded = protowire.AppendTag(encoded, 2, protowire.BytesType)
+		encoded = protowire.AppendString(encoded, label.value)
+
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, encoded)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(timestamp))
+
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+
+	buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+	return protowire.AppendBytes(buf, series)
+}
+
+// formatFloat formats le and quantile label values the way Prometheus does
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,357 @@
+package push
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/exporters"
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
+)
+
+// remoteWriteSeries is a decoded remote-write series
+type remoteWriteSeries struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest decodes a remote-write 1.0 WriteRequest
+func decodeWriteRequest(t *testing.T, data []byte) []remoteWriteSeries {
+	t.Helper()
+
+	fields := func(b []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, varint uint64)) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				t.Fatalf("Invalid tag: %v", protowire.ParseError(n))
+			}
+			b = b[n:]
+			switch typ {
+			case protowire.BytesType:
+				value, n := protowire.ConsumeBytes(b)
+				fn(num, typ, value, 0)
+				b = b[n:]
+			case protowire.VarintType:
+				value, n := protowire.ConsumeVarint(b)
+				fn(num, typ, nil, value)
+				b = b[n:]
+			case protowire.Fixed64Type:
+				value, n := protowire.ConsumeFixed64(b)
+				fn(num, typ, nil, value)
+				b = b[n:]
+			default:
+				t.Fatalf("Unexpected wire type %v", typ)
+			}
+		}
+	}
+
+	var result []remoteWriteSeries
+	fields(data, func(_ protowire.Number, _ protowire.Type, series []byte, _ uint64) {
+		decoded := remoteWriteSeries{labels: make(map[string]string)}
+		var names []string
+		fields(series, func(num protowire.Number, _ protowire.Type, value []byte, _ uint64) {
+			switch num {
+			case 1:
+				var name, labelValue string
+				fields(value, func(num protowire.Number, _ protowire.Type, value []byte, _ uint64) {
+					if num == 1 {
+						name = string(value)
+					} else {
+						labelValue = string(value)
+					}
+				})
+				decoded.labels[name] = labelValue
+				names = append(names, name)
+			case 2:
+				fields(value, func(num protowire.Number, _ protowire.Type, _ []byte, varint uint64) {
+					if num == 1 {
+						decoded.value = math.Float64frombits(varint)
+					} else {
+						decoded.timestamp = int64(varint)
+					}
+				})
+			}
+		})
+		if !sort.StringsAreSorted(names) {
+			t.Errorf("Expected sorted labels, got %v", names)
+		}
+		result = append(result, decoded)
+	})
+	return result
+}
+
+// remoteWriteReceiver is a local remote-write endpoint stand-in that answers
+// with the queued status codes before accepting requests
+type remoteWriteReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests [][]remoteWriteSeries
+	headers  []http.Header
+	t        *testing.T
+}
+
+func (r *remoteWriteReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.requests = append(r.requests, decodeWriteRequest(r.t, data))
+	r.headers = append(r.headers, req.Header.Clone())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *remoteWriteReceiver) received() ([][]remoteWriteSeries, []http.Header) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests, r.headers
+}
+
+func newTestRemoteWritePusher(t *testing.T, url string, config RemoteWriteConfig) (*RemoteWritePusher, *prometheus.Registry) {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	peers := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "netbird_peers", Help: "Total number of NetBird peers"}, []string{})
+	peers.WithLabelValues().Set(3)
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "netbird_peers_scrape_duration_seconds", Help: "Scrape duration", Buckets: []float64{1}})
+	duration.Observe(0.5)
+	registry.MustRegister(peers, duration)
+
+	config.URL = url
+	config.Interval = time.Hour
+	config.MinBackoff = time.Millisecond
+	pusher, err := NewRemoteWritePusher(registry, config)
+	if err != nil {
+		t.Fatalf("Failed to create remote-write pusher: %v", err)
+	}
+	t.Cleanup(func() { pusher.cancel() })
+	return pusher, registry
+}
+
+func findSeries(series []remoteWriteSeries, name string, labels map[string]string) *remoteWriteSeries {
+	for i := range series {
+		if series[i].labels["__name__"] != name {
+			continue
+		}
+		matches := true
+		for key, value := range labels {
+			if series[i].labels[key] != value {
+				matches = false
+			}
+		}
+		if matches {
+			return &series[i]
+		}
+	}
+	return nil
+}
+
+func TestRemoteWritePusher_Push(t *testing.T) {
+	receiver := &remoteWriteReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	pusher, _ := newTestRemoteWritePusher(t, server.URL, RemoteWriteConfig{
+		BearerToken:    "secret",
+		ExternalLabels: map[string]string{"cluster": "customer-a", "__name__": "ignored"},
+	})
+
+	if err := pusher.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Failed to push metrics: %v", err)
+	}
+
+	requests, headers := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(requests))
+	}
+	if headers[0].Get("Authorization") != "Bearer secret" {
+		t.Errorf("Expected bearer auth, got %q", headers[0].Get("Authorization"))
+	}
+	if headers[0].Get("Content-Encoding") != "snappy" || headers[0].Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+		t.Errorf("Expected remote-write headers, got %v", headers[0])
+	}
+
+	series := requests[0]
+	peers := findSeries(series, "netbird_peers", nil)
+	if peers == nil || peers.value != 3 || peers.labels["cluster"] != "customer-a" || peers.timestamp == 0 {
+		t.Errorf("Expected netbird_peers 3 with external labels and timestamp, got %+v", peers)
+	}
+	if bucket := findSeries(series, "netbird_peers_scrape_duration_seconds_bucket", map[string]string{"le": "+Inf"}); bucket == nil || bucket.value != 1 {
+		t.Errorf("Expected +Inf histogram bucket of 1, got %+v", bucket)
+	}
+	if count := findSeries(series, "netbird_peers_scrape_duration_seconds_count", nil); count == nil || count.value != 1 {
+		t.Errorf("Expected histogram count of 1, got %+v", count)
+	}
+	if value := testutil.ToFloat64(pusher.samplesSentTotal); value != float64(len(series)) {
+		t.Errorf("Expected %d samples sent, got %f", len(series), value)
+	}
+}
+
+func TestRemoteWritePusher_BasicAuth(t *testing.T) {
+	receiver := &remoteWriteReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	pusher, _ := newTestRemoteWritePusher(t, server.URL, RemoteWriteConfig{Username: "user", Password: "pass"})
+	if err := pusher.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Failed to push metrics: %v", err)
+	}
+
+	_, headers := receiver.received()
+	if !strings.HasPrefix(headers[0].Get("Authorization"), "Basic ") {
+		t.Errorf("Expected basic auth, got %q", headers[0].Get("Authorization"))
+	}
+}
+
+func TestRemoteWritePusher_Retry(t *testing.T) {
+	receiver := &remoteWriteReceiver{t: t, statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	pusher, _ := newTestRemoteWritePusher(t, server.URL, RemoteWriteConfig{})
+	if err := pusher.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Expected push to succeed after retries: %v", err)
+	}
+
+	if value := testutil.ToFloat64(pusher.requestsTotal.WithLabelValues("retry")); value != 2 {
+		t.Errorf("Expected 2 retries, got %f", value)
+	}
+	if value := testutil.ToFloat64(pusher.requestsTotal.WithLabelValues("success")); value != 1 {
+		t.Errorf("Expected 1 successful request, got %f", value)
+	}
+}
+
+func TestRemoteWritePusher_QueueWhileUnreachable(t *testing.T) {
+	receiver := &remoteWriteReceiver{t: t, statuses: []int{500, 500, 500, 500}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	pusher, _ := newTestRemoteWritePusher(t, server.URL, RemoteWriteConfig{QueueSize: 2, MaxRetries: -1})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := pusher.ForceFlush(ctx); err == nil {
+			t.Fatal("Expected push to fail while the endpoint is down")
+		}
+	}
+	if value := testutil.ToFloat64(pusher.queueLength); value != 2 {
+		t.Errorf("Expected the queue to be bounded to 2 batches, got %f", value)
+	}
+	if value := testutil.ToFloat64(pusher.samplesDroppedTotal.WithLabelValues("queue_full")); value == 0 {
+		t.Error("Expected samples of the oldest batch to be dropped")
+	}
+
+	// The fourth failure is the last one, the queued batches are sent in order afterwards
+	_ = pusher.ForceFlush(ctx)
+	if err := pusher.ForceFlush(ctx); err != nil {
+		t.Fatalf("Expected queued batches to be sent once the endpoint is back: %v", err)
+	}
+	requests, _ := receiver.received()
+	if len(requests) != 2 {
+		t.Errorf("Expected the 2 queued batches to be sent, got %d requests", len(requests))
+	}
+	if value := testutil.ToFloat64(pusher.queueLength); value != 0 {
+		t.Errorf("Expected an empty queue, got %f", value)
+	}
+}
+
+func TestRemoteWritePusher_NonRetryable(t *testing.T) {
+	receiver := &remoteWriteReceiver{t: t, statuses: []int{http.StatusBadRequest}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	pusher, _ := newTestRemoteWritePusher(t, server.URL, RemoteWriteConfig{})
+	if err := pusher.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Expected rejected batch to be dropped without error: %v", err)
+	}
+
+	if value := testutil.ToFloat64(pusher.requestsTotal.WithLabelValues("retry")); value != 0 {
+		t.Errorf("Expected no retries of a rejected batch, got %f", value)
+	}
+	if value := testutil.ToFloat64(pusher.samplesDroppedTotal.WithLabelValues("non_retryable")); value == 0 {
+		t.Error("Expected samples of the rejected batch to be dropped")
+	}
+}
+
+func TestNewRemoteWritePusher_InvalidConfig(t *testing.T) {
+	if _, err := NewRemoteWritePusher(prometheus.NewRegistry(), RemoteWriteConfig{}); err == nil {
+		t.Error("Expected an error without URL")
+	}
+}
+
+func TestRemoteWritePusher_ExporterSharedWithScrapes(t *testing.T) {
+	receiver := &remoteWriteReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	f := fakeapi.NewFixture("example.com")
+	for _, name := range []string{"peer-1", "peer-2", "peer-3"} {
+		f.Peer(name).Connected()
+	}
+	api := httptest.NewServer(fakeapi.NewServer(f, fakeapi.Config{Token: "test-token", Latency: 5 * time.Millisecond}))
+	defer api.Close()
+
+	// The exporter is gathered for remote-write and for /metrics at once, the
+	// collections must not reset each other's metrics
+	exporter := exporters.NewNetBirdExporter(api.URL, "test-token")
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	pusher, err := NewRemoteWritePusher(registry, RemoteWriteConfig{URL: server.URL, Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create remote-write pusher: %v", err)
+	}
+	t.Cleanup(func() { pusher.cancel() })
+	scrapes := prometheus.NewRegistry()
+	scrapes.MustRegister(exporter)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := pusher.ForceFlush(context.Background()); err != nil {
+			t.Errorf("Failed to push metrics: %v", err)
+		}
+	}()
+	if _, err := scrapes.Gather(); err != nil {
+		t.Errorf("Failed to gather metrics: %v", err)
+	}
+	wg.Wait()
+
+	requests, _ := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(requests))
+	}
+	peers := 0
+	for _, series := range requests[0] {
+		if series.labels["__name__"] == "netbird_peer_info" {
+			peers++
+		}
+	}
+	if peers != 3 {
+		t.Errorf("Expected the 3 peers in the pushed metrics, got %d", peers)
+	}
+}
@@ -0,0 +1,216 @@
+// Package recording records NetBird API responses to a directory and replays
+// them to the NetBird client. Recordings are scrubbed of secrets and personal
+// data, so they can be attached to bug reports and kept as regression tests.
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/sirupsen/logrus"
+)
+
+// ManifestFile is the file describing a recording
+const ManifestFile = "recording.json"
+
+// Manifest describes a recording
+type Manifest struct {
+	// RecordedAt is the time of the last recorded response, replays use it as
+	// the clock of the time-based metrics
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// response is a recorded API response, stored in one file per path
+type response struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	// Body is the scrubbed JSON body, Text the body of non-JSON responses
+	Body json.RawMessage `json:"body,omitempty"`
+	Text string          `json:"text,omitempty"`
+}
+
+// file returns the file of an API path, e.g. users/user-1/tokens.json for
+// /api/users/user-1/tokens
+func file(dir, path string) (string, error) {
+	name := strings.Trim(strings.TrimPrefix(path, "/api/"), "/")
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `\:`) {
+			return "", fmt.Errorf("unsupported API path %q", path)
+		}
+	}
+	return filepath.Join(dir, filepath.FromSlash(name)+".json"), nil
+}
+
+// Recorder is an http.RoundTripper saving the scrubbed responses of the
+// NetBird API to a directory. Every response replaces the previous one of its
+// path. Failing to save a response is logged and does not fail the request.
+type Recorder struct {
+	dir  string
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	scrubber *scrubber
+}
+
+// NewRecorder records the responses of a transport, http.DefaultTransport when
+// nil, to a directory
+func NewRecorder(dir string, next http.RoundTripper) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{dir: dir, next: next, scrubber: newScrubber()}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.save(req.URL.Path, resp.StatusCode, body); err != nil {
+		logrus.WithError(err).WithField("path", req.URL.Path).Warn("Failed to record NetBird API response")
+	}
+	return resp, nil
+}
+
+// save scrubs a response and writes it with the manifest
+func (r *Recorder) save(path string, status int, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recorded := response{Method: http.MethodGet, Path: r.scrubber.Path(path), Status: status}
+	if scrubbed, ok := r.scrubber.Body(body); ok {
+		recorded.Body = scrubbed
+	} else {
+		recorded.Text = string(body)
+	}
+
+	name, err := file(r.dir, recorded.Path)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(name, recorded); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(r.dir, ManifestFile), Manifest{RecordedAt: time.Now().UTC().Truncate(time.Second)})
+}
+
+func writeJSON(name string, value any) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(data, '\n'), 0o644)
+}
+
+// Replayer is an http.RoundTripper serving the responses of a recording.
+// Paths that were not recorded are answered with 404 Not Found.
+type Replayer struct {
+	manifest  Manifest
+	responses map[string]response
+}
+
+// NewReplayer loads a recording
+func NewReplayer(dir string) (*Replayer, error) {
+	r := &Replayer{responses: make(map[string]response)}
+
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse recording manifest: %w", err)
+	}
+
+	err = filepath.WalkDir(dir, func(name string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(name) != ".json" || name == filepath.Join(dir, ManifestFile) {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		var recorded response
+		if err := json.Unmarshal(data, &recorded); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		r.responses[recorded.Method+" "+recorded.Path] = recorded
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recording: %w", err)
+	}
+	return r, nil
+}
+
+// Manifest returns the manifest of the recording
+func (r *Replayer) Manifest() Manifest {
+	return r.manifest
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	recorded, ok := r.responses[req.Method+" "+req.URL.Path]
+	if !ok {
+		recorded = response{Status: http.StatusNotFound}
+		recorded.Body, _ = json.Marshal(map[string]any{
+			"message": fmt.Sprintf("no recorded response for %s %s", req.Method, req.URL.Path),
+			"code":    http.StatusNotFound,
+		})
+	}
+
+	body := []byte(recorded.Text)
+	header := make(http.Header)
+	if recorded.Body != nil {
+		body = recorded.Body
+		header.Set("Content-Type", "application/json")
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Client returns a NetBird client served by the recording
+func (r *Replayer) Client() *nbclient.Client {
+	return nbclient.NewWithOptions(
+		nbclient.WithManagementURL("http://recording"),
+		nbclient.WithPAT("recording"),
+		nbclient.WithHttpClient(&http.Client{Transport: r}),
+	)
+}
@@ -0,0 +1,292 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/exporters"
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden metrics of the recordings in testdata")
+
+func TestScrubber(t *testing.T) {
+	s := newScrubber()
+	peers, ok := s.Body([]byte(`[{"id":"p1","name":"alice-laptop","hostname":"alice-laptop","dns_label":"alice-laptop.netbird.cloud",
+		"connection_ip":"203.0.113.7","city_name":"Berlin","geoname_id":2950159,"serial_number":"C02XYZ","user_id":"google-oauth2|42",
+		"groups":[{"id":"g1","name":"devs","peers_count":1}]}]`))
+	if !ok {
+		t.Fatal("Expected the peers to be scrubbed")
+	}
+	users, _ := s.Body([]byte(`[{"id":"google-oauth2|42","email":"alice@corp.example","name":"Alice","role":"admin"}]`))
+	groups, _ := s.Body([]byte(`[{"id":"g1","name":"devs","peers_count":1,"peers":[{"id":"p1","name":"alice-laptop"}]},
+		{"id":"g0","name":"All","peers_count":1}]`))
+	keys, _ := s.Body([]byte(`[{"id":"k1","key":"A616****","name":"servers"}]`))
+	events, _ := s.Body([]byte(`[{"activity_code":"user.invite","initiator_email":"alice@corp.example","initiator_name":"Alice",
+		"initiator_id":"google-oauth2|42","target_id":"google-oauth2|42","meta":{"email":"bob@corp.example"}}]`))
+
+	scrubbed := string(peers) + string(users) + string(groups) + string(keys) + string(events)
+	for _, secret := range []string{"alice", "Alice", "devs", "203.0.113.7", "Berlin", "2950159", "C02XYZ", "google-oauth2", "corp.example", "A616"} {
+		if strings.Contains(scrubbed, secret) {
+			t.Errorf("Expected %q to be scrubbed, got %s", secret, scrubbed)
+		}
+	}
+	for _, kept := range []string{`"id": "p1"`, `"name": "All"`, `"role": "admin"`, `"name": "servers"`, `"activity_code": "user.invite"`} {
+		if !strings.Contains(scrubbed, kept) {
+			t.Errorf("Expected %s to be kept, got %s", kept, scrubbed)
+		}
+	}
+
+	// References between objects keep matching
+	if strings.Count(scrubbed, `"user-1"`) != 4 || strings.Count(scrubbed, `"peer-1"`) != 3 || strings.Count(scrubbed, `"user1@example.com"`) != 2 || strings.Count(scrubbed, `"group-1"`) != 2 {
+		t.Errorf("Expected consistent pseudonyms, got %s", scrubbed)
+	}
+	if path := s.Path("/api/users/google-oauth2|42/tokens"); path != "/api/users/user-1/tokens" {
+		t.Errorf("Expected the user ID scrubbed from the path, got %s", path)
+	}
+	if _, ok := s.Body([]byte("<html>Bad Gateway</html>")); ok {
+		t.Error("Expected a non-JSON body not to be scrubbed")
+	}
+}
+
+func TestScrubber_Fields(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		secret   string
+		expected string
+	}{
+		{"peer ip", `[{"id":"p1","hostname":"laptop","ip":"100.64.0.7"}]`, "100.64.0.7", `"ip": "198.18.0.1"`},
+		{"group name", `[{"id":"g1","name":"devs","peers_count":0}]`, "devs", `"name": "group-1"`},
+		{"JWT group name", `[{"id":"g1","name":"alice@corp.example","peers_count":0,"issued":"jwt"}]`, "alice", `"name": "group-1"`},
+		{"group in a policy rule", `[{"id":"pol1","name":"x","rules":[{"bidirectional":true,"name":"x","sources":[{"id":"g1","name":"devs","peers_count":0}]}]}]`, "devs", `"name": "group-1"`},
+		{"policy name", `[{"id":"pol1","name":"alice to servers","rules":[]}]`, "alice", `"name": "policy-1"`},
+		{"policy rule name", `[{"id":"pol1","name":"p","rules":[{"bidirectional":true,"name":"alice ssh"}]}]`, "alice", `"name": "policy-2"`},
+		{"route network ID", `[{"id":"r1","network_id":"alice-home","network":"192.168.1.0/24"}]`, "alice-home", `"network_id": "route-1"`},
+		{"route network", `[{"id":"r1","network_id":"lan","network":"192.168.1.0/24"}]`, "192.168.1", `"network": "198.18.0.1/24"`},
+		{"route domains", `[{"id":"r1","network_id":"lan","domains":["corp.example"]}]`, "corp.example", `"domain-1.example.com"`},
+		{"description", `[{"id":"pol1","name":"p","description":"Alice's laptop","rules":[]}]`, "Alice", `"description": "Description 1"`},
+		{"network name", `[{"id":"n1","name":"alice-home","routing_peers_count":1}]`, "alice-home", `"name": "network-1"`},
+		{"nameserver IP", `[{"id":"ns1","name":"dns","nameservers":[{"ip":"10.10.0.53","ns_type":"udp","port":53}]}]`, "10.10.0.53", `"ip": "198.18.0.1"`},
+		{"nameserver group name", `[{"id":"ns1","name":"alice-dns","nameservers":[]}]`, "alice-dns", `"name": "nameservers-1"`},
+		{"resource name", `[{"id":"res1","name":"alice-nas","type":"host","address":"10.0.0.7"}]`, "alice-nas", `"name": "resource-1"`},
+		{"host resource address", `[{"id":"res1","name":"db","type":"host","address":"10.0.0.7"}]`, "10.0.0.7", `"address": "198.18.0.1"`},
+		{"subnet resource address", `[{"id":"res1","name":"lan","type":"subnet","address":"10.0.0.0/24"}]`, "10.0.0.0", `"address": "198.18.0.1/24"`},
+		{"domain resource address", `[{"id":"res1","name":"intranet","type":"domain","address":"*.corp.example"}]`, "corp.example", `"address": "*.domain-1.example.com"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scrubbed, ok := newScrubber().Body([]byte(tt.body))
+			if !ok {
+				t.Fatal("Expected the body to be scrubbed")
+			}
+			if strings.Contains(string(scrubbed), tt.secret) {
+				t.Errorf("Expected %q to be scrubbed, got %s", tt.secret, scrubbed)
+			}
+			if !strings.Contains(string(scrubbed), tt.expected) {
+				t.Errorf("Expected %s, got %s", tt.expected, scrubbed)
+			}
+		})
+	}
+}
+
+func TestScrubber_ConsistentNames(t *testing.T) {
+	s := newScrubber()
+	groups, _ := s.Body([]byte(`[{"id":"g1","name":"alice@corp.example","peers_count":1,"issued":"jwt"}]`))
+	peers, _ := s.Body([]byte(`[{"id":"p1","hostname":"laptop","ip":"100.64.0.7","groups":[{"id":"g1","name":"alice@corp.example","peers_count":1}]}]`))
+	resources, _ := s.Body([]byte(`[{"id":"res1","name":"vpn","type":"host","address":"100.64.0.7","groups":[{"id":"g1","name":"alice@corp.example","peers_count":1}]}]`))
+
+	scrubbed := string(groups) + string(peers) + string(resources)
+	if strings.Count(scrubbed, `"name": "group-1"`) != 3 {
+		t.Errorf("Expected the group to have the same pseudonym everywhere, got %s", scrubbed)
+	}
+	if strings.Count(scrubbed, `"198.18.0.1"`) != 2 {
+		t.Errorf("Expected an IP to have the same pseudonym as a peer and an address, got %s", scrubbed)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := fakeapi.NewServer(fakeapi.Demo(time.Now()), fakeapi.Config{Token: fakeapi.DemoToken})
+	server.InjectError("/api/setup-keys", http.StatusInternalServerError, -1)
+	api := httptest.NewServer(server)
+	defer api.Close()
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	client := nbclient.NewWithOptions(
+		nbclient.WithManagementURL(api.URL),
+		nbclient.WithPAT(fakeapi.DemoToken),
+		nbclient.WithHttpClient(&http.Client{Transport: recorder}),
+	)
+	ctx := context.Background()
+	users, err := client.Users.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list users through the recorder: %v", err)
+	}
+	if !strings.HasSuffix(users[0].Email, "@demo.example.com") {
+		t.Errorf("Expected the client to get the real response, got %s", users[0].Email)
+	}
+	if _, err := client.Tokens.List(ctx, users[0].Id); err != nil {
+		t.Fatalf("Failed to list tokens through the recorder: %v", err)
+	}
+	if _, err := client.SetupKeys.List(ctx); err == nil {
+		t.Fatal("Expected the injected error")
+	}
+
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatalf("Failed to load recording: %v", err)
+	}
+	if time.Since(replayer.Manifest().RecordedAt) > time.Minute {
+		t.Errorf("Expected the recording time in the manifest, got %v", replayer.Manifest().RecordedAt)
+	}
+	replay := replayer.Client()
+
+	replayed, err := replay.Users.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to replay users: %v", err)
+	}
+	if len(replayed) != len(users) || replayed[0].Email != "user1@example.com" || replayed[0].Role != users[0].Role {
+		t.Errorf("Expected the scrubbed users, got %+v", replayed[0])
+	}
+	if tokens, err := replay.Tokens.List(ctx, replayed[0].Id); err != nil || len(tokens) == 0 {
+		t.Errorf("Expected the tokens at the scrubbed user ID, got %v, %v", tokens, err)
+	}
+	if _, err := replay.SetupKeys.List(ctx); err == nil || err.Error() != "internal server error" {
+		t.Errorf("Expected the recorded error, got %v", err)
+	}
+	if _, err := replay.Peers.List(ctx); err == nil || !strings.Contains(err.Error(), "no recorded response for GET /api/peers") {
+		t.Errorf("Expected an error for a path that was not recorded, got %v", err)
+	}
+}
+
+// goldenConfig enables every collector the recordings can replay
+func goldenConfig(now time.Time) exporters.Config {
+	config := exporters.AllCollectorsConfig()
+	config.DNS.ProbeEnabled = false
+	config.Peers.MinSupportedVersion = "0.47.0"
+	config.Peers.StaleAfterDays = 30
+	config.Groups.TrackReferences = true
+	config.Users.DormantAfterDays = 30
+	config.Users.TrackInviteAge = true
+	config.Now = func() time.Time { return now }
+	return config
+}
+
+// metrics replays a recording and returns the /metrics output, without the
+// scrape durations
+func metrics(t *testing.T, dir string) []byte {
+	t.Helper()
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", dir, err)
+	}
+	exporter := exporters.NewNetBirdExporterWithClient(replayer.Client(), goldenConfig(replayer.Manifest().RecordedAt))
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	var buf bytes.Buffer
+	for _, family := range families {
+		if strings.HasSuffix(family.GetName(), "_scrape_duration_seconds") {
+			continue
+		}
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			t.Fatalf("Failed to encode %s: %v", family.GetName(), err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// TestGolden replays every recording in testdata and compares the metrics to
+// its golden file, so changes in how metrics are derived from real accounts are
+// caught. Add a recording with API_RECORD_DIR=pkg/recording/testdata/<name> and
+// write its golden file with go test ./pkg/recording -update.
+func TestGolden(t *testing.T) {
+	manifests, err := filepath.Glob(filepath.Join("testdata", "*", ManifestFile))
+	if err != nil || len(manifests) == 0 {
+		t.Fatalf("Expected recordings in testdata, got %v", err)
+	}
+	for _, manifest := range manifests {
+		dir := filepath.Dir(manifest)
+		name := filepath.Base(dir)
+		t.Run(name, func(t *testing.T) {
+			actual := metrics(t, dir)
+			golden := filepath.Join("testdata", name+".prom")
+			if *update {
+				if err := os.WriteFile(golden, actual, 0o644); err != nil {
+					t.Fatalf("Failed to write %s: %v", golden, err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Failed to read %s, write it with -update: %v", golden, err)
+			}
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("Replaying %s yields different metrics than %s, review the diff and rewrite it with go test ./pkg/recording -update:\n%s", dir, golden, diff(string(expected), string(actual)))
+			}
+		})
+	}
+}
+
+// diff lists the lines only in one of two outputs
+func diff(expected, actual string) string {
+	count := make(map[string]int)
+	for _, line := range strings.Split(expected, "\n") {
+		count[line]++
+	}
+	for _, line := range strings.Split(actual, "\n") {
+		count[line]--
+	}
+	var lines []string
+	for _, line := range strings.Split(expected, "\n") {
+		if count[line] > 0 {
+			lines = append(lines, "- "+line)
+		}
+	}
+	for _, line := range strings.Split(actual, "\n") {
+		if count[line] < 0 {
+			lines = append(lines, "+ "+line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestReplayer_Manifest(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewReplayer(dir); err == nil {
+		t.Error("Expected an error without a manifest")
+	}
+
+	recordedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	data, _ := json.Marshal(Manifest{RecordedAt: recordedAt})
+	if err := os.WriteFile(filepath.Join(dir, ManifestFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatalf("Failed to load an empty recording: %v", err)
+	}
+	if !replayer.Manifest().RecordedAt.Equal(recordedAt) {
+		t.Errorf("Expected %v, got %v", recordedAt, replayer.Manifest().RecordedAt)
+	}
+}
@@ -0,0 +1,246 @@
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces secrets in recorded responses
+const Redacted = "REDACTED"
+
+// allGroupName is the built-in group every peer belongs to, its name is kept as
+// the exporters recognize it
+const allGroupName = "All"
+
+// pseudonym formats of the scrubbed kinds of values. A value is replaced by the
+// same pseudonym everywhere in a recording, so the objects referring to each
+// other, e.g. peers to their user, still match.
+var pseudonymFormats = map[string]string{
+	"email":       "user%d@example.com",
+	"person":      "User %d",
+	"user_id":     "user-%d",
+	"peer":        "peer-%d",
+	"dns_label":   "peer-%d.example.com",
+	"ip":          "198.18.%d.%d",
+	"city":        "City %d",
+	"serial":      "serial-%d",
+	"domain":      "domain-%d.example.com",
+	"meta":        "meta-%d",
+	"group":       "group-%d",
+	"policy":      "policy-%d",
+	"route":       "route-%d",
+	"network":     "network-%d",
+	"resource":    "resource-%d",
+	"nameservers": "nameservers-%d",
+	"description": "Description %d",
+}
+
+// scrubber replaces secrets and personal data in API responses
+type scrubber struct {
+	pseudonyms map[string]map[string]string
+}
+
+func newScrubber() *scrubber {
+	return &scrubber{pseudonyms: make(map[string]map[string]string)}
+}
+
+// pseudonym returns the replacement of a value, empty values are kept
+func (s *scrubber) pseudonym(kind, value string) string {
+	if value == "" {
+		return value
+	}
+	values, ok := s.pseudonyms[kind]
+	if !ok {
+		values = make(map[string]string)
+		s.pseudonyms[kind] = values
+	}
+	if pseudonym, ok := values[value]; ok {
+		return pseudonym
+	}
+	n := len(values) + 1
+	pseudonym := fmt.Sprintf(pseudonymFormats[kind], n)
+	if kind == "ip" {
+		pseudonym = fmt.Sprintf(pseudonymFormats[kind], n/256, n%256)
+	}
+	values[value] = pseudonym
+	return pseudonym
+}
+
+// known returns the pseudonym of a value already scrubbed as a kind
+func (s *scrubber) known(kind, value string) (string, bool) {
+	pseudonym, ok := s.pseudonyms[kind][value]
+	return pseudonym, ok
+}
+
+// Path scrubs the user IDs in an API path, e.g. /api/users/{id}/tokens
+func (s *scrubber) Path(path string) string {
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		if parts[i-1] == "users" && parts[i] != "current" {
+			parts[i] = s.pseudonym("user_id", parts[i])
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Body scrubs a JSON response body and indents it, bodies that are not JSON
+// are returned as they are with ok false
+func (s *scrubber) Body(body []byte) (scrubbed json.RawMessage, ok bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+	scrubbed, err := json.MarshalIndent(s.value("", value), "", "  ")
+	if err != nil {
+		return nil, false
+	}
+	return scrubbed, true
+}
+
+// value scrubs a JSON value, the key is the field holding it
+func (s *scrubber) value(key string, value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		s.object(key, v)
+	case []any:
+		for i := range v {
+			v[i] = s.value(key, v[i])
+		}
+	}
+	return value
+}
+
+// object scrubs the fields of an API object, which are recognized by the
+// fields they have or, for the peers of a group and the nameservers of a
+// nameserver group, the field holding them. The fields are scrubbed in order so
+// pseudonyms do not depend on map iteration.
+func (s *scrubber) object(parent string, object map[string]any) {
+	_, user := object["email"]
+	_, peer := object["hostname"]
+	peer = peer || parent == "peers"
+	_, account := object["domain_category"]
+	_, event := object["activity_code"]
+	_, nameserverGroup := object["nameservers"]
+	nameserver := parent == "nameservers"
+	_, group := object["peers_count"]
+	_, policy := object["rules"]
+	_, rule := object["bidirectional"]
+	_, route := object["network_id"]
+	_, network := object["routing_peers_count"]
+	_, resource := object["address"]
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := object[key]
+		str, isString := value.(string)
+		switch {
+		case key == "key" && isString && str != "":
+			object[key] = Redacted
+		case key == "user_id" || key == "created_by" || key == "initiator_id":
+			object[key] = s.scrubString("user_id", value)
+		case user && key == "id":
+			object[key] = s.scrubString("user_id", value)
+		case user && key == "email", event && key == "initiator_email":
+			object[key] = s.scrubString("email", value)
+		case user && key == "name", event && key == "initiator_name":
+			object[key] = s.scrubString("person", value)
+		case peer && (key == "name" || key == "hostname"):
+			object[key] = s.scrubString("peer", value)
+		case peer && (key == "dns_label" || key == "extra_dns_labels"):
+			object[key] = s.scrubStrings("dns_label", value)
+		case peer && (key == "ip" || key == "connection_ip"):
+			object[key] = s.scrubString("ip", value)
+		case peer && key == "city_name":
+			object[key] = s.scrubString("city", value)
+		case peer && key == "serial_number":
+			object[key] = s.scrubString("serial", value)
+		case peer && key == "geoname_id":
+			object[key] = json.Number("0")
+		case account && key == "domain" && isString && str != "":
+			object[key] = "example.com"
+		case nameserverGroup && key == "domains", route && key == "domains":
+			object[key] = s.scrubStrings("domain", value)
+		case key == "description":
+			object[key] = s.scrubString("description", value)
+		case group && key == "name" && str != allGroupName:
+			// Groups synced from JWT claims are often named after people
+			object[key] = s.scrubString("group", value)
+		case (policy || rule) && key == "name":
+			object[key] = s.scrubString("policy", value)
+		case route && key == "network_id":
+			object[key] = s.scrubString("route", value)
+		case network && key == "name":
+			object[key] = s.scrubString("network", value)
+		case nameserverGroup && key == "name":
+			object[key] = s.scrubString("nameservers", value)
+		case resource && key == "name":
+			object[key] = s.scrubString("resource", value)
+		case resource && key == "address", route && key == "network", nameserver && key == "ip":
+			object[key] = s.scrubAddress(value)
+		case event && key == "target_id" && isString:
+			// Targets are users, peers or other objects, only the users are known
+			if pseudonym, ok := s.known("user_id", str); ok {
+				object[key] = pseudonym
+			}
+		case event && key == "meta":
+			if meta, ok := value.(map[string]any); ok {
+				names := make([]string, 0, len(meta))
+				for name := range meta {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					meta[name] = s.scrubString("meta", meta[name])
+				}
+			}
+		default:
+			object[key] = s.value(key, value)
+		}
+	}
+}
+
+func (s *scrubber) scrubString(kind string, value any) any {
+	if str, ok := value.(string); ok {
+		return s.pseudonym(kind, str)
+	}
+	return value
+}
+
+// scrubAddress replaces an IP, a prefix or a domain, e.g. *.corp.example, by a
+// pseudonym of the same form
+func (s *scrubber) scrubAddress(value any) any {
+	str, ok := value.(string)
+	if !ok || str == "" {
+		return value
+	}
+	if prefix, err := netip.ParsePrefix(str); err == nil {
+		return fmt.Sprintf("%s/%d", s.pseudonym("ip", prefix.Addr().String()), prefix.Bits())
+	}
+	if _, err := netip.ParseAddr(str); err == nil {
+		return s.pseudonym("ip", str)
+	}
+	if domain, ok := strings.CutPrefix(str, "*."); ok {
+		return "*." + s.pseudonym("domain", domain)
+	}
+	return s.pseudonym("domain", str)
+}
+
+func (s *scrubber) scrubStrings(kind string, value any) any {
+	if values, ok := value.([]any); ok {
+		for i := range values {
+			values[i] = s.scrubString(kind, values[i])
+		}
+		return values
+	}
+	return s.scrubString(kind, value)
+}
@@ -0,0 +1,53 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// helmEscaper turns template delimiters into Helm actions printing them
+var helmEscaper = strings.NewReplacer("{{", `{{"{{"}}`, "}}", `{{"}}"}}`)
+
+// escapeHelm makes Helm render a string unchanged
+func escapeHelm(s string) string {
+	return helmEscaper.Replace(s)
+}
+
+// quote renders a YAML single-quoted string
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// formatFloat renders a threshold without trailing zeros
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// formatSeconds renders a duration as a number of seconds
+func formatSeconds(d time.Duration) string {
+	return formatFloat(d.Seconds())
+}
+
+// formatDuration renders a duration in the Prometheus duration syntax
+func formatDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", int64(d.Seconds()))
+	}
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,390 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Output formats
+const (
+	// FormatRules is a Prometheus rules file, e.g. rules.yml
+	FormatRules = "rules"
+
+	// FormatPrometheusRule is a Prometheus Operator PrometheusRule resource
+	FormatPrometheusRule = "prometheusrule"
+
+	// FormatHelm is the PrometheusRule template shipped with the Helm chart
+	FormatHelm = "helm"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{FormatRules, FormatPrometheusRule, FormatHelm}
+
+// helmJob is the job label of the exporter scraped through the chart ServiceMonitor
+const helmJob = `{{ include "netbird-api-exporter.fullname" . }}`
+
+const (
+	defaultName                   = "netbird-api-exporter"
+	defaultJob                    = "netbird-api-exporter"
+	defaultScrapeErrorsThreshold  = 3
+	defaultDisconnectedRatio      = 0.5
+	defaultSetupKeyExpiryWarning  = 7 * 24 * time.Hour
+	defaultTokenExpiryWarning     = 14 * 24 * time.Hour
+	defaultDNSProbeFailureFor     = 10 * time.Minute
+	defaultDisconnectedRatioFor   = 15 * time.Minute
+	defaultNetworkNoRoutersFor    = 5 * time.Minute
+	scrapeErrorsRecordingInterval = "15m"
+)
+
+// Config selects the rules and their thresholds
+type Config struct {
+	// Job restricts the rules to the series of this scrape job. Defaults to
+	// netbird-api-exporter, the rules never match every job as up would then
+	// alert on every target.
+	Job string
+
+	// Name and Namespace of the PrometheusRule resource. Name defaults to
+	// netbird-api-exporter.
+	Name      string
+	Namespace string
+
+	// Optional collectors, each one adds the rules on its metrics
+	SetupKeys      bool
+	TokenExpiry    bool
+	NetworkDetails bool
+	DNSProbe       bool
+
+	// ScrapeErrorsThreshold is the number of scrape errors over 15 minutes
+	// alerted on. Defaults to 3.
+	ScrapeErrorsThreshold float64
+
+	// DisconnectedRatio is the ratio of disconnected peers alerted on.
+	// Defaults to 0.5.
+	DisconnectedRatio float64
+
+	// SetupKeyExpiryWarning is how long before its expiry a setup key is
+	// alerted on. Defaults to 7 days.
+	SetupKeyExpiryWarning time.Duration
+
+	// TokenExpiryWarning is how long before its expiry the API token is
+	// alerted on. Defaults to 14 days.
+	TokenExpiryWarning time.Duration
+}
+
+// Optional collectors, named after their prometheusRule.collectors chart value
+const (
+	collectorSetupKeys      = "setupKeys"
+	collectorTokenExpiry    = "tokenExpiry"
+	collectorNetworkDetails = "networkDetails"
+	collectorDNSProbe       = "dnsProbe"
+)
+
+// Rule is an alerting rule or a recording rule
+type Rule struct {
+	Record      string
+	Alert       string
+	Expr        string
+	For         time.Duration
+	Labels      map[string]string
+	Annotations map[string]string
+
+	// collector is the optional collector producing the metrics of the rule,
+	// empty for the rules on the metrics always produced
+	collector string
+}
+
+// Group is a named group of rules
+type Group struct {
+	Name  string
+	Rules []Rule
+}
+
+// ValidateFormat checks that format is one of Formats
+func ValidateFormat(format string) error {
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// withDefaults fills the unset thresholds
+func (c Config) withDefaults() Config {
+	if c.Name == "" {
+		c.Name = defaultName
+	}
+	if c.Job == "" {
+		c.Job = defaultJob
+	}
+	if c.ScrapeErrorsThreshold <= 0 {
+		c.ScrapeErrorsThreshold = defaultScrapeErrorsThreshold
+	}
+	if c.DisconnectedRatio <= 0 {
+		c.DisconnectedRatio = defaultDisconnectedRatio
+	}
+	if c.SetupKeyExpiryWarning <= 0 {
+		c.SetupKeyExpiryWarning = defaultSetupKeyExpiryWarning
+	}
+	if c.TokenExpiryWarning <= 0 {
+		c.TokenExpiryWarning = defaultTokenExpiryWarning
+	}
+	return c
+}
+
+// thresholds are the rendered thresholds of the alerting rules
+type thresholds struct {
+	scrapeErrors      string
+	disconnectedRatio string
+	setupKeyExpiry    string
+	tokenExpiry       string
+}
+
+// helmThresholds reads the thresholds from the prometheusRule chart values.
+// The expiries are cast to integers, Helm would render large numbers in
+// scientific notation.
+var helmThresholds = thresholds{
+	scrapeErrors:      "{{ .Values.prometheusRule.scrapeErrorsThreshold }}",
+	disconnectedRatio: "{{ .Values.prometheusRule.disconnectedRatio }}",
+	setupKeyExpiry:    "{{ .Values.prometheusRule.setupKeyExpiryWarningSeconds | int64 }}",
+	tokenExpiry:       "{{ .Values.prometheusRule.tokenExpiryWarningSeconds | int64 }}",
+}
+
+// thresholds renders the thresholds of the config
+func (c Config) thresholds() thresholds {
+	return thresholds{
+		scrapeErrors:      formatFloat(c.ScrapeErrorsThreshold),
+		disconnectedRatio: formatFloat(c.DisconnectedRatio),
+		setupKeyExpiry:    formatSeconds(c.SetupKeyExpiryWarning),
+		tokenExpiry:       formatSeconds(c.TokenExpiryWarning),
+	}
+}
+
+// Groups returns the rule groups of the enabled collectors
+func Groups(config Config) []Group {
+	config = config.withDefaults()
+	return groups(config, config.thresholds())
+}
+
+// groups returns the rule groups of the enabled collectors with the given
+// thresholds
+func groups(config Config, thresholds thresholds) []Group {
+	selector := fmt.Sprintf(`job="%s"`, config.Job)
+	// sel renders a label selector, adding the job matcher to the given ones
+	sel := func(matchers ...string) string {
+		return "{" + strings.Join(append([]string{selector}, matchers...), ",") + "}"
+	}
+
+	recording := Group{
+		Name: "netbird-api-exporter.recording",
+		Rules: []Rule{
+			{
+				Record: "netbird:peers_disconnected:ratio",
+				Expr: fmt.Sprintf(`sum by (job, instance) (netbird_peers_connected%s) / (sum by (job, instance) (netbird_peers%s) > 0)`,
+					sel(`connected="false"`), sel()),
+			},
+			{
+				Record: "netbird:scrape_errors:increase" + scrapeErrorsRecordingInterval,
+				Expr: fmt.Sprintf(`sum by (job, instance, error_type) (increase(%s[%s]))`,
+					sel(`__name__=~"netbird_.+_scrape_errors_total"`), scrapeErrorsRecordingInterval),
+			},
+		},
+	}
+
+	alerts := Group{
+		Name: "netbird-api-exporter.alerts",
+		Rules: []Rule{
+			{
+				Alert:  "NetBirdExporterDown",
+				Expr:   fmt.Sprintf(`up%s == 0`, sel()),
+				For:    5 * time.Minute,
+				Labels: map[string]string{"severity": "critical"},
+				Annotations: map[string]string{
+					"summary":     "NetBird API exporter is down",
+					"description": "Prometheus failed to scrape the exporter {{ $labels.instance }} for 5 minutes.",
+				},
+			},
+			{
+				Alert:  "NetBirdAPIDown",
+				Expr:   fmt.Sprintf(`up%s == 1 unless on (job, instance) netbird_peers`, sel()),
+				For:    5 * time.Minute,
+				Labels: map[string]string{"severity": "critical"},
+				Annotations: map[string]string{
+					"summary":     "NetBird API is unreachable",
+					"description": "The exporter {{ $labels.instance }} has not been able to fetch peers from the NetBird API for 5 minutes.",
+				},
+			},
+			{
+				Alert:  "NetBirdScrapeErrors",
+				Expr:   fmt.Sprintf(`netbird:scrape_errors:increase%s%s >= %s`, scrapeErrorsRecordingInterval, sel(), thresholds.scrapeErrors),
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary":     "NetBird API scrape errors are rising",
+					"description": "The exporter {{ $labels.instance }} hit {{ $value }} {{ $labels.error_type }} errors over the last " + scrapeErrorsRecordingInterval + ".",
+				},
+			},
+			{
+				Alert:  "NetBirdPeersDisconnectedRatioHigh",
+				Expr:   fmt.Sprintf(`netbird:peers_disconnected:ratio%s > %s`, sel(), thresholds.disconnectedRatio),
+				For:    defaultDisconnectedRatioFor,
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary":     "Many NetBird peers are disconnected",
+					"description": "{{ $value | humanizePercentage }} of the NetBird peers are disconnected.",
+				},
+			},
+		},
+	}
+
+	if config.SetupKeys {
+		alerts.Rules = append(alerts.Rules, Rule{
+			Alert:  "NetBirdSetupKeyExpiring",
+			Expr:   fmt.Sprintf(`netbird_setup_key_expires_in_seconds%s < %s`, sel(), thresholds.setupKeyExpiry),
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "NetBird setup key is expiring",
+				"description": "The setup key {{ $labels.key_name }} expires in {{ $value | humanizeDuration }}.",
+			},
+			collector: collectorSetupKeys,
+		})
+	}
+	if config.TokenExpiry {
+		alerts.Rules = append(alerts.Rules, Rule{
+			Alert:  "NetBirdAPITokenExpiring",
+			Expr:   fmt.Sprintf(`netbird_user_token_expires_in_seconds%s < %s`, sel(), thresholds.tokenExpiry),
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "NetBird API token is expiring",
+				"description": "The token {{ $labels.token_name }} of {{ $labels.user_email }} expires in {{ $value | humanizeDuration }}.",
+			},
+			collector: collectorTokenExpiry,
+		})
+	}
+	if config.NetworkDetails {
+		alerts.Rules = append(alerts.Rules, Rule{
+			Alert: "NetBirdNetworkNoRoutersOnline",
+			Expr: fmt.Sprintf(`netbird_network_ha_routers_online%s == 0 and on (job, instance, network_id) netbird_network_ha_routers_total%s > 0`,
+				sel(), sel()),
+			For:    defaultNetworkNoRoutersFor,
+			Labels: map[string]string{"severity": "critical"},
+			Annotations: map[string]string{
+				"summary":     "NetBird network has no online router",
+				"description": "None of the routers of the network {{ $labels.network_name }} is online, its resources are unreachable.",
+			},
+			collector: collectorNetworkDetails,
+		})
+	}
+	if config.DNSProbe {
+		alerts.Rules = append(alerts.Rules, Rule{
+			Alert:  "NetBirdNameserverProbeFailing",
+			Expr:   fmt.Sprintf(`netbird_dns_probe_success%s == 0`, sel()),
+			For:    defaultDNSProbeFailureFor,
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "NetBird nameserver is not answering",
+				"description": "The nameserver {{ $labels.ip }}:{{ $labels.port }} of {{ $labels.group_name }} failed to answer {{ $labels.query }}.",
+			},
+			collector: collectorDNSProbe,
+		})
+	}
+
+	return []Group{recording, alerts}
+}
+
+// Generate renders the rule groups of the enabled collectors in a format. The
+// helm format covers every collector, the rules of the optional ones are only
+// rendered when enabled in the prometheusRule.collectors chart value, and takes
+// the thresholds from the prometheusRule chart values.
+func Generate(config Config, format string) ([]byte, error) {
+	if err := ValidateFormat(format); err != nil {
+		return nil, err
+	}
+	config = config.withDefaults()
+	if format == FormatHelm {
+		config.Job = helmJob
+		config.SetupKeys = true
+		config.TokenExpiry = true
+		config.NetworkDetails = true
+		config.DNSProbe = true
+	}
+
+	var b strings.Builder
+	switch format {
+	case FormatRules:
+		writeGroups(&b, Groups(config), "", false)
+	case FormatPrometheusRule:
+		b.WriteString("apiVersion: monitoring.coreos.com/v1\nkind: PrometheusRule\nmetadata:\n")
+		fmt.Fprintf(&b, "  name: %s\n", quote(config.Name))
+		if config.Namespace != "" {
+			fmt.Fprintf(&b, "  namespace: %s\n", quote(config.Namespace))
+		}
+		b.WriteString("spec:\n")
+		writeGroups(&b, Groups(config), "  ", false)
+	case FormatHelm:
+		b.WriteString(helmHeader)
+		writeGroups(&b, groups(config, helmThresholds), "  ", true)
+		b.WriteString("{{- end }}\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// helmHeader opens the chart template, generated by the rules command
+const helmHeader = `# Code generated by "netbird-api-exporter rules -format helm". DO NOT EDIT.
+{{- if .Values.prometheusRule.enabled }}
+apiVersion: monitoring.coreos.com/v1
+kind: PrometheusRule
+metadata:
+  name: {{ include "netbird-api-exporter.fullname" . }}
+  labels:
+    {{- include "netbird-api-exporter.labels" . | nindent 4 }}
+    {{- with .Values.prometheusRule.additionalLabels }}
+    {{- toYaml . | nindent 4 }}
+    {{- end }}
+spec:
+`
+
+// writeGroups renders the groups as YAML. Helm templates escape the template
+// actions of the annotations so Prometheus gets them verbatim, and render the
+// rules of optional collectors only when the chart enables them.
+func writeGroups(b *strings.Builder, groups []Group, indent string, helm bool) {
+	fmt.Fprintf(b, "%sgroups:\n", indent)
+	for _, group := range groups {
+		fmt.Fprintf(b, "%s  - name: %s\n", indent, quote(group.Name))
+		fmt.Fprintf(b, "%s    rules:\n", indent)
+		for _, rule := range group.Rules {
+			if helm && rule.collector != "" {
+				fmt.Fprintf(b, "%s      {{- if .Values.prometheusRule.collectors.%s }}\n", indent, rule.collector)
+			}
+			if rule.Record != "" {
+				fmt.Fprintf(b, "%s      - record: %s\n", indent, rule.Record)
+			} else {
+				fmt.Fprintf(b, "%s      - alert: %s\n", indent, rule.Alert)
+			}
+			fmt.Fprintf(b, "%s        expr: |-\n%s          %s\n", indent, indent, rule.Expr)
+			if rule.For > 0 {
+				fmt.Fprintf(b, "%s        for: %s\n", indent, formatDuration(rule.For))
+			}
+			writeMap(b, indent+"        ", "labels", rule.Labels, false)
+			writeMap(b, indent+"        ", "annotations", rule.Annotations, helm)
+			if helm && rule.collector != "" {
+				fmt.Fprintf(b, "%s      {{- end }}\n", indent)
+			}
+		}
+	}
+}
+
+// writeMap renders a string map with sorted keys
+func writeMap(b *strings.Builder, indent, name string, values map[string]string, helm bool) {
+	if len(values) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s%s:\n", indent, name)
+	for _, key := range sortedKeys(values) {
+		value := values[key]
+		if helm {
+			value = escapeHelm(value)
+		}
+		fmt.Fprintf(b, "%s  %s: %s\n", indent, key, quote(value))
+	}
+}
@@ -0,0 +1,274 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/exporters"
+)
+
+// allCollectors enables every optional collector
+var allCollectors = Config{SetupKeys: true, TokenExpiry: true, NetworkDetails: true, DNSProbe: true}
+
+func alertNames(groups []Group) map[string]Rule {
+	alerts := make(map[string]Rule)
+	for _, group := range groups {
+		for _, rule := range group.Rules {
+			if rule.Alert != "" {
+				alerts[rule.Alert] = rule
+			}
+		}
+	}
+	return alerts
+}
+
+func TestGroups_EnabledCollectors(t *testing.T) {
+	core := []string{"NetBirdExporterDown", "NetBirdAPIDown", "NetBirdScrapeErrors", "NetBirdPeersDisconnectedRatioHigh"}
+	optional := []string{"NetBirdSetupKeyExpiring", "NetBirdAPITokenExpiring", "NetBirdNetworkNoRoutersOnline", "NetBirdNameserverProbeFailing"}
+
+	alerts := alertNames(Groups(Config{}))
+	if len(alerts) != len(core) {
+		t.Errorf("Expected only the core alerts by default, got %v", alerts)
+	}
+	for _, name := range core {
+		if _, ok := alerts[name]; !ok {
+			t.Errorf("Expected %s by default", name)
+		}
+	}
+
+	alerts = alertNames(Groups(allCollectors))
+	for _, name := range append(core, optional...) {
+		if _, ok := alerts[name]; !ok {
+			t.Errorf("Expected %s with every collector enabled", name)
+		}
+	}
+}
+
+func TestGroups_EmptyJob(t *testing.T) {
+	for _, group := range Groups(Config{Job: ""}) {
+		for _, rule := range group.Rules {
+			if !strings.Contains(rule.Expr, `job="netbird-api-exporter"`) {
+				t.Errorf("Expected %s%s to select the default job, got %s", rule.Alert, rule.Record, rule.Expr)
+			}
+		}
+	}
+}
+
+func TestGroups_Thresholds(t *testing.T) {
+	config := allCollectors
+	config.Job = "netbird"
+	config.ScrapeErrorsThreshold = 10
+	config.DisconnectedRatio = 0.25
+	config.SetupKeyExpiryWarning = 48 * time.Hour
+	config.TokenExpiryWarning = 24 * time.Hour
+	alerts := alertNames(Groups(config))
+
+	expected := map[string]string{
+		"NetBirdScrapeErrors":               `netbird:scrape_errors:increase15m{job="netbird"} >= 10`,
+		"NetBirdPeersDisconnectedRatioHigh": `netbird:peers_disconnected:ratio{job="netbird"} > 0.25`,
+		"NetBirdSetupKeyExpiring":           `netbird_setup_key_expires_in_seconds{job="netbird"} < 172800`,
+		"NetBirdAPITokenExpiring":           `netbird_user_token_expires_in_seconds{job="netbird"} < 86400`,
+	}
+	for name, expr := range expected {
+		if alerts[name].Expr != expr {
+			t.Errorf("Expected %s expr %q, got %q", name, expr, alerts[name].Expr)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	if _, err := Generate(Config{}, "json"); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+
+	rules, err := Generate(Config{Job: "netbird"}, FormatRules)
+	if err != nil {
+		t.Fatalf("Failed to generate rules: %v", err)
+	}
+	if !strings.HasPrefix(string(rules), "groups:\n") {
+		t.Errorf("Expected a rules file, got %s", rules)
+	}
+	if !strings.Contains(string(rules), "'Prometheus failed to scrape the exporter {{ $labels.instance }} for 5 minutes.'") {
+		t.Errorf("Expected unescaped annotations, got %s", rules)
+	}
+
+	resource, err := Generate(Config{Namespace: "monitoring"}, FormatPrometheusRule)
+	if err != nil {
+		t.Fatalf("Failed to generate PrometheusRule: %v", err)
+	}
+	for _, expected := range []string{"kind: PrometheusRule\n", "  name: 'netbird-api-exporter'\n", "  namespace: 'monitoring'\n", "spec:\n  groups:\n"} {
+		if !strings.Contains(string(resource), expected) {
+			t.Errorf("Expected %q in the PrometheusRule, got %s", expected, resource)
+		}
+	}
+}
+
+// TestRules_MetricsExist guards against rules drifting from the metric names
+// the exporter actually produces
+func TestRules_MetricsExist(t *testing.T) {
+	exporter := exporters.NewNetBirdExporterWithConfig("http://localhost", "test-token", exporters.AllCollectorsConfig())
+
+	metrics, err := exporters.Metrics(exporter)
+	if err != nil {
+		t.Fatalf("Failed to describe the metrics: %v", err)
+	}
+	described := make(map[string]bool)
+	for _, metric := range metrics {
+		described[metric.Name] = true
+	}
+
+	metric := regexp.MustCompile(`\bnetbird_[a-z0-9_]*[a-z0-9]\b`)
+	scrapeErrors := regexp.MustCompile(`^netbird_.+_scrape_errors_total$`)
+	for _, group := range Groups(allCollectors) {
+		for _, rule := range group.Rules {
+			expr := strings.ReplaceAll(rule.Expr, `"netbird_.+_scrape_errors_total"`, "")
+			for _, name := range metric.FindAllString(expr, -1) {
+				if !described[name] {
+					t.Errorf("Rule %s%s uses %s, which the exporter does not produce", rule.Alert, rule.Record, name)
+				}
+			}
+		}
+	}
+
+	matched := 0
+	for name := range described {
+		if scrapeErrors.MatchString(name) {
+			matched++
+		}
+	}
+	if matched < 5 {
+		t.Errorf("Expected the scrape errors recording rule to match every collector, got %d metrics", matched)
+	}
+}
+
+// TestHelmChartRules fails when the chart template is not regenerated after
+// changing the rules
+func TestHelmChartRules(t *testing.T) {
+	expected, err := Generate(Config{}, FormatHelm)
+	if err != nil {
+		t.Fatalf("Failed to generate chart rules: %v", err)
+	}
+	path := filepath.Join("charts", "netbird-api-exporter", "templates", "prometheusrule.yaml")
+	actual, err := os.ReadFile(filepath.Join("..", "..", path))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	if string(actual) != string(expected) {
+		t.Errorf("%s is out of date, regenerate it from the repository root with: go run . rules -format helm -output %s", path, path)
+	}
+}
+
+// renderHelm renders the chart rules with the given prometheusRule values over
+// the chart thresholds, stubbing the chart helpers
+func renderHelm(t *testing.T, overrides map[string]any) string {
+	t.Helper()
+	chart, err := Generate(Config{}, FormatHelm)
+	if err != nil {
+		t.Fatalf("Failed to generate chart rules: %v", err)
+	}
+	funcs := template.FuncMap{
+		"include": func(name string, _ any) string { return "netbird" },
+		"nindent": func(_ int, s string) string { return s },
+		"toYaml":  func(any) string { return "" },
+		"int64":   func(v float64) int64 { return int64(v) },
+	}
+	tmpl, err := template.New("prometheusrule").Funcs(funcs).Parse(string(chart))
+	if err != nil {
+		t.Fatalf("Failed to parse chart rules: %v", err)
+	}
+	prometheusRule := chartThresholds(t)
+	for key, value := range overrides {
+		prometheusRule[key] = value
+	}
+	prometheusRule["enabled"] = true
+	var b strings.Builder
+	if err := tmpl.Execute(&b, map[string]any{"Values": map[string]any{"prometheusRule": prometheusRule}}); err != nil {
+		t.Fatalf("Failed to render chart rules: %v", err)
+	}
+	return b.String()
+}
+
+// chartThresholds are the threshold values of the chart, parsed the way Helm
+// parses numbers
+func chartThresholds(t *testing.T) map[string]any {
+	t.Helper()
+	values, err := os.ReadFile(filepath.Join("..", "..", "charts", "netbird-api-exporter", "values.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read the chart values: %v", err)
+	}
+	thresholds := make(map[string]any)
+	for _, key := range []string{"scrapeErrorsThreshold", "disconnectedRatio", "setupKeyExpiryWarningSeconds", "tokenExpiryWarningSeconds"} {
+		match := regexp.MustCompile(`(?m)^  ` + key + `: ([0-9.]+)$`).FindSubmatch(values)
+		if match == nil {
+			t.Fatalf("Expected prometheusRule.%s in the chart values", key)
+		}
+		value, err := strconv.ParseFloat(string(match[1]), 64)
+		if err != nil {
+			t.Fatalf("Failed to parse prometheusRule.%s: %v", key, err)
+		}
+		thresholds[key] = value
+	}
+	return thresholds
+}
+
+func TestHelmChartRules_Thresholds(t *testing.T) {
+	// The chart defaults render the same expressions as the RULES_* defaults
+	config := allCollectors
+	config.Job = "netbird"
+	expected := alertNames(Groups(config))
+
+	rendered := renderHelm(t, map[string]any{"collectors": map[string]any{"setupKeys": true, "tokenExpiry": true}})
+	for _, name := range []string{"NetBirdScrapeErrors", "NetBirdPeersDisconnectedRatioHigh", "NetBirdSetupKeyExpiring", "NetBirdAPITokenExpiring"} {
+		if !strings.Contains(rendered, "\n            "+expected[name].Expr+"\n") {
+			t.Errorf("Expected the chart defaults to render %s as %q, got %s", name, expected[name].Expr, rendered)
+		}
+	}
+
+	// Custom thresholds
+	rendered = renderHelm(t, map[string]any{
+		"scrapeErrorsThreshold":        float64(10),
+		"disconnectedRatio":            0.25,
+		"setupKeyExpiryWarningSeconds": float64(172800),
+		"tokenExpiryWarningSeconds":    float64(2592000),
+		"collectors":                   map[string]any{"setupKeys": true, "tokenExpiry": true},
+	})
+	for _, expr := range []string{
+		`netbird:scrape_errors:increase15m{job="netbird"} >= 10`,
+		`netbird:peers_disconnected:ratio{job="netbird"} > 0.25`,
+		`netbird_setup_key_expires_in_seconds{job="netbird"} < 172800`,
+		`netbird_user_token_expires_in_seconds{job="netbird"} < 2592000`,
+	} {
+		if !strings.Contains(rendered, expr) {
+			t.Errorf("Expected %q in the chart rules, got %s", expr, rendered)
+		}
+	}
+}
+
+func TestHelmChartRules_Collectors(t *testing.T) {
+	optional := []string{"NetBirdSetupKeyExpiring", "NetBirdAPITokenExpiring", "NetBirdNetworkNoRoutersOnline", "NetBirdNameserverProbeFailing"}
+
+	rendered := renderHelm(t, map[string]any{"collectors": map[string]any{}})
+	if !strings.Contains(rendered, "alert: NetBirdPeersDisconnectedRatioHigh\n") {
+		t.Errorf("Expected the core rules, got %s", rendered)
+	}
+	for _, name := range optional {
+		if strings.Contains(rendered, name) {
+			t.Errorf("Expected no %s rule without its collector, got %s", name, rendered)
+		}
+	}
+
+	rendered = renderHelm(t, map[string]any{"collectors": map[string]any{
+		"setupKeys": true, "tokenExpiry": true, "networkDetails": true, "dnsProbe": true,
+	}})
+	for _, name := range optional {
+		if !strings.Contains(rendered, "        - alert: "+name+"\n") {
+			t.Errorf("Expected the %s rule with its collector enabled, got %s", name, rendered)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package snapshot
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/sirupsen/logrus"
+)
+
+// Response headers carrying the snapshot time and the SHA-256 hash of the body
+const (
+	HeaderTimestamp = "X-Snapshot-Timestamp"
+	HeaderSHA256    = "X-Snapshot-SHA256"
+)
+
+// contentTypes maps the formats to their content type
+var contentTypes = map[string]string{
+	FormatCSV:    "text/csv; charset=utf-8",
+	FormatNDJSON: "application/x-ndjson",
+}
+
+// HandlerConfig holds the settings of the snapshot endpoint
+type HandlerConfig struct {
+	// CacheTTL is how long a snapshot of a kind is served before its objects
+	// are fetched again. Zero fetches them on every request.
+	CacheTTL time.Duration
+
+	// Token is required as a bearer token on every request when set. Snapshots
+	// hold the full inventory of the account, e.g. user emails and roles.
+	Token string
+}
+
+// handler serves snapshots, caching them per kind
+type handler struct {
+	client *nbclient.Client
+	config HandlerConfig
+	now    func() time.Time
+
+	// mu serializes fetches, so concurrent requests share a snapshot
+	mu        sync.Mutex
+	snapshots map[string]*Snapshot
+}
+
+// Handler serves a snapshot of one kind as a download, e.g.
+// /api/v1/snapshot?kind=users&format=csv. The format defaults to CSV. Snapshots
+// are taken on request and reused for the cache TTL.
+func Handler(client *nbclient.Client, config HandlerConfig) http.Handler {
+	return &handler{client: client, config: config, now: time.Now, snapshots: make(map[string]*Snapshot)}
+}
+
+// ServeHTTP implements http.Handler
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.config.Token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.config.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="snapshot"`)
+			http.Error(w, "invalid or missing bearer token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	kind := r.URL.Query().Get("kind")
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatCSV
+	}
+	if kind == "" {
+		http.Error(w, fmt.Sprintf("kind query parameter is required, expected one of %v", Kinds), http.StatusBadRequest)
+		return
+	}
+	if err := ValidateKinds([]string{kind}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := ValidateFormat(format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snapshot, err := h.snapshot(r.Context(), kind)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to take snapshot")
+		http.Error(w, "failed to fetch objects from the NetBird API", http.StatusBadGateway)
+		return
+	}
+	file, err := snapshot.Encode(kind, format)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode snapshot")
+		http.Error(w, "failed to encode snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`,
+		kind, snapshot.TakenAt.Format("20060102T150405Z"), format))
+	w.Header().Set(HeaderTimestamp, snapshot.TakenAt.Format(time.RFC3339))
+	w.Header().Set(HeaderSHA256, file.SHA256)
+	if _, err := w.Write(file.Data); err != nil {
+		logrus.WithError(err).Error("Failed to write snapshot")
+	}
+}
+
+// snapshot returns the cached snapshot of a kind, or takes a new one when it
+// is older than the cache TTL
+func (h *handler) snapshot(ctx context.Context, kind string) (*Snapshot, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if cached, ok := h.snapshots[kind]; ok && h.now().Sub(cached.TakenAt) < h.config.CacheTTL {
+		return cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	snapshot, err := Take(ctx, h.client, []string{kind})
+	if err != nil {
+		return nil, err
+	}
+	h.snapshots[kind] = snapshot
+	return snapshot, nil
+}
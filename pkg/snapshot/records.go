@@ -0,0 +1,224 @@
+package snapshot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/exporters"
+	"github.com/netbirdio/netbird/management/server/http/api"
+)
+
+// The columns of every kind are part of the snapshot format; add new columns at
+// the end and never rename or remove existing ones.
+
+var peerColumns = []string{
+	"id", "name", "hostname", "ip", "dns_label", "os", "version", "connected",
+	"last_seen", "last_login", "login_expired", "ssh_enabled", "approval_required",
+	"ephemeral", "country_code", "city_name", "user_id", "groups",
+}
+
+var userColumns = []string{
+	"id", "email", "name", "role", "status", "is_service_user", "is_blocked",
+	"issued", "last_login", "auto_groups", "is_restricted", "permissions",
+	"permissions_source",
+}
+
+var groupColumns = []string{
+	"id", "name", "issued", "peers_count", "resources_count",
+}
+
+// Policies have one record per rule
+var policyColumns = []string{
+	"policy_id", "policy_name", "policy_enabled", "rule_id", "rule_name",
+	"rule_enabled", "action", "bidirectional", "protocol", "ports", "sources",
+	"destinations", "source_posture_checks",
+}
+
+// csvValue formats a value for CSV: lists joined with semicolons and nil as an
+// empty field
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case []string:
+		return strings.Join(v, ";")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// timestamp formats a time as RFC 3339 in UTC, or nil when it is not set
+func timestamp(t *time.Time) any {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// stringValue dereferences an optional string
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// groupNames returns the sorted names of group references
+func groupNames(groups []api.GroupMinimum) []string {
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func peerRows(peers []api.Peer) [][]any {
+	rows := make([][]any, 0, len(peers))
+	for _, peer := range peers {
+		rows = append(rows, []any{
+			peer.Id, peer.Name, peer.Hostname, peer.Ip, peer.DnsLabel, peer.Os,
+			peer.Version, peer.Connected, timestamp(&peer.LastSeen),
+			timestamp(&peer.LastLogin), peer.LoginExpired, peer.SshEnabled,
+			peer.ApprovalRequired, peer.Ephemeral, string(peer.CountryCode),
+			string(peer.CityName), peer.UserId, groupNames(peer.Groups),
+		})
+	}
+	return rows
+}
+
+// Sources of the permissions of a user
+const (
+	// permissionsSourceAPI are the permissions returned by the API, which
+	// NetBird only sets on the owner of the token
+	permissionsSourceAPI = "api"
+	// permissionsSourceRoleDefault are the permissions NetBird grants the
+	// built-in role of the user
+	permissionsSourceRoleDefault = "role_default"
+)
+
+// userPermissions returns the granted permissions as sorted module:permission
+// values, e.g. peers:read, and their source. Users of custom roles other than
+// the token owner have no known permissions and no source.
+func userPermissions(user api.User) ([]string, string) {
+	permissions := []string{}
+	var modules map[string]map[string]bool
+	source := ""
+	if user.Permissions != nil {
+		modules, source = user.Permissions.Modules, permissionsSourceAPI
+	} else if defaults, ok := exporters.RoleDefaultPermissions(user.Role); ok {
+		modules, source = defaults, permissionsSourceRoleDefault
+	}
+	for module, modulePermissions := range modules {
+		for permission, granted := range modulePermissions {
+			if granted {
+				permissions = append(permissions, module+":"+permission)
+			}
+		}
+	}
+	sort.Strings(permissions)
+	return permissions, source
+}
+
+// userRows resolves the auto groups of users to names, falling back to the ID
+// of groups that no longer exist
+func userRows(users []api.User, groups []api.Group) [][]any {
+	names := make(map[string]string, len(groups))
+	for _, group := range groups {
+		names[group.Id] = group.Name
+	}
+
+	rows := make([][]any, 0, len(users))
+	for _, user := range users {
+		autoGroups := make([]string, 0, len(user.AutoGroups))
+		for _, id := range user.AutoGroups {
+			if name, ok := names[id]; ok {
+				autoGroups = append(autoGroups, name)
+			} else {
+				autoGroups = append(autoGroups, id)
+			}
+		}
+		sort.Strings(autoGroups)
+
+		isServiceUser := user.IsServiceUser != nil && *user.IsServiceUser
+		isRestricted := user.Permissions != nil && user.Permissions.IsRestricted
+		permissions, permissionsSource := userPermissions(user)
+		rows = append(rows, []any{
+			user.Id, user.Email, user.Name, user.Role, string(user.Status),
+			isServiceUser, user.IsBlocked, stringValue(user.Issued),
+			timestamp(user.LastLogin), autoGroups, isRestricted, permissions,
+			permissionsSource,
+		})
+	}
+	return rows
+}
+
+func groupRows(groups []api.Group) [][]any {
+	rows := make([][]any, 0, len(groups))
+	for _, group := range groups {
+		issued := ""
+		if group.Issued != nil {
+			issued = string(*group.Issued)
+		}
+		rows = append(rows, []any{
+			group.Id, group.Name, issued, group.PeersCount, group.ResourcesCount,
+		})
+	}
+	return rows
+}
+
+// ruleTargets returns the group names of a rule side, or the resource when the
+// side targets a single resource
+func ruleTargets(groups *[]api.GroupMinimum, resource *api.Resource) []string {
+	if resource != nil {
+		return []string{string(resource.Type) + ":" + resource.Id}
+	}
+	if groups == nil {
+		return []string{}
+	}
+	return groupNames(*groups)
+}
+
+// rulePorts returns the ports and port ranges (start-end) of a rule
+func rulePorts(rule api.PolicyRule) []string {
+	ports := []string{}
+	if rule.Ports != nil {
+		ports = append(ports, *rule.Ports...)
+	}
+	if rule.PortRanges != nil {
+		for _, portRange := range *rule.PortRanges {
+			ports = append(ports, fmt.Sprintf("%d-%d", portRange.Start, portRange.End))
+		}
+	}
+	return ports
+}
+
+func policyRows(policies []api.Policy) [][]any {
+	rows := [][]any{}
+	for _, policy := range policies {
+		postureChecks := policy.SourcePostureChecks
+		if postureChecks == nil {
+			postureChecks = []string{}
+		}
+		for _, rule := range policy.Rules {
+			rows = append(rows, []any{
+				stringValue(policy.Id), policy.Name, policy.Enabled,
+				stringValue(rule.Id), rule.Name, rule.Enabled, string(rule.Action),
+				rule.Bidirectional, string(rule.Protocol), rulePorts(rule),
+				ruleTargets(rule.Sources, rule.SourceResource),
+				ruleTargets(rule.Destinations, rule.DestinationResource),
+				postureChecks,
+			})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,263 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/netbirdio/netbird/management/server/http/api"
+	"github.com/sirupsen/logrus"
+)
+
+// Object kinds of a snapshot
+const (
+	KindPeers    = "peers"
+	KindUsers    = "users"
+	KindGroups   = "groups"
+	KindPolicies = "policies"
+)
+
+// Kinds lists every object kind of a snapshot
+var Kinds = []string{KindPeers, KindUsers, KindGroups, KindPolicies}
+
+// Snapshot file formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ManifestName is the name of the manifest written next to the snapshot files
+const ManifestName = "manifest.json"
+
+// Snapshot holds the NetBird objects fetched at a point in time
+type Snapshot struct {
+	TakenAt  time.Time
+	Peers    []api.Peer
+	Users    []api.User
+	Groups   []api.Group
+	Policies []api.Policy
+}
+
+// File is one object kind of a snapshot encoded in a format
+type File struct {
+	Kind    string
+	Format  string
+	Records int
+	Data    []byte
+	SHA256  string
+}
+
+// Name returns the file name of the encoded kind, e.g. users.csv
+func (f *File) Name() string {
+	return f.Kind + "." + f.Format
+}
+
+// Manifest describes the files of a snapshot written to a directory
+type Manifest struct {
+	TakenAt time.Time      `json:"taken_at"`
+	Format  string         `json:"format"`
+	Files   []ManifestFile `json:"files"`
+}
+
+// ManifestFile describes a single snapshot file and its SHA-256 hash
+type ManifestFile struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Records int    `json:"records"`
+	SHA256  string `json:"sha256"`
+}
+
+// ValidateKinds returns an error for unknown kinds
+func ValidateKinds(kinds []string) error {
+	for _, kind := range kinds {
+		if !slices.Contains(Kinds, kind) {
+			return fmt.Errorf("unknown snapshot kind %q, expected one of %v", kind, Kinds)
+		}
+	}
+	return nil
+}
+
+// ValidateFormat returns an error for unknown formats
+func ValidateFormat(format string) error {
+	if format != FormatCSV && format != FormatNDJSON {
+		return fmt.Errorf("unknown snapshot format %q, expected %q or %q", format, FormatCSV, FormatNDJSON)
+	}
+	return nil
+}
+
+// Take fetches the objects of the given kinds from the NetBird API. Groups are
+// also fetched for users, to resolve the names of their auto groups.
+func Take(ctx context.Context, client *nbclient.Client, kinds []string) (*Snapshot, error) {
+	if err := ValidateKinds(kinds); err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{TakenAt: time.Now().UTC()}
+	var err error
+
+	if slices.Contains(kinds, KindPeers) {
+		if snapshot.Peers, err = client.Peers.List(ctx); err != nil {
+			return nil, fmt.Errorf("fetch peers: %w", err)
+		}
+	}
+	if slices.Contains(kinds, KindUsers) {
+		if snapshot.Users, err = client.Users.List(ctx); err != nil {
+			return nil, fmt.Errorf("fetch users: %w", err)
+		}
+	}
+	if slices.Contains(kinds, KindGroups) || slices.Contains(kinds, KindUsers) {
+		if snapshot.Groups, err = client.Groups.List(ctx); err != nil {
+			return nil, fmt.Errorf("fetch groups: %w", err)
+		}
+	}
+	if slices.Contains(kinds, KindPolicies) {
+		if snapshot.Policies, err = client.Policies.List(ctx); err != nil {
+			return nil, fmt.Errorf("fetch policies: %w", err)
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"kinds":    kinds,
+		"peers":    len(snapshot.Peers),
+		"users":    len(snapshot.Users),
+		"groups":   len(snapshot.Groups),
+		"policies": len(snapshot.Policies),
+	}).Debug("Took snapshot")
+
+	return snapshot, nil
+}
+
+// table returns the columns and rows of a kind
+func (s *Snapshot) table(kind string) ([]string, [][]any, error) {
+	switch kind {
+	case KindPeers:
+		return peerColumns, peerRows(s.Peers), nil
+	case KindUsers:
+		return userColumns, userRows(s.Users, s.Groups), nil
+	case KindGroups:
+		return groupColumns, groupRows(s.Groups), nil
+	case KindPolicies:
+		return policyColumns, policyRows(s.Policies), nil
+	default:
+		return nil, nil, ValidateKinds([]string{kind})
+	}
+}
+
+// Encode encodes the objects of a kind in the given format
+func (s *Snapshot) Encode(kind, format string) (*File, error) {
+	if err := ValidateFormat(format); err != nil {
+		return nil, err
+	}
+	columns, rows, err := s.table(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case FormatCSV:
+		err = writeCSV(&buf, columns, rows)
+	case FormatNDJSON:
+		err = writeNDJSON(&buf, columns, rows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", kind, err)
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return &File{
+		Kind:    kind,
+		Format:  format,
+		Records: len(rows),
+		Data:    buf.Bytes(),
+		SHA256:  hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// WriteDir writes one file per kind and a manifest with the snapshot time and
+// the hash of every file to dir, which is created when missing
+func (s *Snapshot) WriteDir(dir string, kinds []string, format string) (*Manifest, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create snapshot directory: %w", err)
+	}
+
+	manifest := &Manifest{TakenAt: s.TakenAt, Format: format}
+	for _, kind := range kinds {
+		file, err := s.Encode(kind, format)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(dir, file.Name()), file.Data, 0o644); err != nil {
+			return nil, fmt.Errorf("write %s: %w", file.Name(), err)
+		}
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Kind:    file.Kind,
+			Name:    file.Name(),
+			Records: file.Records,
+			SHA256:  file.SHA256,
+		})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encode manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestName), append(data, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("write manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeCSV writes a header line and one line per row. Lists are joined with
+// semicolons and times use RFC 3339.
+func writeCSV(buf *bytes.Buffer, columns []string, rows [][]any) error {
+	writer := csv.NewWriter(buf)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, value := range row {
+			record[i] = csvValue(value)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeNDJSON writes one JSON object per row with the keys in column order
+func writeNDJSON(buf *bytes.Buffer, columns []string, rows [][]any) error {
+	for _, row := range rows {
+		buf.WriteByte('{')
+		for i, value := range row {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(columns[i])
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(data)
+		}
+		buf.WriteString("}\n")
+	}
+	return nil
+}
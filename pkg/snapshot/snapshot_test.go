@@ -0,0 +1,333 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	nbclient "github.com/netbirdio/netbird/management/client/rest"
+	"github.com/netbirdio/netbird/management/server/http/api"
+
+	"github.com/matanbaruch/netbird-api-exporter/pkg/fakeapi"
+)
+
+// newTestAPI serves a small account on the NetBird API endpoints
+func newTestAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	lastLogin := time.Date(2026, 9, 30, 8, 0, 0, 0, time.UTC)
+	serviceUser := true
+	policyID := "policy1"
+	ruleID := "rule1"
+	ports := []string{"22"}
+	responses := map[string]any{
+		"/api/peers": []api.Peer{{
+			Id: "peer1", Name: "server", Os: "Linux", Connected: true,
+			LastSeen: lastLogin, CountryCode: "DE",
+			Groups: []api.GroupMinimum{{Id: "group2", Name: "servers"}, {Id: "group1", Name: "All"}},
+		}},
+		"/api/users": []api.User{
+			{
+				Id: "user1", Email: "admin@example.com", Name: "Admin", Role: "admin",
+				Status: "active", LastLogin: &lastLogin, AutoGroups: []string{"group2", "deleted"},
+				Permissions: &api.UserPermissions{Modules: map[string]map[string]bool{
+					"peers": {"read": true, "delete": false},
+					"users": {"read": true},
+				}},
+			},
+			{Id: "user2", Name: "ci", Role: "user", Status: "active", IsServiceUser: &serviceUser},
+		},
+		"/api/groups": []api.Group{
+			{Id: "group1", Name: "All", PeersCount: 1},
+			{Id: "group2", Name: "servers", PeersCount: 1},
+		},
+		"/api/policies": []api.Policy{{
+			Id: &policyID, Name: "ssh", Enabled: true,
+			Rules: []api.PolicyRule{{
+				Id: &ruleID, Name: "admins to servers", Enabled: true, Action: "accept",
+				Protocol: "tcp", Ports: &ports,
+				Sources:      &[]api.GroupMinimum{{Id: "group1", Name: "All"}},
+				Destinations: &[]api.GroupMinimum{{Id: "group2", Name: "servers"}},
+			}},
+		}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Errorf("Failed to encode response: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func takeTestSnapshot(t *testing.T, kinds []string) *Snapshot {
+	t.Helper()
+	server := newTestAPI(t)
+	snapshot, err := Take(context.Background(), nbclient.New(server.URL, "test-token"), kinds)
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	return snapshot
+}
+
+func TestSnapshot_EncodeCSV(t *testing.T) {
+	snapshot := takeTestSnapshot(t, Kinds)
+
+	file, err := snapshot.Encode(KindUsers, FormatCSV)
+	if err != nil {
+		t.Fatalf("Failed to encode users: %v", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(file.Data)).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(records) != 3 || file.Records != 2 {
+		t.Fatalf("Expected a header and 2 users, got %v", records)
+	}
+	if strings.Join(records[0], ",") != strings.Join(userColumns, ",") {
+		t.Errorf("Expected header %v, got %v", userColumns, records[0])
+	}
+
+	admin := make(map[string]string)
+	for i, column := range records[0] {
+		admin[column] = records[1][i]
+	}
+	expected := map[string]string{
+		"role":               "admin",
+		"last_login":         "2026-09-30T08:00:00Z",
+		"auto_groups":        "deleted;servers",
+		"permissions":        "peers:read;users:read",
+		"permissions_source": "api",
+		"is_service_user":    "false",
+	}
+	for column, value := range expected {
+		if admin[column] != value {
+			t.Errorf("Expected %s=%q, got %q", column, value, admin[column])
+		}
+	}
+
+	// Other users get the defaults of their role, as the API only returns
+	// the permissions of the token owner
+	ci := make(map[string]string)
+	for i, column := range records[0] {
+		ci[column] = records[2][i]
+	}
+	if ci["permissions"] != "" || ci["permissions_source"] != "role_default" {
+		t.Errorf("Expected no permissions from the user role defaults, got %q from %q", ci["permissions"], ci["permissions_source"])
+	}
+
+	sum := sha256.Sum256(file.Data)
+	if file.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected the SHA-256 of the file content, got %s", file.SHA256)
+	}
+}
+
+func TestSnapshot_EncodeNDJSON(t *testing.T) {
+	snapshot := takeTestSnapshot(t, []string{KindPeers, KindPolicies})
+
+	if snapshot.Users != nil || snapshot.Groups != nil {
+		t.Error("Expected only the requested kinds to be fetched")
+	}
+
+	file, err := snapshot.Encode(KindPolicies, FormatNDJSON)
+	if err != nil {
+		t.Fatalf("Failed to encode policies: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(file.Data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected one line per rule, got %q", file.Data)
+	}
+	if !strings.HasPrefix(lines[0], `{"policy_id":"policy1","policy_name":"ssh",`) {
+		t.Errorf("Expected fields in column order, got %s", lines[0])
+	}
+	var rule map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rule); err != nil {
+		t.Fatalf("Failed to decode rule: %v", err)
+	}
+	if sources, ok := rule["sources"].([]any); !ok || len(sources) != 1 || sources[0] != "All" {
+		t.Errorf("Expected sources as a list of group names, got %v", rule["sources"])
+	}
+
+	file, err = snapshot.Encode(KindPeers, FormatNDJSON)
+	if err != nil {
+		t.Fatalf("Failed to encode peers: %v", err)
+	}
+	var peer map[string]any
+	if err := json.Unmarshal(file.Data, &peer); err != nil {
+		t.Fatalf("Failed to decode peer: %v", err)
+	}
+	if peer["last_login"] != nil {
+		t.Errorf("Expected null for a missing time, got %v", peer["last_login"])
+	}
+	if groups, ok := peer["groups"].([]any); !ok || len(groups) != 2 || groups[0] != "All" {
+		t.Errorf("Expected sorted group names, got %v", peer["groups"])
+	}
+
+	if _, err := snapshot.Encode(KindPeers, "xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestSnapshot_WriteDir(t *testing.T) {
+	snapshot := takeTestSnapshot(t, Kinds)
+	dir := filepath.Join(t.TempDir(), "snapshot")
+
+	manifest, err := snapshot.WriteDir(dir, Kinds, FormatCSV)
+	if err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+	if len(manifest.Files) != len(Kinds) {
+		t.Fatalf("Expected one file per kind, got %+v", manifest.Files)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	var written Manifest
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("Failed to decode manifest: %v", err)
+	}
+	if !written.TakenAt.Equal(snapshot.TakenAt) {
+		t.Errorf("Expected taken_at %v, got %v", snapshot.TakenAt, written.TakenAt)
+	}
+
+	for _, file := range written.Files {
+		content, err := os.ReadFile(filepath.Join(dir, file.Name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file.Name, err)
+		}
+		sum := sha256.Sum256(content)
+		if file.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("Expected manifest hash of %s to match its content", file.Name)
+		}
+	}
+}
+
+func TestTake_UnknownKind(t *testing.T) {
+	if _, err := Take(context.Background(), nbclient.New("http://localhost", "test-token"), []string{"routes"}); err == nil {
+		t.Error("Expected an error for an unknown kind")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	server := newTestAPI(t)
+	handler := Handler(nbclient.New(server.URL, "test-token"), HandlerConfig{})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/snapshot?kind=groups", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+		t.Errorf("Expected CSV by default, got %s", contentType)
+	}
+	sum := sha256.Sum256(rec.Body.Bytes())
+	if rec.Header().Get(HeaderSHA256) != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected %s header with the body hash", HeaderSHA256)
+	}
+	if _, err := time.Parse(time.RFC3339, rec.Header().Get(HeaderTimestamp)); err != nil {
+		t.Errorf("Expected %s header with an RFC 3339 time: %v", HeaderTimestamp, err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/snapshot?kind=users&format=ndjson", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	lines := 0
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("Expected 2 NDJSON lines, got %d", lines)
+	}
+
+	for _, target := range []string{"/api/v1/snapshot", "/api/v1/snapshot?kind=routes", "/api/v1/snapshot?kind=users&format=xml"} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestHandler_Cache(t *testing.T) {
+	f := fakeapi.NewFixture("example.com")
+	f.User("admin@example.com").Role("admin")
+	api := fakeapi.NewServer(f, fakeapi.Config{Token: "test-token"})
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	now := time.Now()
+	h := Handler(nbclient.New(server.URL, "test-token"), HandlerConfig{CacheTTL: time.Minute}).(*handler)
+	h.now = func() time.Time { return now }
+
+	get := func() string {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/snapshot?kind=users&format=ndjson", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		return rec.Header().Get(HeaderSHA256)
+	}
+
+	first := get()
+	api.Update(func(f *fakeapi.Fixture) { f.User("new@example.com") })
+	if get() != first || api.Requests("/api/users") != 1 {
+		t.Errorf("Expected the cached snapshot within the TTL, got %d requests", api.Requests("/api/users"))
+	}
+
+	// Another format of the same kind is encoded from the cached snapshot
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/snapshot?kind=users&format=csv", nil))
+	if rec.Code != http.StatusOK || api.Requests("/api/users") != 1 {
+		t.Errorf("Expected the cached snapshot in CSV, got status %d and %d requests", rec.Code, api.Requests("/api/users"))
+	}
+
+	now = now.Add(2 * time.Minute)
+	if get() == first || api.Requests("/api/users") != 2 {
+		t.Errorf("Expected a new snapshot after the TTL, got %d requests", api.Requests("/api/users"))
+	}
+}
+
+func TestHandler_Token(t *testing.T) {
+	server := newTestAPI(t)
+	handler := Handler(nbclient.New(server.URL, "test-token"), HandlerConfig{Token: "secret"})
+
+	for header, expected := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Token secret":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/snapshot?kind=groups", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != expected {
+			t.Errorf("Expected status %d with Authorization %q, got %d", expected, header, rec.Code)
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package utils
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
 
 // GetEnvWithDefault returns environment variable value or default
 func GetEnvWithDefault(key, defaultValue string) string {
@@ -9,3 +16,117 @@ func GetEnvWithDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// GetEnvBoolWithDefault returns environment variable value parsed as a boolean or default
+func GetEnvBoolWithDefault(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"key":   key,
+			"value": value,
+		}).Warn("Invalid boolean environment variable, using default")
+		return defaultValue
+	}
+	return parsed
+}
+
+// GetEnvIntWithDefault returns environment variable value parsed as an integer or default
+func GetEnvIntWithDefault(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"key":   key,
+			"value": value,
+		}).Warn("Invalid integer environment variable, using default")
+		return defaultValue
+	}
+	return parsed
+}
+
+// GetEnvFloatWithDefault returns environment variable value parsed as a float or default
+func GetEnvFloatWithDefault(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"key":   key,
+			"value": value,
+		}).Warn("Invalid float environment variable, using default")
+		return defaultValue
+	}
+	return parsed
+}
+
+// GetEnvDurationWithDefault returns environment variable value parsed as a duration (e.g. "30s") or default
+func GetEnvDurationWithDefault(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"key":   key,
+			"value": value,
+		}).Warn("Invalid duration environment variable, using default")
+		return defaultValue
+	}
+	return parsed
+}
+
+// GetEnvListWithDefault returns environment variable value split on commas or default.
+// Surrounding whitespace and empty items are dropped.
+func GetEnvListWithDefault(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// GetEnvMapWithDefault returns environment variable value parsed as comma-separated
+// key=value pairs (e.g. "env=prod,team=net") or default. Pairs without a key are
+// skipped with a warning.
+func GetEnvMapWithDefault(key string, defaultValue map[string]string) map[string]string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	pairs := make(map[string]string)
+	for _, item := range GetEnvListWithDefault(key, nil) {
+		name, val, _ := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			logrus.WithFields(logrus.Fields{
+				"key":  key,
+				"pair": item,
+			}).Warn("Invalid key=value pair in environment variable, skipping")
+			continue
+		}
+		pairs[name] = strings.TrimSpace(val)
+	}
+	return pairs
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestGetEnvWithDefault(t *testing.T) {
@@ -208,3 +209,126 @@ func TestGetEnvWithDefault_EdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestGetEnvBoolWithDefault(t *testing.T) {
+	tests := []struct {
+		name         string
+		envValue     string
+		defaultValue bool
+		expected     bool
+	}{
+		{name: "returns default when unset", envValue: "", defaultValue: true, expected: true},
+		{name: "parses true", envValue: "true", defaultValue: false, expected: true},
+		{name: "parses numeric false", envValue: "0", defaultValue: true, expected: false},
+		{name: "returns default when invalid", envValue: "not-a-bool", defaultValue: true, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_BOOL_VAR", tt.envValue)
+
+			result := GetEnvBoolWithDefault("TEST_BOOL_VAR", tt.defaultValue)
+			if result != tt.expected {
+				t.Errorf("GetEnvBoolWithDefault(%q) = %v, want %v", tt.envValue, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetEnvIntWithDefault(t *testing.T) {
+	tests := []struct {
+		name         string
+		envValue     string
+		defaultValue int
+		expected     int
+	}{
+		{name: "returns default when unset", envValue: "", defaultValue: 30, expected: 30},
+		{name: "parses integer", envValue: "7", defaultValue: 30, expected: 7},
+		{name: "returns default when invalid", envValue: "seven", defaultValue: 30, expected: 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_INT_VAR", tt.envValue)
+
+			result := GetEnvIntWithDefault("TEST_INT_VAR", tt.defaultValue)
+			if result != tt.expected {
+				t.Errorf("GetEnvIntWithDefault(%q) = %d, want %d", tt.envValue, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetEnvFloatWithDefault(t *testing.T) {
+	tests := []struct {
+		name         string
+		envValue     string
+		defaultValue float64
+		expected     float64
+	}{
+		{name: "returns default when unset", envValue: "", defaultValue: 0.5, expected: 0.5},
+		{name: "parses float", envValue: "0.25", defaultValue: 0.5, expected: 0.25},
+		{name: "returns default when invalid", envValue: "half", defaultValue: 0.5, expected: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_FLOAT_VAR", tt.envValue)
+
+			result := GetEnvFloatWithDefault("TEST_FLOAT_VAR", tt.defaultValue)
+			if result != tt.expected {
+				t.Errorf("GetEnvFloatWithDefault(%q) = %v, want %v", tt.envValue, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetEnvDurationWithDefault(t *testing.T) {
+	tests := []struct {
+		name         string
+		envValue     string
+		defaultValue time.Duration
+		expected     time.Duration
+	}{
+		{name: "returns default when unset", envValue: "", defaultValue: time.Minute, expected: time.Minute},
+		{name: "parses duration", envValue: "1500ms", defaultValue: time.Minute, expected: 1500 * time.Millisecond},
+		{name: "returns default when invalid", envValue: "30", defaultValue: time.Minute, expected: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_DURATION_VAR", tt.envValue)
+
+			result := GetEnvDurationWithDefault("TEST_DURATION_VAR", tt.defaultValue)
+			if result != tt.expected {
+				t.Errorf("GetEnvDurationWithDefault(%q) = %v, want %v", tt.envValue, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetEnvListWithDefault(t *testing.T) {
+	t.Setenv("TEST_LIST_VAR", "")
+	if result := GetEnvListWithDefault("TEST_LIST_VAR", []string{"default"}); len(result) != 1 || result[0] != "default" {
+		t.Errorf("Expected default list, got %v", result)
+	}
+
+	t.Setenv("TEST_LIST_VAR", " servers, ,prod-admins ,")
+	result := GetEnvListWithDefault("TEST_LIST_VAR", nil)
+	if len(result) != 2 || result[0] != "servers" || result[1] != "prod-admins" {
+		t.Errorf("Expected [servers prod-admins], got %v", result)
+	}
+}
+
+func TestGetEnvMapWithDefault(t *testing.T) {
+	t.Setenv("TEST_MAP_VAR", "")
+	if result := GetEnvMapWithDefault("TEST_MAP_VAR", map[string]string{"env": "default"}); result["env"] != "default" {
+		t.Errorf("Expected default map, got %v", result)
+	}
+
+	t.Setenv("TEST_MAP_VAR", "env=prod, team = net ,=orphan,flag")
+	result := GetEnvMapWithDefault("TEST_MAP_VAR", nil)
+	if len(result) != 3 || result["env"] != "prod" || result["team"] != "net" || result["flag"] != "" {
+		t.Errorf("Expected map[env:prod flag: team:net], got %v", result)
+	}
+}